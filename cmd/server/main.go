@@ -23,6 +23,7 @@ import (
 	"github.com/Mag1cFall/magtrade/internal/mq"
 	"github.com/Mag1cFall/magtrade/internal/pkg/utils"
 	"github.com/Mag1cFall/magtrade/internal/router"
+	"github.com/Mag1cFall/magtrade/internal/service"
 	"github.com/Mag1cFall/magtrade/internal/worker"
 	"go.uber.org/zap"
 )
@@ -71,10 +72,13 @@ func main() {
 	}
 	defer cache.Close()
 
+	// 服務層快取依賴（Redis 實作），所有 Handler 與 Worker 共用
+	cacheDeps := service.NewRedisCacheDeps(log)
+
 	// 啟動 gRPC 庫存服務
 	if cfg.Server.GRPCPort > 0 {
 		grpcAddr := fmt.Sprintf("%s:%d", cfg.Server.Host, cfg.Server.GRPCPort)
-		grpcServer, err := magrpc.StartGRPCServer(grpcAddr, log)
+		grpcServer, err := magrpc.StartGRPCServer(grpcAddr, cacheDeps.Stock, log)
 		if err != nil {
 			log.Fatal("failed to start gRPC server", zap.Error(err))
 		}
@@ -98,7 +102,7 @@ func main() {
 	go wsHub.Run() // 獨立 goroutine 執行訊息分發
 
 	// 訂單 Worker：消費 Kafka 訊息，建立實際訂單並推送 WS 通知
-	orderWorker := worker.NewOrderWorker(producer, wsHub, log)
+	orderWorker := worker.NewOrderWorker(cacheDeps, producer, wsHub, log)
 	consumer.RegisterHandler(cfg.Kafka.Topics.FlashSaleOrders, orderWorker.HandleFlashSaleOrder)
 	consumer.RegisterHandler(cfg.Kafka.Topics.OrderStatusChange, orderWorker.HandleOrderStatusChange)
 
@@ -107,20 +111,37 @@ func main() {
 
 	consumer.Start(ctx) // 啟動 Kafka 消費者
 
-	// 定時任務 Worker：自動開啟/結束秒殺活動
-	schedulerWorker := worker.NewSchedulerWorker(producer, log)
+	// 訂閱活動售罄/關閉旗標與中繼資料失效廣播，同步本實例的本地快取
+	go cache.SaleFlags().Listen(ctx, log)
+	go cache.FlashSaleMetas().Listen(ctx, log)
+
+	// 庫存變更事件：聚合發布本實例的庫存變更，並推送給 WebSocket/SSE 訂閱者
+	go cache.StockEvents().Run(ctx, log)
+
+	// Outbox Relay：將 Redis Outbox 中的秒殺訂單訊息投遞至 Kafka
+	outboxRelay := worker.NewOutboxRelay(producer, log)
+	outboxRelay.Start(ctx)
+	defer outboxRelay.Stop()
+
+	// 排隊 Worker：依速率放行排隊模式活動的搶購請求
+	queueWorker := worker.NewQueueWorker(cacheDeps, producer, wsHub, &cfg.Rush, log)
+	queueWorker.Start(ctx)
+	defer queueWorker.Stop()
+
+	// 定時任務 Worker：自動開啟/結束秒殺活動、抽籤、依範本產生活動
+	schedulerWorker := worker.NewSchedulerWorker(cacheDeps, producer, wsHub, &cfg.Email, &cfg.Scheduler, log)
 	schedulerWorker.Start(ctx)
 	defer schedulerWorker.Stop()
 
 	// 設定 Gin 路由
-	r := router.Setup(cfg, producer, wsHub, log)
+	r := router.Setup(cfg, cacheDeps, producer, wsHub, log)
 
 	// 配置 HTTP 伺服器
 	srv := &http.Server{
 		Addr:         fmt.Sprintf("%s:%d", cfg.Server.Host, cfg.Server.Port),
 		Handler:      r,
 		ReadTimeout:  10 * time.Second, // 讀取請求超時
-		WriteTimeout: 30 * time.Second, // 寫入回應超時（含秒殺處理時間）
+		WriteTimeout: 30 * time.Second, // 寫入回應超時（含秒殺處理時間，SSE 串流由處理器自行解除）
 		IdleTimeout:  60 * time.Second, // Keep-Alive 連線閒置超時
 	}
 
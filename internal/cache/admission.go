@@ -0,0 +1,88 @@
+// 搶購准入
+//
+// 本檔案封裝 AdmitScript：一次 Redis 往返完成搶購的全部准入檢查與扣減
+// 取代舊流程的 DB 重複訂單查詢 → 使用者鎖加鎖 → 扣減腳本 → 解鎖（至少四次網路往返）
+// 中繼資料 Hash 未載入時返回 AdmitMetaMissing，由呼叫端載入後重試
+package cache
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// AdmitCode 准入結果碼
+type AdmitCode int
+
+const (
+	AdmitOK               AdmitCode = 1  // 准入成功，訂單訊息已寫入 Outbox
+	AdmitSoldOut          AdmitCode = -1 // 庫存不足（活動或規格）
+	AdmitLimitExceeded    AdmitCode = -2 // 超出限購數量
+	AdmitAlreadyPurchased AdmitCode = -3 // 已參與過本活動
+	AdmitNotStarted       AdmitCode = -4 // 活動尚未開始
+	AdmitEnded            AdmitCode = -5 // 活動已結束
+	AdmitNotActive        AdmitCode = -6 // 活動狀態不允許搶購（暫停、取消等）
+	AdmitMetaMissing      AdmitCode = -7 // 中繼資料 Hash 未載入
+)
+
+// AdmitRequest 准入參數
+type AdmitRequest struct {
+	FlashSaleID int64
+	UserID      int64
+	ItemID      int64 // 規格 ID，0 表示單規格活動
+	Quantity    int
+	Payload     string        // Outbox 訂單訊息
+	Retention   time.Duration // 已購數量 Key 在活動結束後的保留時間
+	StockTaken  bool          // 庫存已由 DeductShard 扣減，腳本只做驗證、查重與寫入 Outbox
+}
+
+// AdmitResult 准入結果
+type AdmitResult struct {
+	Code      AdmitCode
+	Message   string
+	Remaining int // 活動總庫存：成功時為扣減後的值，失敗時為當前值（StockTaken 或庫存 Key 不存在時為 0）
+}
+
+// Admit 執行准入腳本
+func (s *StockService) Admit(ctx context.Context, req *AdmitRequest) (*AdmitResult, error) {
+	keys := []string{
+		FlashSaleMetaKey(req.FlashSaleID),
+		StockKey(req.FlashSaleID),
+		BoughtKey(req.FlashSaleID, req.UserID),
+		OutboxKey(req.FlashSaleID),
+		ItemStockKey(req.FlashSaleID, req.ItemID),
+	}
+
+	res, err := s.rdb.Eval(ctx, AdmitScript, keys,
+		req.Quantity, req.Payload, flag(req.ItemID > 0), int(req.Retention.Seconds()), flag(req.StockTaken), OutboxGroup,
+	).Slice()
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute admit script: %w", err)
+	}
+	if len(res) != 4 {
+		return nil, fmt.Errorf("unexpected script result format")
+	}
+
+	code, _ := res[0].(int64)
+	msg, _ := res[1].(string)
+	remaining, loaded := res[2].(int64) // 庫存 Key 不存在時為 nil
+	if created, _ := res[3].(int64); created == 1 {
+		s.registerOutbox(ctx, req.FlashSaleID)
+	}
+
+	result := &AdmitResult{
+		Code:      AdmitCode(code),
+		Message:   msg,
+		Remaining: int(remaining),
+	}
+
+	// 中繼資料未載入、庫存 Key 不存在或庫存已由分片扣減時庫存值無意義，不更新售罄旗標
+	if !req.StockTaken && loaded && result.Code != AdmitMetaMissing && remaining <= 0 {
+		s.syncSoldOut(ctx, req.FlashSaleID, int(remaining))
+	}
+	// 庫存已由分片扣減時 DeductShard 已標記
+	if !req.StockTaken && result.Code == AdmitOK {
+		s.events.Notify(req.FlashSaleID)
+	}
+	return result, nil
+}
@@ -0,0 +1,136 @@
+// 搶購准入基準測試
+//
+// 比較舊流程（使用者鎖加鎖 → 扣減腳本 → 解鎖）與單一准入腳本的 Redis 往返成本
+// 舊流程另有一次 DB 重複訂單查詢，此處未計入，實際差距大於測得結果
+// 需要可用的 Redis：REDIS_BENCH_ADDR=127.0.0.1:6379 go test -bench Rush ./internal/cache/
+package cache
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const benchFlashSaleID int64 = 900000001
+
+// setupBenchRedis 連線基準測試用 Redis 並寫入活動資料，未設定位址或無法連線時略過
+func setupBenchRedis(b *testing.B) context.Context {
+	b.Helper()
+
+	addr := os.Getenv("REDIS_BENCH_ADDR")
+	if addr == "" {
+		b.Skip("REDIS_BENCH_ADDR not set")
+	}
+
+	ctx := context.Background()
+	rdb = redis.NewClient(&redis.Options{Addr: addr, Password: os.Getenv("REDIS_BENCH_PASSWORD")})
+	if err := rdb.Ping(ctx).Err(); err != nil {
+		b.Skipf("redis unavailable: %v", err)
+	}
+
+	cleanupBenchKeys(b, ctx)
+	b.Cleanup(func() {
+		cleanupBenchKeys(b, ctx)
+		_ = rdb.Close()
+		rdb = nil
+	})
+
+	now := time.Now()
+	metaKey := FlashSaleMetaKey(benchFlashSaleID)
+	if err := rdb.HSet(ctx, metaKey, map[string]interface{}{
+		"status":         1,
+		"start_ms":       now.Add(-time.Minute).UnixMilli(),
+		"end_ms":         now.Add(time.Hour).UnixMilli(),
+		"per_user_limit": 1,
+	}).Err(); err != nil {
+		b.Fatal(err)
+	}
+	if err := rdb.Set(ctx, StockKey(benchFlashSaleID), 1<<40, time.Hour).Err(); err != nil {
+		b.Fatal(err)
+	}
+	return ctx
+}
+
+// cleanupBenchKeys 清除基準測試產生的 Key
+func cleanupBenchKeys(b *testing.B, ctx context.Context) {
+	b.Helper()
+
+	patterns := []string{
+		fmt.Sprintf("flash:bought:{%d}:*", benchFlashSaleID),
+		fmt.Sprintf("flash:lock:{%d}:*", benchFlashSaleID),
+	}
+	for _, pattern := range patterns {
+		iter := rdb.Scan(ctx, 0, pattern, 1000).Iterator()
+		for iter.Next(ctx) {
+			rdb.Del(ctx, iter.Val())
+		}
+	}
+	rdb.Del(ctx, FlashSaleMetaKey(benchFlashSaleID), StockKey(benchFlashSaleID), OutboxKey(benchFlashSaleID))
+}
+
+// BenchmarkRushLegacy 舊流程：使用者鎖 + 扣減腳本 + 解鎖（三次往返，不含 DB 查重）
+func BenchmarkRushLegacy(b *testing.B) {
+	ctx := setupBenchRedis(b)
+	stock := NewStockService()
+	var userSeq int64
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			userID := atomic.AddInt64(&userSeq, 1)
+
+			lock := NewRenewableLock(LockKey(benchFlashSaleID, userID), LockOptions{})
+			acquired, err := lock.Lock(ctx)
+			if err != nil || !acquired {
+				b.Errorf("lock failed: acquired=%v err=%v", acquired, err)
+				return
+			}
+			result, err := stock.Deduct(ctx, &DeductRequest{
+				FlashSaleID: benchFlashSaleID,
+				UserID:      userID,
+				Quantity:    1,
+				Limit:       1,
+				Payload:     "{}",
+			})
+			if err != nil || !result.Success {
+				b.Errorf("deduct failed: result=%+v err=%v", result, err)
+				return
+			}
+			if err := lock.Unlock(ctx); err != nil {
+				b.Error(err)
+				return
+			}
+		}
+	})
+}
+
+// BenchmarkRushAdmitScript 新流程：單一准入腳本（一次往返）
+func BenchmarkRushAdmitScript(b *testing.B) {
+	ctx := setupBenchRedis(b)
+	stock := NewStockService()
+	var userSeq int64
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			userID := atomic.AddInt64(&userSeq, 1)
+
+			result, err := stock.Admit(ctx, &AdmitRequest{
+				FlashSaleID: benchFlashSaleID,
+				UserID:      userID,
+				Quantity:    1,
+				Payload:     "{}",
+				Retention:   time.Hour,
+			})
+			if err != nil || result.Code != AdmitOK {
+				b.Errorf("admit failed: result=%+v err=%v", result, err)
+				return
+			}
+		}
+	})
+}
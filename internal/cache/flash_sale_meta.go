@@ -0,0 +1,442 @@
+// 秒殺活動中繼資料快取
+//
+// 本檔案為搶購熱路徑提供活動資料的讀穿透快取：本地 LRU → Redis Hash → DB
+// 快取內容：狀態、類型、起訖時間、價格、限購、預約/排隊設定、規格與商品資訊
+// 庫存相關欄位（AvailableStock）不保證即時，即時庫存一律以 Redis 庫存 Key 為準
+// 排程變更狀態或管理員編輯時呼叫 Invalidate：遞增版本號、刪除 Redis Hash 並透過 Pub/Sub 通知各實例清除本地快取
+// 讀穿透在載入 DB 前記下版本號，寫回 Redis 時版本已變更則放棄（FlashSaleMetaSetScript），
+// 本地快取同樣以失效世代比對，載入期間發生的失效不會被舊資料覆蓋
+// 本地與 Redis 快取皆有 TTL，作為遺漏失效訊息時的上限
+// Redis Hash 同時供 AdmitScript 讀取狀態、起訖時間（毫秒）與限購
+package cache
+
+import (
+	"container/list"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Mag1cFall/magtrade/internal/model"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+)
+
+// FlashSaleMetaChannel 中繼資料失效廣播頻道，訊息內容為活動 ID
+const FlashSaleMetaChannel = "flash:meta:invalidate"
+
+const (
+	flashSaleMetaCapacity = 1024             // 本地 LRU 容量
+	flashSaleMetaLocalTTL = 10 * time.Second // 本地快取存活時間
+	flashSaleMetaRedisTTL = time.Minute      // Redis Hash 存活時間
+	flashSaleMetaVerTTL   = 24 * time.Hour   // 版本號存活時間，遠大於一次讀穿透的耗時
+)
+
+// ErrFlashSaleMetaChanged 重新載入期間活動再次失效
+var ErrFlashSaleMetaChanged = errors.New("flash sale meta changed during refresh")
+
+// FlashSaleMetaKey 生成中繼資料 Key，格式: flash:meta:{活動ID}
+func FlashSaleMetaKey(flashSaleID int64) string {
+	return fmt.Sprintf("flash:meta:{%d}", flashSaleID)
+}
+
+// FlashSaleMetaVersionKey 生成中繼資料版本號 Key，格式: flash:meta:ver:{活動ID}（與 Hash 同 slot）
+func FlashSaleMetaVersionKey(flashSaleID int64) string {
+	return fmt.Sprintf("flash:meta:ver:{%d}", flashSaleID)
+}
+
+// FlashSaleLoader 快取未命中時從 DB 載入活動
+type FlashSaleLoader func(ctx context.Context) (*model.FlashSale, error)
+
+type metaEntry struct {
+	id        int64
+	flashSale *model.FlashSale
+	expiresAt time.Time
+}
+
+// FlashSaleMetaCache 活動中繼資料快取（本地 LRU 每個實例一份）
+type FlashSaleMetaCache struct {
+	mu         sync.Mutex
+	entries    map[int64]*list.Element
+	order      *list.List // 最近使用在前
+	capacity   int
+	generation uint64 // 每次清除本地快取遞增，載入期間有變更時不寫入本地
+}
+
+var flashSaleMetas = newFlashSaleMetaCache(flashSaleMetaCapacity)
+
+func newFlashSaleMetaCache(capacity int) *FlashSaleMetaCache {
+	return &FlashSaleMetaCache{
+		entries:  make(map[int64]*list.Element),
+		order:    list.New(),
+		capacity: capacity,
+	}
+}
+
+// FlashSaleMetas 取得本實例的中繼資料快取
+func FlashSaleMetas() *FlashSaleMetaCache {
+	return flashSaleMetas
+}
+
+// Get 讀穿透查詢活動：本地 → Redis → loader
+// Redis 失敗時直接回退 loader，不影響可用性；返回值為副本，呼叫端可自由修改頂層欄位
+func (c *FlashSaleMetaCache) Get(ctx context.Context, flashSaleID int64, load FlashSaleLoader) (*model.FlashSale, error) {
+	if flashSale := c.getLocal(flashSaleID); flashSale != nil {
+		return flashSale, nil
+	}
+	generation := c.currentGeneration()
+
+	pipe := Get().Pipeline()
+	hash := pipe.HGetAll(ctx, FlashSaleMetaKey(flashSaleID))
+	version := pipe.Get(ctx, FlashSaleMetaVersionKey(flashSaleID))
+	_, _ = pipe.Exec(ctx) // 各命令結果分別檢查，版本號不存在時 Exec 返回 redis.Nil
+
+	if fields, err := hash.Result(); err == nil && len(fields) > 0 {
+		if flashSale, err := decodeFlashSaleMeta(flashSaleID, fields); err == nil {
+			c.putLocal(flashSale, generation)
+			return copyFlashSale(flashSale), nil
+		}
+	}
+
+	flashSale, err := load(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if v, err := metaVersion(version); err == nil {
+		_, _ = c.store(ctx, flashSale, v) // 寫入失敗或已失效只影響下次命中率
+	}
+
+	c.putLocal(flashSale, generation)
+	return copyFlashSale(flashSale), nil
+}
+
+// Refresh 從 loader 重新載入並寫入 Redis 與本地快取（准入腳本回報中繼資料未載入時使用）
+// 載入期間活動被失效時重新載入一次，仍失效則返回 ErrFlashSaleMetaChanged
+func (c *FlashSaleMetaCache) Refresh(ctx context.Context, flashSaleID int64, load FlashSaleLoader) (*model.FlashSale, error) {
+	for attempt := 0; attempt < 2; attempt++ {
+		generation := c.currentGeneration()
+		version, err := metaVersion(Get().Get(ctx, FlashSaleMetaVersionKey(flashSaleID)))
+		if err != nil {
+			return nil, err
+		}
+
+		flashSale, err := load(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		stored, err := c.store(ctx, flashSale, version)
+		if err != nil {
+			return nil, err
+		}
+		if stored {
+			c.putLocal(flashSale, generation)
+			return copyFlashSale(flashSale), nil
+		}
+	}
+	return nil, ErrFlashSaleMetaChanged
+}
+
+// Invalidate 遞增版本號、清除活動快取並通知所有實例
+// 版本號使進行中的讀穿透放棄寫回，避免載入於變更前的舊資料在刪除後被寫回
+func (c *FlashSaleMetaCache) Invalidate(ctx context.Context, flashSaleID int64) error {
+	c.removeLocal(flashSaleID)
+
+	versionKey := FlashSaleMetaVersionKey(flashSaleID)
+	pipe := Get().TxPipeline()
+	pipe.Incr(ctx, versionKey)
+	pipe.Expire(ctx, versionKey, flashSaleMetaVerTTL)
+	pipe.Del(ctx, FlashSaleMetaKey(flashSaleID))
+	if _, err := pipe.Exec(ctx); err != nil {
+		return err
+	}
+	return Get().Publish(ctx, FlashSaleMetaChannel, flashSaleID).Err()
+}
+
+// store 以載入前讀取的版本號條件寫入 Redis Hash，返回 false 表示載入期間已失效
+func (c *FlashSaleMetaCache) store(ctx context.Context, flashSale *model.FlashSale, version string) (bool, error) {
+	fields, err := encodeFlashSaleMeta(flashSale)
+	if err != nil {
+		return false, err
+	}
+
+	args := make([]interface{}, 0, 2+2*len(fields))
+	args = append(args, version, flashSaleMetaRedisTTL.Milliseconds())
+	for name, value := range fields {
+		args = append(args, name, value)
+	}
+
+	keys := []string{FlashSaleMetaKey(flashSale.ID), FlashSaleMetaVersionKey(flashSale.ID)}
+	stored, err := Get().Eval(ctx, FlashSaleMetaSetScript, keys, args...).Int()
+	if err != nil {
+		return false, err
+	}
+	return stored == 1, nil
+}
+
+// metaVersion 解析版本號查詢結果，不存在視為 "0"
+func metaVersion(cmd *redis.StringCmd) (string, error) {
+	version, err := cmd.Result()
+	if errors.Is(err, redis.Nil) {
+		return "0", nil
+	}
+	return version, err
+}
+
+// Listen 訂閱失效頻道直到 ctx 結束（阻塞）
+// 每次（重新）訂閱成功時清空本地快取，避免斷線期間遺漏失效訊息
+func (c *FlashSaleMetaCache) Listen(ctx context.Context, log *zap.Logger) {
+	pubsub := Get().Subscribe(ctx, FlashSaleMetaChannel)
+	defer pubsub.Close()
+
+	for {
+		msg, err := pubsub.Receive(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			log.Warn("flash sale meta subscription error", zap.Error(err))
+			time.Sleep(time.Second)
+			continue
+		}
+
+		switch m := msg.(type) {
+		case *redis.Subscription:
+			if m.Kind == "subscribe" {
+				c.reset()
+			}
+		case *redis.Message:
+			flashSaleID, err := strconv.ParseInt(m.Payload, 10, 64)
+			if err != nil {
+				log.Warn("invalid flash sale meta message", zap.String("payload", m.Payload))
+				continue
+			}
+			c.removeLocal(flashSaleID)
+		}
+	}
+}
+
+func (c *FlashSaleMetaCache) getLocal(flashSaleID int64) *model.FlashSale {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[flashSaleID]
+	if !ok {
+		return nil
+	}
+	entry := elem.Value.(*metaEntry)
+	if time.Now().After(entry.expiresAt) {
+		c.order.Remove(elem)
+		delete(c.entries, flashSaleID)
+		return nil
+	}
+
+	c.order.MoveToFront(elem)
+	return copyFlashSale(entry.flashSale)
+}
+
+func (c *FlashSaleMetaCache) currentGeneration() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.generation
+}
+
+// putLocal 寫入本地快取，generation 為載入前的失效世代，期間有失效時放棄寫入
+func (c *FlashSaleMetaCache) putLocal(flashSale *model.FlashSale, generation uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if generation != c.generation {
+		return
+	}
+
+	entry := &metaEntry{
+		id:        flashSale.ID,
+		flashSale: copyFlashSale(flashSale),
+		expiresAt: time.Now().Add(flashSaleMetaLocalTTL),
+	}
+
+	if elem, ok := c.entries[flashSale.ID]; ok {
+		elem.Value = entry
+		c.order.MoveToFront(elem)
+		return
+	}
+
+	c.entries[flashSale.ID] = c.order.PushFront(entry)
+	if c.order.Len() > c.capacity {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*metaEntry).id)
+	}
+}
+
+func (c *FlashSaleMetaCache) removeLocal(flashSaleID int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.generation++
+	if elem, ok := c.entries[flashSaleID]; ok {
+		c.order.Remove(elem)
+		delete(c.entries, flashSaleID)
+	}
+}
+
+func (c *FlashSaleMetaCache) reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.generation++
+	c.entries = make(map[int64]*list.Element)
+	c.order.Init()
+}
+
+// copyFlashSale 淺拷貝活動（Items 與 Product 共用，快取內容視為唯讀）
+func copyFlashSale(flashSale *model.FlashSale) *model.FlashSale {
+	cp := *flashSale
+	return &cp
+}
+
+// encodeFlashSaleMeta 將活動轉為 Redis Hash 欄位
+func encodeFlashSaleMeta(flashSale *model.FlashSale) (map[string]interface{}, error) {
+	items, err := json.Marshal(flashSale.Items)
+	if err != nil {
+		return nil, err
+	}
+	product, err := json.Marshal(flashSale.Product)
+	if err != nil {
+		return nil, err
+	}
+
+	templateID := int64(0)
+	if flashSale.TemplateID != nil {
+		templateID = *flashSale.TemplateID
+	}
+
+	return map[string]interface{}{
+		"product_id":             flashSale.ProductID,
+		"template_id":            templateID,
+		"flash_price":            strconv.FormatFloat(flashSale.FlashPrice, 'f', -1, 64),
+		"total_stock":            flashSale.TotalStock,
+		"available_stock":        flashSale.AvailableStock,
+		"sale_type":              int(flashSale.SaleType),
+		"per_user_limit":         flashSale.PerUserLimit,
+		"reserved_only":          flag(flashSale.ReservedOnly),
+		"remind_minutes":         flashSale.RemindMinutes,
+		"queue_enabled":          flag(flashSale.QueueEnabled),
+		"queue_rate":             flashSale.QueueRate,
+		"stock_shards":           flashSale.StockShards,
+		"campaign":               flashSale.Campaign,
+		"payment_window_minutes": flashSale.PaymentWindowMinutes,
+		"start_time":             flashSale.StartTime.Format(time.RFC3339Nano),
+		"end_time":               flashSale.EndTime.Format(time.RFC3339Nano),
+		"start_ms":               flashSale.StartTime.UnixMilli(), // 供 AdmitScript 比較時間
+		"end_ms":                 flashSale.EndTime.UnixMilli(),
+		"status":                 int(flashSale.Status),
+		"created_at":             flashSale.CreatedAt.Format(time.RFC3339Nano),
+		"updated_at":             flashSale.UpdatedAt.Format(time.RFC3339Nano),
+		"items":                  string(items),
+		"product":                string(product),
+	}, nil
+}
+
+// decodeFlashSaleMeta 由 Redis Hash 欄位還原活動，欄位缺漏或格式錯誤時返回錯誤（視為未命中）
+func decodeFlashSaleMeta(flashSaleID int64, fields map[string]string) (*model.FlashSale, error) {
+	d := metaDecoder{fields: fields}
+
+	flashSale := &model.FlashSale{
+		ID:                   flashSaleID,
+		ProductID:            d.int64("product_id"),
+		FlashPrice:           d.float("flash_price"),
+		TotalStock:           int(d.int64("total_stock")),
+		AvailableStock:       int(d.int64("available_stock")),
+		SaleType:             model.FlashSaleType(d.int64("sale_type")),
+		PerUserLimit:         int(d.int64("per_user_limit")),
+		ReservedOnly:         fields["reserved_only"] == "1",
+		RemindMinutes:        int(d.int64("remind_minutes")),
+		QueueEnabled:         fields["queue_enabled"] == "1",
+		QueueRate:            int(d.int64("queue_rate")),
+		StockShards:          int(d.int64("stock_shards")),
+		Campaign:             fields["campaign"],
+		PaymentWindowMinutes: int(d.int64("payment_window_minutes")),
+		StartTime:            d.time("start_time"),
+		EndTime:              d.time("end_time"),
+		Status:               model.FlashSaleStatus(d.int64("status")),
+		CreatedAt:            d.time("created_at"),
+		UpdatedAt:            d.time("updated_at"),
+	}
+	if templateID := d.int64("template_id"); templateID > 0 {
+		flashSale.TemplateID = &templateID
+	}
+	d.json("items", &flashSale.Items)
+	d.json("product", &flashSale.Product)
+
+	if d.err != nil {
+		return nil, d.err
+	}
+	return flashSale, nil
+}
+
+// metaDecoder 依序解析欄位並保留第一個錯誤
+type metaDecoder struct {
+	fields map[string]string
+	err    error
+}
+
+func (d *metaDecoder) value(name string) (string, bool) {
+	v, ok := d.fields[name]
+	if !ok && d.err == nil {
+		d.err = fmt.Errorf("flash sale meta missing field %q", name)
+	}
+	return v, ok
+}
+
+func (d *metaDecoder) int64(name string) int64 {
+	v, ok := d.value(name)
+	if !ok {
+		return 0
+	}
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil && d.err == nil {
+		d.err = err
+	}
+	return n
+}
+
+func (d *metaDecoder) float(name string) float64 {
+	v, ok := d.value(name)
+	if !ok {
+		return 0
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil && d.err == nil {
+		d.err = err
+	}
+	return f
+}
+
+func (d *metaDecoder) time(name string) time.Time {
+	v, ok := d.value(name)
+	if !ok {
+		return time.Time{}
+	}
+	t, err := time.Parse(time.RFC3339Nano, v)
+	if err != nil && d.err == nil {
+		d.err = err
+	}
+	return t
+}
+
+func (d *metaDecoder) json(name string, dst interface{}) {
+	v, ok := d.value(name)
+	if !ok {
+		return
+	}
+	if err := json.Unmarshal([]byte(v), dst); err != nil && d.err == nil {
+		d.err = err
+	}
+}
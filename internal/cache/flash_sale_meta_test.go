@@ -0,0 +1,146 @@
+// 活動中繼資料快取整合測試
+//
+// 測試覆蓋：
+// - 讀穿透載入 DB 期間活動被 Invalidate 時，載入的舊資料不寫回 Redis Hash 與本地快取
+// - Refresh 載入期間被失效時重新載入，寫入變更後的資料
+// 需要可用的 Redis：REDIS_TEST_ADDR=127.0.0.1:6379 go test -run FlashSaleMeta ./internal/cache/
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Mag1cFall/magtrade/internal/model"
+)
+
+const testMetaSaleID int64 = 900000201
+
+// setupTestMeta 清除測試活動的中繼資料與版本號，返回獨立的本地快取
+func setupTestMeta(t *testing.T) (context.Context, *FlashSaleMetaCache) {
+	t.Helper()
+	ctx := setupTestRedis(t)
+
+	cleanup := func() {
+		rdb.Del(ctx, FlashSaleMetaKey(testMetaSaleID), FlashSaleMetaVersionKey(testMetaSaleID))
+	}
+	cleanup()
+	t.Cleanup(cleanup)
+
+	return ctx, newFlashSaleMetaCache(flashSaleMetaCapacity)
+}
+
+// testMetaSale 建立指定狀態的測試活動
+func testMetaSale(status model.FlashSaleStatus) *model.FlashSale {
+	now := time.Now()
+	return &model.FlashSale{
+		ID:           testMetaSaleID,
+		ProductID:    1,
+		FlashPrice:   10,
+		TotalStock:   100,
+		PerUserLimit: 1,
+		StartTime:    now.Add(-time.Minute),
+		EndTime:      now.Add(time.Hour),
+		Status:       status,
+	}
+}
+
+// assertMetaStatus 檢查 Redis Hash 中的狀態（AdmitScript 讀取的欄位），want 為 nil 表示 Hash 不存在
+func assertMetaStatus(t *testing.T, ctx context.Context, want *model.FlashSaleStatus) {
+	t.Helper()
+
+	fields, err := rdb.HGetAll(ctx, FlashSaleMetaKey(testMetaSaleID)).Result()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want == nil {
+		if len(fields) != 0 {
+			t.Errorf("meta hash = %v, want none", fields)
+		}
+		return
+	}
+	flashSale, err := decodeFlashSaleMeta(testMetaSaleID, fields)
+	if err != nil {
+		t.Fatalf("decode meta hash: %v", err)
+	}
+	if flashSale.Status != *want {
+		t.Errorf("meta status = %d, want %d", flashSale.Status, *want)
+	}
+}
+
+func TestFlashSaleMeta_InvalidateDuringReadThrough(t *testing.T) {
+	ctx, metas := setupTestMeta(t)
+
+	// 讀取 DB 後、寫回快取前，活動被取消並失效
+	stale := func(ctx context.Context) (*model.FlashSale, error) {
+		if err := metas.Invalidate(ctx, testMetaSaleID); err != nil {
+			t.Fatal(err)
+		}
+		return testMetaSale(model.FlashSaleStatusActive), nil
+	}
+
+	got, err := metas.Get(ctx, testMetaSaleID, stale)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Status != model.FlashSaleStatusActive {
+		t.Errorf("Get() status = %d, want loaded value", got.Status)
+	}
+	assertMetaStatus(t, ctx, nil)
+	if metas.getLocal(testMetaSaleID) != nil {
+		t.Error("stale meta cached locally")
+	}
+
+	// 下一次讀穿透載入變更後的資料
+	cancelled := model.FlashSaleStatusCancelled
+	got, err = metas.Get(ctx, testMetaSaleID, func(context.Context) (*model.FlashSale, error) {
+		return testMetaSale(cancelled), nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Status != cancelled {
+		t.Errorf("Get() status = %d, want %d", got.Status, cancelled)
+	}
+	assertMetaStatus(t, ctx, &cancelled)
+	if local := metas.getLocal(testMetaSaleID); local == nil || local.Status != cancelled {
+		t.Errorf("local meta = %+v, want cancelled", local)
+	}
+
+	// 已快取的資料在失效後不再命中
+	if err := metas.Invalidate(ctx, testMetaSaleID); err != nil {
+		t.Fatal(err)
+	}
+	assertMetaStatus(t, ctx, nil)
+	if metas.getLocal(testMetaSaleID) != nil {
+		t.Error("local meta survived invalidate")
+	}
+}
+
+func TestFlashSaleMeta_RefreshRetriesAfterInvalidate(t *testing.T) {
+	ctx, metas := setupTestMeta(t)
+
+	loads := 0
+	got, err := metas.Refresh(ctx, testMetaSaleID, func(ctx context.Context) (*model.FlashSale, error) {
+		loads++
+		if loads == 1 {
+			if err := metas.Invalidate(ctx, testMetaSaleID); err != nil {
+				t.Fatal(err)
+			}
+			return testMetaSale(model.FlashSaleStatusActive), nil
+		}
+		return testMetaSale(model.FlashSaleStatusCancelled), nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loads != 2 {
+		t.Errorf("loads = %d, want 2", loads)
+	}
+
+	cancelled := model.FlashSaleStatusCancelled
+	if got.Status != cancelled {
+		t.Errorf("Refresh() status = %d, want %d", got.Status, cancelled)
+	}
+	assertMetaStatus(t, ctx, &cancelled)
+}
@@ -0,0 +1,97 @@
+// 領導者選舉
+//
+// 本檔案提供基於 Redis 的領導者選舉 LeaderElector，多個實例中同一時間只有一個擔任領導者
+// 呼叫方每隔 TTL/3 呼叫 Campaign：無人擔任時當選，已當選時續期
+// 本地以「最後一次成功當選時間 + TTL」判斷任期，Redis 無法連線或續期中斷時任期到期即自動卸任，
+// 不會與新當選的實例同時認為自己是領導者（前提是各實例時鐘漂移遠小於 TTL）
+package cache
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+// DefaultLeaderTTL 預設領導者任期
+const DefaultLeaderTTL = 15 * time.Second
+
+// LeaderKey 生成領導者 Key，格式: leader:名稱
+func LeaderKey(name string) string {
+	return "leader:" + name
+}
+
+// LeaderElector 領導者選舉
+type LeaderElector struct {
+	rdb redis.UniversalClient
+	key string
+	id  string
+	ttl time.Duration
+
+	mu         sync.Mutex
+	validUntil time.Time // 本地任期到期時間，零值表示非領導者
+}
+
+// NewLeaderElector 建立選舉實例，ttl 為 0 使用 DefaultLeaderTTL
+func NewLeaderElector(name string, ttl time.Duration) *LeaderElector {
+	if ttl <= 0 {
+		ttl = DefaultLeaderTTL
+	}
+	return &LeaderElector{
+		rdb: Get(),
+		key: LeaderKey(name),
+		id:  uuid.New().String(),
+		ttl: ttl,
+	}
+}
+
+// ID 本實例的候選者標識
+func (e *LeaderElector) ID() string {
+	return e.id
+}
+
+// TTL 領導者任期，呼叫方應每隔 TTL/3 呼叫 Campaign
+func (e *LeaderElector) TTL() time.Duration {
+	return e.ttl
+}
+
+// Campaign 參與選舉或續期，返回本實例是否為領導者
+// 發送請求前記錄時間作為任期起點，網路延遲只會使本地任期提早結束
+func (e *LeaderElector) Campaign(ctx context.Context) (bool, error) {
+	start := time.Now()
+	elected, err := e.rdb.Eval(ctx, LeaderCampaignScript, []string{e.key}, e.id, e.ttl.Milliseconds()).Int()
+	if err != nil {
+		return e.IsLeader(), err // 任期內仍視為領導者，到期後自動卸任
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if elected == 1 {
+		e.validUntil = start.Add(e.ttl)
+	} else {
+		e.validUntil = time.Time{}
+	}
+	return elected == 1, nil
+}
+
+// IsLeader 本實例是否為領導者（本地任期尚未到期）
+func (e *LeaderElector) IsLeader() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return time.Now().Before(e.validUntil)
+}
+
+// Resign 卸任並刪除領導者 Key，讓其他實例立即接手
+// 使用不受取消影響的 ctx，停止時仍能卸任
+func (e *LeaderElector) Resign(ctx context.Context) error {
+	e.mu.Lock()
+	e.validUntil = time.Time{}
+	e.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), lockReleaseTimeout)
+	defer cancel()
+	return e.rdb.Eval(ctx, LeaderResignScript, []string{e.key}, e.id).Err()
+}
@@ -0,0 +1,127 @@
+// 領導者選舉整合測試
+//
+// 測試覆蓋：
+// - 多個實例並行參與選舉，任一輪都只有一個實例當選，續期後領導者不變
+// - 領導者卸任後由其他實例接手；Redis Key 遺失時本地任期到期後自動卸任
+// 需要可用的 Redis：REDIS_TEST_ADDR=127.0.0.1:6379 go test -run Leader ./internal/cache/
+package cache
+
+import (
+	"context"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const testLeaderName = "test:leader"
+
+// setupTestRedis 連線測試用 Redis，未設定位址時略過（已設定則必須可連線）
+func setupTestRedis(t *testing.T) context.Context {
+	t.Helper()
+
+	addr := os.Getenv("REDIS_TEST_ADDR")
+	if addr == "" {
+		t.Skip("REDIS_TEST_ADDR not set")
+	}
+
+	ctx := context.Background()
+	rdb = redis.NewClient(&redis.Options{Addr: addr, Password: os.Getenv("REDIS_TEST_PASSWORD")})
+	if err := rdb.Ping(ctx).Err(); err != nil {
+		t.Fatalf("redis unavailable: %v", err)
+	}
+
+	rdb.Del(ctx, LeaderKey(testLeaderName))
+	t.Cleanup(func() {
+		rdb.Del(ctx, LeaderKey(testLeaderName))
+		_ = rdb.Close()
+		rdb = nil
+	})
+	return ctx
+}
+
+// campaignAll 所有實例並行參與一次選舉，返回當選者
+func campaignAll(t *testing.T, ctx context.Context, electors []*LeaderElector) []*LeaderElector {
+	t.Helper()
+
+	var (
+		wg     sync.WaitGroup
+		mu     sync.Mutex
+		leader []*LeaderElector
+	)
+	for _, e := range electors {
+		wg.Add(1)
+		go func(e *LeaderElector) {
+			defer wg.Done()
+			ok, err := e.Campaign(ctx)
+			if err != nil {
+				t.Errorf("Campaign() error = %v", err)
+				return
+			}
+			if ok {
+				mu.Lock()
+				leader = append(leader, e)
+				mu.Unlock()
+			}
+		}(e)
+	}
+	wg.Wait()
+	return leader
+}
+
+func TestLeaderElector_SingleLeader(t *testing.T) {
+	ctx := setupTestRedis(t)
+
+	electors := make([]*LeaderElector, 8)
+	for i := range electors {
+		electors[i] = NewLeaderElector(testLeaderName, 2*time.Second)
+	}
+
+	var first *LeaderElector
+	for round := 0; round < 5; round++ {
+		leaders := campaignAll(t, ctx, electors)
+		if len(leaders) != 1 {
+			t.Fatalf("round %d: %d leaders elected, want 1", round, len(leaders))
+		}
+		if first == nil {
+			first = leaders[0]
+		} else if leaders[0] != first {
+			t.Fatalf("round %d: leader changed from %s to %s without resigning", round, first.ID(), leaders[0].ID())
+		}
+	}
+
+	for _, e := range electors {
+		if e != first && e.IsLeader() {
+			t.Errorf("elector %s reports leadership while %s leads", e.ID(), first.ID())
+		}
+	}
+
+	if err := first.Resign(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if first.IsLeader() {
+		t.Error("IsLeader() = true after Resign()")
+	}
+
+	leaders := campaignAll(t, ctx, electors)
+	if len(leaders) != 1 {
+		t.Fatalf("%d leaders elected after resign, want 1", len(leaders))
+	}
+}
+
+func TestLeaderElector_LocalTermExpires(t *testing.T) {
+	ctx := setupTestRedis(t)
+
+	e := NewLeaderElector(testLeaderName, 300*time.Millisecond)
+	if ok, err := e.Campaign(ctx); err != nil || !ok {
+		t.Fatalf("Campaign() = %v, %v, want true", ok, err)
+	}
+
+	// 未續期時任期到期即卸任，不依賴 Redis 通知
+	time.Sleep(400 * time.Millisecond)
+	if e.IsLeader() {
+		t.Error("IsLeader() = true after term expired without renewal")
+	}
+}
@@ -0,0 +1,212 @@
+// 可續期分散式鎖
+//
+// 本檔案提供基於 Redis 的分散式鎖 RenewableLock
+// - 看門狗：持有期間每隔 TTL/3 續期，臨界區執行再久也不會因過期被他人取得
+// - 可重入：鎖以 Hash 記錄持有者與重入次數，相同 Owner 可重複加鎖，解鎖次數相同才真正釋放
+// - 取消感知：加鎖時的 ctx 取消後看門狗停止並釋放鎖；Unlock 不受已取消的 ctx 影響
+// - TryLock：鎖被占用時以指數退避重試，直到取得、逾時或 ctx 取消
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	DefaultLockTTL = 10 * time.Second // 預設鎖過期時間
+
+	lockReleaseTimeout = 3 * time.Second        // 解鎖時的 Redis 操作逾時
+	lockBackoffMin     = 20 * time.Millisecond  // TryLock 首次重試間隔
+	lockBackoffMax     = 500 * time.Millisecond // TryLock 最大重試間隔
+)
+
+// ErrLockNotHeld 解鎖時本實例未持有鎖
+var ErrLockNotHeld = errors.New("lock not held")
+
+// LockKey 生成使用者搶購鎖 Key，格式: flash:lock:{活動ID}:{使用者ID}
+func LockKey(flashSaleID, userID int64) string {
+	return fmt.Sprintf("flash:lock:{%d}:%d", flashSaleID, userID)
+}
+
+// StockAdjustLockKey 生成活動庫存調整鎖 Key，格式: flash:lock:{活動ID}:stock
+func StockAdjustLockKey(flashSaleID int64) string {
+	return fmt.Sprintf("flash:lock:{%d}:stock", flashSaleID)
+}
+
+// LockOptions 鎖選項
+type LockOptions struct {
+	TTL   time.Duration // 鎖過期時間，0 使用 DefaultLockTTL；看門狗每 TTL/3 續期
+	Owner string        // 持有者，相同持有者可重入；空值為每個鎖實例產生唯一值（不可重入）
+}
+
+// RenewableLock 可續期、可重入的分散式鎖
+// 同一實例可在多個 goroutine 間共用，但應由取得鎖的一方負責解鎖
+type RenewableLock struct {
+	rdb   redis.UniversalClient
+	key   string
+	owner string
+	ttl   time.Duration
+
+	mu    sync.Mutex
+	held  int           // 本實例持有的重入次數
+	stop  chan struct{} // 關閉時停止看門狗
+	watch sync.WaitGroup
+}
+
+// NewRenewableLock 建立鎖實例
+func NewRenewableLock(key string, opts LockOptions) *RenewableLock {
+	if opts.TTL <= 0 {
+		opts.TTL = DefaultLockTTL
+	}
+	if opts.Owner == "" {
+		opts.Owner = uuid.New().String()
+	}
+	return &RenewableLock{
+		rdb:   Get(),
+		key:   key,
+		owner: opts.Owner,
+		ttl:   opts.TTL,
+	}
+}
+
+// Lock 嘗試加鎖一次，返回 false 表示鎖由其他持有者占用
+// 首次取得時啟動看門狗，ctx 取消時看門狗停止並釋放本實例持有的鎖
+func (l *RenewableLock) Lock(ctx context.Context) (bool, error) {
+	count, err := l.rdb.Eval(ctx, LockAcquireScript,
+		[]string{l.key},
+		l.owner, l.ttl.Milliseconds(),
+	).Int()
+	if err != nil {
+		return false, err
+	}
+	if count == 0 {
+		return false, nil
+	}
+
+	l.mu.Lock()
+	l.held++
+	if l.held == 1 {
+		l.stop = make(chan struct{})
+		l.watch.Add(1)
+		go l.watchdog(ctx, l.stop)
+	}
+	l.mu.Unlock()
+	return true, nil
+}
+
+// TryLock 在 timeout 內以指數退避（含隨機抖動）重試加鎖
+// 逾時返回 false；ctx 取消返回 ctx.Err()
+func (l *RenewableLock) TryLock(ctx context.Context, timeout time.Duration) (bool, error) {
+	deadline := time.Now().Add(timeout)
+	backoff := lockBackoffMin
+
+	for {
+		ok, err := l.Lock(ctx)
+		if err != nil || ok {
+			return ok, err
+		}
+
+		wait := backoff/2 + rand.N(backoff/2+1)
+		if remaining := time.Until(deadline); remaining <= 0 {
+			return false, nil
+		} else if wait > remaining {
+			wait = remaining
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return false, ctx.Err()
+		case <-timer.C:
+		}
+
+		backoff = min(backoff*2, lockBackoffMax)
+	}
+}
+
+// Unlock 釋放一次重入，次數歸零時刪除鎖並停止看門狗
+// 使用不受取消影響的 ctx，請求已取消時仍能釋放
+func (l *RenewableLock) Unlock(ctx context.Context) error {
+	l.mu.Lock()
+	if l.held == 0 {
+		l.mu.Unlock()
+		return ErrLockNotHeld
+	}
+	l.held--
+	var stop chan struct{}
+	if l.held == 0 {
+		stop, l.stop = l.stop, nil
+	}
+	l.mu.Unlock()
+
+	if stop != nil {
+		close(stop)
+		l.watch.Wait()
+	}
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), lockReleaseTimeout)
+	defer cancel()
+	return l.release(ctx)
+}
+
+// release 在 Redis 端減少一次重入
+func (l *RenewableLock) release(ctx context.Context) error {
+	return l.rdb.Eval(ctx, LockReleaseScript,
+		[]string{l.key},
+		l.owner, l.ttl.Milliseconds(),
+	).Err()
+}
+
+// watchdog 持有期間定期續期；續期發現鎖已不屬於自己時停止
+// 加鎖時的 ctx 取消後釋放本實例持有的全部重入
+func (l *RenewableLock) watchdog(ctx context.Context, stop chan struct{}) {
+	defer l.watch.Done()
+
+	ticker := time.NewTicker(l.ttl / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ctx.Done():
+			l.abandon()
+			return
+		case <-ticker.C:
+			renewCtx, cancel := context.WithTimeout(context.Background(), l.ttl/3)
+			renewed, err := l.rdb.Eval(renewCtx, LockRenewScript,
+				[]string{l.key},
+				l.owner, l.ttl.Milliseconds(),
+			).Int()
+			cancel()
+			if err == nil && renewed == 0 {
+				return // 鎖已過期或被刪除，不再續期
+			}
+		}
+	}
+}
+
+// abandon ctx 取消時釋放本實例持有的全部重入（由看門狗呼叫）
+func (l *RenewableLock) abandon() {
+	l.mu.Lock()
+	held := l.held
+	l.held = 0
+	l.stop = nil
+	l.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), lockReleaseTimeout)
+	defer cancel()
+	for i := 0; i < held; i++ {
+		if err := l.release(ctx); err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,183 @@
+// 可續期分散式鎖整合測試
+//
+// 測試覆蓋：
+// - 可重入：相同持有者重複加鎖累計次數，解鎖相同次數才真正釋放
+// - 看門狗：持有時間超過初始 TTL 後鎖仍存在，解鎖後停止續期
+// - 非持有者解鎖不會釋放他人的鎖
+// - TryLock：鎖被占用時逾時返回 false，ctx 取消返回錯誤，鎖釋放後取得
+// 需要可用的 Redis：REDIS_TEST_ADDR=127.0.0.1:6379 go test -run RenewableLock ./internal/cache/
+package cache
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+const testLockSaleID int64 = 900000301
+
+// setupTestLock 清除測試鎖 Key，返回 Key
+func setupTestLock(t *testing.T) (context.Context, string) {
+	t.Helper()
+	ctx := setupTestRedis(t)
+
+	key := LockKey(testLockSaleID, 1)
+	rdb.Del(ctx, key)
+	t.Cleanup(func() { rdb.Del(ctx, key) })
+	return ctx, key
+}
+
+// lockCount 查詢持有者在 Redis 中的重入次數，鎖不存在或不屬於持有者時為 0
+func lockCount(t *testing.T, ctx context.Context, key, owner string) int {
+	t.Helper()
+
+	n, err := rdb.HGet(ctx, key, owner).Int()
+	if err != nil {
+		return 0
+	}
+	return n
+}
+
+func TestRenewableLock_Reentrant(t *testing.T) {
+	ctx, key := setupTestLock(t)
+	lock := NewRenewableLock(key, LockOptions{Owner: "owner-a"})
+	other := NewRenewableLock(key, LockOptions{Owner: "owner-b"})
+
+	for i := 1; i <= 2; i++ {
+		ok, err := lock.Lock(ctx)
+		if err != nil || !ok {
+			t.Fatalf("Lock() #%d = %v, %v", i, ok, err)
+		}
+		if got := lockCount(t, ctx, key, "owner-a"); got != i {
+			t.Errorf("count after Lock() #%d = %d, want %d", i, got, i)
+		}
+	}
+
+	if ok, err := other.Lock(ctx); err != nil || ok {
+		t.Fatalf("other Lock() = %v, %v, want false", ok, err)
+	}
+
+	// 第一次解鎖只減少重入次數
+	if err := lock.Unlock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got := lockCount(t, ctx, key, "owner-a"); got != 1 {
+		t.Errorf("count after first Unlock() = %d, want 1", got)
+	}
+	if ok, _ := other.Lock(ctx); ok {
+		t.Fatal("other acquired lock still held once")
+	}
+
+	if err := lock.Unlock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := rdb.Exists(ctx, key).Result(); n != 0 {
+		t.Error("lock still exists after releasing all holds")
+	}
+	if err := lock.Unlock(ctx); !errors.Is(err, ErrLockNotHeld) {
+		t.Errorf("extra Unlock() error = %v, want ErrLockNotHeld", err)
+	}
+
+	ok, err := other.Lock(ctx)
+	if err != nil || !ok {
+		t.Fatalf("other Lock() after release = %v, %v", ok, err)
+	}
+	_ = other.Unlock(ctx)
+}
+
+func TestRenewableLock_WatchdogExtendsTTL(t *testing.T) {
+	ctx, key := setupTestLock(t)
+	const ttl = 300 * time.Millisecond
+	lock := NewRenewableLock(key, LockOptions{TTL: ttl})
+
+	if ok, err := lock.Lock(ctx); err != nil || !ok {
+		t.Fatalf("Lock() = %v, %v", ok, err)
+	}
+
+	time.Sleep(4 * ttl)
+
+	pttl, err := rdb.PTTL(ctx, key).Result()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pttl <= 0 {
+		t.Fatalf("lock ttl = %v after %v, want renewed", pttl, 4*ttl)
+	}
+	other := NewRenewableLock(key, LockOptions{TTL: ttl})
+	if ok, _ := other.Lock(ctx); ok {
+		t.Fatal("other acquired lock held beyond initial ttl")
+	}
+
+	if err := lock.Unlock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := rdb.Exists(ctx, key).Result(); n != 0 {
+		t.Error("lock still exists after Unlock()")
+	}
+}
+
+func TestRenewableLock_NonOwnerUnlock(t *testing.T) {
+	ctx, key := setupTestLock(t)
+	lock := NewRenewableLock(key, LockOptions{Owner: "owner-a"})
+	other := NewRenewableLock(key, LockOptions{Owner: "owner-b"})
+
+	if ok, err := lock.Lock(ctx); err != nil || !ok {
+		t.Fatalf("Lock() = %v, %v", ok, err)
+	}
+	defer func() { _ = lock.Unlock(ctx) }()
+
+	// 本實例未持有：不觸及 Redis
+	if err := other.Unlock(ctx); !errors.Is(err, ErrLockNotHeld) {
+		t.Errorf("non-owner Unlock() error = %v, want ErrLockNotHeld", err)
+	}
+
+	// 直接執行解鎖腳本：非持有者不影響鎖
+	if err := other.release(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got := lockCount(t, ctx, key, "owner-a"); got != 1 {
+		t.Errorf("owner count after non-owner release = %d, want 1", got)
+	}
+	if ok, _ := other.Lock(ctx); ok {
+		t.Error("non-owner acquired lock after its release")
+	}
+}
+
+func TestRenewableLock_TryLockTimeout(t *testing.T) {
+	ctx, key := setupTestLock(t)
+	lock := NewRenewableLock(key, LockOptions{})
+	other := NewRenewableLock(key, LockOptions{})
+
+	if ok, err := lock.Lock(ctx); err != nil || !ok {
+		t.Fatalf("Lock() = %v, %v", ok, err)
+	}
+
+	const timeout = 200 * time.Millisecond
+	start := time.Now()
+	ok, err := other.TryLock(ctx, timeout)
+	elapsed := time.Since(start)
+	if err != nil || ok {
+		t.Fatalf("TryLock() on held lock = %v, %v, want false", ok, err)
+	}
+	if elapsed < timeout || elapsed > timeout+lockBackoffMax {
+		t.Errorf("TryLock() returned after %v, want about %v", elapsed, timeout)
+	}
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err := other.TryLock(cancelled, time.Second); !errors.Is(err, context.Canceled) {
+		t.Errorf("TryLock() with cancelled ctx error = %v, want context.Canceled", err)
+	}
+
+	// 等待期間鎖被釋放
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		_ = lock.Unlock(ctx)
+	}()
+	ok, err = other.TryLock(ctx, 2*time.Second)
+	if err != nil || !ok {
+		t.Fatalf("TryLock() after release = %v, %v", ok, err)
+	}
+	_ = other.Unlock(ctx)
+}
@@ -0,0 +1,367 @@
+// 行程內庫存後端
+//
+// MemoryStockStore 以互斥鎖保護的 map 實作 StockStore 與 StockCache，語意與 Redis 扣減/准入/恢復腳本一致
+// 准入所需的活動中繼資料由 SetMeta 寫入（對應 Redis 的中繼資料 Hash），未寫入時 Admit 返回 AdmitMetaMissing
+// 行程內沒有 slot 熱點，分片活動的庫存視為單一庫存，DeductShard 只回報使用者所屬分片序號
+// 用於單元測試與本地開發，不跨實例共享，也不處理 TTL 與售罄旗標廣播
+package cache
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/Mag1cFall/magtrade/internal/model"
+	"github.com/Mag1cFall/magtrade/internal/pkg/utils"
+)
+
+// memoryAdmitMeta 准入檢查使用的活動中繼資料
+type memoryAdmitMeta struct {
+	status       model.FlashSaleStatus
+	startTime    time.Time
+	endTime      time.Time
+	perUserLimit int
+}
+
+// MemoryStockStore 行程內庫存後端
+type MemoryStockStore struct {
+	mu     sync.Mutex
+	stock  map[int64]int
+	items  map[int64]map[int64]int // 活動 ID → 規格 ID → 規格庫存
+	bought map[int64]map[int64]int // 活動 ID → 使用者 ID → 已購數量
+	outbox map[int64][]string      // 活動 ID → 已寫入的訂單訊息
+	meta   map[int64]memoryAdmitMeta
+}
+
+func NewMemoryStockStore() *MemoryStockStore {
+	return &MemoryStockStore{
+		stock:  make(map[int64]int),
+		items:  make(map[int64]map[int64]int),
+		bought: make(map[int64]map[int64]int),
+		outbox: make(map[int64][]string),
+		meta:   make(map[int64]memoryAdmitMeta),
+	}
+}
+
+var (
+	_ StockStore = (*MemoryStockStore)(nil)
+	_ StockCache = (*MemoryStockStore)(nil)
+)
+
+// InitStock 初始化活動庫存（覆寫現有值）
+func (m *MemoryStockStore) InitStock(_ context.Context, flashSaleID int64, stock int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.stock[flashSaleID] = stock
+	return nil
+}
+
+// SetStock 設定活動庫存（覆寫現有值，不處理 TTL）
+func (m *MemoryStockStore) SetStock(ctx context.Context, flashSaleID int64, stock int, _ time.Duration) error {
+	return m.InitStock(ctx, flashSaleID, stock)
+}
+
+// SetShardedStock 設定分片活動庫存（行程內不分片）
+func (m *MemoryStockStore) SetShardedStock(ctx context.Context, flashSaleID int64, stock, _ int, _ time.Duration) error {
+	return m.InitStock(ctx, flashSaleID, stock)
+}
+
+// SetItemStock 設定規格庫存（覆寫現有值，不處理 TTL）
+func (m *MemoryStockStore) SetItemStock(_ context.Context, flashSaleID, itemID int64, stock int, _ time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.setItemStock(flashSaleID, itemID, stock)
+	return nil
+}
+
+func (m *MemoryStockStore) setItemStock(flashSaleID, itemID int64, stock int) {
+	if m.items[flashSaleID] == nil {
+		m.items[flashSaleID] = make(map[int64]int)
+	}
+	m.items[flashSaleID][itemID] = stock
+}
+
+// WarmUpStock 庫存不存在才載入
+func (m *MemoryStockStore) WarmUpStock(_ context.Context, flashSaleID int64, stock int, _ time.Duration) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.stock[flashSaleID]; ok {
+		return false, nil
+	}
+	m.stock[flashSaleID] = stock
+	return true, nil
+}
+
+// WarmUpShardedStock 分片活動庫存不存在才載入（行程內不分片）
+func (m *MemoryStockStore) WarmUpShardedStock(ctx context.Context, flashSaleID int64, stock, _ int, ttl time.Duration) (bool, error) {
+	return m.WarmUpStock(ctx, flashSaleID, stock, ttl)
+}
+
+// WarmUpItemStock 規格庫存不存在才載入
+func (m *MemoryStockStore) WarmUpItemStock(_ context.Context, flashSaleID, itemID int64, stock int, _ time.Duration) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.items[flashSaleID][itemID]; ok {
+		return false, nil
+	}
+	m.setItemStock(flashSaleID, itemID, stock)
+	return true, nil
+}
+
+// AdjustStock 增減庫存，語意與 AdjustStockScript 相同：未載入返回 ErrStockNotLoaded，調整後為負返回 ErrStockNegative
+func (m *MemoryStockStore) AdjustStock(_ context.Context, flashSaleID, itemID int64, delta int) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stock, ok := m.stock[flashSaleID]
+	if !ok {
+		return 0, ErrStockNotLoaded
+	}
+	item, itemOK := m.items[flashSaleID][itemID]
+	if itemID > 0 && !itemOK {
+		return 0, ErrStockNotLoaded
+	}
+	if stock+delta < 0 || (itemID > 0 && item+delta < 0) {
+		return 0, ErrStockNegative
+	}
+
+	m.stock[flashSaleID] = stock + delta
+	if itemID > 0 {
+		m.items[flashSaleID][itemID] = item + delta
+	}
+	return stock + delta, nil
+}
+
+// DeleteStock 刪除活動的庫存與規格庫存
+func (m *MemoryStockStore) DeleteStock(_ context.Context, flashSaleID int64, _ []int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.stock, flashSaleID)
+	delete(m.items, flashSaleID)
+	return nil
+}
+
+// PeekStock 查詢庫存並區分是否已載入
+func (m *MemoryStockStore) PeekStock(_ context.Context, flashSaleID int64) (int, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stock, ok := m.stock[flashSaleID]
+	return stock, ok, nil
+}
+
+// GetItemStocks 批量查詢規格庫存，未載入的規格視為 0
+func (m *MemoryStockStore) GetItemStocks(_ context.Context, flashSaleID int64, itemIDs []int64) (map[int64]int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stocks := make(map[int64]int, len(itemIDs))
+	for _, itemID := range itemIDs {
+		stocks[itemID] = m.items[flashSaleID][itemID]
+	}
+	return stocks, nil
+}
+
+// RestoreBought 回填使用者已購數量（已存在則保留）
+func (m *MemoryStockStore) RestoreBought(_ context.Context, flashSaleID int64, bought map[int64]int, _ time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	users := m.boughtOf(flashSaleID)
+	for userID, quantity := range bought {
+		if _, ok := users[userID]; !ok {
+			users[userID] = quantity
+		}
+	}
+	return nil
+}
+
+// DeductShard 扣減分片活動庫存，成功時返回使用者所屬分片
+func (m *MemoryStockStore) DeductShard(_ context.Context, flashSaleID, userID int64, shards, quantity int) (*ShardDeductResult, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.stock[flashSaleID] < quantity {
+		return shardResult(false, -1), nil
+	}
+	m.stock[flashSaleID] -= quantity
+	return shardResult(true, utils.ShardIndex(userID, shards)), nil
+}
+
+// ReleaseShard 歸還分片活動庫存
+func (m *MemoryStockStore) ReleaseShard(_ context.Context, flashSaleID int64, _, quantity int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.stock[flashSaleID] += quantity
+	return nil
+}
+
+// SetMeta 寫入准入檢查使用的活動中繼資料（對應 Redis 中繼資料 Hash）
+func (m *MemoryStockStore) SetMeta(flashSale *model.FlashSale) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.meta[flashSale.ID] = memoryAdmitMeta{
+		status:       flashSale.Status,
+		startTime:    flashSale.StartTime,
+		endTime:      flashSale.EndTime,
+		perUserLimit: flashSale.PerUserLimit,
+	}
+}
+
+// DeleteMeta 刪除活動中繼資料，之後的准入返回 AdmitMetaMissing
+func (m *MemoryStockStore) DeleteMeta(flashSaleID int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.meta, flashSaleID)
+}
+
+// GetStock 查詢活動庫存，未初始化視為 0
+func (m *MemoryStockStore) GetStock(_ context.Context, flashSaleID int64) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.stock[flashSaleID], nil
+}
+
+// Deduct 扣減庫存，檢查順序與 DeductStockScript 相同：活動庫存 → 規格庫存 → 限購
+func (m *MemoryStockStore) Deduct(_ context.Context, req *DeductRequest) (*DeductResult, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stock := m.stock[req.FlashSaleID]
+	if stock < req.Quantity {
+		return &DeductResult{Code: -1, Message: "库存不足", Remaining: stock}, nil
+	}
+	if req.ItemID > 0 && m.items[req.FlashSaleID][req.ItemID] < req.Quantity {
+		return &DeductResult{Code: -1, Message: "库存不足", Remaining: stock}, nil
+	}
+
+	bought := m.boughtOf(req.FlashSaleID)
+	if bought[req.UserID]+req.Quantity > req.Limit {
+		return &DeductResult{Code: -2, Message: "超出限购数量", Remaining: stock}, nil
+	}
+
+	m.stock[req.FlashSaleID] = stock - req.Quantity
+	if req.ItemID > 0 {
+		m.items[req.FlashSaleID][req.ItemID] -= req.Quantity
+	}
+	bought[req.UserID] += req.Quantity
+	if req.Payload != "" {
+		m.outbox[req.FlashSaleID] = append(m.outbox[req.FlashSaleID], req.Payload)
+	}
+
+	return &DeductResult{Success: true, Code: 1, Message: "success", Remaining: stock - req.Quantity}, nil
+}
+
+// Admit 准入檢查與扣減，檢查順序與 AdmitScript 相同：中繼資料 → 時間 → 狀態 → 查重 → 限購 → 庫存
+func (m *MemoryStockStore) Admit(_ context.Context, req *AdmitRequest) (*AdmitResult, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	meta, ok := m.meta[req.FlashSaleID]
+	if !ok {
+		return &AdmitResult{Code: AdmitMetaMissing, Message: "活动信息未加载"}, nil
+	}
+
+	stock := 0
+	if !req.StockTaken {
+		stock = m.stock[req.FlashSaleID]
+	}
+	reject := func(code AdmitCode, message string) (*AdmitResult, error) {
+		return &AdmitResult{Code: code, Message: message, Remaining: stock}, nil
+	}
+
+	now := time.Now()
+	if now.Before(meta.startTime) {
+		return reject(AdmitNotStarted, "秒杀活动尚未开始")
+	}
+	if now.After(meta.endTime) {
+		return reject(AdmitEnded, "秒杀活动已结束")
+	}
+	if meta.status != model.FlashSaleStatusActive {
+		return reject(AdmitNotActive, "秒杀活动未开放")
+	}
+
+	bought := m.boughtOf(req.FlashSaleID)
+	if bought[req.UserID] > 0 {
+		return reject(AdmitAlreadyPurchased, "您已参与过本次秒杀")
+	}
+	if req.Quantity > meta.perUserLimit {
+		return reject(AdmitLimitExceeded, "超出限购数量")
+	}
+
+	if !req.StockTaken {
+		if stock < req.Quantity {
+			return reject(AdmitSoldOut, "库存不足")
+		}
+		if req.ItemID > 0 {
+			if m.items[req.FlashSaleID][req.ItemID] < req.Quantity {
+				return reject(AdmitSoldOut, "库存不足")
+			}
+			m.items[req.FlashSaleID][req.ItemID] -= req.Quantity
+		}
+		stock -= req.Quantity
+		m.stock[req.FlashSaleID] = stock
+	}
+
+	bought[req.UserID] += req.Quantity
+	m.outbox[req.FlashSaleID] = append(m.outbox[req.FlashSaleID], req.Payload)
+	return &AdmitResult{Code: AdmitOK, Message: "success", Remaining: stock}, nil
+}
+
+// boughtOf 取得活動的已購數量表，不存在時建立（呼叫端需持有鎖）
+func (m *MemoryStockStore) boughtOf(flashSaleID int64) map[int64]int {
+	bought := m.bought[flashSaleID]
+	if bought == nil {
+		bought = make(map[int64]int)
+		m.bought[flashSaleID] = bought
+	}
+	return bought
+}
+
+// Restore 恢復庫存，已購數量足夠時才回滾（與 RestoreStockScript 相同）
+func (m *MemoryStockStore) Restore(_ context.Context, req *RestoreRequest) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.stock[req.FlashSaleID] += req.Quantity
+	if req.ItemID > 0 {
+		m.setItemStock(req.FlashSaleID, req.ItemID, m.items[req.FlashSaleID][req.ItemID]+req.Quantity)
+	}
+	if bought := m.bought[req.FlashSaleID]; bought != nil && bought[req.UserID] >= req.Quantity {
+		bought[req.UserID] -= req.Quantity
+	}
+	return nil
+}
+
+// ItemStock 查詢規格庫存
+func (m *MemoryStockStore) ItemStock(flashSaleID, itemID int64) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.items[flashSaleID][itemID]
+}
+
+// Bought 查詢使用者已購數量
+func (m *MemoryStockStore) Bought(flashSaleID, userID int64) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.bought[flashSaleID][userID]
+}
+
+// Outbox 取得活動已寫入的訂單訊息（副本）
+func (m *MemoryStockStore) Outbox(flashSaleID int64) []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return append([]string(nil), m.outbox[flashSaleID]...)
+}
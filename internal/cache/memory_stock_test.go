@@ -0,0 +1,242 @@
+// 行程內庫存後端單元測試
+//
+// 測試覆蓋：
+// - Deduct: 成功扣減、庫存不足、規格庫存不足、超出限購、Outbox 寫入
+// - Admit: 與 AdmitScript 相同的檢查順序（中繼資料、時間、狀態、查重、限購、庫存）、StockTaken 只驗證不扣減
+// - Restore: 恢復活動與規格庫存、已購數量回滾、已購不足時不回滾
+// - 併發扣減不超賣
+package cache
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Mag1cFall/magtrade/internal/model"
+)
+
+func TestMemoryStockStore_Deduct(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name     string
+		stock    int
+		item     int // 規格庫存，0 表示單規格
+		bought   int // 扣減前已購數量
+		quantity int
+		limit    int
+		wantCode int
+		wantLeft int
+	}{
+		{"success", 10, 0, 0, 2, 5, 1, 8},
+		{"exact stock", 2, 0, 0, 2, 5, 1, 0},
+		{"insufficient", 1, 0, 0, 2, 5, -1, 1},
+		{"item insufficient", 10, 1, 0, 2, 5, -1, 10},
+		{"item success", 10, 3, 0, 2, 5, 1, 8},
+		{"limit exceeded", 10, 0, 1, 1, 1, -2, 10},
+		{"stock checked before limit", 0, 0, 5, 1, 1, -1, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewMemoryStockStore()
+			_ = m.InitStock(ctx, 1, tt.stock+tt.bought)
+
+			var itemID int64
+			if tt.item > 0 {
+				itemID = 7
+				_ = m.SetItemStock(ctx, 1, itemID, tt.item+tt.bought, 0)
+			}
+			if tt.bought > 0 {
+				if res, _ := m.Deduct(ctx, &DeductRequest{FlashSaleID: 1, UserID: 100, ItemID: itemID, Quantity: tt.bought, Limit: tt.bought}); !res.Success {
+					t.Fatalf("setup deduct failed: %+v", res)
+				}
+			}
+
+			res, err := m.Deduct(ctx, &DeductRequest{
+				FlashSaleID: 1,
+				UserID:      100,
+				ItemID:      itemID,
+				Quantity:    tt.quantity,
+				Limit:       tt.limit,
+				Payload:     "order",
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.Code != tt.wantCode || res.Success != (tt.wantCode == 1) {
+				t.Errorf("Deduct() code = %d success = %v, want %d", res.Code, res.Success, tt.wantCode)
+			}
+			if res.Remaining != tt.wantLeft {
+				t.Errorf("Deduct() remaining = %d, want %d", res.Remaining, tt.wantLeft)
+			}
+			if got, _ := m.GetStock(ctx, 1); got != tt.wantLeft {
+				t.Errorf("GetStock() = %d, want %d", got, tt.wantLeft)
+			}
+
+			wantOutbox := 0
+			if tt.wantCode == 1 {
+				wantOutbox = 1
+			}
+			if got := len(m.Outbox(1)); got != wantOutbox {
+				t.Errorf("outbox size = %d, want %d", got, wantOutbox)
+			}
+		})
+	}
+}
+
+func TestMemoryStockStore_Admit(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+
+	tests := []struct {
+		name       string
+		meta       *model.FlashSale // nil 表示中繼資料未載入
+		bought     bool             // 使用者已參與
+		item       int              // 規格庫存，0 表示單規格
+		quantity   int
+		stockTaken bool
+		wantCode   AdmitCode
+		wantLeft   int
+	}{
+		{"success", activeMeta(now), false, 0, 1, false, AdmitOK, 4},
+		{"meta missing", nil, false, 0, 1, false, AdmitMetaMissing, 5},
+		{"not started", &model.FlashSale{ID: 1, Status: model.FlashSaleStatusActive, PerUserLimit: 2, StartTime: now.Add(time.Minute), EndTime: now.Add(time.Hour)}, false, 0, 1, false, AdmitNotStarted, 5},
+		{"ended", &model.FlashSale{ID: 1, Status: model.FlashSaleStatusActive, PerUserLimit: 2, StartTime: now.Add(-time.Hour), EndTime: now.Add(-time.Minute)}, false, 0, 1, false, AdmitEnded, 5},
+		{"paused", &model.FlashSale{ID: 1, Status: model.FlashSaleStatusPaused, PerUserLimit: 2, StartTime: now.Add(-time.Minute), EndTime: now.Add(time.Hour)}, false, 0, 1, false, AdmitNotActive, 5},
+		{"already purchased", activeMeta(now), true, 0, 1, false, AdmitAlreadyPurchased, 5},
+		{"limit exceeded", activeMeta(now), false, 0, 3, false, AdmitLimitExceeded, 5},
+		{"sold out", &model.FlashSale{ID: 1, Status: model.FlashSaleStatusActive, PerUserLimit: 10, StartTime: now.Add(-time.Minute), EndTime: now.Add(time.Hour)}, false, 0, 6, false, AdmitSoldOut, 5},
+		{"item sold out", activeMeta(now), false, 1, 2, false, AdmitSoldOut, 5},
+		{"item success", activeMeta(now), false, 2, 2, false, AdmitOK, 3},
+		{"stock taken", activeMeta(now), false, 0, 1, true, AdmitOK, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewMemoryStockStore()
+			_ = m.InitStock(ctx, 1, 5)
+			if tt.meta != nil {
+				m.SetMeta(tt.meta)
+			}
+			if tt.bought {
+				_ = m.RestoreBought(ctx, 1, map[int64]int{100: 1}, 0)
+			}
+
+			var itemID int64
+			if tt.item > 0 {
+				itemID = 7
+				_ = m.SetItemStock(ctx, 1, itemID, tt.item, 0)
+			}
+
+			res, err := m.Admit(ctx, &AdmitRequest{
+				FlashSaleID: 1,
+				UserID:      100,
+				ItemID:      itemID,
+				Quantity:    tt.quantity,
+				Payload:     "order",
+				StockTaken:  tt.stockTaken,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.Code != tt.wantCode {
+				t.Errorf("Admit() code = %d, want %d", res.Code, tt.wantCode)
+			}
+			if tt.wantCode != AdmitMetaMissing && res.Remaining != tt.wantLeft {
+				t.Errorf("Admit() remaining = %d, want %d", res.Remaining, tt.wantLeft)
+			}
+
+			wantOutbox, wantBought := 0, 0
+			if tt.wantCode == AdmitOK {
+				wantOutbox, wantBought = 1, tt.quantity
+			}
+			if tt.bought {
+				wantBought = 1
+			}
+			if got := len(m.Outbox(1)); got != wantOutbox {
+				t.Errorf("outbox size = %d, want %d", got, wantOutbox)
+			}
+			if got := m.Bought(1, 100); got != wantBought {
+				t.Errorf("bought = %d, want %d", got, wantBought)
+			}
+		})
+	}
+}
+
+// activeMeta 進行中、每人限購 2 件的活動
+func activeMeta(now time.Time) *model.FlashSale {
+	return &model.FlashSale{
+		ID:           1,
+		Status:       model.FlashSaleStatusActive,
+		PerUserLimit: 2,
+		StartTime:    now.Add(-time.Minute),
+		EndTime:      now.Add(time.Hour),
+	}
+}
+
+func TestMemoryStockStore_Restore(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemoryStockStore()
+	_ = m.InitStock(ctx, 1, 5)
+	_ = m.SetItemStock(ctx, 1, 7, 5, 0)
+
+	if res, _ := m.Deduct(ctx, &DeductRequest{FlashSaleID: 1, UserID: 100, ItemID: 7, Quantity: 2, Limit: 2}); !res.Success {
+		t.Fatalf("Deduct() failed: %+v", res)
+	}
+	if err := m.Restore(ctx, &RestoreRequest{FlashSaleID: 1, UserID: 100, ItemID: 7, Quantity: 2}); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, _ := m.GetStock(ctx, 1); got != 5 {
+		t.Errorf("stock after restore = %d, want 5", got)
+	}
+	if got := m.ItemStock(1, 7); got != 5 {
+		t.Errorf("item stock after restore = %d, want 5", got)
+	}
+	if got := m.Bought(1, 100); got != 0 {
+		t.Errorf("bought after restore = %d, want 0", got)
+	}
+
+	// 已購數量不足時只恢復庫存
+	if err := m.Restore(ctx, &RestoreRequest{FlashSaleID: 1, UserID: 200, Quantity: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := m.GetStock(ctx, 1); got != 6 {
+		t.Errorf("stock after unmatched restore = %d, want 6", got)
+	}
+	if got := m.Bought(1, 200); got != 0 {
+		t.Errorf("bought after unmatched restore = %d, want 0", got)
+	}
+}
+
+func TestMemoryStockStore_ConcurrentDeduct(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemoryStockStore()
+	_ = m.InitStock(ctx, 1, 50)
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	success := 0
+	for i := 0; i < 200; i++ {
+		wg.Add(1)
+		go func(userID int64) {
+			defer wg.Done()
+			res, err := m.Deduct(ctx, &DeductRequest{FlashSaleID: 1, UserID: userID, Quantity: 1, Limit: 1})
+			if err == nil && res.Success {
+				mu.Lock()
+				success++
+				mu.Unlock()
+			}
+		}(int64(i))
+	}
+	wg.Wait()
+
+	if success != 50 {
+		t.Errorf("successful deducts = %d, want 50", success)
+	}
+	if got, _ := m.GetStock(ctx, 1); got != 0 {
+		t.Errorf("stock = %d, want 0", got)
+	}
+}
@@ -0,0 +1,68 @@
+// 訂單到期佇列
+//
+// 本檔案以 Redis ZSET 實作待付款訂單的延遲佇列，分數為付款截止時間（毫秒）
+// 下單時加入佇列，Worker 每秒領取已到期的訂單逐筆取消，處理完成後移除
+// 領取時將分數延後一段租約時間，Worker 中斷或處理失敗的訂單會在租約到期後重試
+// 佇列遺失（Redis 清空）時由 DB 定時掃描兜底
+package cache
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// OrderExpiryKey 訂單到期佇列 Key
+const OrderExpiryKey = "order:expiry"
+
+// OrderExpiryQueue 訂單到期佇列
+type OrderExpiryQueue struct {
+	rdb redis.UniversalClient
+}
+
+func NewOrderExpiryQueue() *OrderExpiryQueue {
+	return &OrderExpiryQueue{rdb: Get()}
+}
+
+// Schedule 將訂單加入到期佇列，已存在時更新到期時間
+func (q *OrderExpiryQueue) Schedule(ctx context.Context, orderID int64, expiresAt time.Time) error {
+	return q.rdb.ZAdd(ctx, OrderExpiryKey, redis.Z{
+		Score:  float64(expiresAt.UnixMilli()),
+		Member: orderID,
+	}).Err()
+}
+
+// Claim 領取最多 limit 筆已到期的訂單，並在 lease 時間內不再被其他呼叫領取
+func (q *OrderExpiryQueue) Claim(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]int64, error) {
+	res, err := q.rdb.Eval(ctx, OrderExpiryClaimScript, []string{OrderExpiryKey},
+		now.UnixMilli(), now.Add(lease).UnixMilli(), limit,
+	).StringSlice()
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]int64, 0, len(res))
+	for _, v := range res {
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			continue
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// Remove 將訂單移出到期佇列（已取消、已付款或不存在）
+func (q *OrderExpiryQueue) Remove(ctx context.Context, orderIDs ...int64) error {
+	if len(orderIDs) == 0 {
+		return nil
+	}
+
+	members := make([]interface{}, len(orderIDs))
+	for i, id := range orderIDs {
+		members[i] = id
+	}
+	return q.rdb.ZRem(ctx, OrderExpiryKey, members...).Err()
+}
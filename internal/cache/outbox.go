@@ -0,0 +1,149 @@
+// 秒殺訂單 Outbox
+//
+// 本檔案提供基於 Redis Stream 的交易式 Outbox
+// 扣減庫存時由 Lua 腳本同步寫入 Stream，再由 Relay 讀出並投遞至 Kafka
+// 使用消費者群組（Consumer Group）追蹤處理進度，崩潰遺留的訊息會被重新認領
+// Stream 不存在時由扣減腳本在 XADD 前建立消費者群組，並由呼叫端加入註冊表；預熱時再次檢查群組與註冊表
+// Stream 不設 TTL，Relay 在 Stream 清空且閒置一段時間後才刪除
+package cache
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	OutboxRegistryKey = "flash:outbox:streams" // 已註冊的 Outbox Stream 集合
+	OutboxGroup       = "outbox-relay"         // Relay 消費者群組名稱
+	outboxPayload     = "payload"              // Stream 訊息欄位名稱
+)
+
+// OutboxKey 生成 Outbox Stream Key，格式: flash:outbox:{活動ID}
+func OutboxKey(flashSaleID int64) string {
+	return fmt.Sprintf("flash:outbox:{%d}", flashSaleID)
+}
+
+// OutboxEntry Outbox 中的一筆待投遞訊息
+type OutboxEntry struct {
+	Stream  string
+	ID      string
+	Payload string
+}
+
+// OutboxService Outbox 讀寫服務
+type OutboxService struct {
+	rdb redis.UniversalClient
+}
+
+func NewOutboxService() *OutboxService {
+	return &OutboxService{rdb: Get()}
+}
+
+// Register 檢查活動的 Outbox Stream：Stream 已存在時補建消費者群組並加入註冊表（活動建立與預熱時呼叫）
+// Stream 不存在時不建立，第一筆訊息寫入時由扣減腳本建立並註冊
+func (s *OutboxService) Register(ctx context.Context, flashSaleID int64) error {
+	key := OutboxKey(flashSaleID)
+
+	exists, err := s.rdb.Eval(ctx, OutboxEnsureGroupScript, []string{key}, OutboxGroup).Int()
+	if err != nil {
+		return fmt.Errorf("failed to ensure outbox group: %w", err)
+	}
+	if exists == 0 {
+		return nil
+	}
+	return registerOutbox(ctx, s.rdb, flashSaleID)
+}
+
+// registerOutbox 將 Stream 加入註冊表（SADD 可重複執行）
+// Stream 與註冊表位於不同 slot，不能與扣減腳本合併；失敗時由下次預熱的 Register 補上
+func registerOutbox(ctx context.Context, rdb redis.UniversalClient, flashSaleID int64) error {
+	return rdb.SAdd(ctx, OutboxRegistryKey, OutboxKey(flashSaleID)).Err()
+}
+
+// Streams 列出所有已註冊的 Outbox Stream
+func (s *OutboxService) Streams(ctx context.Context) ([]string, error) {
+	return s.rdb.SMembers(ctx, OutboxRegistryKey).Result()
+}
+
+// Prune 刪除已清空且閒置超過 idle 的 Stream 並移除註冊，返回 true 表示已移除
+// 刪除與移除註冊之間被重建的 Stream 由下次預熱的 Register 補回註冊
+func (s *OutboxService) Prune(ctx context.Context, stream string, idle time.Duration) (bool, error) {
+	removed, err := s.rdb.Eval(ctx, OutboxPruneScript, []string{stream}, idle.Milliseconds()).Int()
+	if err != nil {
+		return false, err
+	}
+	if removed == 0 {
+		return false, nil
+	}
+	return true, s.rdb.SRem(ctx, OutboxRegistryKey, stream).Err()
+}
+
+// Pending 統計活動 Outbox 中尚未投遞確認的訊息數量
+func (s *OutboxService) Pending(ctx context.Context, flashSaleID int64) (int64, error) {
+	return s.rdb.XLen(ctx, OutboxKey(flashSaleID)).Result()
+}
+
+// Claim 認領閒置過久的未確認訊息（處理其他 Relay 崩潰遺留的訊息）
+func (s *OutboxService) Claim(ctx context.Context, stream, consumer string, minIdle time.Duration, count int64) ([]OutboxEntry, error) {
+	msgs, _, err := s.rdb.XAutoClaim(ctx, &redis.XAutoClaimArgs{
+		Stream:   stream,
+		Group:    OutboxGroup,
+		Consumer: consumer,
+		MinIdle:  minIdle,
+		Start:    "0-0",
+		Count:    count,
+	}).Result()
+	if err != nil {
+		return nil, err
+	}
+	return toOutboxEntries(stream, msgs), nil
+}
+
+// Read 讀取尚未分派給任何 Relay 的新訊息（非阻塞）
+func (s *OutboxService) Read(ctx context.Context, stream, consumer string, count int64) ([]OutboxEntry, error) {
+	res, err := s.rdb.XReadGroup(ctx, &redis.XReadGroupArgs{
+		Group:    OutboxGroup,
+		Consumer: consumer,
+		Streams:  []string{stream, ">"},
+		Count:    count,
+		Block:    -1, // 負值表示不阻塞
+	}).Result()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []OutboxEntry
+	for _, st := range res {
+		entries = append(entries, toOutboxEntries(st.Stream, st.Messages)...)
+	}
+	return entries, nil
+}
+
+// Ack 確認訊息已投遞並從 Stream 刪除
+func (s *OutboxService) Ack(ctx context.Context, entry OutboxEntry) error {
+	pipe := s.rdb.TxPipeline()
+	pipe.XAck(ctx, entry.Stream, OutboxGroup, entry.ID)
+	pipe.XDel(ctx, entry.Stream, entry.ID)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// toOutboxEntries 將 Stream 訊息轉為 OutboxEntry
+func toOutboxEntries(stream string, msgs []redis.XMessage) []OutboxEntry {
+	entries := make([]OutboxEntry, 0, len(msgs))
+	for _, m := range msgs {
+		payload, _ := m.Values[outboxPayload].(string)
+		entries = append(entries, OutboxEntry{
+			Stream:  stream,
+			ID:      m.ID,
+			Payload: payload,
+		})
+	}
+	return entries
+}
@@ -0,0 +1,185 @@
+// Outbox 整合測試
+//
+// 測試覆蓋：
+// - 准入腳本在 Stream 不存在時與 XADD 一同建立消費者群組並註冊，Stream 過期或被清空後仍可投遞
+// - Register 補建遺失的消費者群組與註冊，並移除 TTL；Stream 不存在時不建立
+// - Prune 只刪除已清空且閒置的 Stream
+// 需要可用的 Redis：REDIS_TEST_ADDR=127.0.0.1:6379 go test -run Outbox ./internal/cache/
+package cache
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const testOutboxSaleID int64 = 900000101
+
+// setupTestOutbox 寫入進行中活動的中繼資料與庫存，結束後清除測試 Key
+func setupTestOutbox(t *testing.T) context.Context {
+	t.Helper()
+	ctx := setupTestRedis(t)
+
+	cleanup := func() {
+		iter := rdb.Scan(ctx, 0, fmt.Sprintf("flash:bought:{%d}:*", testOutboxSaleID), 1000).Iterator()
+		for iter.Next(ctx) {
+			rdb.Del(ctx, iter.Val())
+		}
+		rdb.Del(ctx, FlashSaleMetaKey(testOutboxSaleID), StockKey(testOutboxSaleID), OutboxKey(testOutboxSaleID))
+		rdb.SRem(ctx, OutboxRegistryKey, OutboxKey(testOutboxSaleID))
+	}
+	cleanup()
+	t.Cleanup(cleanup)
+
+	now := time.Now()
+	if err := rdb.HSet(ctx, FlashSaleMetaKey(testOutboxSaleID), map[string]interface{}{
+		"status":         1,
+		"start_ms":       now.Add(-time.Minute).UnixMilli(),
+		"end_ms":         now.Add(time.Hour).UnixMilli(),
+		"per_user_limit": 1,
+	}).Err(); err != nil {
+		t.Fatal(err)
+	}
+	if err := rdb.Set(ctx, StockKey(testOutboxSaleID), 100, time.Hour).Err(); err != nil {
+		t.Fatal(err)
+	}
+	return ctx
+}
+
+// assertOutboxReady 檢查 Stream 具有消費者群組、已註冊且未設 TTL
+func assertOutboxReady(t *testing.T, ctx context.Context) {
+	t.Helper()
+	key := OutboxKey(testOutboxSaleID)
+
+	groups, err := rdb.XInfoGroups(ctx, key).Result()
+	if err != nil {
+		t.Fatalf("XINFO GROUPS error = %v", err)
+	}
+	if len(groups) != 1 || groups[0].Name != OutboxGroup {
+		t.Errorf("groups = %+v, want [%s]", groups, OutboxGroup)
+	}
+	if ok, _ := rdb.SIsMember(ctx, OutboxRegistryKey, key).Result(); !ok {
+		t.Error("stream not registered")
+	}
+	if ttl, _ := rdb.TTL(ctx, key).Result(); ttl != -1 {
+		t.Errorf("stream ttl = %v, want none", ttl)
+	}
+}
+
+func TestOutbox_AdmitRecreatesStream(t *testing.T) {
+	ctx := setupTestOutbox(t)
+	stock := NewStockService()
+	outbox := NewOutboxService()
+	key := OutboxKey(testOutboxSaleID)
+
+	admit := func(userID int64) {
+		t.Helper()
+		res, err := stock.Admit(ctx, &AdmitRequest{
+			FlashSaleID: testOutboxSaleID,
+			UserID:      userID,
+			Quantity:    1,
+			Payload:     fmt.Sprintf("order-%d", userID),
+			Retention:   time.Hour,
+		})
+		if err != nil || res.Code != AdmitOK {
+			t.Fatalf("Admit() = %+v, %v", res, err)
+		}
+	}
+
+	admit(1)
+	assertOutboxReady(t, ctx)
+
+	// Stream 過期或被清空：下一筆准入重建群組與註冊，訊息仍可被 Relay 讀取
+	rdb.Del(ctx, key)
+	rdb.SRem(ctx, OutboxRegistryKey, key)
+	admit(2)
+	assertOutboxReady(t, ctx)
+
+	entries, err := outbox.Read(ctx, key, "test-relay", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Payload != "order-2" {
+		t.Errorf("entries = %+v, want [order-2]", entries)
+	}
+}
+
+func TestOutbox_Register(t *testing.T) {
+	ctx := setupTestOutbox(t)
+	outbox := NewOutboxService()
+	key := OutboxKey(testOutboxSaleID)
+
+	// Stream 不存在時不建立
+	if err := outbox.Register(ctx, testOutboxSaleID); err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := rdb.Exists(ctx, key).Result(); n != 0 {
+		t.Error("Register() created missing stream")
+	}
+
+	// 群組與註冊遺失、帶有舊版 TTL 的 Stream
+	rdb.XAdd(ctx, &redis.XAddArgs{Stream: key, Values: map[string]interface{}{outboxPayload: "legacy"}})
+	rdb.Expire(ctx, key, time.Hour)
+	if err := outbox.Register(ctx, testOutboxSaleID); err != nil {
+		t.Fatal(err)
+	}
+	assertOutboxReady(t, ctx)
+
+	// 群組從 0 開始讀取，補建前寫入的訊息也會被投遞
+	entries, err := outbox.Read(ctx, key, "test-relay", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Payload != "legacy" {
+		t.Errorf("entries = %+v, want [legacy]", entries)
+	}
+
+	// 重複註冊冪等
+	if err := outbox.Register(ctx, testOutboxSaleID); err != nil {
+		t.Fatal(err)
+	}
+	assertOutboxReady(t, ctx)
+}
+
+func TestOutbox_Prune(t *testing.T) {
+	ctx := setupTestOutbox(t)
+	stock := NewStockService()
+	outbox := NewOutboxService()
+	key := OutboxKey(testOutboxSaleID)
+
+	if _, err := stock.Admit(ctx, &AdmitRequest{FlashSaleID: testOutboxSaleID, UserID: 1, Quantity: 1, Payload: "order-1"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// 尚有未投遞訊息
+	if pruned, err := outbox.Prune(ctx, key, 0); err != nil || pruned {
+		t.Fatalf("Prune() with pending entries = %v, %v", pruned, err)
+	}
+
+	entries, err := outbox.Read(ctx, key, "test-relay", 10)
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("Read() = %+v, %v", entries, err)
+	}
+	if err := outbox.Ack(ctx, entries[0]); err != nil {
+		t.Fatal(err)
+	}
+
+	// 已清空但仍在閒置時間內
+	if pruned, err := outbox.Prune(ctx, key, time.Hour); err != nil || pruned {
+		t.Fatalf("Prune() within idle = %v, %v", pruned, err)
+	}
+
+	pruned, err := outbox.Prune(ctx, key, 0)
+	if err != nil || !pruned {
+		t.Fatalf("Prune() after idle = %v, %v", pruned, err)
+	}
+	if n, _ := rdb.Exists(ctx, key).Result(); n != 0 {
+		t.Error("pruned stream still exists")
+	}
+	if ok, _ := rdb.SIsMember(ctx, OutboxRegistryKey, key).Result(); ok {
+		t.Error("pruned stream still registered")
+	}
+}
@@ -0,0 +1,156 @@
+// 跨活動限購計數器
+//
+// 本檔案以 Redis 計數器記錄使用者在限購策略週期內的購買數量
+// 計數器跨活動累計，以使用者為 hash tag，與以活動為 hash tag 的准入腳本位於不同 slot，採兩階段預扣：
+// 預扣時在計數器旁的暫扣 Hash 寫入帶到期時間的暫扣（Field 為搶購憑證），檢查上限時計入未到期的暫扣；
+// 准入成功後確認（刪除暫扣並累加計數器），被拒絕時直接刪除暫扣
+// 准入腳本執行失敗或實例崩潰時不需要歸還：暫扣到期後不再計入，也不會留下多計的計數器
+// 預扣腳本對同一使用者的所有計數器原子檢查並暫扣，任一超限則全部不暫扣
+package cache
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// PurchaseLimitKey 生成限購計數器 Key，格式: flash:limit:{u使用者ID}:{策略ID}:{週期標識}
+func PurchaseLimitKey(userID, policyID int64, period string) string {
+	return fmt.Sprintf("flash:limit:{u%d}:%d:%s", userID, policyID, period)
+}
+
+// PurchaseLimitHoldKey 生成計數器的暫扣 Hash Key（與計數器同一 slot），格式: {計數器 Key}:hold
+func PurchaseLimitHoldKey(counterKey string) string {
+	return counterKey + ":hold"
+}
+
+// LimitCharge 單一計數器的預扣參數
+type LimitCharge struct {
+	Key string
+	Max int           // 週期內購買上限
+	TTL time.Duration // 計數器存活時間，已有更長 TTL 時保留
+}
+
+// LimitCounter 計數器當前狀態
+type LimitCounter struct {
+	Used int
+	TTL  time.Duration // 剩餘存活時間，計數器不存在時為 0
+}
+
+// LimitCounterService 限購計數器服務
+type LimitCounterService struct {
+	rdb redis.UniversalClient
+}
+
+func NewLimitCounterService() *LimitCounterService {
+	return &LimitCounterService{rdb: Get()}
+}
+
+// Reserve 以搶購憑證暫扣計數器，暫扣於 holdTTL 後到期；返回超出上限的計數器索引，-1 表示全部暫扣成功
+// 所有 charges 必須屬於同一使用者
+func (s *LimitCounterService) Reserve(ctx context.Context, charges []LimitCharge, quantity int, ticket string, holdTTL time.Duration) (int, error) {
+	if len(charges) == 0 {
+		return -1, nil
+	}
+
+	args := make([]interface{}, 0, 4+len(charges))
+	args = append(args, quantity, ticket, time.Now().UnixMilli(), holdTTL.Milliseconds())
+	for _, charge := range charges {
+		args = append(args, charge.Max)
+	}
+
+	exceeded, err := s.rdb.Eval(ctx, LimitReserveScript, limitChargeKeys(charges), args...).Int()
+	if err != nil {
+		return -1, fmt.Errorf("failed to execute limit reserve script: %w", err)
+	}
+	return exceeded - 1, nil
+}
+
+// Confirm 准入成功後確認暫扣：刪除暫扣並累加計數器
+// 暫扣已到期時不累加（重複確認也不重複累加），短少的計數由庫存對帳依訂單補足
+func (s *LimitCounterService) Confirm(ctx context.Context, charges []LimitCharge, quantity int, ticket string) error {
+	if len(charges) == 0 {
+		return nil
+	}
+
+	args := make([]interface{}, 0, 2+len(charges))
+	args = append(args, quantity, ticket)
+	for _, charge := range charges {
+		args = append(args, int(charge.TTL.Seconds()))
+	}
+	return s.rdb.Eval(ctx, LimitConfirmScript, limitChargeKeys(charges), args...).Err()
+}
+
+// Cancel 准入被拒絕時刪除暫扣
+func (s *LimitCounterService) Cancel(ctx context.Context, charges []LimitCharge, ticket string) error {
+	if len(charges) == 0 {
+		return nil
+	}
+
+	_, err := s.rdb.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, charge := range charges {
+			pipe.HDel(ctx, PurchaseLimitHoldKey(charge.Key), ticket)
+		}
+		return nil
+	})
+	return err
+}
+
+// Release 歸還計數器（訂單取消時使用），所有 keys 必須屬於同一使用者
+func (s *LimitCounterService) Release(ctx context.Context, keys []string, quantity int) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	return s.rdb.Eval(ctx, LimitReleaseScript, keys, quantity).Err()
+}
+
+// limitChargeKeys 依序排列每個計數器與其暫扣 Hash 的 Key
+func limitChargeKeys(charges []LimitCharge) []string {
+	keys := make([]string, 0, len(charges)*2)
+	for _, charge := range charges {
+		keys = append(keys, charge.Key, PurchaseLimitHoldKey(charge.Key))
+	}
+	return keys
+}
+
+// CompareAndSet 計數器仍為 expected 時修正為 value（0 時刪除），返回 false 表示期間已變更
+func (s *LimitCounterService) CompareAndSet(ctx context.Context, key string, expected, value int, ttl time.Duration) (bool, error) {
+	ok, err := s.rdb.Eval(ctx, LimitCompareAndSetScript, []string{key}, expected, value, int(ttl.Seconds())).Int()
+	if err != nil {
+		return false, err
+	}
+	return ok == 1, nil
+}
+
+// Counters 查詢計數器當前值與剩餘 TTL（管理介面與對帳使用）
+func (s *LimitCounterService) Counters(ctx context.Context, keys []string) ([]LimitCounter, error) {
+	if len(keys) == 0 {
+		return nil, nil
+	}
+
+	pipe := s.rdb.Pipeline()
+	getCmds := make([]*redis.StringCmd, len(keys))
+	ttlCmds := make([]*redis.DurationCmd, len(keys))
+	for i, key := range keys {
+		getCmds[i] = pipe.Get(ctx, key)
+		ttlCmds[i] = pipe.TTL(ctx, key)
+	}
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, err
+	}
+
+	counters := make([]LimitCounter, len(keys))
+	for i := range keys {
+		used, err := getCmds[i].Int()
+		if err != nil && err != redis.Nil {
+			return nil, err
+		}
+		counters[i].Used = used
+		if ttl := ttlCmds[i].Val(); ttl > 0 {
+			counters[i].TTL = ttl
+		}
+	}
+	return counters, nil
+}
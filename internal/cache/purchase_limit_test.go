@@ -0,0 +1,108 @@
+// 跨活動限購計數器整合測試
+//
+// 測試覆蓋：
+// - 暫扣計入上限檢查，取消後釋出；確認後累加計數器，重複確認不重複累加
+// - 未確認的暫扣到期後不再計入，計數器不變
+// 需要可用的 Redis：REDIS_TEST_ADDR=127.0.0.1:6379 go test -run LimitCounter ./internal/cache/
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+const testLimitUserID int64 = 900000401
+
+// setupTestLimit 清除測試計數器與暫扣，返回單一計數器的預扣參數
+func setupTestLimit(t *testing.T, max int) (context.Context, *LimitCounterService, []LimitCharge) {
+	t.Helper()
+	ctx := setupTestRedis(t)
+
+	key := PurchaseLimitKey(testLimitUserID, 1, "all")
+	cleanup := func() { rdb.Del(ctx, key, PurchaseLimitHoldKey(key)) }
+	cleanup()
+	t.Cleanup(cleanup)
+
+	return ctx, &LimitCounterService{rdb: rdb}, []LimitCharge{{Key: key, Max: max, TTL: time.Minute}}
+}
+
+// reserveLimit 暫扣並返回超限索引
+func reserveLimit(t *testing.T, ctx context.Context, s *LimitCounterService, charges []LimitCharge, quantity int, ticket string, holdTTL time.Duration) int {
+	t.Helper()
+
+	exceeded, err := s.Reserve(ctx, charges, quantity, ticket, holdTTL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return exceeded
+}
+
+// assertLimitUsed 檢查計數器當前值
+func assertLimitUsed(t *testing.T, ctx context.Context, s *LimitCounterService, charges []LimitCharge, want int) {
+	t.Helper()
+
+	counters, err := s.Counters(ctx, []string{charges[0].Key})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if counters[0].Used != want {
+		t.Errorf("counter = %d, want %d", counters[0].Used, want)
+	}
+}
+
+func TestLimitCounter_ReserveConfirmCancel(t *testing.T) {
+	ctx, s, charges := setupTestLimit(t, 2)
+
+	if got := reserveLimit(t, ctx, s, charges, 1, "ticket-a", time.Minute); got != -1 {
+		t.Fatalf("Reserve(a) = %d, want -1", got)
+	}
+	if got := reserveLimit(t, ctx, s, charges, 2, "ticket-b", time.Minute); got != 0 {
+		t.Fatalf("Reserve(b) with a held = %d, want 0", got)
+	}
+	assertLimitUsed(t, ctx, s, charges, 0)
+
+	// 取消暫扣後釋出額度
+	if err := s.Cancel(ctx, charges, "ticket-a"); err != nil {
+		t.Fatal(err)
+	}
+	if got := reserveLimit(t, ctx, s, charges, 2, "ticket-b", time.Minute); got != -1 {
+		t.Fatalf("Reserve(b) after cancel = %d, want -1", got)
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := s.Confirm(ctx, charges, 2, "ticket-b"); err != nil {
+			t.Fatal(err)
+		}
+		assertLimitUsed(t, ctx, s, charges, 2)
+	}
+	if got := reserveLimit(t, ctx, s, charges, 1, "ticket-c", time.Minute); got != 0 {
+		t.Errorf("Reserve(c) after confirm = %d, want 0", got)
+	}
+}
+
+func TestLimitCounter_HoldExpires(t *testing.T) {
+	ctx, s, charges := setupTestLimit(t, 2)
+	const holdTTL = 200 * time.Millisecond
+
+	// 暫扣後准入腳本失敗，未確認也未取消
+	if got := reserveLimit(t, ctx, s, charges, 2, "ticket-a", holdTTL); got != -1 {
+		t.Fatalf("Reserve(a) = %d, want -1", got)
+	}
+	if got := reserveLimit(t, ctx, s, charges, 1, "ticket-b", holdTTL); got != 0 {
+		t.Fatalf("Reserve(b) while a held = %d, want 0", got)
+	}
+
+	time.Sleep(2 * holdTTL)
+
+	if got := reserveLimit(t, ctx, s, charges, 2, "ticket-b", holdTTL); got != -1 {
+		t.Fatalf("Reserve(b) after hold expired = %d, want -1", got)
+	}
+	assertLimitUsed(t, ctx, s, charges, 0)
+
+	// 已到期的暫扣確認時不累加
+	if err := s.Confirm(ctx, charges, 2, "ticket-a"); err != nil {
+		t.Fatal(err)
+	}
+	assertLimitUsed(t, ctx, s, charges, 0)
+}
@@ -0,0 +1,207 @@
+// 秒殺排隊佇列
+//
+// 本檔案提供基於 Redis ZSET 的公平排隊佇列
+// 開啟排隊模式的活動，搶購請求先依到達時間入列，再由 Worker 以固定速率出列扣減庫存
+// 每位使用者在同一活動中只佔一個位置，排名即為真實排隊位置
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// QueueRegistryKey 有排隊請求的活動 ID 集合，供 Worker 巡檢
+// 註冊表與各佇列位於不同 slot，不在腳本內維護：入列後加入、佇列清空時移除後再確認
+const QueueRegistryKey = "flash:queue:active"
+
+// QueueKey 生成排隊 ZSET Key，格式: flash:queue:{活動ID}
+func QueueKey(flashSaleID int64) string {
+	return fmt.Sprintf("flash:queue:{%d}", flashSaleID)
+}
+
+// QueueEntriesKey 生成排隊請求 Hash Key，格式: flash:queue:{活動ID}:entries
+func QueueEntriesKey(flashSaleID int64) string {
+	return fmt.Sprintf("flash:queue:{%d}:entries", flashSaleID)
+}
+
+// QueueRateKey 生成放行計數 Key，格式: flash:queue:{活動ID}:rate
+func QueueRateKey(flashSaleID int64) string {
+	return fmt.Sprintf("flash:queue:{%d}:rate", flashSaleID)
+}
+
+// QueueEntry 排隊中的搶購請求
+type QueueEntry struct {
+	Ticket      string    `json:"ticket"`
+	FlashSaleID int64     `json:"flash_sale_id"`
+	UserID      int64     `json:"user_id"`
+	ItemID      int64     `json:"item_id,omitempty"`
+	Quantity    int       `json:"quantity"`
+	EnqueuedAt  time.Time `json:"enqueued_at"`
+}
+
+// QueueService 排隊佇列服務
+type QueueService struct {
+	rdb redis.UniversalClient
+}
+
+func NewQueueService() *QueueService {
+	return &QueueService{rdb: Get()}
+}
+
+// Enqueue 將搶購請求加入排隊
+// 使用者已在佇列中時返回原請求與目前位置，added 為 false
+// position 從 1 開始
+func (s *QueueService) Enqueue(ctx context.Context, entry *QueueEntry, ttl time.Duration) (*QueueEntry, int, bool, error) {
+	payload, err := json.Marshal(entry)
+	if err != nil {
+		return nil, 0, false, err
+	}
+
+	res, err := s.rdb.Eval(ctx, QueueEnqueueScript,
+		[]string{QueueKey(entry.FlashSaleID), QueueEntriesKey(entry.FlashSaleID)},
+		entry.UserID, string(payload), ttl.Milliseconds(),
+	).Slice()
+	if err != nil {
+		return nil, 0, false, err
+	}
+	if len(res) < 3 {
+		return nil, 0, false, fmt.Errorf("unexpected enqueue result: %v", res)
+	}
+
+	// 入列後才註冊，與 unregisterIfEmpty 的「先移除再確認」搭配，不會遺漏佇列
+	if err := s.rdb.SAdd(ctx, QueueRegistryKey, entry.FlashSaleID).Err(); err != nil {
+		return nil, 0, false, err
+	}
+
+	added, _ := res[0].(int64)
+	rank, _ := res[1].(int64)
+	stored, _ := res[2].(string)
+
+	current := entry
+	if added == 0 && stored != "" {
+		current = &QueueEntry{}
+		if err := json.Unmarshal([]byte(stored), current); err != nil {
+			return nil, 0, false, err
+		}
+	}
+
+	return current, int(rank) + 1, added == 1, nil
+}
+
+// Position 查詢使用者的排隊位置與佇列長度，不在佇列中時 entry 為 nil
+func (s *QueueService) Position(ctx context.Context, flashSaleID, userID int64) (*QueueEntry, int, int64, error) {
+	member := strconv.FormatInt(userID, 10)
+
+	pipe := s.rdb.Pipeline()
+	rankCmd := pipe.ZRank(ctx, QueueKey(flashSaleID), member)
+	lenCmd := pipe.ZCard(ctx, QueueKey(flashSaleID))
+	entryCmd := pipe.HGet(ctx, QueueEntriesKey(flashSaleID), member)
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, 0, 0, err
+	}
+
+	length := lenCmd.Val()
+	rank, err := rankCmd.Result()
+	if err == redis.Nil {
+		return nil, 0, length, nil
+	}
+	if err != nil {
+		return nil, 0, 0, err
+	}
+
+	entry := &QueueEntry{}
+	if payload := entryCmd.Val(); payload != "" {
+		if err := json.Unmarshal([]byte(payload), entry); err != nil {
+			return nil, 0, 0, err
+		}
+	}
+	return entry, int(rank) + 1, length, nil
+}
+
+// Length 查詢佇列長度
+func (s *QueueService) Length(ctx context.Context, flashSaleID int64) (int64, error) {
+	return s.rdb.ZCard(ctx, QueueKey(flashSaleID)).Result()
+}
+
+// Drain 依到達順序出列，受每秒放行數 rate 限制，單次最多 batch 筆
+func (s *QueueService) Drain(ctx context.Context, flashSaleID int64, rate, batch int) ([]QueueEntry, error) {
+	res, err := s.rdb.Eval(ctx, QueueDrainScript,
+		[]string{QueueKey(flashSaleID), QueueEntriesKey(flashSaleID), QueueRateKey(flashSaleID)},
+		rate, batch,
+	).StringSlice()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.unregisterIfEmpty(ctx, flashSaleID); err != nil {
+		return nil, err
+	}
+	return parseQueueEntries(res), nil
+}
+
+// Clear 清空佇列並返回被移除的請求（售罄或活動結束時通知使用者）
+func (s *QueueService) Clear(ctx context.Context, flashSaleID int64) ([]QueueEntry, error) {
+	res, err := s.rdb.Eval(ctx, QueueClearScript,
+		[]string{QueueKey(flashSaleID), QueueEntriesKey(flashSaleID)},
+	).StringSlice()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.unregisterIfEmpty(ctx, flashSaleID); err != nil {
+		return nil, err
+	}
+	return parseQueueEntries(res), nil
+}
+
+// unregisterIfEmpty 佇列已空時從註冊表移除
+// 先移除再確認佇列是否仍為空：期間有新請求入列時重新加入，入列端也會在入列後註冊
+func (s *QueueService) unregisterIfEmpty(ctx context.Context, flashSaleID int64) error {
+	n, err := s.rdb.ZCard(ctx, QueueKey(flashSaleID)).Result()
+	if err != nil || n > 0 {
+		return err
+	}
+	if err := s.rdb.SRem(ctx, QueueRegistryKey, flashSaleID).Err(); err != nil {
+		return err
+	}
+
+	n, err = s.rdb.ZCard(ctx, QueueKey(flashSaleID)).Result()
+	if err != nil || n == 0 {
+		return err
+	}
+	return s.rdb.SAdd(ctx, QueueRegistryKey, flashSaleID).Err()
+}
+
+// ActiveQueues 列出目前有排隊請求的活動 ID
+func (s *QueueService) ActiveQueues(ctx context.Context) ([]int64, error) {
+	members, err := s.rdb.SMembers(ctx, QueueRegistryKey).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]int64, 0, len(members))
+	for _, m := range members {
+		id, err := strconv.ParseInt(m, 10, 64)
+		if err != nil {
+			continue
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// parseQueueEntries 解析請求內容，略過無法解析的項目
+func parseQueueEntries(payloads []string) []QueueEntry {
+	entries := make([]QueueEntry, 0, len(payloads))
+	for _, p := range payloads {
+		var entry QueueEntry
+		if err := json.Unmarshal([]byte(p), &entry); err != nil {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
@@ -1,12 +1,14 @@
 // Redis 客戶端初始化與連線管理
 //
 // 本檔案提供 Redis 連線池的初始化、獲取和關閉功能
-// 使用 go-redis/v9 客戶端，支援連線池和超時配置
+// 使用 go-redis/v9 UniversalClient，依配置支援單節點、Sentinel 與 Cluster 三種部署
+// Cluster 模式下 Lua 腳本的 KEYS 必須位於同一 slot，同一活動的 Key 以 {活動ID} 作為 hash tag
 package cache
 
 import (
 	"context"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/Mag1cFall/magtrade/internal/config"
@@ -14,12 +16,11 @@ import (
 	"go.uber.org/zap"
 )
 
-var rdb *redis.Client // 全域 Redis 客戶端實例
+var rdb redis.UniversalClient // 全域 Redis 客戶端實例
 
 // Init 初始化 Redis 連線池
 func Init(cfg *config.RedisConfig, log *zap.Logger) error {
-	rdb = redis.NewClient(&redis.Options{
-		Addr:         cfg.Addr(),
+	opts := &redis.UniversalOptions{
 		Password:     cfg.Password,
 		DB:           cfg.DB,
 		PoolSize:     cfg.PoolSize, // 連線池大小，生產環境建議 100-200
@@ -27,7 +28,33 @@ func Init(cfg *config.RedisConfig, log *zap.Logger) error {
 		DialTimeout:  5 * time.Second,
 		ReadTimeout:  3 * time.Second,
 		WriteTimeout: 3 * time.Second,
-	})
+	}
+
+	var addrs []string
+	switch cfg.Mode {
+	case config.RedisModeSentinel:
+		if cfg.MasterName == "" || len(cfg.SentinelAddrs) == 0 {
+			return fmt.Errorf("redis sentinel mode requires master_name and sentinel_addrs")
+		}
+		addrs = cfg.SentinelAddrs
+		opts.Addrs = addrs
+		opts.MasterName = cfg.MasterName
+		opts.SentinelPassword = cfg.SentinelPassword
+		rdb = redis.NewFailoverClient(opts.Failover())
+	case config.RedisModeCluster:
+		if len(cfg.ClusterAddrs) == 0 {
+			return fmt.Errorf("redis cluster mode requires cluster_addrs")
+		}
+		addrs = cfg.ClusterAddrs
+		opts.Addrs = addrs
+		rdb = redis.NewClusterClient(opts.Cluster())
+	case "", config.RedisModeSingle:
+		addrs = []string{cfg.Addr()}
+		opts.Addrs = addrs
+		rdb = redis.NewClient(opts.Simple())
+	default:
+		return fmt.Errorf("unknown redis mode: %s", cfg.Mode)
+	}
 
 	// 測試連線是否正常
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
@@ -38,15 +65,24 @@ func Init(cfg *config.RedisConfig, log *zap.Logger) error {
 	}
 
 	log.Info("redis connected",
-		zap.String("addr", cfg.Addr()),
+		zap.String("mode", modeName(cfg.Mode)),
+		zap.String("addrs", strings.Join(addrs, ",")),
 		zap.Int("db", cfg.DB),
 	)
 
 	return nil
 }
 
+// modeName 取得部署模式名稱（空值視為單節點）
+func modeName(mode string) string {
+	if mode == "" {
+		return config.RedisModeSingle
+	}
+	return mode
+}
+
 // Get 取得 Redis 客戶端實例，若未初始化則 panic
-func Get() *redis.Client {
+func Get() redis.UniversalClient {
 	if rdb == nil {
 		panic("redis not initialized, call Init() first")
 	}
@@ -62,6 +98,6 @@ func Close() error {
 }
 
 // GetClient 取得客戶端（Get 的別名，兼容舊代碼）
-func GetClient() *redis.Client {
+func GetClient() redis.UniversalClient {
 	return Get()
 }
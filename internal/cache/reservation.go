@@ -0,0 +1,70 @@
+// 預約名單快取
+//
+// 本檔案以 Redis Set 保存活動的預約使用者，供「僅限預約」活動在搶購時快速判斷
+// Key 缺失（過期或 Redis 重啟）時由呼叫端回退查詢 DB 並重新載入
+package cache
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// ReservedKey 生成預約名單 Key，格式: flash:reserved:{活動ID}
+func ReservedKey(flashSaleID int64) string {
+	return fmt.Sprintf("flash:reserved:{%d}", flashSaleID)
+}
+
+// ReservationCache 預約名單快取
+type ReservationCache struct {
+	rdb redis.UniversalClient
+}
+
+func NewReservationCache() *ReservationCache {
+	return &ReservationCache{rdb: Get()}
+}
+
+// Add 加入預約名單（名單已載入時才寫入，避免只含部分使用者的名單被視為完整）
+func (c *ReservationCache) Add(ctx context.Context, flashSaleID, userID int64) error {
+	return c.rdb.Eval(ctx, ReservedAddScript, []string{ReservedKey(flashSaleID)}, userID).Err()
+}
+
+// Remove 從預約名單移除
+func (c *ReservationCache) Remove(ctx context.Context, flashSaleID, userID int64) error {
+	return c.rdb.SRem(ctx, ReservedKey(flashSaleID), userID).Err()
+}
+
+// IsReserved 判斷使用者是否已預約，loaded 為 false 表示名單未載入，需回退查詢 DB
+func (c *ReservationCache) IsReserved(ctx context.Context, flashSaleID, userID int64) (reserved, loaded bool, err error) {
+	key := ReservedKey(flashSaleID)
+
+	pipe := c.rdb.Pipeline()
+	existsCmd := pipe.Exists(ctx, key)
+	memberCmd := pipe.SIsMember(ctx, key, userID)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return false, false, err
+	}
+
+	return memberCmd.Val(), existsCmd.Val() > 0, nil
+}
+
+// Load 以完整名單重建預約快取
+// 名單含一個佔位成員 0，空名單也能標記為已載入
+func (c *ReservationCache) Load(ctx context.Context, flashSaleID int64, userIDs []int64, ttl time.Duration) error {
+	key := ReservedKey(flashSaleID)
+
+	members := make([]interface{}, 0, len(userIDs)+1)
+	members = append(members, 0)
+	for _, id := range userIDs {
+		members = append(members, id)
+	}
+
+	pipe := c.rdb.TxPipeline()
+	pipe.Del(ctx, key)
+	pipe.SAdd(ctx, key, members...)
+	pipe.Expire(ctx, key, ttl)
+	_, err := pipe.Exec(ctx)
+	return err
+}
@@ -0,0 +1,185 @@
+// 活動售罄/關閉本地旗標
+//
+// 本檔案在每個實例的記憶體中保存活動的售罄、關閉、暫停旗標
+// 搶購請求命中旗標時直接拒絕，不再查詢 DB、取鎖或執行 Redis 腳本
+// 旗標變更透過 Redis Pub/Sub 廣播至所有實例；訂閱重連時清空本地旗標
+// 每個旗標有短暫的本地 TTL，Pub/Sub 訊息遺失時最多在 TTL 後回到正常路徑重新判斷
+package cache
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+)
+
+// SaleFlagChannel 旗標變更廣播頻道，訊息格式: {活動ID}:{旗標}，旗標為負數表示清除該旗標
+const SaleFlagChannel = "flash:sale_flags"
+
+// saleFlagTTL 本地旗標的存活時間
+const saleFlagTTL = 10 * time.Second
+
+// SaleFlag 活動本地旗標
+type SaleFlag int8
+
+const (
+	SaleFlagNone    SaleFlag = 0 // 無旗標
+	SaleFlagSoldOut SaleFlag = 1 // 總庫存售罄
+	SaleFlagClosed  SaleFlag = 2 // 已結束或已取消
+	SaleFlagPaused  SaleFlag = 3 // 管理員暫停
+)
+
+// SaleFlagStats 旗標快取統計
+type SaleFlagStats struct {
+	Hits    int64 `json:"hits"`    // 命中旗標直接拒絕的請求數
+	Misses  int64 `json:"misses"`  // 未命中、走正常流程的請求數
+	Entries int   `json:"entries"` // 目前本地旗標數量
+}
+
+type saleFlagEntry struct {
+	flag      SaleFlag
+	expiresAt time.Time
+}
+
+// SaleFlagCache 本地旗標快取（每個實例一份）
+type SaleFlagCache struct {
+	mu     sync.RWMutex
+	flags  map[int64]saleFlagEntry
+	ttl    time.Duration
+	hits   atomic.Int64
+	misses atomic.Int64
+}
+
+var saleFlags = &SaleFlagCache{
+	flags: make(map[int64]saleFlagEntry),
+	ttl:   saleFlagTTL,
+}
+
+// SaleFlags 取得本實例的旗標快取
+func SaleFlags() *SaleFlagCache {
+	return saleFlags
+}
+
+// Check 查詢活動旗標並累計命中/未命中次數
+func (c *SaleFlagCache) Check(flashSaleID int64) SaleFlag {
+	c.mu.RLock()
+	entry, ok := c.flags[flashSaleID]
+	c.mu.RUnlock()
+
+	if !ok || time.Now().After(entry.expiresAt) {
+		c.misses.Add(1)
+		return SaleFlagNone
+	}
+	c.hits.Add(1)
+	return entry.flag
+}
+
+// Set 設定本地旗標並廣播至其他實例
+func (c *SaleFlagCache) Set(ctx context.Context, flashSaleID int64, flag SaleFlag) error {
+	c.apply(flashSaleID, flag)
+	return c.publish(ctx, flashSaleID, flag)
+}
+
+// Clear 清除指定旗標並廣播至其他實例（庫存恢復時清除售罄、活動恢復時清除暫停）
+// 目前旗標不是 flag 時保持不變，避免庫存恢復誤清已關閉活動的旗標
+func (c *SaleFlagCache) Clear(ctx context.Context, flashSaleID int64, flag SaleFlag) error {
+	c.apply(flashSaleID, -flag)
+	return c.publish(ctx, flashSaleID, -flag)
+}
+
+// Stats 取得統計資料
+func (c *SaleFlagCache) Stats() SaleFlagStats {
+	c.mu.RLock()
+	entries := len(c.flags)
+	c.mu.RUnlock()
+
+	return SaleFlagStats{
+		Hits:    c.hits.Load(),
+		Misses:  c.misses.Load(),
+		Entries: entries,
+	}
+}
+
+// Listen 訂閱旗標變更頻道直到 ctx 結束（阻塞）
+// go-redis 斷線後自動重新訂閱，每次（重新）訂閱成功時清空本地旗標，避免遺漏的清除訊息造成誤拒
+func (c *SaleFlagCache) Listen(ctx context.Context, log *zap.Logger) {
+	pubsub := Get().Subscribe(ctx, SaleFlagChannel)
+	defer pubsub.Close()
+
+	for {
+		msg, err := pubsub.Receive(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			log.Warn("sale flag subscription error", zap.Error(err))
+			time.Sleep(time.Second)
+			continue
+		}
+
+		switch m := msg.(type) {
+		case *redis.Subscription:
+			if m.Kind == "subscribe" {
+				c.reset()
+			}
+		case *redis.Message:
+			flashSaleID, flag, err := parseSaleFlagMessage(m.Payload)
+			if err != nil {
+				log.Warn("invalid sale flag message", zap.String("payload", m.Payload), zap.Error(err))
+				continue
+			}
+			c.apply(flashSaleID, flag)
+		}
+	}
+}
+
+// apply 套用旗標變更，負數表示清除對應旗標
+func (c *SaleFlagCache) apply(flashSaleID int64, flag SaleFlag) {
+	if flag == SaleFlagNone {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if flag < 0 {
+		if entry, ok := c.flags[flashSaleID]; ok && entry.flag == -flag {
+			delete(c.flags, flashSaleID)
+		}
+		return
+	}
+	c.flags[flashSaleID] = saleFlagEntry{flag: flag, expiresAt: time.Now().Add(c.ttl)}
+}
+
+func (c *SaleFlagCache) reset() {
+	c.mu.Lock()
+	c.flags = make(map[int64]saleFlagEntry)
+	c.mu.Unlock()
+}
+
+func (c *SaleFlagCache) publish(ctx context.Context, flashSaleID int64, flag SaleFlag) error {
+	payload := fmt.Sprintf("%d:%d", flashSaleID, flag)
+	return Get().Publish(ctx, SaleFlagChannel, payload).Err()
+}
+
+func parseSaleFlagMessage(payload string) (int64, SaleFlag, error) {
+	idStr, flagStr, ok := strings.Cut(payload, ":")
+	if !ok {
+		return 0, SaleFlagNone, fmt.Errorf("missing separator")
+	}
+	flashSaleID, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		return 0, SaleFlagNone, err
+	}
+	flag, err := strconv.ParseInt(flagStr, 10, 8)
+	if err != nil {
+		return 0, SaleFlagNone, err
+	}
+	return flashSaleID, SaleFlag(flag), nil
+}
@@ -6,45 +6,93 @@
 package cache
 
 // DeductStockScript 庫存扣減腳本
+// 扣減成功時在同一腳本內寫入 Outbox Stream，保證扣減與訂單訊息不會分離
+// 多規格活動同時扣減規格庫存與活動總庫存，限購以活動為單位計算
 // KEYS[1]: 庫存 Key (flash:stock:{id})
 // KEYS[2]: 使用者已購數量 Key (flash:bought:{id}:{uid})
+// KEYS[3]: Outbox Stream Key (flash:outbox:{id})
+// KEYS[4]: 規格庫存 Key (flash:stock:{id}:item:{item_id})
 // ARGV[1]: 購買數量
 // ARGV[2]: 限購數量
-// 返回值: [1,"success"] 成功 / [-1,"库存不足"] / [-2,"超出限购数量"]
+// ARGV[3]: Outbox 訊息內容（空字串表示不寫入）
+// ARGV[4]: 是否扣減規格庫存（"1" 是 / "0" 否）
+// ARGV[5]: 已購數量 Key 的 TTL（秒），依活動結束時間推算
+// ARGV[6]: Outbox 消費者群組名稱，Stream 不存在時與 XADD 在同一腳本內建立
+// 返回值: [code, message, 活動總庫存, Outbox 是否新建]，code 為 1 成功 / -1 庫存不足 / -2 超出限購
+// 總庫存成功時為扣減後的值，失敗時為當前值，供呼叫端判斷是否售罄；庫存 Key 不存在時為 nil（不可視為售罄）
+// Outbox 新建時呼叫端須將 Stream 加入註冊表（位於不同 slot，不能在腳本內寫入）
 const DeductStockScript = `
 local stock_key = KEYS[1]
 local bought_key = KEYS[2]
+local outbox_key = KEYS[3]
+local item_key = KEYS[4]
 local quantity = tonumber(ARGV[1])
 local limit = tonumber(ARGV[2])
+local payload = ARGV[3]
+local has_item = ARGV[4] == '1'
+local bought_ttl = tonumber(ARGV[5])
+local outbox_group = ARGV[6]
 
-local stock = tonumber(redis.call('GET', stock_key) or 0)
+local stock_raw = redis.call('GET', stock_key)
+local stock = tonumber(stock_raw or 0)
+local reported = stock_raw and stock
 local user_bought = tonumber(redis.call('GET', bought_key) or 0)
 
 if stock < quantity then
-    return {-1, "库存不足"}
+    return {-1, "库存不足", reported, 0}
+end
+
+if has_item then
+    local item_stock = tonumber(redis.call('GET', item_key) or 0)
+    if item_stock < quantity then
+        return {-1, "库存不足", reported, 0}
+    end
 end
 
 if user_bought + quantity > limit then
-    return {-2, "超出限购数量"}
+    return {-2, "超出限购数量", reported, 0}
 end
 
 redis.call('DECRBY', stock_key, quantity)
+if has_item then
+    redis.call('DECRBY', item_key, quantity)
+end
 redis.call('INCRBY', bought_key, quantity)
-redis.call('EXPIRE', bought_key, 86400)
+redis.call('EXPIRE', bought_key, bought_ttl)
 
-return {1, "success"}
+local outbox_created = 0
+if payload ~= '' then
+    if redis.call('EXISTS', outbox_key) == 0 then
+        redis.call('XGROUP', 'CREATE', outbox_key, outbox_group, '0', 'MKSTREAM')
+        outbox_created = 1
+    end
+    redis.call('XADD', outbox_key, '*', 'payload', payload)
+end
+
+return {1, "success", stock - quantity, outbox_created}
 `
 
-// RestoreStockScript 庫存恢復腳本（訂單取消或 Kafka 發送失敗時回滾）
+// RestoreStockScript 庫存恢復腳本（訂單取消時回滾）
 // KEYS[1]: 庫存 Key
 // KEYS[2]: 使用者已購數量 Key
+// KEYS[3]: 規格庫存 Key
 // ARGV[1]: 恢復數量
+// ARGV[2]: 是否恢復規格庫存（"1" 是 / "0" 否）
+// ARGV[3]: 是否恢復活動庫存（"0" 表示分片活動，庫存已另行歸還分片）
 const RestoreStockScript = `
 local stock_key = KEYS[1]
 local bought_key = KEYS[2]
+local item_key = KEYS[3]
 local quantity = tonumber(ARGV[1])
+local has_item = ARGV[2] == '1'
+local restore_stock = ARGV[3] ~= '0'
 
-redis.call('INCRBY', stock_key, quantity)
+if restore_stock then
+    redis.call('INCRBY', stock_key, quantity)
+end
+if has_item then
+    redis.call('INCRBY', item_key, quantity)
+end
 local bought = tonumber(redis.call('GET', bought_key) or 0)
 if bought >= quantity then
     redis.call('DECRBY', bought_key, quantity)
@@ -53,32 +101,602 @@ end
 return {1, "success"}
 `
 
-// DistributedLockScript 分散式鎖加鎖腳本
-// 使用 SET NX PX 命令，若 Key 不存在則設定並返回 1，否則返回 0
-// KEYS[1]: 鎖 Key (flash:lock:{id}:{uid})
-// ARGV[1]: 鎖值（UUID，解鎖時驗證身份）
+// WarmUpStockScript 庫存預熱腳本
+// Key 不存在時以 DB 推算的庫存載入；已存在則只延長 TTL，不覆寫線上扣減結果
+// KEYS[1]: 庫存 Key
+// ARGV[1]: 庫存數量
 // ARGV[2]: 過期時間（毫秒）
-const DistributedLockScript = `
+// 返回值: 1 已載入 / 0 Key 已存在
+const WarmUpStockScript = `
+local stock_key = KEYS[1]
+local stock = tonumber(ARGV[1])
+local ttl = tonumber(ARGV[2])
+
+if redis.call('EXISTS', stock_key) == 1 then
+    redis.call('PEXPIRE', stock_key, ttl)
+    return 0
+end
+
+redis.call('SET', stock_key, stock, 'PX', ttl)
+return 1
+`
+
+// CompareAndSetStockScript 庫存比較後設定腳本（對帳修復用）
+// 僅當當前庫存仍等於預期值時才覆寫，保留原有 TTL
+// KEYS[1]: 庫存 Key
+// ARGV[1]: 預期的當前庫存
+// ARGV[2]: 新庫存
+// 返回值: 1 已更新 / 0 庫存已變動
+const CompareAndSetStockScript = `
+local stock_key = KEYS[1]
+local expected = tonumber(ARGV[1])
+local stock = tonumber(ARGV[2])
+
+local current = tonumber(redis.call('GET', stock_key) or 0)
+if current ~= expected then
+    return 0
+end
+
+redis.call('SET', stock_key, stock, 'KEEPTTL')
+return 1
+`
+
+// LockAcquireScript 可重入分散式鎖加鎖腳本
+// 鎖以 Hash 儲存持有者與重入次數，同一持有者重複加鎖時次數加一並重設過期時間
+// KEYS[1]: 鎖 Key
+// ARGV[1]: 持有者
+// ARGV[2]: 過期時間（毫秒）
+// 返回值: 加鎖後的重入次數 / 0 鎖已被其他持有者占用
+const LockAcquireScript = `
 local lock_key = KEYS[1]
-local lock_value = ARGV[1]
-local expire_time = tonumber(ARGV[2])
+local owner = ARGV[1]
+local ttl = tonumber(ARGV[2])
 
-if redis.call('SET', lock_key, lock_value, 'NX', 'PX', expire_time) then
-    return 1
+if redis.call('EXISTS', lock_key) == 0 or redis.call('HEXISTS', lock_key, owner) == 1 then
+    local count = redis.call('HINCRBY', lock_key, owner, 1)
+    redis.call('PEXPIRE', lock_key, ttl)
+    return count
 end
 return 0
 `
 
-// DistributedUnlockScript 分散式鎖解鎖腳本
-// 只有鎖的持有者（value 匹配）才能解鎖，防止誤刪其他人的鎖
+// LockReleaseScript 可重入分散式鎖解鎖腳本
+// 重入次數減一，歸零時刪除鎖；非持有者解鎖不做任何事
 // KEYS[1]: 鎖 Key
-// ARGV[1]: 鎖值
-const DistributedUnlockScript = `
+// ARGV[1]: 持有者
+// ARGV[2]: 過期時間（毫秒，尚有重入時重設）
+// 返回值: 剩餘重入次數 / -1 非持有者
+const LockReleaseScript = `
 local lock_key = KEYS[1]
-local lock_value = ARGV[1]
+local owner = ARGV[1]
+
+if redis.call('HEXISTS', lock_key, owner) == 0 then
+    return -1
+end
+
+local count = redis.call('HINCRBY', lock_key, owner, -1)
+if count <= 0 then
+    redis.call('DEL', lock_key)
+    return 0
+end
+redis.call('PEXPIRE', lock_key, tonumber(ARGV[2]))
+return count
+`
+
+// LockRenewScript 分散式鎖續期腳本（看門狗呼叫），只有持有者能續期
+// KEYS[1]: 鎖 Key
+// ARGV[1]: 持有者
+// ARGV[2]: 過期時間（毫秒）
+// 返回值: 1 已續期 / 0 鎖已不屬於持有者
+const LockRenewScript = `
+if redis.call('HEXISTS', KEYS[1], ARGV[1]) == 1 then
+    return redis.call('PEXPIRE', KEYS[1], tonumber(ARGV[2]))
+end
+return 0
+`
+
+// QueueEnqueueScript 排隊入列腳本
+// 以 Redis 伺服器時間（微秒）作為分數，多實例共用同一時鐘，保證先到先得
+// 同一使用者重複入列時保留原位置與原憑證
+// 排隊活動註冊表與佇列位於不同 slot，由 QueueService 在腳本外維護
+// KEYS[1]: 排隊 ZSET Key (flash:queue:{id})
+// KEYS[2]: 排隊請求 Hash Key (flash:queue:{id}:entries)
+// ARGV[1]: 成員（使用者 ID）
+// ARGV[2]: 請求內容（JSON）
+// ARGV[3]: 過期時間（毫秒）
+// 返回值: [是否新入列(1/0), 排名(從 0 起), 請求內容]
+const QueueEnqueueScript = `
+local queue_key = KEYS[1]
+local entries_key = KEYS[2]
+local member = ARGV[1]
+local payload = ARGV[2]
+local ttl = tonumber(ARGV[3])
+
+local now = redis.call('TIME')
+local score = tonumber(now[1]) * 1000000 + tonumber(now[2])
+
+local added = redis.call('ZADD', queue_key, 'NX', score, member)
+if added == 1 then
+    redis.call('HSET', entries_key, member, payload)
+    redis.call('PEXPIRE', queue_key, ttl)
+    redis.call('PEXPIRE', entries_key, ttl)
+end
+
+local rank = redis.call('ZRANK', queue_key, member)
+return {added, rank, redis.call('HGET', entries_key, member) or ''}
+`
+
+// QueueDrainScript 排隊出列腳本
+// 以每秒放行數限制全域出列速率，多個 Worker 同時出列也不會超出
+// KEYS[1]: 排隊 ZSET Key
+// KEYS[2]: 排隊請求 Hash Key
+// KEYS[3]: 放行計數 Key (flash:queue:{id}:rate)
+// ARGV[1]: 每秒放行數
+// ARGV[2]: 單次最多出列數
+// 返回值: 出列的請求內容陣列（依到達順序）
+const QueueDrainScript = `
+local queue_key = KEYS[1]
+local entries_key = KEYS[2]
+local rate_key = KEYS[3]
+local rate = tonumber(ARGV[1])
+local batch = tonumber(ARGV[2])
+
+local sec = redis.call('TIME')[1]
+local used = 0
+if redis.call('HGET', rate_key, 'sec') == sec then
+    used = tonumber(redis.call('HGET', rate_key, 'count') or 0)
+end
+
+local n = math.min(rate - used, batch)
+local result = {}
+
+if n > 0 then
+    local popped = redis.call('ZPOPMIN', queue_key, n)
+    for i = 1, #popped, 2 do
+        local member = popped[i]
+        local payload = redis.call('HGET', entries_key, member)
+        redis.call('HDEL', entries_key, member)
+        if payload then
+            table.insert(result, payload)
+        end
+    end
+    redis.call('HSET', rate_key, 'sec', sec, 'count', used + #popped / 2)
+    redis.call('EXPIRE', rate_key, 5)
+end
+
+return result
+`
+
+// QueueClearScript 清空排隊腳本（售罄或活動結束時使用）
+// KEYS[1]: 排隊 ZSET Key
+// KEYS[2]: 排隊請求 Hash Key
+// 返回值: 被清除的請求內容陣列
+const QueueClearScript = `
+local payloads = redis.call('HVALS', KEYS[2])
+redis.call('DEL', KEYS[1], KEYS[2])
+return payloads
+`
+
+// ReservedAddScript 預約名單加入腳本
+// 名單 Key 存在才加入，避免 Key 過期後只寫入單一使用者而被誤認為完整名單
+// KEYS[1]: 預約名單 Key (flash:reserved:{id})
+// ARGV[1]: 使用者 ID
+const ReservedAddScript = `
+if redis.call('EXISTS', KEYS[1]) == 1 then
+    return redis.call('SADD', KEYS[1], ARGV[1])
+end
+return 0
+`
+
+// AdjustStockScript 庫存調整腳本（管理員增減庫存）
+// 多規格活動同時調整規格庫存與活動總庫存，調整後不得為負數
+// KEYS[1]: 庫存 Key
+// KEYS[2]: 規格庫存 Key
+// ARGV[1]: 調整量（正數增加 / 負數減少）
+// ARGV[2]: 是否調整規格庫存（"1" 是 / "0" 否）
+// 返回值: [1,調整後庫存] 成功 / [-1,"库存不足"] / [-3,"库存未加载"]
+const AdjustStockScript = `
+local stock_key = KEYS[1]
+local item_key = KEYS[2]
+local delta = tonumber(ARGV[1])
+local has_item = ARGV[2] == '1'
+
+if redis.call('EXISTS', stock_key) == 0 then
+    return {-3, "库存未加载"}
+end
+if has_item and redis.call('EXISTS', item_key) == 0 then
+    return {-3, "库存未加载"}
+end
+
+local stock = tonumber(redis.call('GET', stock_key))
+if stock + delta < 0 then
+    return {-1, "库存不足"}
+end
+if has_item then
+    local item_stock = tonumber(redis.call('GET', item_key))
+    if item_stock + delta < 0 then
+        return {-1, "库存不足"}
+    end
+    redis.call('INCRBY', item_key, delta)
+end
+
+return {1, redis.call('INCRBY', stock_key, delta)}
+`
+
+// TicketSetScript 更新搶購憑證狀態
+// 終態不可回退：success 只能再寫 success，failed 只能被 success 覆蓋（Kafka 重試後成功）
+// KEYS[1]: 憑證 Key (flash:ticket:{ticket})
+// ARGV[1]: 狀態
+// ARGV[2]: 使用者 ID
+// ARGV[3]: 活動 ID
+// ARGV[4]: 訂單號
+// ARGV[5]: 失敗原因
+// ARGV[6]: 更新時間（Unix 秒）
+// ARGV[7]: TTL 秒數
+// 返回值: 1 已更新 / 0 狀態不允許回退
+const TicketSetScript = `
+local current = redis.call('HGET', KEYS[1], 'status')
+local status = ARGV[1]
+
+if current == 'success' and status ~= 'success' then
+    return 0
+end
+if current == 'failed' and status ~= 'success' and status ~= 'failed' then
+    return 0
+end
+
+redis.call('HSET', KEYS[1],
+    'status', status,
+    'user_id', ARGV[2],
+    'flash_sale_id', ARGV[3],
+    'order_no', ARGV[4],
+    'reason', ARGV[5],
+    'updated_at', ARGV[6])
+redis.call('EXPIRE', KEYS[1], ARGV[7])
+return 1
+`
+
+// AdmitScript 搶購准入腳本：單次往返完成活動狀態/時間驗證、重複參與與限購檢查、扣減庫存並寫入 Outbox
+// 活動狀態、起訖時間與限購取自中繼資料 Hash，時間以 Redis 伺服器時鐘為準
+// 使用者已購數量 > 0 視為已參與（每人每活動一筆訂單），取代 DB 查詢與使用者鎖
+// KEYS[1]: 中繼資料 Hash Key (flash:meta:{id})
+// KEYS[2]: 庫存 Key (flash:stock:{id})
+// KEYS[3]: 使用者已購數量 Key (flash:bought:{id}:{uid})
+// KEYS[4]: Outbox Stream Key (flash:outbox:{id})
+// KEYS[5]: 規格庫存 Key (flash:stock:{id}:item:{item_id})
+// ARGV[1]: 購買數量
+// ARGV[2]: Outbox 訊息內容
+// ARGV[3]: 是否扣減規格庫存（"1" 是 / "0" 否）
+// ARGV[4]: 已購數量 Key 在活動結束後的保留秒數
+// ARGV[5]: 庫存是否已由分片扣減（"1" 是，腳本不檢查也不扣減 KEYS[2]）
+// ARGV[6]: Outbox 消費者群組名稱，Stream 不存在時與 XADD 在同一腳本內建立
+// 返回值: [code, message, 活動總庫存（分片活動固定為 0，庫存 Key 不存在時為 nil）, Outbox 是否新建]
+// code: 1 成功 / -1 庫存不足 / -2 超出限購 / -3 已參與 / -4 未開始 / -5 已結束 / -6 未開放 / -7 中繼資料未載入
+const AdmitScript = `
+local meta_key = KEYS[1]
+local stock_key = KEYS[2]
+local bought_key = KEYS[3]
+local outbox_key = KEYS[4]
+local item_key = KEYS[5]
+local quantity = tonumber(ARGV[1])
+local payload = ARGV[2]
+local has_item = ARGV[3] == '1'
+local retention = tonumber(ARGV[4])
+local stock_taken = ARGV[5] == '1'
+local outbox_group = ARGV[6]
 
-if redis.call('GET', lock_key) == lock_value then
-    return redis.call('DEL', lock_key)
+local meta = redis.call('HMGET', meta_key, 'status', 'start_ms', 'end_ms', 'per_user_limit')
+if not meta[1] or not meta[2] or not meta[3] or not meta[4] then
+    return {-7, "活动信息未加载", 0, 0}
+end
+
+local status = tonumber(meta[1])
+local start_ms = tonumber(meta[2])
+local end_ms = tonumber(meta[3])
+local limit = tonumber(meta[4])
+
+local now = redis.call('TIME')
+local now_ms = tonumber(now[1]) * 1000 + math.floor(tonumber(now[2]) / 1000)
+
+local stock = 0
+local reported = 0
+if not stock_taken then
+    local stock_raw = redis.call('GET', stock_key)
+    stock = tonumber(stock_raw or 0)
+    reported = stock_raw and stock
+end
+
+if now_ms < start_ms then
+    return {-4, "秒杀活动尚未开始", reported, 0}
+end
+if now_ms > end_ms then
+    return {-5, "秒杀活动已结束", reported, 0}
+end
+if status ~= 1 then
+    return {-6, "秒杀活动未开放", reported, 0}
+end
+
+local user_bought = tonumber(redis.call('GET', bought_key) or 0)
+if user_bought > 0 then
+    return {-3, "您已参与过本次秒杀", reported, 0}
+end
+if quantity > limit then
+    return {-2, "超出限购数量", reported, 0}
+end
+
+if not stock_taken then
+    if stock < quantity then
+        return {-1, "库存不足", reported, 0}
+    end
+    if has_item then
+        local item_stock = tonumber(redis.call('GET', item_key) or 0)
+        if item_stock < quantity then
+            return {-1, "库存不足", reported, 0}
+        end
+        redis.call('DECRBY', item_key, quantity)
+    end
+    redis.call('DECRBY', stock_key, quantity)
+    stock = stock - quantity
+end
+
+redis.call('INCRBY', bought_key, quantity)
+redis.call('EXPIRE', bought_key, math.max(math.floor((end_ms - now_ms) / 1000), 0) + retention)
+local outbox_created = 0
+if redis.call('EXISTS', outbox_key) == 0 then
+    redis.call('XGROUP', 'CREATE', outbox_key, outbox_group, '0', 'MKSTREAM')
+    outbox_created = 1
+end
+redis.call('XADD', outbox_key, '*', 'payload', payload)
+
+return {1, "success", stock, outbox_created}
+`
+
+// ShardDeductScript 分片庫存扣減腳本，只操作單一分片 Key（各分片可位於不同 Cluster slot）
+// KEYS[1]: 分片庫存 Key
+// ARGV[1]: 扣減數量
+// 返回值: 扣減後的分片庫存 / -1 分片庫存不足
+const ShardDeductScript = `
+local stock = tonumber(redis.call('GET', KEYS[1]) or 0)
+local quantity = tonumber(ARGV[1])
+if stock < quantity then
+    return -1
+end
+return redis.call('DECRBY', KEYS[1], quantity)
+`
+
+// ShardTakeScript 分片庫存提取腳本（再平衡與減少庫存用），最多取出 ARGV[1] 件
+// KEYS[1]: 分片庫存 Key
+// ARGV[1]: 希望取出的數量
+// 返回值: 實際取出的數量
+const ShardTakeScript = `
+local stock = tonumber(redis.call('GET', KEYS[1]) or 0)
+local want = tonumber(ARGV[1])
+local taken = math.min(stock, want)
+if taken <= 0 then
+    return 0
+end
+redis.call('DECRBY', KEYS[1], taken)
+return taken
+`
+
+// LimitReserveScript 跨活動限購預扣腳本：全部計數器檢查通過後才一併暫扣
+// 同一使用者的計數器與暫扣 Hash 以 {u使用者ID} 作為 hash tag，Cluster 模式下位於同一 slot
+// 暫扣 Hash 的 Field 為搶購憑證，值為 "數量:到期時間（毫秒）"；檢查時清除已到期的暫扣
+// KEYS[2i-1]: 限購計數器 Key
+// KEYS[2i]: 計數器的暫扣 Hash Key
+// ARGV[1]: 購買數量
+// ARGV[2]: 搶購憑證
+// ARGV[3]: 目前時間（毫秒）
+// ARGV[4]: 暫扣存活時間（毫秒）
+// ARGV[4+i]: 第 i 個計數器的上限
+// 返回值: 0 成功 / i 表示第 i 個計數器超出上限（未暫扣任何計數器）
+const LimitReserveScript = `
+local quantity = tonumber(ARGV[1])
+local now = tonumber(ARGV[3])
+local holdTTL = tonumber(ARGV[4])
+local n = #KEYS / 2
+
+for i = 1, n do
+    local held = 0
+    local holds = redis.call('HGETALL', KEYS[i * 2])
+    for j = 1, #holds, 2 do
+        local q, expireAt = string.match(holds[j + 1], '^(%d+):(%d+)$')
+        if q == nil or tonumber(expireAt) <= now then
+            redis.call('HDEL', KEYS[i * 2], holds[j])
+        else
+            held = held + tonumber(q)
+        end
+    end
+
+    local used = tonumber(redis.call('GET', KEYS[i * 2 - 1]) or 0)
+    if used + held + quantity > tonumber(ARGV[4 + i]) then
+        return i
+    end
+end
+
+local hold = quantity .. ':' .. (now + holdTTL)
+for i = 1, n do
+    redis.call('HSET', KEYS[i * 2], ARGV[2], hold)
+    redis.call('PEXPIRE', KEYS[i * 2], holdTTL)
+end
+return 0
+`
+
+// LimitConfirmScript 跨活動限購確認腳本（准入成功後使用）：刪除暫扣並累加計數器
+// 暫扣已到期被清除或已確認過時不累加
+// KEYS[2i-1]: 限購計數器 Key
+// KEYS[2i]: 計數器的暫扣 Hash Key
+// ARGV[1]: 購買數量
+// ARGV[2]: 搶購憑證
+// ARGV[2+i]: 第 i 個計數器的 TTL（秒），TTL 只延長不縮短
+// 返回值: 已累加的計數器數量
+const LimitConfirmScript = `
+local quantity = tonumber(ARGV[1])
+local confirmed = 0
+for i = 1, #KEYS / 2 do
+    if redis.call('HDEL', KEYS[i * 2], ARGV[2]) == 1 then
+        local ttl = tonumber(ARGV[2 + i])
+        redis.call('INCRBY', KEYS[i * 2 - 1], quantity)
+        if redis.call('TTL', KEYS[i * 2 - 1]) < ttl then
+            redis.call('EXPIRE', KEYS[i * 2 - 1], ttl)
+        end
+        confirmed = confirmed + 1
+    end
+end
+return confirmed
+`
+
+// LimitReleaseScript 跨活動限購歸還腳本（訂單取消時使用）
+// 計數器已過期或不足時不建立負值，歸零時刪除
+// KEYS[i]: 限購計數器 Key
+// ARGV[1]: 歸還數量
+const LimitReleaseScript = `
+local quantity = tonumber(ARGV[1])
+for _, key in ipairs(KEYS) do
+    local used = tonumber(redis.call('GET', key) or 0)
+    if used > quantity then
+        redis.call('DECRBY', key, quantity)
+    elseif used > 0 then
+        redis.call('DEL', key)
+    end
+end
+return 1
+`
+
+// LimitCompareAndSetScript 限購計數器對帳修正腳本：當前值與讀取時相同才寫入
+// KEYS[1]: 限購計數器 Key
+// ARGV[1]: 讀取時的計數（不存在為 0）
+// ARGV[2]: 修正後的計數，0 時刪除
+// ARGV[3]: TTL（秒），已有更長 TTL 時保留
+// 返回值: 1 已修正 / 0 計數已變更
+const LimitCompareAndSetScript = `
+local used = tonumber(redis.call('GET', KEYS[1]) or 0)
+if used ~= tonumber(ARGV[1]) then
+    return 0
+end
+local value = tonumber(ARGV[2])
+if value <= 0 then
+    redis.call('DEL', KEYS[1])
+    return 1
+end
+local ttl = redis.call('TTL', KEYS[1])
+redis.call('SET', KEYS[1], value)
+redis.call('EXPIRE', KEYS[1], math.max(ttl, tonumber(ARGV[3])))
+return 1
+`
+
+// OrderExpiryClaimScript 訂單到期佇列領取腳本
+// 取出已到期的訂單並將分數延後至租約到期，處理中斷的訂單會在租約到期後重新被領取
+// KEYS[1]: 到期佇列 Key (order:expiry)
+// ARGV[1]: 當前時間（毫秒）
+// ARGV[2]: 租約到期時間（毫秒）
+// ARGV[3]: 單次領取上限
+// 返回值: 領取的訂單 ID 列表
+const OrderExpiryClaimScript = `
+local ids = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', ARGV[1], 'LIMIT', 0, tonumber(ARGV[3]))
+for _, id in ipairs(ids) do
+    redis.call('ZADD', KEYS[1], ARGV[2], id)
+end
+return ids
+`
+
+// LeaderCampaignScript 領導者選舉腳本：無人擔任時成為領導者，已是領導者時續期
+// KEYS[1]: 領導者 Key
+// ARGV[1]: 候選者（實例標識）
+// ARGV[2]: 任期（毫秒）
+// 返回值: 1 擔任領導者 / 0 由其他實例擔任
+const LeaderCampaignScript = `
+local current = redis.call('GET', KEYS[1])
+if current == false then
+    redis.call('SET', KEYS[1], ARGV[1], 'PX', tonumber(ARGV[2]))
+    return 1
+end
+if current == ARGV[1] then
+    redis.call('PEXPIRE', KEYS[1], tonumber(ARGV[2]))
+    return 1
 end
 return 0
 `
+
+// LeaderResignScript 卸任腳本，只有現任領導者能刪除 Key
+// KEYS[1]: 領導者 Key
+// ARGV[1]: 候選者（實例標識）
+// 返回值: 1 已卸任 / 0 非現任領導者
+const LeaderResignScript = `
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+    return redis.call('DEL', KEYS[1])
+end
+return 0
+`
+
+// OutboxEnsureGroupScript Outbox 消費者群組檢查腳本（預熱時呼叫），Stream 不存在時不建立
+// 補建遺失的消費者群組，並移除舊版本設定的 TTL（Stream 僅由 Relay 在清空閒置後刪除）
+// KEYS[1]: Outbox Stream Key
+// ARGV[1]: 消費者群組名稱
+// 返回值: 1 Stream 存在（呼叫端應確保已註冊）/ 0 Stream 不存在（下次寫入時由扣減腳本建立）
+const OutboxEnsureGroupScript = `
+if redis.call('EXISTS', KEYS[1]) == 0 then
+    return 0
+end
+local groups = redis.call('XINFO', 'GROUPS', KEYS[1])
+local found = false
+for _, group in ipairs(groups) do
+    for i = 1, #group, 2 do
+        if group[i] == 'name' and group[i + 1] == ARGV[1] then
+            found = true
+        end
+    end
+end
+if not found then
+    redis.call('XGROUP', 'CREATE', KEYS[1], ARGV[1], '0')
+end
+redis.call('PERSIST', KEYS[1])
+return 1
+`
+
+// OutboxPruneScript Outbox 清理腳本：Stream 已清空且最後一筆訊息早於閒置時間才刪除
+// 刪除後再寫入時由扣減腳本重建 Stream 與消費者群組
+// KEYS[1]: Outbox Stream Key
+// ARGV[1]: 閒置時間（毫秒）
+// 返回值: 1 Stream 不存在或已刪除 / 0 仍在使用
+const OutboxPruneScript = `
+if redis.call('EXISTS', KEYS[1]) == 0 then
+    return 1
+end
+if redis.call('XLEN', KEYS[1]) > 0 then
+    return 0
+end
+local info = redis.call('XINFO', 'STREAM', KEYS[1])
+local last_ms = 0
+for i = 1, #info, 2 do
+    if info[i] == 'last-generated-id' then
+        last_ms = tonumber(string.match(info[i + 1], '^(%d+)')) or 0
+    end
+end
+local now = redis.call('TIME')
+local now_ms = tonumber(now[1]) * 1000 + math.floor(tonumber(now[2]) / 1000)
+if now_ms - last_ms < tonumber(ARGV[1]) then
+    return 0
+end
+redis.call('DEL', KEYS[1])
+return 1
+`
+
+// FlashSaleMetaSetScript 中繼資料寫入腳本：版本號未變更才寫入 Hash
+// 讀穿透在載入 DB 前讀取版本號，載入期間被 Invalidate 遞增版本時放棄寫入，避免舊資料覆蓋失效
+// KEYS[1]: 中繼資料 Hash Key (flash:meta:{id})
+// KEYS[2]: 版本號 Key (flash:meta:ver:{id})
+// ARGV[1]: 載入前讀取的版本號（不存在為 "0"）
+// ARGV[2]: Hash 的 TTL（毫秒）
+// ARGV[3...]: Hash 欄位與值交替排列
+// 返回值: 1 已寫入 / 0 版本已變更未寫入
+const FlashSaleMetaSetScript = `
+local version = redis.call('GET', KEYS[2]) or '0'
+if version ~= ARGV[1] then
+    return 0
+end
+redis.call('DEL', KEYS[1])
+redis.call('HSET', KEYS[1], unpack(ARGV, 3))
+redis.call('PEXPIRE', KEYS[1], ARGV[2])
+return 1
+`
@@ -1,41 +1,46 @@
-// 庫存快取服務與分散式鎖
+// 庫存快取服務
 //
 // 本檔案提供秒殺核心的快取操作功能
-// StockService: 庫存的初始化、查詢、扣減、恢復
-// DistributedLock: 基於 Redis 的分散式鎖，防止重複提交
+// StockService: 庫存的初始化、查詢、扣減、恢復（分片活動見 stock_shard.go）
 package cache
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"strconv"
 	"time"
 
-	"github.com/google/uuid"
+	"github.com/Mag1cFall/magtrade/internal/pkg/utils"
 	"github.com/redis/go-redis/v9"
 )
 
 // StockService 庫存快取服務
 type StockService struct {
-	rdb *redis.Client
+	rdb    redis.UniversalClient
+	flags  *SaleFlagCache // 本地售罄旗標，庫存歸零時設定、庫存增加時清除
+	events *StockEventBus // 庫存變更事件，扣減/恢復成功後標記
 }
 
 func NewStockService() *StockService {
-	return &StockService{rdb: Get()}
+	return &StockService{rdb: Get(), flags: SaleFlags(), events: StockEvents()}
 }
 
+// 同一活動的 Key 以 {活動ID} 作為 hash tag，Cluster 模式下位於同一 slot，Lua 腳本可同時操作
+
 // StockKey 生成庫存 Redis Key，格式: flash:stock:{活動ID}
 func StockKey(flashSaleID int64) string {
-	return fmt.Sprintf("flash:stock:%d", flashSaleID)
+	return fmt.Sprintf("flash:stock:{%d}", flashSaleID)
 }
 
 // BoughtKey 生成使用者已購數量 Key，格式: flash:bought:{活動ID}:{使用者ID}
 func BoughtKey(flashSaleID, userID int64) string {
-	return fmt.Sprintf("flash:bought:%d:%d", flashSaleID, userID)
+	return fmt.Sprintf("flash:bought:{%d}:%d", flashSaleID, userID)
 }
 
-// LockKey 生成分散式鎖 Key，格式: flash:lock:{活動ID}:{使用者ID}
-func LockKey(flashSaleID, userID int64) string {
-	return fmt.Sprintf("flash:lock:%d:%d", flashSaleID, userID)
+// ItemStockKey 生成規格庫存 Key，格式: flash:stock:{活動ID}:item:{規格ID}
+func ItemStockKey(flashSaleID, itemID int64) string {
+	return fmt.Sprintf("flash:stock:{%d}:item:%d", flashSaleID, itemID)
 }
 
 // InitStock 初始化秒殺活動庫存至 Redis，有效期 24 小時
@@ -44,104 +49,369 @@ func (s *StockService) InitStock(ctx context.Context, flashSaleID int64, stock i
 	return s.rdb.Set(ctx, key, stock, 24*time.Hour).Err()
 }
 
-// GetStock 查詢當前庫存數量
+// SetStock 設定活動庫存並指定 TTL（覆寫現有值，僅用於新建活動）
+func (s *StockService) SetStock(ctx context.Context, flashSaleID int64, stock int, ttl time.Duration) error {
+	if err := s.rdb.Set(ctx, StockKey(flashSaleID), stock, ttl).Err(); err != nil {
+		return err
+	}
+	s.syncSoldOut(ctx, flashSaleID, stock)
+	return nil
+}
+
+// WarmUpStock 預熱庫存：Key 不存在才載入，存在則只延長 TTL
+// 返回 true 表示本次重新載入了庫存
+func (s *StockService) WarmUpStock(ctx context.Context, flashSaleID int64, stock int, ttl time.Duration) (bool, error) {
+	result, err := s.rdb.Eval(ctx, WarmUpStockScript,
+		[]string{StockKey(flashSaleID)},
+		stock, ttl.Milliseconds(),
+	).Int()
+	if err != nil {
+		return false, err
+	}
+	if result == 1 {
+		s.syncSoldOut(ctx, flashSaleID, stock)
+	}
+	return result == 1, nil
+}
+
+// SetItemStock 設定規格庫存並指定 TTL（覆寫現有值，僅用於新建活動）
+func (s *StockService) SetItemStock(ctx context.Context, flashSaleID, itemID int64, stock int, ttl time.Duration) error {
+	return s.rdb.Set(ctx, ItemStockKey(flashSaleID, itemID), stock, ttl).Err()
+}
+
+// WarmUpItemStock 預熱規格庫存：Key 不存在才載入，存在則只延長 TTL
+func (s *StockService) WarmUpItemStock(ctx context.Context, flashSaleID, itemID int64, stock int, ttl time.Duration) (bool, error) {
+	result, err := s.rdb.Eval(ctx, WarmUpStockScript,
+		[]string{ItemStockKey(flashSaleID, itemID)},
+		stock, ttl.Milliseconds(),
+	).Int()
+	if err != nil {
+		return false, err
+	}
+	return result == 1, nil
+}
+
+// GetItemStocks 批量查詢規格庫存，Key 不存在的規格視為 0
+func (s *StockService) GetItemStocks(ctx context.Context, flashSaleID int64, itemIDs []int64) (map[int64]int, error) {
+	stocks, err := s.PeekItemStocks(ctx, flashSaleID, itemIDs)
+	if err != nil {
+		return nil, err
+	}
+	for _, itemID := range itemIDs {
+		if _, ok := stocks[itemID]; !ok {
+			stocks[itemID] = 0
+		}
+	}
+	return stocks, nil
+}
+
+// PeekItemStocks 批量查詢規格庫存，返回值不含 Key 不存在的規格（對帳用於區分缺失與售罄）
+func (s *StockService) PeekItemStocks(ctx context.Context, flashSaleID int64, itemIDs []int64) (map[int64]int, error) {
+	stocks := make(map[int64]int, len(itemIDs))
+	if len(itemIDs) == 0 {
+		return stocks, nil
+	}
+
+	keys := make([]string, len(itemIDs))
+	for i, itemID := range itemIDs {
+		keys[i] = ItemStockKey(flashSaleID, itemID)
+	}
+
+	vals, err := s.rdb.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	for i, v := range vals {
+		str, ok := v.(string)
+		if !ok {
+			continue
+		}
+		n, _ := strconv.Atoi(str)
+		stocks[itemIDs[i]] = n
+	}
+	return stocks, nil
+}
+
+// CompareAndSetItemStock 僅當規格庫存仍為 expected 時設定為 stock
+func (s *StockService) CompareAndSetItemStock(ctx context.Context, flashSaleID, itemID int64, expected, stock int) (bool, error) {
+	result, err := s.rdb.Eval(ctx, CompareAndSetStockScript,
+		[]string{ItemStockKey(flashSaleID, itemID)},
+		expected, stock,
+	).Int()
+	if err != nil {
+		return false, err
+	}
+	return result == 1, nil
+}
+
+// RestoreBought 回填使用者已購數量（Key 已存在則保留）
+func (s *StockService) RestoreBought(ctx context.Context, flashSaleID int64, bought map[int64]int, ttl time.Duration) error {
+	if len(bought) == 0 {
+		return nil
+	}
+
+	pipe := s.rdb.Pipeline()
+	for userID, quantity := range bought {
+		pipe.SetNX(ctx, BoughtKey(flashSaleID, userID), quantity, ttl)
+	}
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// GetStock 查詢當前庫存數量，分片活動返回各分片合計
 func (s *StockService) GetStock(ctx context.Context, flashSaleID int64) (int, error) {
-	key := StockKey(flashSaleID)
-	val, err := s.rdb.Get(ctx, key).Int()
-	if err == redis.Nil { // Key 不存在視為庫存 0
-		return 0, nil
+	val, _, err := s.PeekStock(ctx, flashSaleID)
+	return val, err // Key 不存在視為庫存 0
+}
+
+// PeekStock 查詢庫存並區分 Key 是否存在（對帳用）
+// 庫存與分片數在同一次往返查詢，未分片活動不增加額外往返
+func (s *StockService) PeekStock(ctx context.Context, flashSaleID int64) (int, bool, error) {
+	pipe := s.rdb.Pipeline()
+	stockCmd := pipe.Get(ctx, StockKey(flashSaleID))
+	shardsCmd := pipe.Get(ctx, StockShardsKey(flashSaleID))
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return 0, false, err
+	}
+
+	if shards, err := shardsCmd.Int(); err == nil && shards > 0 {
+		total, err := s.sumShards(ctx, flashSaleID, shards)
+		return total, err == nil, err
+	}
+
+	val, err := stockCmd.Int()
+	if err == redis.Nil {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
 	}
-	return val, err
+	return val, true, nil
+}
+
+// CompareAndSetStock 僅當庫存仍為 expected 時設定為 stock
+func (s *StockService) CompareAndSetStock(ctx context.Context, flashSaleID int64, expected, stock int) (bool, error) {
+	shards, err := s.shardCount(ctx, flashSaleID)
+	if err != nil {
+		return false, err
+	}
+	if shards > 0 {
+		return s.setShards(ctx, flashSaleID, shards, expected, stock)
+	}
+
+	result, err := s.rdb.Eval(ctx, CompareAndSetStockScript,
+		[]string{StockKey(flashSaleID)},
+		expected, stock,
+	).Int()
+	if err != nil {
+		return false, err
+	}
+	if result == 1 {
+		s.syncSoldOut(ctx, flashSaleID, stock)
+	}
+	return result == 1, nil
 }
 
 // DeductResult 庫存扣減結果
 type DeductResult struct {
-	Success bool
-	Code    int // 1=成功, -1=庫存不足, -2=超過限購
-	Message string
+	Success   bool
+	Code      int // 1=成功, -1=庫存不足, -2=超過限購
+	Message   string
+	Remaining int // 活動總庫存：成功時為扣減後的值，失敗時為當前值（庫存 Key 不存在時為 0）
+}
+
+// DeductRequest 庫存扣減參數
+type DeductRequest struct {
+	FlashSaleID int64
+	UserID      int64
+	ItemID      int64 // 規格 ID，0 表示單規格活動
+	Quantity    int
+	Limit       int
+	Payload     string        // Outbox 訊息內容，為空則只扣減不寫入 Outbox
+	BoughtTTL   time.Duration // 已購數量 Key 的存活時間，0 使用 defaultBoughtTTL
 }
 
-// DeductStock 扣減庫存（原子操作）
-// 使用 Lua 腳本在 Redis 端執行，保證併發安全
-func (s *StockService) DeductStock(ctx context.Context, flashSaleID, userID int64, quantity, limit int) (*DeductResult, error) {
-	stockKey := StockKey(flashSaleID)
-	boughtKey := BoughtKey(flashSaleID, userID)
+// defaultBoughtTTL 未指定 BoughtTTL 時已購數量 Key 的存活時間
+const defaultBoughtTTL = 24 * time.Hour
+
+// Deduct 扣減庫存，並在同一 Lua 腳本內將訂單訊息寫入 Outbox
+func (s *StockService) Deduct(ctx context.Context, req *DeductRequest) (*DeductResult, error) {
+	stockKey := StockKey(req.FlashSaleID)
+	boughtKey := BoughtKey(req.FlashSaleID, req.UserID)
+	outboxKey := OutboxKey(req.FlashSaleID)
+	itemKey := ItemStockKey(req.FlashSaleID, req.ItemID)
+
+	boughtTTL := req.BoughtTTL
+	if boughtTTL <= 0 {
+		boughtTTL = defaultBoughtTTL
+	}
 
 	result, err := s.rdb.Eval(ctx, DeductStockScript,
-		[]string{stockKey, boughtKey},
-		quantity, limit,
+		[]string{stockKey, boughtKey, outboxKey, itemKey},
+		req.Quantity, req.Limit, req.Payload, flag(req.ItemID > 0), int(boughtTTL.Seconds()), OutboxGroup,
 	).Result()
 
 	if err != nil {
 		return nil, fmt.Errorf("failed to execute deduct script: %w", err)
 	}
 
-	// 解析 Lua 腳本返回值 [code, message]
+	// 解析 Lua 腳本返回值 [code, message, remaining, outbox_created]
 	arr, ok := result.([]interface{})
-	if !ok || len(arr) != 2 {
+	if !ok || len(arr) != 4 {
 		return nil, fmt.Errorf("unexpected script result format")
 	}
 
 	code, _ := arr[0].(int64)
 	msg, _ := arr[1].(string)
+	remaining, loaded := arr[2].(int64) // 庫存 Key 不存在時為 nil
+	if created, _ := arr[3].(int64); created == 1 {
+		s.registerOutbox(ctx, req.FlashSaleID)
+	}
+
+	// 庫存 Key 不存在（未預熱或已過期）不代表售罄，不設定也不廣播售罄旗標
+	if loaded && remaining <= 0 {
+		s.syncSoldOut(ctx, req.FlashSaleID, int(remaining))
+	}
+	if code == 1 {
+		s.events.Notify(req.FlashSaleID)
+	}
 
 	return &DeductResult{
-		Success: code == 1,
-		Code:    int(code),
-		Message: msg,
+		Success:   code == 1,
+		Code:      int(code),
+		Message:   msg,
+		Remaining: int(remaining),
 	}, nil
 }
 
-// RestoreStock 恢復庫存（訂單取消或發送失敗時使用）
-func (s *StockService) RestoreStock(ctx context.Context, flashSaleID, userID int64, quantity int) error {
-	stockKey := StockKey(flashSaleID)
-	boughtKey := BoughtKey(flashSaleID, userID)
+// ErrStockNotLoaded 庫存 Key 不存在（尚未預熱或已過期）
+var ErrStockNotLoaded = errors.New("stock not loaded in redis")
 
-	_, err := s.rdb.Eval(ctx, RestoreStockScript,
-		[]string{stockKey, boughtKey},
-		quantity,
-	).Result()
+// ErrStockNegative 調整後庫存為負數
+var ErrStockNegative = errors.New("stock would become negative")
+
+// AdjustStock 原子增減庫存（保留 TTL），itemID > 0 時同時調整規格庫存，返回調整後的活動庫存
+// 分片活動（僅單規格）依分片增減
+func (s *StockService) AdjustStock(ctx context.Context, flashSaleID, itemID int64, delta int) (int, error) {
+	shards, err := s.shardCount(ctx, flashSaleID)
+	if err != nil {
+		return 0, err
+	}
+	if shards > 0 {
+		stock, err := s.adjustShards(ctx, flashSaleID, shards, delta)
+		if err == nil {
+			s.events.Notify(flashSaleID)
+		}
+		return stock, err
+	}
 
+	res, err := s.rdb.Eval(ctx, AdjustStockScript,
+		[]string{StockKey(flashSaleID), ItemStockKey(flashSaleID, itemID)},
+		delta, flag(itemID > 0),
+	).Slice()
+	if err != nil {
+		return 0, fmt.Errorf("failed to execute adjust script: %w", err)
+	}
+	if len(res) != 2 {
+		return 0, fmt.Errorf("unexpected script result format")
+	}
+
+	code, _ := res[0].(int64)
+	switch code {
+	case 1:
+		stock, _ := res[1].(int64)
+		s.syncSoldOut(ctx, flashSaleID, int(stock))
+		s.events.Notify(flashSaleID)
+		return int(stock), nil
+	case -1:
+		return 0, ErrStockNegative
+	default:
+		return 0, ErrStockNotLoaded
+	}
+}
+
+// DeleteStock 刪除活動的庫存 Key（活動刪除時使用），含分片與分片數 Key
+func (s *StockService) DeleteStock(ctx context.Context, flashSaleID int64, itemIDs []int64) error {
+	shards, err := s.shardCount(ctx, flashSaleID)
+	if err != nil {
+		return err
+	}
+
+	keys := []string{StockKey(flashSaleID), StockShardsKey(flashSaleID)}
+	for _, itemID := range itemIDs {
+		keys = append(keys, ItemStockKey(flashSaleID, itemID))
+	}
+	keys = append(keys, shardKeys(flashSaleID, shards)...)
+
+	// 分片位於不同 slot，逐 Key 刪除
+	pipe := s.rdb.Pipeline()
+	for _, key := range keys {
+		pipe.Del(ctx, key)
+	}
+	_, err = pipe.Exec(ctx)
 	return err
 }
 
-// DistributedLock 分散式鎖，防止同一使用者重複提交
-type DistributedLock struct {
-	rdb   *redis.Client
-	key   string
-	value string // UUID，確保只有自己能解鎖
+// RestoreRequest 庫存恢復參數
+type RestoreRequest struct {
+	FlashSaleID int64
+	UserID      int64
+	ItemID      int64 // 規格 ID，0 表示單規格活動
+	Quantity    int
 }
 
-// NewDistributedLock 建立分散式鎖實例
-func NewDistributedLock(flashSaleID, userID int64) *DistributedLock {
-	return &DistributedLock{
-		rdb:   Get(),
-		key:   LockKey(flashSaleID, userID),
-		value: uuid.New().String(), // 每次鎖用不同 UUID
+// Restore 恢復庫存，多規格活動同時恢復規格庫存
+// 分片活動將庫存歸還使用者所屬分片，腳本只回滾已購數量
+func (s *StockService) Restore(ctx context.Context, req *RestoreRequest) error {
+	shards, err := s.shardCount(ctx, req.FlashSaleID)
+	if err != nil {
+		return err
+	}
+	if shards > 0 {
+		shard := utils.ShardIndex(req.UserID, shards)
+		if err := s.rdb.IncrBy(ctx, StockShardKey(req.FlashSaleID, shard), int64(req.Quantity)).Err(); err != nil {
+			return err
+		}
 	}
-}
 
-// Lock 嘗試加鎖，expireMs 為鎖的過期時間（毫秒）
-// 返回 true 表示加鎖成功，false 表示鎖已被其他人持有
-func (l *DistributedLock) Lock(ctx context.Context, expireMs int) (bool, error) {
-	result, err := l.rdb.Eval(ctx, DistributedLockScript,
-		[]string{l.key},
-		l.value, expireMs,
-	).Result()
+	stockKey := StockKey(req.FlashSaleID)
+	boughtKey := BoughtKey(req.FlashSaleID, req.UserID)
+	itemKey := ItemStockKey(req.FlashSaleID, req.ItemID)
 
+	_, err = s.rdb.Eval(ctx, RestoreStockScript,
+		[]string{stockKey, boughtKey, itemKey},
+		req.Quantity, flag(req.ItemID > 0), flag(shards == 0),
+	).Result()
 	if err != nil {
-		return false, err
+		return err
 	}
 
-	return result.(int64) == 1, nil
+	s.syncSoldOut(ctx, req.FlashSaleID, req.Quantity)
+	s.events.Notify(req.FlashSaleID)
+	return nil
 }
 
-// Unlock 釋放鎖（只有鎖的持有者才能成功釋放）
-func (l *DistributedLock) Unlock(ctx context.Context) error {
-	_, err := l.rdb.Eval(ctx, DistributedUnlockScript,
-		[]string{l.key},
-		l.value,
-	).Result()
+// syncSoldOut 依活動總庫存設定或清除本地售罄旗標並廣播
+// 廣播為盡力而為：失敗時其他實例的旗標在本地 TTL 後失效
+func (s *StockService) syncSoldOut(ctx context.Context, flashSaleID int64, stock int) {
+	if stock <= 0 {
+		_ = s.flags.Set(ctx, flashSaleID, SaleFlagSoldOut)
+		return
+	}
+	_ = s.flags.Clear(ctx, flashSaleID, SaleFlagSoldOut)
+}
 
-	return err
+// registerOutbox 扣減腳本新建 Outbox Stream 後加入註冊表
+// 盡力而為：訊息已與消費者群組一同寫入，註冊失敗時由下次預熱的 Register 補上
+func (s *StockService) registerOutbox(ctx context.Context, flashSaleID int64) {
+	_ = registerOutbox(ctx, s.rdb, flashSaleID)
+}
+
+// flag 將布林值轉為 Lua 腳本使用的 "1"/"0"
+func flag(b bool) string {
+	if b {
+		return "1"
+	}
+	return "0"
 }
@@ -0,0 +1,270 @@
+// 庫存變更事件
+//
+// 本檔案將庫存扣減/恢復轉為按活動聚合、限頻的庫存更新事件
+// 發布端：StockService 成功變更庫存後呼叫 Notify 標記活動，每個週期合併為一則 Pub/Sub 訊息
+// 訂閱端：收到訊息後標記活動，每個週期查詢一次最新庫存並分發給本地訂閱者（WebSocket、SSE）
+// 同一活動每個實例每週期最多發布一則訊息、最多分發一次更新，搶購高峰時不隨請求數放大
+package cache
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+)
+
+// StockEventChannel 庫存變更廣播頻道，訊息內容為活動 ID
+const StockEventChannel = "flash:stock_events"
+
+// StockEventInterval 庫存事件的聚合週期，同一活動每週期最多推送一次
+const StockEventInterval = 200 * time.Millisecond
+
+// StockUpdate 推送給客戶端的庫存更新
+type StockUpdate struct {
+	FlashSaleID int64 `json:"flash_sale_id"`
+	Stock       int   `json:"stock"`
+	SoldOut     bool  `json:"sold_out"`
+	Timestamp   int64 `json:"timestamp"` // 查詢庫存的時間（毫秒）
+}
+
+// StockLoader 查詢活動當前庫存
+type StockLoader func(ctx context.Context, flashSaleID int64) (int, error)
+
+// StockSubscription 單一活動的本地訂閱，C 只保留最新一則更新，消費較慢時舊更新直接被覆蓋
+type StockSubscription struct {
+	C           <-chan StockUpdate
+	flashSaleID int64
+	ch          chan StockUpdate
+	bus         *StockEventBus
+}
+
+// Close 取消訂閱並關閉 C，可重複呼叫
+func (s *StockSubscription) Close() {
+	s.bus.unsubscribe(s)
+}
+
+// StockEventBus 庫存事件匯流排（每個實例一份）
+type StockEventBus struct {
+	mu       sync.Mutex
+	dirty    map[int64]struct{}                        // 本實例已變更、待發布的活動
+	pending  map[int64]struct{}                        // 已收到變更、待分發的活動
+	subs     map[int64]map[*StockSubscription]struct{} // 活動 ID → 本地訂閱者
+	interval time.Duration
+	load     StockLoader
+}
+
+var stockEvents = &StockEventBus{
+	dirty:    make(map[int64]struct{}),
+	pending:  make(map[int64]struct{}),
+	subs:     make(map[int64]map[*StockSubscription]struct{}),
+	interval: StockEventInterval,
+}
+
+// StockEvents 取得本實例的庫存事件匯流排
+func StockEvents() *StockEventBus {
+	return stockEvents
+}
+
+// SetLoader 覆寫庫存查詢函式（預設為 StockService.GetStock）
+func (b *StockEventBus) SetLoader(load StockLoader) {
+	b.mu.Lock()
+	b.load = load
+	b.mu.Unlock()
+}
+
+// Notify 標記活動庫存已變更，不產生網路往返，於下個週期合併發布
+func (b *StockEventBus) Notify(flashSaleID int64) {
+	b.mu.Lock()
+	b.dirty[flashSaleID] = struct{}{}
+	b.mu.Unlock()
+}
+
+// Subscribe 訂閱活動的庫存更新，使用完畢需呼叫 Close
+func (b *StockEventBus) Subscribe(flashSaleID int64) *StockSubscription {
+	ch := make(chan StockUpdate, 1)
+	sub := &StockSubscription{C: ch, flashSaleID: flashSaleID, ch: ch, bus: b}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.subs[flashSaleID] == nil {
+		b.subs[flashSaleID] = make(map[*StockSubscription]struct{})
+	}
+	b.subs[flashSaleID][sub] = struct{}{}
+	return sub
+}
+
+func (b *StockEventBus) unsubscribe(sub *StockSubscription) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	subs, ok := b.subs[sub.flashSaleID]
+	if !ok {
+		return
+	}
+	if _, ok := subs[sub]; !ok {
+		return
+	}
+	delete(subs, sub)
+	if len(subs) == 0 {
+		delete(b.subs, sub.flashSaleID)
+	}
+	close(sub.ch)
+}
+
+// Snapshot 查詢活動當前庫存（訂閱建立時推送初始值用）
+func (b *StockEventBus) Snapshot(ctx context.Context, flashSaleID int64) (StockUpdate, error) {
+	stock, err := b.loader()(ctx, flashSaleID)
+	if err != nil {
+		return StockUpdate{}, err
+	}
+	return newStockUpdate(flashSaleID, stock), nil
+}
+
+// Run 啟動發布與訂閱迴圈直到 ctx 結束（阻塞）
+func (b *StockEventBus) Run(ctx context.Context, log *zap.Logger) {
+	go b.listen(ctx, log)
+
+	ticker := time.NewTicker(b.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			b.publish(ctx, log)
+			b.dispatch(ctx, log)
+		}
+	}
+}
+
+// listen 訂閱庫存變更頻道，只標記有本地訂閱者的活動
+func (b *StockEventBus) listen(ctx context.Context, log *zap.Logger) {
+	pubsub := Get().Subscribe(ctx, StockEventChannel)
+	defer pubsub.Close()
+
+	for {
+		msg, err := pubsub.Receive(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			log.Warn("stock event subscription error", zap.Error(err))
+			time.Sleep(time.Second)
+			continue
+		}
+
+		m, ok := msg.(*redis.Message)
+		if !ok {
+			continue
+		}
+		flashSaleID, err := strconv.ParseInt(m.Payload, 10, 64)
+		if err != nil {
+			log.Warn("invalid stock event message", zap.String("payload", m.Payload))
+			continue
+		}
+		b.markPending(flashSaleID)
+	}
+}
+
+func (b *StockEventBus) markPending(flashSaleID int64) {
+	b.mu.Lock()
+	if _, ok := b.subs[flashSaleID]; ok {
+		b.pending[flashSaleID] = struct{}{}
+	}
+	b.mu.Unlock()
+}
+
+// publish 將本週期變更的活動以一次 Pipeline 發布
+// 發布為盡力而為：失敗時略過本週期，下次庫存變更時會再次發布
+func (b *StockEventBus) publish(ctx context.Context, log *zap.Logger) {
+	ids := b.take(&b.dirty)
+	if len(ids) == 0 {
+		return
+	}
+
+	pipe := Get().Pipeline()
+	for _, id := range ids {
+		pipe.Publish(ctx, StockEventChannel, id)
+	}
+	if _, err := pipe.Exec(ctx); err != nil && ctx.Err() == nil {
+		log.Warn("failed to publish stock events", zap.Int("count", len(ids)), zap.Error(err))
+	}
+}
+
+// dispatch 查詢待分發活動的最新庫存並推送給本地訂閱者
+func (b *StockEventBus) dispatch(ctx context.Context, log *zap.Logger) {
+	ids := b.take(&b.pending)
+	if len(ids) == 0 {
+		return
+	}
+
+	load := b.loader()
+	for _, id := range ids {
+		stock, err := load(ctx, id)
+		if err != nil {
+			if ctx.Err() == nil {
+				log.Warn("failed to load stock for event", zap.Int64("flash_sale_id", id), zap.Error(err))
+			}
+			continue
+		}
+		b.deliver(newStockUpdate(id, stock))
+	}
+}
+
+// deliver 推送更新給活動的所有本地訂閱者，訂閱者尚未取走的舊更新會被取代
+func (b *StockEventBus) deliver(update StockUpdate) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for sub := range b.subs[update.FlashSaleID] {
+		select {
+		case sub.ch <- update:
+		default:
+			// 只有持鎖的 deliver 會寫入，取出舊值後必有空位
+			select {
+			case <-sub.ch:
+			default:
+			}
+			sub.ch <- update
+		}
+	}
+}
+
+// take 取出並清空待處理集合
+func (b *StockEventBus) take(set *map[int64]struct{}) []int64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if len(*set) == 0 {
+		return nil
+	}
+	ids := make([]int64, 0, len(*set))
+	for id := range *set {
+		ids = append(ids, id)
+	}
+	*set = make(map[int64]struct{})
+	return ids
+}
+
+func (b *StockEventBus) loader() StockLoader {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.load == nil {
+		b.load = NewStockService().GetStock
+	}
+	return b.load
+}
+
+func newStockUpdate(flashSaleID int64, stock int) StockUpdate {
+	return StockUpdate{
+		FlashSaleID: flashSaleID,
+		Stock:       stock,
+		SoldOut:     stock <= 0,
+		Timestamp:   time.Now().UnixMilli(),
+	}
+}
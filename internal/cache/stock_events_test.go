@@ -0,0 +1,82 @@
+// 庫存事件匯流排單元測試
+//
+// 測試覆蓋：
+// - 分發：只處理有本地訂閱者的活動，同一週期多次變更合併為一次查詢
+// - 訂閱：未取走的舊更新被最新值取代、Close 後關閉 C 且可重複呼叫
+package cache
+
+import (
+	"context"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+func newTestStockEventBus(stock map[int64]int, loads *int) *StockEventBus {
+	return &StockEventBus{
+		dirty:    make(map[int64]struct{}),
+		pending:  make(map[int64]struct{}),
+		subs:     make(map[int64]map[*StockSubscription]struct{}),
+		interval: StockEventInterval,
+		load: func(ctx context.Context, flashSaleID int64) (int, error) {
+			*loads++
+			return stock[flashSaleID], nil
+		},
+	}
+}
+
+func TestStockEventBus_Dispatch(t *testing.T) {
+	ctx := context.Background()
+	stock := map[int64]int{1: 5, 2: 7}
+	loads := 0
+	bus := newTestStockEventBus(stock, &loads)
+
+	sub := bus.Subscribe(1)
+	defer sub.Close()
+
+	// 同一週期內多次變更只查詢一次；無訂閱者的活動不查詢
+	bus.markPending(1)
+	bus.markPending(1)
+	bus.markPending(2)
+	bus.dispatch(ctx, zap.NewNop())
+
+	if loads != 1 {
+		t.Fatalf("loads = %d, want 1", loads)
+	}
+	select {
+	case update := <-sub.C:
+		if update.FlashSaleID != 1 || update.Stock != 5 || update.SoldOut {
+			t.Errorf("unexpected update %+v", update)
+		}
+	default:
+		t.Fatal("expected an update")
+	}
+
+	// 未再變更時不分發
+	bus.dispatch(ctx, zap.NewNop())
+	if loads != 1 {
+		t.Errorf("loads = %d after idle dispatch, want 1", loads)
+	}
+}
+
+func TestStockEventBus_KeepsLatest(t *testing.T) {
+	bus := newTestStockEventBus(nil, new(int))
+	sub := bus.Subscribe(1)
+
+	bus.deliver(newStockUpdate(1, 3))
+	bus.deliver(newStockUpdate(1, 0))
+
+	update := <-sub.C
+	if update.Stock != 0 || !update.SoldOut {
+		t.Errorf("got %+v, want latest sold-out update", update)
+	}
+
+	sub.Close()
+	sub.Close()
+	if _, ok := <-sub.C; ok {
+		t.Error("channel should be closed after Close")
+	}
+	if len(bus.subs) != 0 {
+		t.Errorf("subs = %d, want 0", len(bus.subs))
+	}
+}
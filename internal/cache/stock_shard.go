@@ -0,0 +1,331 @@
+// 分片庫存
+//
+// 熱門活動的單一庫存 Key 會讓所有流量集中在同一 Redis slot
+// 分片活動將庫存拆成 N 個分片 Key，每個分片使用獨立的 hash tag，在 Cluster 中分散到不同 slot
+// 使用者依 ID 雜湊固定落在一個分片，扣減時先試自己的分片，不足時再平衡後重試，最後依序嘗試其他分片
+// 分片數記錄於 flash:stock:{活動ID}:shards，查詢、調整、恢復庫存時據此判斷是否分片
+// 跨分片操作（再平衡、調整、設定）無法在 Cluster 中原子執行，先取出再放回，過程中總數可能短暫偏低但不會超賣
+package cache
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Mag1cFall/magtrade/internal/pkg/utils"
+	"github.com/redis/go-redis/v9"
+)
+
+// MaxStockShards 單一活動的庫存分片數上限
+const MaxStockShards = 64
+
+// StockShardsKey 生成分片數 Key，格式: flash:stock:{活動ID}:shards
+func StockShardsKey(flashSaleID int64) string {
+	return fmt.Sprintf("flash:stock:{%d}:shards", flashSaleID)
+}
+
+// StockShardKey 生成分片庫存 Key，格式: flash:stock:{活動ID:分片序號}
+// 每個分片自成一個 hash tag，在 Redis Cluster 中分散到不同 slot
+func StockShardKey(flashSaleID int64, shard int) string {
+	return fmt.Sprintf("flash:stock:{%d:%d}", flashSaleID, shard)
+}
+
+// shardKeys 生成活動全部分片 Key
+func shardKeys(flashSaleID int64, shards int) []string {
+	keys := make([]string, shards)
+	for i := range keys {
+		keys[i] = StockShardKey(flashSaleID, i)
+	}
+	return keys
+}
+
+// SetShardedStock 將庫存均分寫入各分片並記錄分片數（覆寫現有值，僅用於新建活動）
+func (s *StockService) SetShardedStock(ctx context.Context, flashSaleID int64, stock, shards int, ttl time.Duration) error {
+	pipe := s.rdb.Pipeline() // 分片位於不同 slot，不能使用 MULTI
+	for i, n := range utils.SplitEven(stock, shards) {
+		pipe.Set(ctx, StockShardKey(flashSaleID, i), n, ttl)
+	}
+	pipe.Set(ctx, StockShardsKey(flashSaleID), shards, ttl)
+	pipe.Del(ctx, StockKey(flashSaleID))
+	if _, err := pipe.Exec(ctx); err != nil {
+		return err
+	}
+	s.syncSoldOut(ctx, flashSaleID, stock)
+	return nil
+}
+
+// WarmUpShardedStock 預熱分片庫存：分片數 Key 不存在才載入，存在則只延長 TTL
+// 以 SETNX 分片數 Key 搶占載入權，避免多個實例同時重複寫入分片
+func (s *StockService) WarmUpShardedStock(ctx context.Context, flashSaleID int64, stock, shards int, ttl time.Duration) (bool, error) {
+	claimed, err := s.rdb.SetNX(ctx, StockShardsKey(flashSaleID), shards, ttl).Result()
+	if err != nil {
+		return false, err
+	}
+
+	if !claimed {
+		current, err := s.shardCount(ctx, flashSaleID)
+		if err != nil {
+			return false, err
+		}
+		pipe := s.rdb.Pipeline()
+		pipe.Expire(ctx, StockShardsKey(flashSaleID), ttl)
+		for _, key := range shardKeys(flashSaleID, current) {
+			pipe.Expire(ctx, key, ttl)
+		}
+		_, err = pipe.Exec(ctx)
+		return false, err
+	}
+
+	pipe := s.rdb.Pipeline()
+	for i, n := range utils.SplitEven(stock, shards) {
+		pipe.Set(ctx, StockShardKey(flashSaleID, i), n, ttl)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return false, err
+	}
+	s.syncSoldOut(ctx, flashSaleID, stock)
+	return true, nil
+}
+
+// shardCount 查詢活動的分片數，未分片返回 0
+func (s *StockService) shardCount(ctx context.Context, flashSaleID int64) (int, error) {
+	n, err := s.rdb.Get(ctx, StockShardsKey(flashSaleID)).Int()
+	if err == redis.Nil {
+		return 0, nil
+	}
+	return n, err
+}
+
+// shardStocks 查詢各分片庫存，不存在的分片視為 0
+// 逐 Key GET 而非 MGET，分片位於不同 slot 時 Cluster 仍可執行
+func (s *StockService) shardStocks(ctx context.Context, flashSaleID int64, shards int) ([]int, error) {
+	pipe := s.rdb.Pipeline()
+	cmds := make([]*redis.StringCmd, shards)
+	for i := range cmds {
+		cmds[i] = pipe.Get(ctx, StockShardKey(flashSaleID, i))
+	}
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, err
+	}
+
+	stocks := make([]int, shards)
+	for i, cmd := range cmds {
+		n, err := cmd.Int()
+		if err != nil && err != redis.Nil {
+			return nil, err
+		}
+		stocks[i] = n
+	}
+	return stocks, nil
+}
+
+// sumShards 查詢分片庫存合計
+func (s *StockService) sumShards(ctx context.Context, flashSaleID int64, shards int) (int, error) {
+	stocks, err := s.shardStocks(ctx, flashSaleID, shards)
+	if err != nil {
+		return 0, err
+	}
+	total := 0
+	for _, n := range stocks {
+		total += n
+	}
+	return total, nil
+}
+
+// ShardDeductResult 分片扣減結果
+type ShardDeductResult struct {
+	Success bool
+	Shard   int // 實際扣減的分片，失敗時為 -1
+}
+
+// DeductShard 從使用者所屬分片扣減庫存
+// 順序：使用者分片 → 再平衡後重試 → 依序嘗試其他分片；全部不足時視為售罄
+// 扣減後仍需執行准入腳本（StockTaken），准入失敗時呼叫 ReleaseShard 歸還
+func (s *StockService) DeductShard(ctx context.Context, flashSaleID, userID int64, shards, quantity int) (*ShardDeductResult, error) {
+	home := utils.ShardIndex(userID, shards)
+
+	ok, err := s.deductShard(ctx, flashSaleID, home, quantity)
+	if err != nil || ok {
+		return shardResult(ok, home), err
+	}
+
+	// 使用者分片已耗盡：將其他分片的剩餘庫存平均分回各分片後重試
+	total, err := s.RebalanceShards(ctx, flashSaleID, shards)
+	if err != nil {
+		return nil, err
+	}
+	if total < quantity {
+		s.syncSoldOut(ctx, flashSaleID, total)
+		return shardResult(false, -1), nil
+	}
+	if ok, err := s.deductShard(ctx, flashSaleID, home, quantity); err != nil || ok {
+		return shardResult(ok, home), err
+	}
+
+	// 剩餘庫存少於分片數時均分後部分分片為 0，依序嘗試其他分片
+	for i := 1; i < shards; i++ {
+		shard := (home + i) % shards
+		ok, err := s.deductShard(ctx, flashSaleID, shard, quantity)
+		if err != nil || ok {
+			return shardResult(ok, shard), err
+		}
+	}
+
+	// 剩餘庫存零散分布在各分片，單一分片皆不足購買數量
+	return shardResult(false, -1), nil
+}
+
+// deductShard 扣減單一分片
+func (s *StockService) deductShard(ctx context.Context, flashSaleID int64, shard, quantity int) (bool, error) {
+	remaining, err := s.rdb.Eval(ctx, ShardDeductScript,
+		[]string{StockShardKey(flashSaleID, shard)},
+		quantity,
+	).Int()
+	if err != nil {
+		return false, fmt.Errorf("failed to execute shard deduct script: %w", err)
+	}
+	if remaining >= 0 {
+		s.events.Notify(flashSaleID)
+	}
+	return remaining >= 0, nil
+}
+
+// shardResult 組裝分片扣減結果
+func shardResult(ok bool, shard int) *ShardDeductResult {
+	if !ok {
+		return &ShardDeductResult{Success: false, Shard: -1}
+	}
+	return &ShardDeductResult{Success: true, Shard: shard}
+}
+
+// ReleaseShard 歸還分片庫存（准入失敗或訂單取消時使用）
+func (s *StockService) ReleaseShard(ctx context.Context, flashSaleID int64, shard, quantity int) error {
+	if err := s.rdb.IncrBy(ctx, StockShardKey(flashSaleID, shard), int64(quantity)).Err(); err != nil {
+		return err
+	}
+	s.syncSoldOut(ctx, flashSaleID, quantity)
+	s.events.Notify(flashSaleID)
+	return nil
+}
+
+// RebalanceShards 將剩餘庫存重新均分至各分片，返回剩餘庫存合計
+// 先從高於目標值的分片取出多餘庫存，再補給低於目標值的分片
+// 取出與補給之間有其他請求扣減時，實際取出量可能少於計算值，不足部分留待下次再平衡
+func (s *StockService) RebalanceShards(ctx context.Context, flashSaleID int64, shards int) (int, error) {
+	stocks, err := s.shardStocks(ctx, flashSaleID, shards)
+	if err != nil {
+		return 0, err
+	}
+
+	total := 0
+	for _, n := range stocks {
+		total += n
+	}
+	target := utils.SplitEven(total, shards)
+
+	pool := 0
+	for i, n := range stocks {
+		if excess := n - target[i]; excess > 0 {
+			taken, err := s.takeShard(ctx, flashSaleID, i, excess)
+			if err != nil {
+				return 0, err
+			}
+			pool += taken
+		}
+	}
+
+	pipe := s.rdb.Pipeline()
+	for i, n := range stocks {
+		if pool == 0 {
+			break
+		}
+		if deficit := target[i] - n; deficit > 0 {
+			give := min(deficit, pool)
+			pipe.IncrBy(ctx, StockShardKey(flashSaleID, i), int64(give))
+			pool -= give
+		}
+	}
+	if pool > 0 { // 取出量與計算值不符時，剩餘部分放回第一個分片
+		pipe.IncrBy(ctx, StockShardKey(flashSaleID, 0), int64(pool))
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, err
+	}
+	return total, nil
+}
+
+// takeShard 從分片最多取出 want 件，返回實際取出數量
+func (s *StockService) takeShard(ctx context.Context, flashSaleID int64, shard, want int) (int, error) {
+	return s.rdb.Eval(ctx, ShardTakeScript,
+		[]string{StockShardKey(flashSaleID, shard)},
+		want,
+	).Int()
+}
+
+// adjustShards 分片活動增減庫存，返回調整後的庫存合計
+// 增加時均分至各分片；減少時依序從各分片取出，不足則全部放回並返回 ErrStockNegative
+func (s *StockService) adjustShards(ctx context.Context, flashSaleID int64, shards, delta int) (int, error) {
+	if delta >= 0 {
+		pipe := s.rdb.Pipeline()
+		for i, n := range utils.SplitEven(delta, shards) {
+			if n > 0 {
+				pipe.IncrBy(ctx, StockShardKey(flashSaleID, i), int64(n))
+			}
+		}
+		if _, err := pipe.Exec(ctx); err != nil {
+			return 0, err
+		}
+	} else {
+		want := -delta
+		taken := make([]int, shards)
+		for i := 0; i < shards && want > 0; i++ {
+			n, err := s.takeShard(ctx, flashSaleID, i, want)
+			if err != nil {
+				return 0, err
+			}
+			taken[i] = n
+			want -= n
+		}
+		if want > 0 {
+			pipe := s.rdb.Pipeline()
+			for i, n := range taken {
+				if n > 0 {
+					pipe.IncrBy(ctx, StockShardKey(flashSaleID, i), int64(n))
+				}
+			}
+			if _, err := pipe.Exec(ctx); err != nil {
+				return 0, err
+			}
+			return 0, ErrStockNegative
+		}
+	}
+
+	total, err := s.sumShards(ctx, flashSaleID, shards)
+	if err != nil {
+		return 0, err
+	}
+	s.syncSoldOut(ctx, flashSaleID, total)
+	return total, nil
+}
+
+// setShards 分片活動覆寫庫存（對帳修復用），僅當合計仍為 expected 時均分寫入
+// 檢查與寫入之間非原子，僅供活動非進行中且無在途訊息時使用
+func (s *StockService) setShards(ctx context.Context, flashSaleID int64, shards, expected, stock int) (bool, error) {
+	total, err := s.sumShards(ctx, flashSaleID, shards)
+	if err != nil {
+		return false, err
+	}
+	if total != expected {
+		return false, nil
+	}
+
+	pipe := s.rdb.Pipeline()
+	for i, n := range utils.SplitEven(stock, shards) {
+		pipe.SetArgs(ctx, StockShardKey(flashSaleID, i), n, redis.SetArgs{KeepTTL: true})
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return false, err
+	}
+	s.syncSoldOut(ctx, flashSaleID, stock)
+	return true, nil
+}
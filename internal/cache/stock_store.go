@@ -0,0 +1,61 @@
+// 庫存後端介面
+//
+// StockStore 抽象搶購熱路徑的庫存操作（初始化、查詢、扣減、准入、恢復），服務層依賴介面而非具體實作
+// StockCache 抽象活動庫存的佈建、預熱、規格庫存與分片扣減
+// 實作：StockService（Redis Lua 腳本，兩者皆實作）、grpc.StockClient（遠端庫存服務，僅 StockStore）、
+// MemoryStockStore（行程內，兩者皆實作，測試用）
+package cache
+
+import (
+	"context"
+	"time"
+)
+
+// StockStore 庫存後端
+type StockStore interface {
+	// InitStock 初始化活動庫存（覆寫現有值）
+	InitStock(ctx context.Context, flashSaleID int64, stock int) error
+	// GetStock 查詢活動庫存，未初始化視為 0
+	GetStock(ctx context.Context, flashSaleID int64) (int, error)
+	// Deduct 原子檢查庫存與限購後扣減並寫入 Outbox，失敗以 DeductResult.Code 表示而非 error
+	Deduct(ctx context.Context, req *DeductRequest) (*DeductResult, error)
+	// Admit 准入檢查（狀態/時間、查重、限購）、扣減並寫入 Outbox，失敗以 AdmitResult.Code 表示而非 error
+	Admit(ctx context.Context, req *AdmitRequest) (*AdmitResult, error)
+	// Restore 恢復庫存並回滾使用者已購數量
+	Restore(ctx context.Context, req *RestoreRequest) error
+}
+
+// StockCache 活動庫存佈建與分片操作
+type StockCache interface {
+	// SetStock 設定活動庫存（覆寫現有值，僅用於新建活動）
+	SetStock(ctx context.Context, flashSaleID int64, stock int, ttl time.Duration) error
+	// SetShardedStock 將庫存均分寫入各分片（覆寫現有值，僅用於新建活動）
+	SetShardedStock(ctx context.Context, flashSaleID int64, stock, shards int, ttl time.Duration) error
+	// SetItemStock 設定規格庫存（覆寫現有值，僅用於新建活動）
+	SetItemStock(ctx context.Context, flashSaleID, itemID int64, stock int, ttl time.Duration) error
+	// WarmUpStock 預熱庫存：不存在才載入，返回 true 表示本次重新載入
+	WarmUpStock(ctx context.Context, flashSaleID int64, stock int, ttl time.Duration) (bool, error)
+	// WarmUpShardedStock 預熱分片庫存：不存在才載入
+	WarmUpShardedStock(ctx context.Context, flashSaleID int64, stock, shards int, ttl time.Duration) (bool, error)
+	// WarmUpItemStock 預熱規格庫存：不存在才載入
+	WarmUpItemStock(ctx context.Context, flashSaleID, itemID int64, stock int, ttl time.Duration) (bool, error)
+	// AdjustStock 增減庫存（itemID > 0 時同時調整規格庫存），返回調整後的活動庫存
+	AdjustStock(ctx context.Context, flashSaleID, itemID int64, delta int) (int, error)
+	// DeleteStock 刪除活動的全部庫存資料（活動刪除時使用）
+	DeleteStock(ctx context.Context, flashSaleID int64, itemIDs []int64) error
+	// PeekStock 查詢庫存並區分是否已載入
+	PeekStock(ctx context.Context, flashSaleID int64) (int, bool, error)
+	// GetItemStocks 批量查詢規格庫存，未載入的規格視為 0
+	GetItemStocks(ctx context.Context, flashSaleID int64, itemIDs []int64) (map[int64]int, error)
+	// RestoreBought 回填使用者已購數量（已存在則保留）
+	RestoreBought(ctx context.Context, flashSaleID int64, bought map[int64]int, ttl time.Duration) error
+	// DeductShard 從使用者所屬分片扣減庫存
+	DeductShard(ctx context.Context, flashSaleID, userID int64, shards, quantity int) (*ShardDeductResult, error)
+	// ReleaseShard 歸還分片庫存
+	ReleaseShard(ctx context.Context, flashSaleID int64, shard, quantity int) error
+}
+
+var (
+	_ StockStore = (*StockService)(nil)
+	_ StockCache = (*StockService)(nil)
+)
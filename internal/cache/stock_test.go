@@ -0,0 +1,82 @@
+// 庫存服務整合測試
+//
+// 測試覆蓋：
+// - 庫存 Key 不存在（未預熱或已過期）時 Deduct / Admit 被拒絕，但不設定售罄旗標；庫存為 0 時才設定
+// 需要可用的 Redis：REDIS_TEST_ADDR=127.0.0.1:6379 go test -run StockService ./internal/cache/
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+const testStockSaleID int64 = 900000501
+
+// setupTestStock 寫入進行中活動的中繼資料（不載入庫存），返回使用獨立旗標快取的庫存服務
+func setupTestStock(t *testing.T) (context.Context, *StockService) {
+	t.Helper()
+	ctx := setupTestRedis(t)
+
+	cleanup := func() {
+		rdb.Del(ctx, FlashSaleMetaKey(testStockSaleID), StockKey(testStockSaleID), OutboxKey(testStockSaleID))
+		rdb.SRem(ctx, OutboxRegistryKey, OutboxKey(testStockSaleID))
+	}
+	cleanup()
+	t.Cleanup(cleanup)
+
+	now := time.Now()
+	if err := rdb.HSet(ctx, FlashSaleMetaKey(testStockSaleID), map[string]interface{}{
+		"status":         1,
+		"start_ms":       now.Add(-time.Minute).UnixMilli(),
+		"end_ms":         now.Add(time.Hour).UnixMilli(),
+		"per_user_limit": 1,
+	}).Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	flags := &SaleFlagCache{flags: make(map[int64]saleFlagEntry), ttl: saleFlagTTL}
+	return ctx, &StockService{rdb: rdb, flags: flags, events: StockEvents()}
+}
+
+func TestStockService_MissingStockKeyNotSoldOut(t *testing.T) {
+	ctx, stock := setupTestStock(t)
+
+	deduct := func() *DeductResult {
+		t.Helper()
+		res, err := stock.Deduct(ctx, &DeductRequest{FlashSaleID: testStockSaleID, UserID: 1, Quantity: 1, Limit: 1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res
+	}
+	admit := func() *AdmitResult {
+		t.Helper()
+		res, err := stock.Admit(ctx, &AdmitRequest{FlashSaleID: testStockSaleID, UserID: 1, Quantity: 1, Payload: "order", Retention: time.Minute})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res
+	}
+
+	if res := deduct(); res.Success || res.Remaining != 0 {
+		t.Errorf("Deduct() without stock key = %+v, want rejected", res)
+	}
+	if res := admit(); res.Code != AdmitSoldOut {
+		t.Errorf("Admit() without stock key code = %d, want %d", res.Code, AdmitSoldOut)
+	}
+	if flag := stock.flags.Check(testStockSaleID); flag == SaleFlagSoldOut {
+		t.Fatal("sold out flag set for missing stock key")
+	}
+
+	// 庫存已載入且為 0：設定售罄旗標
+	if err := rdb.Set(ctx, StockKey(testStockSaleID), 0, time.Hour).Err(); err != nil {
+		t.Fatal(err)
+	}
+	if res := admit(); res.Code != AdmitSoldOut {
+		t.Errorf("Admit() with zero stock code = %d, want %d", res.Code, AdmitSoldOut)
+	}
+	if flag := stock.flags.Check(testStockSaleID); flag != SaleFlagSoldOut {
+		t.Errorf("flag = %d, want sold out", flag)
+	}
+}
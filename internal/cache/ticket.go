@@ -0,0 +1,101 @@
+// 搶購憑證狀態快取
+//
+// 本檔案以 Redis Hash 記錄搶購憑證（Ticket）對應的處理結果
+// 狀態流轉：queued（排隊中）→ processing（已扣減庫存，訂單建立中）→ success / failed
+// 供客戶端在 WebSocket 推送遺失時輪詢查詢；記錄在 TTL 後自動清除
+package cache
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// TicketStatus 搶購憑證狀態
+type TicketStatus string
+
+const (
+	TicketStatusQueued     TicketStatus = "queued"     // 排隊模式等待放行
+	TicketStatusProcessing TicketStatus = "processing" // 已扣減庫存，等待訂單建立
+	TicketStatusSuccess    TicketStatus = "success"    // 訂單建立成功
+	TicketStatusFailed     TicketStatus = "failed"     // 搶購或訂單建立失敗
+)
+
+// TicketTTL 憑證狀態的保留時間
+const TicketTTL = time.Hour
+
+// TicketKey 生成憑證 Key，格式: flash:ticket:{ticket}
+func TicketKey(ticket string) string {
+	return fmt.Sprintf("flash:ticket:%s", ticket)
+}
+
+// TicketRecord 憑證處理結果
+type TicketRecord struct {
+	Ticket      string       `json:"ticket"`
+	UserID      int64        `json:"-"`
+	FlashSaleID int64        `json:"flash_sale_id"`
+	Status      TicketStatus `json:"status"`
+	OrderNo     string       `json:"order_no,omitempty"`
+	Reason      string       `json:"reason,omitempty"` // 失敗原因
+	UpdatedAt   time.Time    `json:"updated_at"`
+}
+
+// TicketStore 憑證狀態存取
+type TicketStore struct {
+	rdb redis.UniversalClient
+}
+
+func NewTicketStore() *TicketStore {
+	return &TicketStore{rdb: Get()}
+}
+
+// Set 寫入憑證狀態，已到終態的憑證不會回退，返回是否實際更新
+func (s *TicketStore) Set(ctx context.Context, record *TicketRecord) (bool, error) {
+	updatedAt := record.UpdatedAt
+	if updatedAt.IsZero() {
+		updatedAt = time.Now()
+	}
+
+	updated, err := s.rdb.Eval(ctx, TicketSetScript,
+		[]string{TicketKey(record.Ticket)},
+		string(record.Status),
+		record.UserID,
+		record.FlashSaleID,
+		record.OrderNo,
+		record.Reason,
+		updatedAt.Unix(),
+		int(TicketTTL.Seconds()),
+	).Int()
+	if err != nil {
+		return false, err
+	}
+	return updated == 1, nil
+}
+
+// Get 查詢憑證狀態，不存在或已過期返回 nil
+func (s *TicketStore) Get(ctx context.Context, ticket string) (*TicketRecord, error) {
+	fields, err := s.rdb.HGetAll(ctx, TicketKey(ticket)).Result()
+	if err != nil {
+		return nil, err
+	}
+	if len(fields) == 0 {
+		return nil, nil
+	}
+
+	userID, _ := strconv.ParseInt(fields["user_id"], 10, 64)
+	flashSaleID, _ := strconv.ParseInt(fields["flash_sale_id"], 10, 64)
+	updatedAt, _ := strconv.ParseInt(fields["updated_at"], 10, 64)
+
+	return &TicketRecord{
+		Ticket:      ticket,
+		UserID:      userID,
+		FlashSaleID: flashSaleID,
+		Status:      TicketStatus(fields["status"]),
+		OrderNo:     fields["order_no"],
+		Reason:      fields["reason"],
+		UpdatedAt:   time.Unix(updatedAt, 0),
+	}, nil
+}
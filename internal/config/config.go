@@ -25,6 +25,9 @@ type Config struct {
 	Log       LogConfig       `mapstructure:"log"`
 	RateLimit RateLimitConfig `mapstructure:"rate_limit"`
 	Email     EmailConfig     `mapstructure:"email"`
+	Scheduler SchedulerConfig `mapstructure:"scheduler"`
+	Rush      RushConfig      `mapstructure:"rush"`
+	Payment   PaymentConfig   `mapstructure:"payment"`
 }
 
 // ServerConfig HTTP 伺服器配置
@@ -57,13 +60,26 @@ func (d *DatabaseConfig) DSN() string {
 	)
 }
 
+// Redis 部署模式
+const (
+	RedisModeSingle   = "single"   // 單節點（預設）
+	RedisModeSentinel = "sentinel" // Sentinel 管理的主從
+	RedisModeCluster  = "cluster"  // Redis Cluster
+)
+
 // RedisConfig Redis 快取配置
+// single 模式使用 Host/Port；sentinel 模式使用 MasterName/SentinelAddrs；cluster 模式使用 ClusterAddrs（不支援 DB）
 type RedisConfig struct {
-	Host     string `mapstructure:"host"`
-	Port     int    `mapstructure:"port"`
-	Password string `mapstructure:"password"`
-	DB       int    `mapstructure:"db"`
-	PoolSize int    `mapstructure:"pool_size"`
+	Mode             string   `mapstructure:"mode"` // single / sentinel / cluster，空值為 single
+	Host             string   `mapstructure:"host"`
+	Port             int      `mapstructure:"port"`
+	Password         string   `mapstructure:"password"`
+	DB               int      `mapstructure:"db"`
+	PoolSize         int      `mapstructure:"pool_size"`
+	MasterName       string   `mapstructure:"master_name"`       // Sentinel 監控的主節點名稱
+	SentinelAddrs    []string `mapstructure:"sentinel_addrs"`    // Sentinel 節點位址
+	SentinelPassword string   `mapstructure:"sentinel_password"` // Sentinel 本身的密碼，通常與資料節點不同
+	ClusterAddrs     []string `mapstructure:"cluster_addrs"`     // Cluster 種子節點位址
 }
 
 // Addr 生成 Redis 連線地址
@@ -125,6 +141,32 @@ type EmailConfig struct {
 	FromName     string `mapstructure:"from_name"`
 }
 
+// SchedulerConfig 定時任務配置
+type SchedulerConfig struct {
+	TemplateHorizon time.Duration `mapstructure:"template_horizon"` // 依範本提前產生活動的時間範圍，0 使用預設值
+	LeaderTTL       time.Duration `mapstructure:"leader_ttl"`       // 定時任務領導者任期，0 使用預設值；實例停止未卸任時最長經過此時間由其他實例接手
+}
+
+// RushConfig 搶購流程配置
+type RushConfig struct {
+	LegacyAdmission bool `mapstructure:"legacy_admission"` // 使用舊流程（DB 查重 + 使用者鎖 + 扣減腳本），預設單一准入腳本
+}
+
+// PaymentConfig 支付閘道配置
+type PaymentConfig struct {
+	Provider      string            `mapstructure:"provider"`        // 預設支付供應商，目前支援 mock
+	NotifyBaseURL string            `mapstructure:"notify_base_url"` // 供應商非同步回調的站點位址，回調路徑為 /api/v1/payments/webhook/{provider}
+	Mock          MockPaymentConfig `mapstructure:"mock"`
+}
+
+// MockPaymentConfig 本地模擬支付配置
+type MockPaymentConfig struct {
+	Secret      string        `mapstructure:"secret"`       // 回調簽名密鑰
+	Delay       time.Duration `mapstructure:"delay"`        // 建立支付後多久完成並回調
+	Outcome     string        `mapstructure:"outcome"`      // success / fail / random
+	SuccessRate float64       `mapstructure:"success_rate"` // outcome 為 random 時的成功率
+}
+
 var cfg *Config // 全域配置實例
 
 // Load 載入配置檔
@@ -208,6 +250,21 @@ func expandEnvVars(c *Config) {
 	} else {
 		c.Redis.Password = expandEnv(c.Redis.Password)
 	}
+	if v := os.Getenv("REDIS_MODE"); v != "" {
+		c.Redis.Mode = v
+	}
+	if v := os.Getenv("REDIS_MASTER_NAME"); v != "" {
+		c.Redis.MasterName = v
+	} else {
+		c.Redis.MasterName = expandEnv(c.Redis.MasterName)
+	}
+	if v := os.Getenv("REDIS_SENTINEL_PASSWORD"); v != "" {
+		c.Redis.SentinelPassword = v
+	} else {
+		c.Redis.SentinelPassword = expandEnv(c.Redis.SentinelPassword)
+	}
+	c.Redis.SentinelAddrs = expandAddrs(os.Getenv("REDIS_SENTINEL_ADDRS"), c.Redis.SentinelAddrs)
+	c.Redis.ClusterAddrs = expandAddrs(os.Getenv("REDIS_CLUSTER_ADDRS"), c.Redis.ClusterAddrs)
 
 	// JWT 配置
 	if v := os.Getenv("JWT_SECRET"); v != "" {
@@ -216,6 +273,18 @@ func expandEnvVars(c *Config) {
 		c.JWT.Secret = expandEnv(c.JWT.Secret)
 	}
 
+	// 支付配置
+	if v := os.Getenv("PAYMENT_MOCK_SECRET"); v != "" {
+		c.Payment.Mock.Secret = v
+	} else {
+		c.Payment.Mock.Secret = expandEnv(c.Payment.Mock.Secret)
+	}
+	if v := os.Getenv("PAYMENT_NOTIFY_BASE_URL"); v != "" {
+		c.Payment.NotifyBaseURL = v
+	} else {
+		c.Payment.NotifyBaseURL = expandEnv(c.Payment.NotifyBaseURL)
+	}
+
 	// AI 配置
 	if v := os.Getenv("AI_API_KEY"); v != "" {
 		c.AI.APIKey = v
@@ -265,3 +334,18 @@ func expandEnv(s string) string {
 	}
 	return s
 }
+
+// expandAddrs 解析位址列表：環境變數（逗號分隔）優先，否則展開配置檔中的 ${VAR}
+func expandAddrs(env string, addrs []string) []string {
+	if env != "" {
+		addrs = strings.Split(env, ",")
+	}
+
+	result := make([]string, 0, len(addrs))
+	for _, addr := range addrs {
+		if addr = strings.TrimSpace(expandEnv(addr)); addr != "" {
+			result = append(result, addr)
+		}
+	}
+	return result
+}
@@ -39,6 +39,7 @@ func Init(cfg *config.DatabaseConfig, log *zap.Logger) error {
 		Logger:                                   gormLogger,
 		PrepareStmt:                              true, // 預編譯語句
 		DisableForeignKeyConstraintWhenMigrating: false,
+		TranslateError:                           true, // 唯一鍵衝突轉為 gorm.ErrDuplicatedKey
 	})
 	if err != nil {
 		return fmt.Errorf("failed to connect database: %w", err)
@@ -74,7 +75,16 @@ func AutoMigrate() error {
 		&model.User{},
 		&model.Product{},
 		&model.FlashSale{},
+		&model.FlashSaleItem{},
+		&model.FlashSaleTemplate{},
+		&model.PurchaseLimitPolicy{},
+		&model.RaffleEntry{},
+		&model.RaffleDraw{},
+		&model.Reservation{},
 		&model.Order{},
+		&model.OrderStatusHistory{},
+		&model.Payment{},
+		&model.Refund{},
 		&model.ChatHistory{},
 		&model.AIRecommendation{},
 	)
@@ -142,6 +152,11 @@ func Get() *gorm.DB {
 	return db
 }
 
+// Set 以既有連線取代全域連線（整合測試連線測試資料庫時使用）
+func Set(conn *gorm.DB) {
+	db = conn
+}
+
 // Close 關閉資料庫連線
 func Close() error {
 	if db == nil {
@@ -2,14 +2,18 @@ package grpc
 
 import (
 	"context"
+	"errors"
 	"time"
 
+	"github.com/Mag1cFall/magtrade/internal/cache"
 	pb "github.com/Mag1cFall/magtrade/proto"
 	"go.uber.org/zap"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials/insecure"
 )
 
+var _ cache.StockStore = (*StockClient)(nil)
+
 type StockClient struct {
 	conn   *grpc.ClientConn
 	client pb.StockServiceClient
@@ -43,58 +47,105 @@ func (c *StockClient) GetStock(ctx context.Context, flashSaleID int64) (int, err
 	if err != nil {
 		return 0, err
 	}
+	if !resp.Success {
+		return 0, errors.New(resp.Message)
+	}
 
 	return int(resp.Stock), nil
 }
 
-type DeductResult struct {
-	Success bool
-	Code    int
-	Message string
+// Deduct 透過遠端庫存服務扣減（含規格庫存與 Outbox 寫入）
+func (c *StockClient) Deduct(ctx context.Context, req *cache.DeductRequest) (*cache.DeductResult, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	resp, err := c.client.DeductStock(ctx, &pb.DeductStockRequest{
+		FlashSaleId:      req.FlashSaleID,
+		UserId:           req.UserID,
+		Quantity:         int32(req.Quantity),
+		Limit:            int32(req.Limit),
+		ItemId:           req.ItemID,
+		Payload:          req.Payload,
+		BoughtTtlSeconds: int64(req.BoughtTTL.Seconds()),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if resp.Code == codeServerError {
+		return nil, errors.New(resp.Message)
+	}
+
+	return &cache.DeductResult{
+		Success:   resp.Success,
+		Code:      int(resp.Code),
+		Message:   resp.Message,
+		Remaining: int(resp.Remaining),
+	}, nil
 }
 
-func (c *StockClient) DeductStock(ctx context.Context, flashSaleID, userID int64, quantity, limit int) (*DeductResult, error) {
+// Admit 透過遠端庫存服務執行准入腳本
+func (c *StockClient) Admit(ctx context.Context, req *cache.AdmitRequest) (*cache.AdmitResult, error) {
 	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
 
-	resp, err := c.client.DeductStock(ctx, &pb.DeductStockRequest{
-		FlashSaleId: flashSaleID,
-		UserId:      userID,
-		Quantity:    int32(quantity),
-		Limit:       int32(limit),
+	resp, err := c.client.AdmitStock(ctx, &pb.AdmitStockRequest{
+		FlashSaleId:      req.FlashSaleID,
+		UserId:           req.UserID,
+		ItemId:           req.ItemID,
+		Quantity:         int32(req.Quantity),
+		Payload:          req.Payload,
+		RetentionSeconds: int64(req.Retention.Seconds()),
+		StockTaken:       req.StockTaken,
 	})
 	if err != nil {
 		return nil, err
 	}
+	if resp.Code == codeServerError {
+		return nil, errors.New(resp.Message)
+	}
 
-	return &DeductResult{
-		Success: resp.Success,
-		Code:    int(resp.Code),
-		Message: resp.Message,
+	return &cache.AdmitResult{
+		Code:      cache.AdmitCode(resp.Code),
+		Message:   resp.Message,
+		Remaining: int(resp.Remaining),
 	}, nil
 }
 
-func (c *StockClient) RestoreStock(ctx context.Context, flashSaleID, userID int64, quantity int) error {
+// Restore 透過遠端庫存服務恢復庫存
+func (c *StockClient) Restore(ctx context.Context, req *cache.RestoreRequest) error {
 	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
 
-	_, err := c.client.RestoreStock(ctx, &pb.RestoreStockRequest{
-		FlashSaleId: flashSaleID,
-		UserId:      userID,
-		Quantity:    int32(quantity),
+	resp, err := c.client.RestoreStock(ctx, &pb.RestoreStockRequest{
+		FlashSaleId: req.FlashSaleID,
+		UserId:      req.UserID,
+		Quantity:    int32(req.Quantity),
+		ItemId:      req.ItemID,
 	})
-	return err
+	if err != nil {
+		return err
+	}
+	if !resp.Success {
+		return errors.New(resp.Message)
+	}
+	return nil
 }
 
 func (c *StockClient) InitStock(ctx context.Context, flashSaleID int64, stock int) error {
 	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
 
-	_, err := c.client.InitStock(ctx, &pb.InitStockRequest{
+	resp, err := c.client.InitStock(ctx, &pb.InitStockRequest{
 		FlashSaleId: flashSaleID,
 		Stock:       int32(stock),
 	})
-	return err
+	if err != nil {
+		return err
+	}
+	if !resp.Success {
+		return errors.New(resp.Message)
+	}
+	return nil
 }
 
 func (c *StockClient) Close() error {
@@ -0,0 +1,132 @@
+// 遠端庫存服務測試
+//
+// 以 bufconn 在行程內啟動 StockServer（後端為 cache.MemoryStockStore），經由 StockClient 呼叫
+// 測試覆蓋：
+// - Admit: 准入結果碼、Outbox 訊息與規格庫存經由遠端呼叫保持一致
+// - Deduct: 規格庫存與 Outbox 寫入、剩餘庫存回傳
+// - Restore: 恢復規格庫存
+package grpc
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/Mag1cFall/magtrade/internal/cache"
+	"github.com/Mag1cFall/magtrade/internal/model"
+	pb "github.com/Mag1cFall/magtrade/proto"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// newTestStockClient 啟動以 store 為後端的行程內庫存服務並返回客戶端
+func newTestStockClient(t *testing.T, store cache.StockStore) *StockClient {
+	t.Helper()
+
+	lis := bufconn.Listen(1 << 20)
+	server := grpc.NewServer()
+	pb.RegisterStockServiceServer(server, NewStockServer(store, zap.NewNop()))
+	go func() { _ = server.Serve(lis) }()
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &StockClient{conn: conn, client: pb.NewStockServiceClient(conn), log: zap.NewNop()}
+	t.Cleanup(func() { _ = client.Close() })
+	return client
+}
+
+func TestStockClient_Admit(t *testing.T) {
+	ctx := context.Background()
+	store := cache.NewMemoryStockStore()
+	_ = store.InitStock(ctx, 1, 3)
+	_ = store.SetItemStock(ctx, 1, 7, 1, 0)
+	client := newTestStockClient(t, store)
+
+	res, err := client.Admit(ctx, &cache.AdmitRequest{FlashSaleID: 1, UserID: 100, ItemID: 7, Quantity: 1, Payload: "order-100"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Code != cache.AdmitMetaMissing {
+		t.Errorf("Admit() before meta code = %d, want %d", res.Code, cache.AdmitMetaMissing)
+	}
+
+	now := time.Now()
+	store.SetMeta(&model.FlashSale{
+		ID:           1,
+		Status:       model.FlashSaleStatusActive,
+		PerUserLimit: 1,
+		StartTime:    now.Add(-time.Minute),
+		EndTime:      now.Add(time.Hour),
+	})
+
+	res, err = client.Admit(ctx, &cache.AdmitRequest{FlashSaleID: 1, UserID: 100, ItemID: 7, Quantity: 1, Payload: "order-100", Retention: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Code != cache.AdmitOK || res.Remaining != 2 {
+		t.Errorf("Admit() = %+v, want ok with 2 remaining", res)
+	}
+
+	res, err = client.Admit(ctx, &cache.AdmitRequest{FlashSaleID: 1, UserID: 200, ItemID: 7, Quantity: 1, Payload: "order-200"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Code != cache.AdmitSoldOut {
+		t.Errorf("Admit() sold out item code = %d, want %d", res.Code, cache.AdmitSoldOut)
+	}
+
+	if outbox := store.Outbox(1); len(outbox) != 1 || outbox[0] != "order-100" {
+		t.Errorf("outbox = %v, want [order-100]", outbox)
+	}
+}
+
+func TestStockClient_DeductAndRestore(t *testing.T) {
+	ctx := context.Background()
+	store := cache.NewMemoryStockStore()
+	_ = store.InitStock(ctx, 1, 5)
+	_ = store.SetItemStock(ctx, 1, 7, 2, 0)
+	client := newTestStockClient(t, store)
+
+	res, err := client.Deduct(ctx, &cache.DeductRequest{
+		FlashSaleID: 1,
+		UserID:      100,
+		ItemID:      7,
+		Quantity:    2,
+		Limit:       2,
+		Payload:     "order-100",
+		BoughtTTL:   time.Hour,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.Success || res.Remaining != 3 {
+		t.Errorf("Deduct() = %+v, want success with 3 remaining", res)
+	}
+	if got := store.ItemStock(1, 7); got != 0 {
+		t.Errorf("item stock = %d, want 0", got)
+	}
+	if got := len(store.Outbox(1)); got != 1 {
+		t.Errorf("outbox size = %d, want 1", got)
+	}
+
+	if err := client.Restore(ctx, &cache.RestoreRequest{FlashSaleID: 1, UserID: 100, ItemID: 7, Quantity: 2}); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := client.GetStock(ctx, 1); got != 5 {
+		t.Errorf("stock after restore = %d, want 5", got)
+	}
+	if got := store.ItemStock(1, 7); got != 2 {
+		t.Errorf("item stock after restore = %d, want 2", got)
+	}
+}
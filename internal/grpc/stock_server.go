@@ -3,6 +3,7 @@ package grpc
 import (
 	"context"
 	"net"
+	"time"
 
 	"github.com/Mag1cFall/magtrade/internal/cache"
 	pb "github.com/Mag1cFall/magtrade/proto"
@@ -11,21 +12,24 @@ import (
 	"google.golang.org/grpc/reflection"
 )
 
+// codeServerError 伺服端執行失敗（Redis 錯誤等）時 DeductStockResponse 與 AdmitStockResponse 的 code
+const codeServerError = -99
+
 type StockServer struct {
 	pb.UnimplementedStockServiceServer
-	stockService *cache.StockService
-	log          *zap.Logger
+	store cache.StockStore
+	log   *zap.Logger
 }
 
-func NewStockServer(log *zap.Logger) *StockServer {
+func NewStockServer(store cache.StockStore, log *zap.Logger) *StockServer {
 	return &StockServer{
-		stockService: cache.NewStockService(),
-		log:          log,
+		store: store,
+		log:   log,
 	}
 }
 
 func (s *StockServer) GetStock(ctx context.Context, req *pb.GetStockRequest) (*pb.GetStockResponse, error) {
-	stock, err := s.stockService.GetStock(ctx, req.FlashSaleId)
+	stock, err := s.store.GetStock(ctx, req.FlashSaleId)
 	if err != nil {
 		return &pb.GetStockResponse{
 			Success: false,
@@ -41,24 +45,62 @@ func (s *StockServer) GetStock(ctx context.Context, req *pb.GetStockRequest) (*p
 }
 
 func (s *StockServer) DeductStock(ctx context.Context, req *pb.DeductStockRequest) (*pb.DeductStockResponse, error) {
-	result, err := s.stockService.DeductStock(ctx, req.FlashSaleId, req.UserId, int(req.Quantity), int(req.Limit))
+	result, err := s.store.Deduct(ctx, &cache.DeductRequest{
+		FlashSaleID: req.FlashSaleId,
+		UserID:      req.UserId,
+		ItemID:      req.ItemId,
+		Quantity:    int(req.Quantity),
+		Limit:       int(req.Limit),
+		Payload:     req.Payload,
+		BoughtTTL:   time.Duration(req.BoughtTtlSeconds) * time.Second,
+	})
 	if err != nil {
 		return &pb.DeductStockResponse{
 			Success: false,
-			Code:    -99,
+			Code:    codeServerError,
 			Message: err.Error(),
 		}, nil
 	}
 
 	return &pb.DeductStockResponse{
-		Success: result.Success,
-		Code:    int32(result.Code),
-		Message: result.Message,
+		Success:   result.Success,
+		Code:      int32(result.Code),
+		Message:   result.Message,
+		Remaining: int32(result.Remaining),
+	}, nil
+}
+
+func (s *StockServer) AdmitStock(ctx context.Context, req *pb.AdmitStockRequest) (*pb.AdmitStockResponse, error) {
+	result, err := s.store.Admit(ctx, &cache.AdmitRequest{
+		FlashSaleID: req.FlashSaleId,
+		UserID:      req.UserId,
+		ItemID:      req.ItemId,
+		Quantity:    int(req.Quantity),
+		Payload:     req.Payload,
+		Retention:   time.Duration(req.RetentionSeconds) * time.Second,
+		StockTaken:  req.StockTaken,
+	})
+	if err != nil {
+		return &pb.AdmitStockResponse{
+			Code:    codeServerError,
+			Message: err.Error(),
+		}, nil
+	}
+
+	return &pb.AdmitStockResponse{
+		Code:      int32(result.Code),
+		Message:   result.Message,
+		Remaining: int32(result.Remaining),
 	}, nil
 }
 
 func (s *StockServer) RestoreStock(ctx context.Context, req *pb.RestoreStockRequest) (*pb.RestoreStockResponse, error) {
-	err := s.stockService.RestoreStock(ctx, req.FlashSaleId, req.UserId, int(req.Quantity))
+	err := s.store.Restore(ctx, &cache.RestoreRequest{
+		FlashSaleID: req.FlashSaleId,
+		UserID:      req.UserId,
+		ItemID:      req.ItemId,
+		Quantity:    int(req.Quantity),
+	})
 	if err != nil {
 		return &pb.RestoreStockResponse{
 			Success: false,
@@ -73,7 +115,7 @@ func (s *StockServer) RestoreStock(ctx context.Context, req *pb.RestoreStockRequ
 }
 
 func (s *StockServer) InitStock(ctx context.Context, req *pb.InitStockRequest) (*pb.InitStockResponse, error) {
-	err := s.stockService.InitStock(ctx, req.FlashSaleId, int(req.Stock))
+	err := s.store.InitStock(ctx, req.FlashSaleId, int(req.Stock))
 	if err != nil {
 		return &pb.InitStockResponse{
 			Success: false,
@@ -87,14 +129,14 @@ func (s *StockServer) InitStock(ctx context.Context, req *pb.InitStockRequest) (
 	}, nil
 }
 
-func StartGRPCServer(addr string, log *zap.Logger) (*grpc.Server, error) {
+func StartGRPCServer(addr string, store cache.StockStore, log *zap.Logger) (*grpc.Server, error) {
 	lis, err := net.Listen("tcp", addr)
 	if err != nil {
 		return nil, err
 	}
 
 	server := grpc.NewServer()
-	stockServer := NewStockServer(log)
+	stockServer := NewStockServer(store, log)
 	pb.RegisterStockServiceServer(server, stockServer)
 	reflection.Register(server)
 
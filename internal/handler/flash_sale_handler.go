@@ -1,17 +1,25 @@
 // 秒殺活動 HTTP 處理器
 //
 // 本檔案處理所有秒殺相關的 HTTP 請求
-// 包含：活動列表、詳情、庫存查詢、建立活動、秒殺搶購
+// 包含：活動列表、詳情、庫存查詢與 SSE 庫存推送、建立/編輯/暫停/恢復/取消/刪除活動、庫存調整與對帳、秒殺搶購、排隊狀態、憑證結果查詢、抽籤登記、活動預約
 // Rush 方法會先進行 AI 異常檢測，再呼叫業務層處理
 package handler
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
 	"strconv"
+	"time"
 
+	"github.com/Mag1cFall/magtrade/internal/cache"
+	"github.com/Mag1cFall/magtrade/internal/config"
 	"github.com/Mag1cFall/magtrade/internal/middleware"
 	"github.com/Mag1cFall/magtrade/internal/model"
 	"github.com/Mag1cFall/magtrade/internal/mq"
 	"github.com/Mag1cFall/magtrade/internal/pkg/response"
+	"github.com/Mag1cFall/magtrade/internal/repository"
 	"github.com/Mag1cFall/magtrade/internal/service"
 	"github.com/Mag1cFall/magtrade/internal/service/ai"
 	"github.com/gin-gonic/gin"
@@ -21,13 +29,25 @@ import (
 // FlashSaleHandler 秒殺 HTTP 處理器
 type FlashSaleHandler struct {
 	flashSaleService *service.FlashSaleService
+	reconcileService *service.StockReconcileService
+	raffleService    *service.RaffleService
+	reservation      *service.ReservationService
+	tickets          *service.TicketService
 	anomalyDetector  *ai.AnomalyDetector // AI 異常偵測（可選，若為 nil 則跳過）
 	log              *zap.Logger
 }
 
-func NewFlashSaleHandler(producer *mq.Producer, anomalyDetector *ai.AnomalyDetector, log *zap.Logger) *FlashSaleHandler {
+func NewFlashSaleHandler(deps *service.CacheDeps, producer *mq.Producer, emailCfg *config.EmailConfig, rushCfg *config.RushConfig, paymentCfg *config.PaymentConfig, anomalyDetector *ai.AnomalyDetector, log *zap.Logger) *FlashSaleHandler {
+	payments := service.NewPaymentService(paymentCfg, deps, producer, log)
+	flashSaleService := service.NewFlashSaleService(deps, payments, producer, log)
+	flashSaleService.SetLegacyAdmission(rushCfg.LegacyAdmission)
+
 	return &FlashSaleHandler{
-		flashSaleService: service.NewFlashSaleService(producer, log),
+		flashSaleService: flashSaleService,
+		reconcileService: service.NewStockReconcileService(log),
+		raffleService:    service.NewRaffleService(deps, producer, log),
+		reservation:      service.NewReservationService(emailCfg, log),
+		tickets:          service.NewTicketService(log),
 		anomalyDetector:  anomalyDetector,
 		log:              log,
 	}
@@ -91,15 +111,107 @@ func (h *FlashSaleHandler) GetStock(c *gin.Context) {
 
 	stock, err := h.flashSaleService.GetStock(c.Request.Context(), id)
 	if err != nil {
-		response.InternalError(c, err.Error())
+		switch err {
+		case repository.ErrFlashSaleNotFound:
+			response.NotFound(c, "flash sale not found")
+		case service.ErrStockAdjustBusy:
+			response.Conflict(c, err.Error())
+		default:
+			response.InternalError(c, err.Error())
+		}
 		return
 	}
 
 	response.Success(c, gin.H{"stock": stock})
 }
 
+// stockStreamHeartbeat SSE 心跳間隔，避免代理因閒置關閉連線
+const stockStreamHeartbeat = 15 * time.Second
+
+// StreamStock 以 Server-Sent Events 推送即時庫存（無法維持 WebSocket 的客戶端使用）
+// GET /api/v1/flash-sales/:id/stock/stream
+// 連線後先推送當前庫存，之後庫存變更時推送 stock_update 事件（同一活動最多每 200ms 一次）
+func (h *FlashSaleHandler) StreamStock(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		response.BadRequest(c, "invalid flash sale id")
+		return
+	}
+
+	flusher, ok := c.Writer.(http.Flusher)
+	if !ok {
+		response.InternalError(c, "streaming not supported")
+		return
+	}
+
+	ctx := c.Request.Context()
+	sub, initial, err := h.flashSaleService.SubscribeStock(ctx, id)
+	if err != nil {
+		if err == repository.ErrFlashSaleNotFound {
+			response.NotFound(c, "flash sale not found")
+			return
+		}
+		response.InternalError(c, err.Error())
+		return
+	}
+	defer sub.Close()
+
+	h.streamStock(c, flusher, sub, initial, stockStreamHeartbeat)
+}
+
+// streamStock 推送初始庫存後持續轉發庫存更新並定時送出心跳，直到客戶端斷線或訂閱關閉
+// 長連線不受 http.Server 的 WriteTimeout 限制（該逾時涵蓋整個回應），改以寫入失敗判斷斷線
+func (h *FlashSaleHandler) streamStock(c *gin.Context, flusher http.Flusher, sub *cache.StockSubscription, initial cache.StockUpdate, interval time.Duration) {
+	if err := http.NewResponseController(c.Writer).SetWriteDeadline(time.Time{}); err != nil {
+		// 不支援時沿用伺服器逾時，連線中斷後由 EventSource 自動重連
+		h.log.Warn("failed to clear write deadline for stock stream", zap.Error(err))
+	}
+
+	// 設定 SSE Headers
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no") // 禁用 Nginx 緩衝
+
+	writeEvent := func(update cache.StockUpdate) error {
+		data, _ := json.Marshal(update)
+		if _, err := fmt.Fprintf(c.Writer, "event: stock_update\ndata: %s\n\n", data); err != nil {
+			return err
+		}
+		flusher.Flush()
+		return nil
+	}
+
+	if err := writeEvent(initial); err != nil {
+		return
+	}
+
+	heartbeat := time.NewTicker(interval)
+	defer heartbeat.Stop()
+
+	ctx := c.Request.Context()
+	for {
+		select {
+		case <-ctx.Done(): // 客戶端斷線
+			return
+		case update, ok := <-sub.C:
+			if !ok {
+				return
+			}
+			if err := writeEvent(update); err != nil {
+				return
+			}
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(c.Writer, ": ping\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
 // Create 建立秒殺活動（管理員專用）
-// POST /api/v1/flash-sales
+// POST /api/v1/admin/flash-sales?dry_run=true
 func (h *FlashSaleHandler) Create(c *gin.Context) {
 	var req service.CreateFlashSaleRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -107,8 +219,24 @@ func (h *FlashSaleHandler) Create(c *gin.Context) {
 		return
 	}
 
+	// dry_run=true 時僅驗證並返回全部問題，不建立活動
+	if c.Query("dry_run") == "true" {
+		fieldErrs, err := h.flashSaleService.ValidateCreate(c.Request.Context(), &req)
+		if err != nil {
+			response.InternalError(c, err.Error())
+			return
+		}
+		response.Success(c, service.ValidateFlashSaleResponse{Valid: len(fieldErrs) == 0, Errors: fieldErrs})
+		return
+	}
+
 	flashSale, err := h.flashSaleService.Create(c.Request.Context(), &req)
 	if err != nil {
+		var validationErr *service.ValidationFailedError
+		if errors.As(err, &validationErr) {
+			response.ValidationFailed(c, validationErr.Errors)
+			return
+		}
 		response.InternalError(c, err.Error())
 		return
 	}
@@ -116,6 +244,171 @@ func (h *FlashSaleHandler) Create(c *gin.Context) {
 	response.Success(c, flashSale)
 }
 
+// Update 編輯尚未開始的活動（管理員專用）
+// PUT /api/v1/admin/flash-sales/:id
+func (h *FlashSaleHandler) Update(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		response.BadRequest(c, "invalid flash sale id")
+		return
+	}
+
+	var req service.UpdateFlashSaleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+
+	flashSale, err := h.flashSaleService.Update(c.Request.Context(), id, &req)
+	if err != nil {
+		h.adminError(c, err)
+		return
+	}
+
+	response.Success(c, flashSale)
+}
+
+// Pause 暫停進行中的活動（管理員專用）
+// POST /api/v1/admin/flash-sales/:id/pause
+func (h *FlashSaleHandler) Pause(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		response.BadRequest(c, "invalid flash sale id")
+		return
+	}
+
+	flashSale, err := h.flashSaleService.Pause(c.Request.Context(), id)
+	if err != nil {
+		h.adminError(c, err)
+		return
+	}
+
+	response.Success(c, flashSale)
+}
+
+// Resume 恢復已暫停的活動（管理員專用）
+// POST /api/v1/admin/flash-sales/:id/resume
+func (h *FlashSaleHandler) Resume(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		response.BadRequest(c, "invalid flash sale id")
+		return
+	}
+
+	flashSale, err := h.flashSaleService.Resume(c.Request.Context(), id)
+	if err != nil {
+		h.adminError(c, err)
+		return
+	}
+
+	response.Success(c, flashSale)
+}
+
+// Cancel 取消活動並取消/退款其訂單（管理員專用）
+// POST /api/v1/admin/flash-sales/:id/cancel
+func (h *FlashSaleHandler) Cancel(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		response.BadRequest(c, "invalid flash sale id")
+		return
+	}
+
+	result, err := h.flashSaleService.Cancel(c.Request.Context(), id)
+	if err != nil {
+		h.adminError(c, err)
+		return
+	}
+
+	response.Success(c, result)
+}
+
+// Delete 刪除活動（管理員專用）
+// DELETE /api/v1/admin/flash-sales/:id
+func (h *FlashSaleHandler) Delete(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		response.BadRequest(c, "invalid flash sale id")
+		return
+	}
+
+	if err := h.flashSaleService.Delete(c.Request.Context(), id); err != nil {
+		h.adminError(c, err)
+		return
+	}
+
+	response.SuccessWithMessage(c, "deleted", nil)
+}
+
+// AdjustStock 增減活動庫存（管理員專用）
+// POST /api/v1/admin/flash-sales/:id/stock
+func (h *FlashSaleHandler) AdjustStock(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		response.BadRequest(c, "invalid flash sale id")
+		return
+	}
+
+	var req service.AdjustStockRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+
+	result, err := h.flashSaleService.AdjustStock(c.Request.Context(), id, &req)
+	if err != nil {
+		h.adminError(c, err)
+		return
+	}
+
+	response.Success(c, result)
+}
+
+// adminError 將活動管理操作的錯誤轉為 HTTP 回應
+func (h *FlashSaleHandler) adminError(c *gin.Context, err error) {
+	var validationErr *service.ValidationFailedError
+	if errors.As(err, &validationErr) {
+		response.ValidationFailed(c, validationErr.Errors)
+		return
+	}
+
+	switch err {
+	case repository.ErrFlashSaleNotFound:
+		response.NotFound(c, "flash sale not found")
+	case service.ErrItemNotFound:
+		response.NotFound(c, "flash sale item not found")
+	case service.ErrFlashSaleNotEditable, service.ErrFlashSaleStatusInvalid, service.ErrFlashSaleHasOrders, service.ErrStockAdjustBusy:
+		response.Conflict(c, err.Error())
+	case service.ErrFlashSaleEnded, service.ErrInvalidStockDelta, service.ErrItemRequired:
+		response.BadRequest(c, err.Error())
+	default:
+		response.InternalError(c, err.Error())
+	}
+}
+
+// Reconcile 對單一活動執行庫存對帳，返回差異報告（管理員專用）
+// POST /api/v1/admin/flash-sales/:id/reconcile?repair=true
+func (h *FlashSaleHandler) Reconcile(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		response.BadRequest(c, "invalid flash sale id")
+		return
+	}
+
+	repair := c.Query("repair") == "true" // 預設只產出報告不修復
+
+	report, err := h.reconcileService.Reconcile(c.Request.Context(), id, repair)
+	if err != nil {
+		if err == repository.ErrFlashSaleNotFound {
+			response.NotFound(c, "flash sale not found")
+			return
+		}
+		response.InternalError(c, err.Error())
+		return
+	}
+
+	response.Success(c, report)
+}
+
 // Rush 秒殺搶購（核心介面）
 // POST /api/v1/flash-sales/:id/rush
 // 需要 JWT 認證，返回排隊憑證或錯誤訊息
@@ -165,7 +458,7 @@ func (h *FlashSaleHandler) Rush(c *gin.Context) {
 	}
 
 	// 呼叫業務層執行秒殺邏輯
-	result, err := h.flashSaleService.Rush(c.Request.Context(), userID, id, req.Quantity)
+	result, err := h.flashSaleService.Rush(c.Request.Context(), userID, id, &req)
 	if err != nil {
 		switch err {
 		case service.ErrFlashSaleNotActive:
@@ -180,6 +473,16 @@ func (h *FlashSaleHandler) Rush(c *gin.Context) {
 			response.BadRequest(c, "秒杀活动尚未开始")
 		case service.ErrFlashSaleEnded:
 			response.BadRequest(c, "秒杀活动已结束")
+		case service.ErrNotReserved:
+			response.Forbidden(c, "仅限预约用户参与")
+		case service.ErrFlashSalePaused:
+			response.FlashSaleNotActive(c)
+		case service.ErrRaffleSale:
+			response.BadRequest(c, "抽签活动请登记参与")
+		case service.ErrItemRequired:
+			response.BadRequest(c, "请选择商品规格")
+		case service.ErrItemNotFound:
+			response.NotFound(c, "商品规格不存在")
 		default:
 			response.InternalError(c, err.Error())
 		}
@@ -188,3 +491,218 @@ func (h *FlashSaleHandler) Rush(c *gin.Context) {
 
 	response.Success(c, result)
 }
+
+// QueueStatus 查詢排隊狀態（排隊模式）
+// GET /api/v1/flash-sales/:id/queue
+func (h *FlashSaleHandler) QueueStatus(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		response.BadRequest(c, "invalid flash sale id")
+		return
+	}
+
+	userID := middleware.GetUserID(c)
+	if userID == 0 {
+		response.Unauthorized(c, "authentication required")
+		return
+	}
+
+	status, err := h.flashSaleService.QueueStatus(c.Request.Context(), userID, id)
+	if err != nil {
+		if err == repository.ErrFlashSaleNotFound {
+			response.NotFound(c, "flash sale not found")
+			return
+		}
+		response.InternalError(c, err.Error())
+		return
+	}
+
+	response.Success(c, status)
+}
+
+// TicketStatus 以搶購憑證查詢結果（WebSocket 推送遺失時輪詢用，僅限本人）
+// GET /api/v1/flash-sales/tickets/:ticket
+func (h *FlashSaleHandler) TicketStatus(c *gin.Context) {
+	ticket := c.Param("ticket")
+	if ticket == "" {
+		response.BadRequest(c, "invalid ticket")
+		return
+	}
+
+	userID := middleware.GetUserID(c)
+	if userID == 0 {
+		response.Unauthorized(c, "authentication required")
+		return
+	}
+
+	record, err := h.tickets.Get(c.Request.Context(), userID, ticket)
+	if err != nil {
+		if err == service.ErrTicketNotFound {
+			response.NotFound(c, "ticket not found or expired")
+			return
+		}
+		response.InternalError(c, err.Error())
+		return
+	}
+
+	response.Success(c, record)
+}
+
+// EnterRaffle 登記參與抽籤
+// POST /api/v1/flash-sales/:id/raffle
+func (h *FlashSaleHandler) EnterRaffle(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		response.BadRequest(c, "invalid flash sale id")
+		return
+	}
+
+	userID := middleware.GetUserID(c)
+	if userID == 0 {
+		response.Unauthorized(c, "authentication required")
+		return
+	}
+
+	entry, err := h.raffleService.Enter(c.Request.Context(), userID, id)
+	if err != nil {
+		switch err {
+		case repository.ErrFlashSaleNotFound:
+			response.NotFound(c, "flash sale not found")
+		case service.ErrNotRaffleSale:
+			response.BadRequest(c, "该活动不是抽签活动")
+		case service.ErrRaffleClosed:
+			response.FlashSaleNotActive(c)
+		case repository.ErrRaffleAlreadyEntered:
+			response.Conflict(c, "您已登记本次抽签")
+		default:
+			response.InternalError(c, err.Error())
+		}
+		return
+	}
+
+	response.Success(c, entry)
+}
+
+// RaffleStatus 查詢抽籤狀態（含抽籤種子與中籤名單）
+// GET /api/v1/flash-sales/:id/raffle
+func (h *FlashSaleHandler) RaffleStatus(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		response.BadRequest(c, "invalid flash sale id")
+		return
+	}
+
+	userID := middleware.GetUserID(c)
+	if userID == 0 {
+		response.Unauthorized(c, "authentication required")
+		return
+	}
+
+	status, err := h.raffleService.Status(c.Request.Context(), userID, id)
+	if err != nil {
+		switch err {
+		case repository.ErrFlashSaleNotFound:
+			response.NotFound(c, "flash sale not found")
+		case service.ErrNotRaffleSale:
+			response.BadRequest(c, "该活动不是抽签活动")
+		default:
+			response.InternalError(c, err.Error())
+		}
+		return
+	}
+
+	response.Success(c, status)
+}
+
+// Reserve 預約活動
+// POST /api/v1/flash-sales/:id/reserve
+func (h *FlashSaleHandler) Reserve(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		response.BadRequest(c, "invalid flash sale id")
+		return
+	}
+
+	userID := middleware.GetUserID(c)
+	if userID == 0 {
+		response.Unauthorized(c, "authentication required")
+		return
+	}
+
+	reservation, err := h.reservation.Reserve(c.Request.Context(), userID, id)
+	if err != nil {
+		switch err {
+		case repository.ErrFlashSaleNotFound:
+			response.NotFound(c, "flash sale not found")
+		case service.ErrReservationClosed:
+			response.BadRequest(c, "活动已开始，无法预约")
+		case repository.ErrAlreadyReserved:
+			response.Conflict(c, "您已预约本次秒杀")
+		default:
+			response.InternalError(c, err.Error())
+		}
+		return
+	}
+
+	response.Success(c, reservation)
+}
+
+// CancelReservation 取消預約
+// DELETE /api/v1/flash-sales/:id/reserve
+func (h *FlashSaleHandler) CancelReservation(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		response.BadRequest(c, "invalid flash sale id")
+		return
+	}
+
+	userID := middleware.GetUserID(c)
+	if userID == 0 {
+		response.Unauthorized(c, "authentication required")
+		return
+	}
+
+	if err := h.reservation.Cancel(c.Request.Context(), userID, id); err != nil {
+		switch err {
+		case repository.ErrFlashSaleNotFound:
+			response.NotFound(c, "flash sale not found")
+		case repository.ErrReservationNotFound:
+			response.NotFound(c, "reservation not found")
+		case service.ErrReservationClosed:
+			response.BadRequest(c, "活动已开始，无法取消预约")
+		default:
+			response.InternalError(c, err.Error())
+		}
+		return
+	}
+
+	response.SuccessWithMessage(c, "预约已取消", nil)
+}
+
+// ReservationStatus 查詢預約狀態
+// GET /api/v1/flash-sales/:id/reserve
+func (h *FlashSaleHandler) ReservationStatus(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		response.BadRequest(c, "invalid flash sale id")
+		return
+	}
+
+	userID := middleware.GetUserID(c)
+	if userID == 0 {
+		response.Unauthorized(c, "authentication required")
+		return
+	}
+
+	status, err := h.reservation.Status(c.Request.Context(), userID, id)
+	if err != nil {
+		if err == repository.ErrFlashSaleNotFound {
+			response.NotFound(c, "flash sale not found")
+			return
+		}
+		response.InternalError(c, err.Error())
+		return
+	}
+
+	response.Success(c, status)
+}
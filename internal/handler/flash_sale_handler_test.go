@@ -0,0 +1,79 @@
+// 秒殺處理器測試
+//
+// 測試覆蓋：
+// - streamStock: SSE 長連線不受 http.Server WriteTimeout 限制，超過逾時後仍持續收到心跳
+package handler
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Mag1cFall/magtrade/internal/cache"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+func TestFlashSaleHandler_StreamStockOutlivesWriteTimeout(t *testing.T) {
+	const (
+		writeTimeout = 300 * time.Millisecond
+		heartbeat    = 50 * time.Millisecond
+		keepOpen     = 4 * writeTimeout
+	)
+
+	gin.SetMode(gin.TestMode)
+	h := &FlashSaleHandler{log: zap.NewNop()}
+	r := gin.New()
+	r.GET("/stream", func(c *gin.Context) {
+		sub := cache.StockEvents().Subscribe(1)
+		defer sub.Close()
+		h.streamStock(c, c.Writer, sub, cache.StockUpdate{FlashSaleID: 1, Stock: 10}, heartbeat)
+	})
+
+	server := httptest.NewUnstartedServer(r)
+	server.Config.WriteTimeout = writeTimeout
+	server.Start()
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"/stream", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("Content-Type = %q, want text/event-stream", ct)
+	}
+
+	start := time.Now()
+	scanner := bufio.NewScanner(resp.Body)
+	var gotInitial bool
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "data: ") && strings.Contains(line, `"stock":10`) {
+			gotInitial = true
+		}
+		if line == ": ping" && time.Since(start) > keepOpen {
+			break
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatalf("stream closed after %v: %v", time.Since(start), err)
+	}
+	if elapsed := time.Since(start); elapsed <= keepOpen {
+		t.Fatalf("stream closed after %v, want open beyond %v", elapsed, keepOpen)
+	}
+	if !gotInitial {
+		t.Error("initial stock event not received")
+	}
+}
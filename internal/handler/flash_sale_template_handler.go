@@ -0,0 +1,168 @@
+// 秒殺活動範本 HTTP 處理器
+//
+// 本檔案處理週期性活動範本的管理介面（管理員專用）
+// 包含：建立、列表、詳情、編輯、暫停/恢復
+// 具體活動由 SchedulerWorker 依範本自動產生
+package handler
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/Mag1cFall/magtrade/internal/model"
+	"github.com/Mag1cFall/magtrade/internal/mq"
+	"github.com/Mag1cFall/magtrade/internal/pkg/response"
+	"github.com/Mag1cFall/magtrade/internal/repository"
+	"github.com/Mag1cFall/magtrade/internal/service"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// FlashSaleTemplateHandler 活動範本 HTTP 處理器
+type FlashSaleTemplateHandler struct {
+	templateService *service.FlashSaleTemplateService
+}
+
+func NewFlashSaleTemplateHandler(deps *service.CacheDeps, producer *mq.Producer, log *zap.Logger) *FlashSaleTemplateHandler {
+	return &FlashSaleTemplateHandler{
+		templateService: service.NewFlashSaleTemplateService(deps, producer, log),
+	}
+}
+
+// Create 建立活動範本
+// POST /api/v1/admin/flash-sale-templates
+func (h *FlashSaleTemplateHandler) Create(c *gin.Context) {
+	var req service.CreateFlashSaleTemplateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+
+	template, err := h.templateService.Create(c.Request.Context(), &req)
+	if err != nil {
+		h.handleError(c, err)
+		return
+	}
+
+	response.Success(c, template)
+}
+
+// List 查詢活動範本列表
+// GET /api/v1/admin/flash-sale-templates?page=1&page_size=20&status=1
+func (h *FlashSaleTemplateHandler) List(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+
+	var status *model.FlashSaleTemplateStatus
+	if statusStr := c.Query("status"); statusStr != "" {
+		s, err := strconv.Atoi(statusStr)
+		if err == nil {
+			st := model.FlashSaleTemplateStatus(s)
+			status = &st
+		}
+	}
+
+	result, err := h.templateService.List(c.Request.Context(), page, pageSize, status)
+	if err != nil {
+		response.InternalError(c, err.Error())
+		return
+	}
+
+	response.Success(c, result)
+}
+
+// GetByID 查詢活動範本詳情
+// GET /api/v1/admin/flash-sale-templates/:id
+func (h *FlashSaleTemplateHandler) GetByID(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		response.BadRequest(c, "invalid template id")
+		return
+	}
+
+	template, err := h.templateService.GetByID(c.Request.Context(), id)
+	if err != nil {
+		h.handleError(c, err)
+		return
+	}
+
+	response.Success(c, template)
+}
+
+// Update 編輯活動範本（僅影響之後產生的活動）
+// PUT /api/v1/admin/flash-sale-templates/:id
+func (h *FlashSaleTemplateHandler) Update(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		response.BadRequest(c, "invalid template id")
+		return
+	}
+
+	var req service.UpdateFlashSaleTemplateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+
+	template, err := h.templateService.Update(c.Request.Context(), id, &req)
+	if err != nil {
+		h.handleError(c, err)
+		return
+	}
+
+	response.Success(c, template)
+}
+
+// Pause 暫停活動範本
+// POST /api/v1/admin/flash-sale-templates/:id/pause
+func (h *FlashSaleTemplateHandler) Pause(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		response.BadRequest(c, "invalid template id")
+		return
+	}
+
+	template, err := h.templateService.Pause(c.Request.Context(), id)
+	if err != nil {
+		h.handleError(c, err)
+		return
+	}
+
+	response.Success(c, template)
+}
+
+// Resume 恢復活動範本
+// POST /api/v1/admin/flash-sale-templates/:id/resume
+func (h *FlashSaleTemplateHandler) Resume(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		response.BadRequest(c, "invalid template id")
+		return
+	}
+
+	template, err := h.templateService.Resume(c.Request.Context(), id)
+	if err != nil {
+		h.handleError(c, err)
+		return
+	}
+
+	response.Success(c, template)
+}
+
+// handleError 將範本業務錯誤對應至 HTTP 回應
+func (h *FlashSaleTemplateHandler) handleError(c *gin.Context, err error) {
+	var validationErr *service.ValidationFailedError
+	if errors.As(err, &validationErr) {
+		response.ValidationFailed(c, validationErr.Errors)
+		return
+	}
+
+	switch err {
+	case repository.ErrFlashSaleTemplateNotFound:
+		response.NotFound(c, "flash sale template not found")
+	case service.ErrFlashSaleTemplateStatusInvalid:
+		response.Conflict(c, err.Error())
+	default:
+		response.InternalError(c, err.Error())
+	}
+}
@@ -1,7 +1,7 @@
 // 監控指標 HTTP 處理器
 //
 // 本檔案提供系統監控指標查詢功能
-// 包含：資料庫連線池狀態、Redis 連線狀態
+// 包含：資料庫連線池狀態、Redis 連線狀態、本地售罄旗標命中率
 // 可擴展為 Prometheus 格式
 package handler
 
@@ -33,6 +33,7 @@ func (h *MetricsHandler) GetMetrics(c *gin.Context) {
 	}
 
 	stats := sqlDB.Stats() // 資料庫連線池統計
+	flagStats := cache.SaleFlags().Stats()
 
 	c.JSON(http.StatusOK, gin.H{
 		"database": gin.H{
@@ -46,6 +47,11 @@ func (h *MetricsHandler) GetMetrics(c *gin.Context) {
 			"max_idle_time_closed": stats.MaxIdleTimeClosed, // 因閒置超時關閉
 			"max_lifetime_closed":  stats.MaxLifetimeClosed, // 因存活超時關閉
 		},
+		"sale_flags": gin.H{
+			"hits":    flagStats.Hits,    // 命中本地旗標直接拒絕的搶購請求
+			"misses":  flagStats.Misses,  // 走完整流程的搶購請求
+			"entries": flagStats.Entries, // 目前本地旗標數
+		},
 	})
 }
 
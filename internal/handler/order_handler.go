@@ -1,15 +1,18 @@
 // 訂單相關 HTTP 處理器
 //
 // 本檔案處理訂單相關請求
-// 包含：訂單列表、訂單詳情、支付、取消
+// 包含：訂單列表、訂單詳情、發起支付、取消、申請退款
 package handler
 
 import (
+	"errors"
 	"strconv"
 
+	"github.com/Mag1cFall/magtrade/internal/config"
 	"github.com/Mag1cFall/magtrade/internal/middleware"
 	"github.com/Mag1cFall/magtrade/internal/mq"
 	"github.com/Mag1cFall/magtrade/internal/pkg/response"
+	"github.com/Mag1cFall/magtrade/internal/repository"
 	"github.com/Mag1cFall/magtrade/internal/service"
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
@@ -17,15 +20,22 @@ import (
 
 // OrderHandler 訂單處理器
 type OrderHandler struct {
-	orderService *service.OrderService
+	orderService   *service.OrderService
+	paymentService *service.PaymentService
 }
 
-func NewOrderHandler(producer *mq.Producer, log *zap.Logger) *OrderHandler {
+func NewOrderHandler(deps *service.CacheDeps, producer *mq.Producer, paymentCfg *config.PaymentConfig, log *zap.Logger) *OrderHandler {
 	return &OrderHandler{
-		orderService: service.NewOrderService(producer, log),
+		orderService:   service.NewOrderService(deps, producer, log),
+		paymentService: service.NewPaymentService(paymentCfg, deps, producer, log),
 	}
 }
 
+// PayRequest 發起支付請求
+type PayRequest struct {
+	Provider string `json:"provider"` // 支付供應商，留空使用預設供應商
+}
+
 // List 查詢當前使用者的訂單列表
 // GET /api/v1/orders?page=1&page_size=20
 func (h *OrderHandler) List(c *gin.Context) {
@@ -71,7 +81,7 @@ func (h *OrderHandler) GetByOrderNo(c *gin.Context) {
 	response.Success(c, order)
 }
 
-// Pay 支付訂單（模擬支付）
+// Pay 發起支付，返回支付單與付款頁面位址，訂單待供應商確認後才標記已付款
 // POST /api/v1/orders/:order_no/pay
 func (h *OrderHandler) Pay(c *gin.Context) {
 	userID := middleware.GetUserID(c)
@@ -86,17 +96,34 @@ func (h *OrderHandler) Pay(c *gin.Context) {
 		return
 	}
 
-	order, err := h.orderService.Pay(c.Request.Context(), userID, orderNo)
+	var req PayRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			response.BadRequest(c, err.Error())
+			return
+		}
+	}
+
+	payment, err := h.paymentService.Pay(c.Request.Context(), userID, orderNo, req.Provider)
 	if err != nil {
-		if err == service.ErrOrderStatusInvalid {
+		switch {
+		case errors.Is(err, repository.ErrOrderNotFound):
+			response.NotFound(c, "order not found")
+		case errors.Is(err, service.ErrOrderStatusInvalid):
 			response.BadRequest(c, "订单状态不允许支付")
-			return
+		case errors.Is(err, service.ErrOrderExpired):
+			response.BadRequest(c, "订单已超时，请重新下单")
+		case errors.Is(err, service.ErrFlashSaleCancelled):
+			response.BadRequest(c, "活动已取消，订单无法支付")
+		case errors.Is(err, service.ErrPaymentProviderNotFound):
+			response.BadRequest(c, "不支持的支付方式")
+		default:
+			response.InternalError(c, err.Error())
 		}
-		response.InternalError(c, err.Error())
 		return
 	}
 
-	response.SuccessWithMessage(c, "支付成功", order)
+	response.SuccessWithMessage(c, "请前往支付页面完成付款", payment)
 }
 
 // Cancel 取消訂單
@@ -116,13 +143,53 @@ func (h *OrderHandler) Cancel(c *gin.Context) {
 
 	order, err := h.orderService.Cancel(c.Request.Context(), userID, orderNo)
 	if err != nil {
-		if err == service.ErrOrderStatusInvalid {
+		switch {
+		case errors.Is(err, repository.ErrOrderNotFound):
+			response.NotFound(c, "order not found")
+		case errors.Is(err, service.ErrOrderStatusInvalid):
 			response.BadRequest(c, "订单状态不允许取消")
-			return
+		default:
+			response.InternalError(c, err.Error())
 		}
-		response.InternalError(c, err.Error())
 		return
 	}
 
 	response.SuccessWithMessage(c, "订单已取消", order)
 }
+
+// Refund 申請退款（全額），待管理員審核
+// POST /api/v1/orders/:order_no/refund
+func (h *OrderHandler) Refund(c *gin.Context) {
+	userID := middleware.GetUserID(c)
+	if userID == 0 {
+		response.Unauthorized(c, "authentication required")
+		return
+	}
+
+	orderNo := c.Param("order_no")
+	if orderNo == "" {
+		response.BadRequest(c, "order_no is required")
+		return
+	}
+
+	var req service.CreateRefundRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+
+	refund, err := h.paymentService.RequestRefund(c.Request.Context(), userID, orderNo, &req)
+	if err != nil {
+		switch {
+		case errors.Is(err, repository.ErrOrderNotFound):
+			response.NotFound(c, "order not found")
+		case errors.Is(err, service.ErrOrderStatusInvalid):
+			response.BadRequest(c, "订单状态不允许退款")
+		default:
+			response.InternalError(c, err.Error())
+		}
+		return
+	}
+
+	response.SuccessWithMessage(c, "退款申请已提交，等待审核", refund)
+}
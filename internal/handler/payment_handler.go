@@ -0,0 +1,175 @@
+// 支付相關 HTTP 處理器
+//
+// 本檔案處理支付單查詢、供應商非同步回調，以及管理員退款審核
+// 回調端點公開但需通過供應商簽名驗證；非 2xx 回應會讓供應商稍後重試
+package handler
+
+import (
+	"errors"
+	"io"
+	"strconv"
+
+	"github.com/Mag1cFall/magtrade/internal/config"
+	"github.com/Mag1cFall/magtrade/internal/middleware"
+	"github.com/Mag1cFall/magtrade/internal/model"
+	"github.com/Mag1cFall/magtrade/internal/mq"
+	"github.com/Mag1cFall/magtrade/internal/pkg/response"
+	"github.com/Mag1cFall/magtrade/internal/repository"
+	"github.com/Mag1cFall/magtrade/internal/service"
+	"github.com/Mag1cFall/magtrade/internal/service/payment"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// maxWebhookBodySize 回調請求體上限
+const maxWebhookBodySize = 64 * 1024
+
+// PaymentHandler 支付處理器
+type PaymentHandler struct {
+	paymentService *service.PaymentService
+	log            *zap.Logger
+}
+
+func NewPaymentHandler(deps *service.CacheDeps, producer *mq.Producer, cfg *config.PaymentConfig, log *zap.Logger) *PaymentHandler {
+	return &PaymentHandler{
+		paymentService: service.NewPaymentService(cfg, deps, producer, log),
+		log:            log,
+	}
+}
+
+// GetByPaymentNo 查詢支付單狀態（待支付時會向供應商同步）
+// GET /api/v1/payments/:payment_no
+func (h *PaymentHandler) GetByPaymentNo(c *gin.Context) {
+	userID := middleware.GetUserID(c)
+	if userID == 0 {
+		response.Unauthorized(c, "authentication required")
+		return
+	}
+
+	p, err := h.paymentService.GetByPaymentNo(c.Request.Context(), userID, c.Param("payment_no"))
+	if err != nil {
+		if errors.Is(err, repository.ErrPaymentNotFound) {
+			response.NotFound(c, "payment not found")
+			return
+		}
+		response.InternalError(c, err.Error())
+		return
+	}
+
+	response.Success(c, p)
+}
+
+// Webhook 供應商非同步回調
+// POST /api/v1/payments/webhook/:provider
+func (h *PaymentHandler) Webhook(c *gin.Context) {
+	provider := c.Param("provider")
+
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, maxWebhookBodySize))
+	if err != nil {
+		response.BadRequest(c, "failed to read body")
+		return
+	}
+
+	err = h.paymentService.HandleCallback(c.Request.Context(), provider, c.Request.Header, body)
+	if err != nil {
+		switch {
+		case errors.Is(err, payment.ErrInvalidSignature):
+			h.log.Warn("payment callback with invalid signature",
+				zap.String("provider", provider),
+				zap.String("ip", c.ClientIP()),
+			)
+			response.Unauthorized(c, "invalid signature")
+		case errors.Is(err, service.ErrPaymentProviderNotFound):
+			response.NotFound(c, "payment provider not found")
+		case errors.Is(err, repository.ErrPaymentNotFound), errors.Is(err, repository.ErrRefundNotFound):
+			response.NotFound(c, "payment not found")
+		default:
+			h.log.Error("failed to handle payment callback",
+				zap.String("provider", provider),
+				zap.Error(err),
+			)
+			response.InternalError(c, "failed to handle callback")
+		}
+		return
+	}
+
+	response.Success(c, nil)
+}
+
+// ListRefunds 查詢退款單列表（管理員）
+// GET /api/v1/admin/refunds?status=0&page=1&page_size=20
+func (h *PaymentHandler) ListRefunds(c *gin.Context) {
+	var status *model.RefundStatus
+	if v := c.Query("status"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			response.BadRequest(c, "invalid status")
+			return
+		}
+		s := model.RefundStatus(n)
+		status = &s
+	}
+
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+
+	result, err := h.paymentService.ListRefunds(c.Request.Context(), status, page, pageSize)
+	if err != nil {
+		response.InternalError(c, err.Error())
+		return
+	}
+
+	response.Success(c, result)
+}
+
+// ApproveRefund 審核通過退款並向供應商發起退款（管理員）
+// POST /api/v1/admin/refunds/:refund_no/approve
+func (h *PaymentHandler) ApproveRefund(c *gin.Context) {
+	var req service.ReviewRefundRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			response.BadRequest(c, err.Error())
+			return
+		}
+	}
+
+	refund, err := h.paymentService.ApproveRefund(c.Request.Context(), middleware.GetUserID(c), c.Param("refund_no"), &req)
+	if err != nil {
+		h.handleRefundError(c, err)
+		return
+	}
+
+	response.SuccessWithMessage(c, "退款已受理", refund)
+}
+
+// RejectRefund 駁回退款申請（管理員）
+// POST /api/v1/admin/refunds/:refund_no/reject
+func (h *PaymentHandler) RejectRefund(c *gin.Context) {
+	var req service.ReviewRefundRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			response.BadRequest(c, err.Error())
+			return
+		}
+	}
+
+	refund, err := h.paymentService.RejectRefund(c.Request.Context(), middleware.GetUserID(c), c.Param("refund_no"), &req)
+	if err != nil {
+		h.handleRefundError(c, err)
+		return
+	}
+
+	response.SuccessWithMessage(c, "退款申请已驳回", refund)
+}
+
+// handleRefundError 將退款業務錯誤對應至 HTTP 回應
+func (h *PaymentHandler) handleRefundError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, repository.ErrRefundNotFound):
+		response.NotFound(c, "refund not found")
+	case errors.Is(err, service.ErrRefundStatusInvalid):
+		response.BadRequest(c, "退款单状态不允许此操作")
+	default:
+		response.InternalError(c, err.Error())
+	}
+}
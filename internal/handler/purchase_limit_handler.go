@@ -0,0 +1,132 @@
+// 跨活動限購策略 HTTP 處理器
+//
+// 本檔案處理限購策略的管理介面（管理員專用）
+// 包含：建立、列表、編輯、刪除策略，以及查詢使用者在各策略當前週期的用量
+package handler
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/Mag1cFall/magtrade/internal/pkg/response"
+	"github.com/Mag1cFall/magtrade/internal/repository"
+	"github.com/Mag1cFall/magtrade/internal/service"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// PurchaseLimitHandler 限購策略 HTTP 處理器
+type PurchaseLimitHandler struct {
+	limitService *service.PurchaseLimitService
+}
+
+func NewPurchaseLimitHandler(log *zap.Logger) *PurchaseLimitHandler {
+	return &PurchaseLimitHandler{
+		limitService: service.NewPurchaseLimitService(log),
+	}
+}
+
+// Create 建立限購策略
+// POST /api/v1/admin/purchase-limits
+func (h *PurchaseLimitHandler) Create(c *gin.Context) {
+	var req service.CreatePurchaseLimitRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+
+	policy, err := h.limitService.Create(c.Request.Context(), &req)
+	if err != nil {
+		h.handleError(c, err)
+		return
+	}
+
+	response.Success(c, policy)
+}
+
+// List 查詢所有限購策略
+// GET /api/v1/admin/purchase-limits
+func (h *PurchaseLimitHandler) List(c *gin.Context) {
+	policies, err := h.limitService.List(c.Request.Context())
+	if err != nil {
+		response.InternalError(c, err.Error())
+		return
+	}
+
+	response.Success(c, gin.H{"policies": policies})
+}
+
+// Update 編輯限購策略
+// PUT /api/v1/admin/purchase-limits/:id
+func (h *PurchaseLimitHandler) Update(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		response.BadRequest(c, "invalid policy id")
+		return
+	}
+
+	var req service.UpdatePurchaseLimitRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+
+	policy, err := h.limitService.Update(c.Request.Context(), id, &req)
+	if err != nil {
+		h.handleError(c, err)
+		return
+	}
+
+	response.Success(c, policy)
+}
+
+// Delete 刪除限購策略
+// DELETE /api/v1/admin/purchase-limits/:id
+func (h *PurchaseLimitHandler) Delete(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		response.BadRequest(c, "invalid policy id")
+		return
+	}
+
+	if err := h.limitService.Delete(c.Request.Context(), id); err != nil {
+		h.handleError(c, err)
+		return
+	}
+
+	response.SuccessWithMessage(c, "deleted", nil)
+}
+
+// UserUsage 查詢使用者在各啟用策略當前週期的用量
+// GET /api/v1/admin/users/:id/purchase-limits
+func (h *PurchaseLimitHandler) UserUsage(c *gin.Context) {
+	userID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		response.BadRequest(c, "invalid user id")
+		return
+	}
+
+	usages, err := h.limitService.UserUsage(c.Request.Context(), userID)
+	if err != nil {
+		response.InternalError(c, err.Error())
+		return
+	}
+
+	response.Success(c, gin.H{"user_id": userID, "usages": usages})
+}
+
+// handleError 將限購策略業務錯誤對應至 HTTP 回應
+func (h *PurchaseLimitHandler) handleError(c *gin.Context, err error) {
+	var validationErr *service.ValidationFailedError
+	if errors.As(err, &validationErr) {
+		response.ValidationFailed(c, validationErr.Errors)
+		return
+	}
+
+	switch err {
+	case repository.ErrPurchaseLimitPolicyNotFound:
+		response.NotFound(c, "purchase limit policy not found")
+	default:
+		response.InternalError(c, err.Error())
+	}
+}
@@ -1,16 +1,19 @@
 // WebSocket Hub 與連線處理器
 //
 // 本檔案實現 WebSocket 即時通訊功能
-// WSHub：管理所有連線，支援單播和廣播
-// 用於推送秒殺結果、訂單狀態變更等即時通知
+// WSHub：管理所有連線，支援單播、廣播與按活動訂閱
+// 用於推送秒殺結果、訂單狀態變更、活動庫存等即時通知
+// 客戶端發送 {"action":"subscribe","flash_sale_id":1} 訂閱活動庫存，以 stock_update 消息推送
 package handler
 
 import (
+	"context"
 	"encoding/json"
 	"net/http"
 	"sync"
 	"time"
 
+	"github.com/Mag1cFall/magtrade/internal/cache"
 	"github.com/Mag1cFall/magtrade/internal/config"
 	"github.com/Mag1cFall/magtrade/internal/pkg/utils"
 	"github.com/gin-gonic/gin"
@@ -27,14 +30,19 @@ var upgrader = websocket.Upgrader{
 	},
 }
 
+// maxWSSubscriptions 單一連線最多訂閱的活動數
+const maxWSSubscriptions = 20
+
 // WSHub WebSocket 連線中心
-// 管理所有客戶端連線，處理註冊、登出、消息分發
+// 管理所有客戶端連線，處理註冊、登出、活動訂閱、消息分發
 type WSHub struct {
 	clients    map[int64]*WSClient // UserID → Client 映射
 	clientsMux sync.RWMutex        // 讀寫鎖
+	topics     map[int64]*wsTopic  // 活動 ID → 訂閱者，僅由 Run 存取
 	broadcast  chan *WSMessage     // 廣播頻道
 	register   chan *WSClient      // 註冊頻道
 	unregister chan *WSClient      // 登出頻道
+	subscribe  chan *wsSubscribe   // 活動訂閱/取消訂閱頻道
 	log        *zap.Logger
 }
 
@@ -42,22 +50,45 @@ type WSHub struct {
 type WSClient struct {
 	userID int64
 	conn   *websocket.Conn
-	send   chan []byte // 發送緩衝區
+	send   chan []byte        // 發送緩衝區
+	sales  map[int64]struct{} // 已訂閱的活動，僅由 Run 存取
 }
 
 // WSMessage WebSocket 消息
 type WSMessage struct {
-	Type   string      `json:"type"` // 消息類型：order_result/stock_update/notification
-	Data   interface{} `json:"data"`
-	UserID int64       `json:"-"` // 目標使用者 ID（0 表示廣播）
+	Type        string      `json:"type"` // 消息類型：order_result/stock_update/notification
+	Data        interface{} `json:"data"`
+	UserID      int64       `json:"-"` // 目標使用者 ID（0 表示廣播）
+	FlashSaleID int64       `json:"-"` // 目標活動 ID，> 0 時只發送給該活動的訂閱者
+}
+
+// wsTopic 單一活動的訂閱者與對應的庫存事件訂閱
+type wsTopic struct {
+	clients map[*WSClient]struct{}
+	sub     *cache.StockSubscription
+}
+
+// wsSubscribe 客戶端訂閱或取消訂閱活動
+type wsSubscribe struct {
+	client      *WSClient
+	flashSaleID int64
+	subscribe   bool
+}
+
+// wsClientMessage 客戶端發送的控制消息
+type wsClientMessage struct {
+	Action      string `json:"action"` // subscribe/unsubscribe
+	FlashSaleID int64  `json:"flash_sale_id"`
 }
 
 func NewWSHub(log *zap.Logger) *WSHub {
 	return &WSHub{
 		clients:    make(map[int64]*WSClient),
+		topics:     make(map[int64]*wsTopic),
 		broadcast:  make(chan *WSMessage, 256),
 		register:   make(chan *WSClient),
 		unregister: make(chan *WSClient),
+		subscribe:  make(chan *wsSubscribe, 64),
 		log:        log,
 	}
 }
@@ -79,11 +110,31 @@ func (h *WSHub) Run() {
 				close(client.send)
 			}
 			h.clientsMux.Unlock()
+			for flashSaleID := range client.sales {
+				h.leaveTopic(client, flashSaleID)
+			}
 			h.log.Debug("websocket client unregistered", zap.Int64("user_id", client.userID))
 
+		case req := <-h.subscribe: // 活動訂閱變更
+			if req.subscribe {
+				h.joinTopic(req.client, req.flashSaleID)
+			} else {
+				h.leaveTopic(req.client, req.flashSaleID)
+			}
+
 		case message := <-h.broadcast: // 消息分發
 			h.clientsMux.RLock()
-			if message.UserID > 0 { // 單播：發送給指定使用者
+			if message.FlashSaleID > 0 { // 活動訂閱者
+				if topic, ok := h.topics[message.FlashSaleID]; ok {
+					data, _ := json.Marshal(message)
+					for client := range topic.clients {
+						select {
+						case client.send <- data:
+						default: // 發送緩衝區滿，略過本次更新，下次更新會帶最新庫存
+						}
+					}
+				}
+			} else if message.UserID > 0 { // 單播：發送給指定使用者
 				if client, ok := h.clients[message.UserID]; ok {
 					data, _ := json.Marshal(message)
 					select {
@@ -108,6 +159,64 @@ func (h *WSHub) Run() {
 	}
 }
 
+// joinTopic 將客戶端加入活動訂閱，首位訂閱者建立庫存事件訂閱並啟動轉發
+func (h *WSHub) joinTopic(client *WSClient, flashSaleID int64) {
+	// 訂閱請求可能晚於登出處理，已登出的客戶端不再加入
+	if h.clients[client.userID] != client {
+		return
+	}
+	if _, ok := client.sales[flashSaleID]; ok || len(client.sales) >= maxWSSubscriptions {
+		return
+	}
+
+	topic, ok := h.topics[flashSaleID]
+	if !ok {
+		topic = &wsTopic{
+			clients: make(map[*WSClient]struct{}),
+			sub:     cache.StockEvents().Subscribe(flashSaleID),
+		}
+		h.topics[flashSaleID] = topic
+		go h.forwardStock(flashSaleID, topic.sub)
+	}
+	topic.clients[client] = struct{}{}
+	client.sales[flashSaleID] = struct{}{}
+
+	// 訂閱後立即推送當前庫存，不等待下一次變更
+	go func() {
+		update, err := cache.StockEvents().Snapshot(context.Background(), flashSaleID)
+		if err != nil {
+			return
+		}
+		h.SendToUser(client.userID, "stock_update", update)
+	}()
+}
+
+// leaveTopic 將客戶端移出活動訂閱，最後一位訂閱者離開時關閉庫存事件訂閱
+func (h *WSHub) leaveTopic(client *WSClient, flashSaleID int64) {
+	delete(client.sales, flashSaleID)
+
+	topic, ok := h.topics[flashSaleID]
+	if !ok {
+		return
+	}
+	delete(topic.clients, client)
+	if len(topic.clients) == 0 {
+		topic.sub.Close() // 關閉後 forwardStock 結束
+		delete(h.topics, flashSaleID)
+	}
+}
+
+// forwardStock 將活動的庫存事件轉為 stock_update 消息
+func (h *WSHub) forwardStock(flashSaleID int64, sub *cache.StockSubscription) {
+	for update := range sub.C {
+		h.broadcast <- &WSMessage{
+			Type:        "stock_update",
+			Data:        update,
+			FlashSaleID: flashSaleID,
+		}
+	}
+}
+
 // SendToUser 發送消息給指定使用者
 func (h *WSHub) SendToUser(userID int64, msgType string, data interface{}) {
 	h.broadcast <- &WSMessage{
@@ -167,6 +276,7 @@ func (h *WSHandler) HandleConnection(c *gin.Context) {
 		userID: claims.UserID,
 		conn:   conn,
 		send:   make(chan []byte, 256),
+		sales:  make(map[int64]struct{}),
 	}
 
 	h.hub.register <- client // 註冊到 Hub
@@ -175,7 +285,7 @@ func (h *WSHandler) HandleConnection(c *gin.Context) {
 	go h.readPump(client)  // 啟動讀 goroutine
 }
 
-// readPump 讀取客戶端消息（主要處理 Pong 心跳）
+// readPump 讀取客戶端消息（Pong 心跳與活動訂閱控制消息）
 func (h *WSHandler) readPump(client *WSClient) {
 	defer func() {
 		h.hub.unregister <- client
@@ -190,13 +300,26 @@ func (h *WSHandler) readPump(client *WSClient) {
 	})
 
 	for {
-		_, _, err := client.conn.ReadMessage()
+		_, data, err := client.conn.ReadMessage()
 		if err != nil {
 			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
 				h.log.Error("websocket read error", zap.Error(err))
 			}
 			break
 		}
+
+		var msg wsClientMessage
+		if err := json.Unmarshal(data, &msg); err != nil || msg.FlashSaleID <= 0 {
+			continue // 非控制消息忽略
+		}
+		switch msg.Action {
+		case "subscribe", "unsubscribe":
+			h.hub.subscribe <- &wsSubscribe{
+				client:      client,
+				flashSaleID: msg.FlashSaleID,
+				subscribe:   msg.Action == "subscribe",
+			}
+		}
 	}
 }
 
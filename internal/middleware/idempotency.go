@@ -16,11 +16,11 @@ import (
 
 // IdempotencyChecker 冪等性檢查器
 type IdempotencyChecker struct {
-	rdb *redis.Client
+	rdb redis.UniversalClient
 	ttl time.Duration // 冪等 Key 過期時間
 }
 
-func NewIdempotencyChecker(rdb *redis.Client) *IdempotencyChecker {
+func NewIdempotencyChecker(rdb redis.UniversalClient) *IdempotencyChecker {
 	return &IdempotencyChecker{
 		rdb: rdb,
 		ttl: 10 * time.Minute, // 10 分鐘內相同請求視為重複
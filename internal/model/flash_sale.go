@@ -2,7 +2,16 @@
 //
 // 對應資料表 flash_sales，儲存限時搶購活動資訊
 // 狀態流轉：待開始(0) → 進行中(1) → 已結束(2)
+// 管理員可暫停(3)/恢復進行中的活動，或將未結束的活動取消(4)
 // 庫存由 Redis 和 DB 雙寫，以 Redis 為準
+// 多規格活動的規格與庫存見 FlashSaleItem
+// 開啟排隊模式的活動依到達順序以固定速率放行搶購請求
+// 抽籤類型活動在開始至結束期間登記，結束後抽出中籤者建立訂單
+// 使用者可在活動開始前預約，開賣前收到提醒；可設定僅限預約使用者搶購
+// 由範本（FlashSaleTemplate）產生的活動記錄 TemplateID，同一範本同一開始時間僅一場
+// 熱門活動可設定 StockShards 將 Redis 庫存拆分為多個分片，分散單一 Key 的流量
+// Campaign 標記活動所屬行銷檔期，供跨活動限購策略（PurchaseLimitPolicy）比對
+// PaymentWindowMinutes 為下單後的付款時限，逾時未付款的訂單自動取消並恢復庫存
 package model
 
 import (
@@ -15,26 +24,55 @@ import (
 type FlashSaleStatus int8
 
 const (
-	FlashSaleStatusPending  FlashSaleStatus = 0 // 待開始
-	FlashSaleStatusActive   FlashSaleStatus = 1 // 進行中
-	FlashSaleStatusFinished FlashSaleStatus = 2 // 已結束
+	FlashSaleStatusPending   FlashSaleStatus = 0 // 待開始
+	FlashSaleStatusActive    FlashSaleStatus = 1 // 進行中
+	FlashSaleStatusFinished  FlashSaleStatus = 2 // 已結束
+	FlashSaleStatusPaused    FlashSaleStatus = 3 // 已暫停（管理員操作，可恢復）
+	FlashSaleStatusCancelled FlashSaleStatus = 4 // 已取消（終止狀態）
 )
 
+// FlashSaleType 秒殺活動類型
+type FlashSaleType int8
+
+const (
+	FlashSaleTypeRush   FlashSaleType = 0 // 搶購：先搶先得
+	FlashSaleTypeRaffle FlashSaleType = 1 // 抽籤：登記後抽出中籤者
+)
+
+// DefaultRemindMinutes 未設定提醒時間時，於開始前幾分鐘提醒預約使用者
+const DefaultRemindMinutes = 5
+
+// DefaultPaymentWindowMinutes 未設定付款時限時，下單後幾分鐘內須完成付款
+const DefaultPaymentWindowMinutes = 15
+
+// DefaultQueueRate 排隊模式未設定放行速率時的預設值（每秒放行請求數）
+const DefaultQueueRate = 100
+
 // FlashSale 秒殺活動模型
 type FlashSale struct {
-	ID             int64           `gorm:"primaryKey;autoIncrement" json:"id"`
-	ProductID      int64           `gorm:"index;not null" json:"product_id"`
-	Product        *Product        `gorm:"foreignKey:ProductID" json:"product,omitempty"` // GORM 關聯
-	FlashPrice     float64         `gorm:"type:decimal(10,2);not null" json:"flash_price"`
-	TotalStock     int             `gorm:"not null" json:"total_stock"`     // 總庫存
-	AvailableStock int             `gorm:"not null" json:"available_stock"` // 剩餘庫存（DB）
-	PerUserLimit   int             `gorm:"default:1" json:"per_user_limit"` // 每人限購數量
-	StartTime      time.Time       `gorm:"not null;index" json:"start_time"`
-	EndTime        time.Time       `gorm:"not null;index" json:"end_time"`
-	Status         FlashSaleStatus `gorm:"type:smallint;default:0" json:"status"`
-	CreatedAt      time.Time       `gorm:"autoCreateTime" json:"created_at"`
-	UpdatedAt      time.Time       `gorm:"autoUpdateTime" json:"updated_at"`
-	DeletedAt      gorm.DeletedAt  `gorm:"index" json:"-"`
+	ID                   int64           `gorm:"primaryKey;autoIncrement" json:"id"`
+	ProductID            int64           `gorm:"index;not null" json:"product_id"`
+	Product              *Product        `gorm:"foreignKey:ProductID" json:"product,omitempty"`                           // GORM 關聯
+	TemplateID           *int64          `gorm:"uniqueIndex:idx_flash_sales_template_start" json:"template_id,omitempty"` // 來源範本，手動建立為空
+	Items                []FlashSaleItem `gorm:"foreignKey:FlashSaleID" json:"items,omitempty"`                           // 多規格活動的規格列表
+	FlashPrice           float64         `gorm:"type:decimal(10,2);not null" json:"flash_price"`
+	TotalStock           int             `gorm:"not null" json:"total_stock"`     // 總庫存
+	AvailableStock       int             `gorm:"not null" json:"available_stock"` // 剩餘庫存（DB）
+	SaleType             FlashSaleType   `gorm:"type:smallint;default:0" json:"sale_type"`
+	PerUserLimit         int             `gorm:"default:1" json:"per_user_limit"`                  // 每人限購數量
+	ReservedOnly         bool            `gorm:"default:false" json:"reserved_only"`               // 僅限預約使用者搶購
+	RemindMinutes        int             `gorm:"default:0" json:"remind_minutes"`                  // 開始前幾分鐘提醒預約使用者，0 使用預設值
+	QueueEnabled         bool            `gorm:"default:false" json:"queue_enabled"`               // 是否開啟排隊模式
+	QueueRate            int             `gorm:"default:0" json:"queue_rate"`                      // 排隊放行速率（每秒），0 使用預設值
+	StockShards          int             `gorm:"not null;default:0" json:"stock_shards"`           // Redis 庫存分片數，0 或 1 不分片
+	Campaign             string          `gorm:"type:varchar(64);index" json:"campaign,omitempty"` // 所屬行銷檔期，空值表示不屬於任何檔期
+	PaymentWindowMinutes int             `gorm:"not null;default:0" json:"payment_window_minutes"` // 下單後付款時限（分鐘），0 使用預設值
+	StartTime            time.Time       `gorm:"not null;index;uniqueIndex:idx_flash_sales_template_start" json:"start_time"`
+	EndTime              time.Time       `gorm:"not null;index" json:"end_time"`
+	Status               FlashSaleStatus `gorm:"type:smallint;default:0" json:"status"`
+	CreatedAt            time.Time       `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt            time.Time       `gorm:"autoUpdateTime" json:"updated_at"`
+	DeletedAt            gorm.DeletedAt  `gorm:"index" json:"-"`
 }
 
 // TableName 指定資料表名稱
@@ -55,3 +93,72 @@ func (f *FlashSale) IsPending() bool {
 	now := time.Now()
 	return f.Status == FlashSaleStatusPending && now.Before(f.StartTime)
 }
+
+// HasItems 檢查是否為多規格活動（需先預載 Items）
+func (f *FlashSale) HasItems() bool {
+	return len(f.Items) > 0
+}
+
+// FindItem 依 ID 查找規格，不存在返回 nil
+func (f *FlashSale) FindItem(itemID int64) *FlashSaleItem {
+	for i := range f.Items {
+		if f.Items[i].ID == itemID {
+			return &f.Items[i]
+		}
+	}
+	return nil
+}
+
+// AdmitRate 取得排隊模式每秒放行的請求數
+func (f *FlashSale) AdmitRate() int {
+	if f.QueueRate > 0 {
+		return f.QueueRate
+	}
+	return DefaultQueueRate
+}
+
+// IsSharded 檢查 Redis 庫存是否分片
+func (f *FlashSale) IsSharded() bool {
+	return f.StockShards > 1
+}
+
+// IsRaffle 檢查是否為抽籤活動
+func (f *FlashSale) IsRaffle() bool {
+	return f.SaleType == FlashSaleTypeRaffle
+}
+
+// RemindBefore 取得開始前提醒預約使用者的提前時間
+func (f *FlashSale) RemindBefore() time.Duration {
+	if f.RemindMinutes > 0 {
+		return time.Duration(f.RemindMinutes) * time.Minute
+	}
+	return DefaultRemindMinutes * time.Minute
+}
+
+// PaymentWindow 取得下單後的付款時限
+func (f *FlashSale) PaymentWindow() time.Duration {
+	if f.PaymentWindowMinutes > 0 {
+		return time.Duration(f.PaymentWindowMinutes) * time.Minute
+	}
+	return DefaultPaymentWindowMinutes * time.Minute
+}
+
+// IsPaused 檢查活動是否已暫停
+func (f *FlashSale) IsPaused() bool {
+	return f.Status == FlashSaleStatusPaused
+}
+
+// IsEditable 檢查活動是否可編輯（待開始且尚未到開始時間）
+func (f *FlashSale) IsEditable() bool {
+	return f.IsPending()
+}
+
+// CanCancel 檢查活動是否可取消（已結束或已取消的活動不可取消）
+func (f *FlashSale) CanCancel() bool {
+	switch f.Status {
+	case FlashSaleStatusPending, FlashSaleStatusActive, FlashSaleStatusPaused:
+		return true
+	default:
+		return false
+	}
+}
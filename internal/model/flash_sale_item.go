@@ -0,0 +1,32 @@
+// 秒殺活動規格資料模型
+//
+// 對應資料表 flash_sale_items，儲存同一活動下的多個規格（顏色、尺寸等）
+// 每個規格擁有獨立的秒殺價格與庫存，活動總庫存為各規格庫存之和
+// 限購以整個活動計算，不區分規格
+package model
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// FlashSaleItem 秒殺活動規格
+type FlashSaleItem struct {
+	ID             int64          `gorm:"primaryKey;autoIncrement" json:"id"`
+	FlashSaleID    int64          `gorm:"index;not null" json:"flash_sale_id"`
+	Name           string         `gorm:"type:varchar(100);not null" json:"name"` // 規格名稱，如「黑色 / 256GB」
+	SKU            string         `gorm:"type:varchar(64)" json:"sku"`
+	FlashPrice     float64        `gorm:"type:decimal(10,2);not null" json:"flash_price"`
+	TotalStock     int            `gorm:"not null" json:"total_stock"`
+	AvailableStock int            `gorm:"not null" json:"available_stock"` // 剩餘庫存（DB）
+	Sort           int            `gorm:"default:0" json:"sort"`           // 顯示排序，小者在前
+	CreatedAt      time.Time      `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt      time.Time      `gorm:"autoUpdateTime" json:"updated_at"`
+	DeletedAt      gorm.DeletedAt `gorm:"index" json:"-"`
+}
+
+// TableName 指定資料表名稱
+func (FlashSaleItem) TableName() string {
+	return "flash_sale_items"
+}
@@ -0,0 +1,66 @@
+// 秒殺活動範本資料模型
+//
+// 對應資料表 flash_sale_templates，描述週期性重複的秒殺活動（如每日 10:00 與 20:00）
+// 週期規則為 5 欄位 cron 表達式，依範本時區計算
+// 排程器在設定的時間範圍內提前產生具體的 FlashSale 並初始化 Redis 庫存
+// LastScheduledAt 記錄已產生的最後一場開始時間，避免重複產生
+package model
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// FlashSaleTemplateStatus 範本狀態
+type FlashSaleTemplateStatus int8
+
+const (
+	FlashSaleTemplateStatusPaused FlashSaleTemplateStatus = 0 // 已暫停：不再產生新活動
+	FlashSaleTemplateStatusActive FlashSaleTemplateStatus = 1 // 啟用中
+)
+
+// DefaultTemplateTimezone 範本未指定時區時使用的時區
+const DefaultTemplateTimezone = "Asia/Shanghai"
+
+// FlashSaleTemplate 秒殺活動範本
+type FlashSaleTemplate struct {
+	ID              int64                   `gorm:"primaryKey;autoIncrement" json:"id"`
+	Name            string                  `gorm:"type:varchar(100);not null" json:"name"`
+	ProductID       int64                   `gorm:"index;not null" json:"product_id"`
+	Product         *Product                `gorm:"foreignKey:ProductID" json:"product,omitempty"`
+	Recurrence      string                  `gorm:"type:varchar(100);not null" json:"recurrence"` // cron 表達式：分 時 日 月 週
+	Timezone        string                  `gorm:"type:varchar(64);not null;default:'Asia/Shanghai'" json:"timezone"`
+	DurationMinutes int                     `gorm:"not null" json:"duration_minutes"` // 每場活動持續時間
+	FlashPrice      float64                 `gorm:"type:decimal(10,2);not null" json:"flash_price"`
+	TotalStock      int                     `gorm:"not null" json:"total_stock"`
+	PerUserLimit    int                     `gorm:"default:1" json:"per_user_limit"`
+	Status          FlashSaleTemplateStatus `gorm:"type:smallint;default:1;index" json:"status"`
+	LastScheduledAt *time.Time              `json:"last_scheduled_at,omitempty"` // 已產生的最後一場開始時間
+	CreatedAt       time.Time               `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt       time.Time               `gorm:"autoUpdateTime" json:"updated_at"`
+	DeletedAt       gorm.DeletedAt          `gorm:"index" json:"-"`
+}
+
+// TableName 指定資料表名稱
+func (FlashSaleTemplate) TableName() string {
+	return "flash_sale_templates"
+}
+
+// IsActive 檢查範本是否啟用中
+func (t *FlashSaleTemplate) IsActive() bool {
+	return t.Status == FlashSaleTemplateStatusActive
+}
+
+// Duration 取得每場活動的持續時間
+func (t *FlashSaleTemplate) Duration() time.Duration {
+	return time.Duration(t.DurationMinutes) * time.Minute
+}
+
+// Location 取得範本時區，未設定時使用預設時區
+func (t *FlashSaleTemplate) Location() (*time.Location, error) {
+	if t.Timezone == "" {
+		return time.LoadLocation(DefaultTemplateTimezone)
+	}
+	return time.LoadLocation(t.Timezone)
+}
@@ -0,0 +1,53 @@
+// 秒殺活動範本模型單元測試
+//
+// 測試覆蓋：
+// - FlashSaleTemplate.IsActive: 啟用/暫停狀態判斷
+// - FlashSaleTemplate.Duration: 持續分鐘數換算
+// - FlashSaleTemplate.Location: 指定時區、預設時區、無效時區
+package model
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFlashSaleTemplate_IsActive(t *testing.T) {
+	if !(&FlashSaleTemplate{Status: FlashSaleTemplateStatusActive}).IsActive() {
+		t.Error("active template IsActive() = false, want true")
+	}
+	if (&FlashSaleTemplate{Status: FlashSaleTemplateStatusPaused}).IsActive() {
+		t.Error("paused template IsActive() = true, want false")
+	}
+}
+
+func TestFlashSaleTemplate_Duration(t *testing.T) {
+	tpl := &FlashSaleTemplate{DurationMinutes: 90}
+	if got := tpl.Duration(); got != 90*time.Minute {
+		t.Errorf("Duration() = %v, want %v", got, 90*time.Minute)
+	}
+}
+
+func TestFlashSaleTemplate_Location(t *testing.T) {
+	tests := []struct {
+		name     string
+		timezone string
+		want     string
+		wantErr  bool
+	}{
+		{"explicit timezone", "UTC", "UTC", false},
+		{"default timezone", "", DefaultTemplateTimezone, false},
+		{"invalid timezone", "Mars/Olympus", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			loc, err := (&FlashSaleTemplate{Timezone: tt.timezone}).Location()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Location() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && loc.String() != tt.want {
+				t.Errorf("Location() = %v, want %v", loc, tt.want)
+			}
+		})
+	}
+}
@@ -3,6 +3,10 @@
 // 測試覆蓋：
 // - FlashSale.IsActive: 活動是否進行中（狀態 + 時間範圍判斷）
 // - FlashSale.IsPending: 活動是否待開始（狀態 + 開始時間判斷）
+// - FlashSale.HasItems / FindItem: 多規格活動的規格查找
+// - FlashSale.AdmitRate: 排隊模式放行速率（含預設值）
+// - FlashSale.PaymentWindow: 下單後付款時限（含預設值）
+// - FlashSale.CanCancel: 各狀態是否允許取消
 package model
 
 import (
@@ -116,3 +120,105 @@ func TestFlashSale_IsPending(t *testing.T) {
 		})
 	}
 }
+
+func TestFlashSale_FindItem(t *testing.T) {
+	flashSale := &FlashSale{
+		Items: []FlashSaleItem{
+			{ID: 11, Name: "黑色"},
+			{ID: 12, Name: "白色"},
+		},
+	}
+
+	if !flashSale.HasItems() {
+		t.Fatal("FlashSale.HasItems() = false, want true")
+	}
+
+	tests := []struct {
+		name   string
+		itemID int64
+		want   string
+	}{
+		{"first item", 11, "黑色"},
+		{"second item", 12, "白色"},
+		{"unknown item", 99, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			item := flashSale.FindItem(tt.itemID)
+			got := ""
+			if item != nil {
+				got = item.Name
+			}
+			if got != tt.want {
+				t.Errorf("FlashSale.FindItem(%d) = %q, want %q", tt.itemID, got, tt.want)
+			}
+		})
+	}
+
+	if (&FlashSale{}).HasItems() {
+		t.Error("FlashSale.HasItems() on single-sku sale = true, want false")
+	}
+}
+
+func TestFlashSale_AdmitRate(t *testing.T) {
+	tests := []struct {
+		name string
+		rate int
+		want int
+	}{
+		{"configured rate", 20, 20},
+		{"zero falls back to default", 0, DefaultQueueRate},
+		{"negative falls back to default", -5, DefaultQueueRate},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := &FlashSale{QueueRate: tt.rate}
+			if got := f.AdmitRate(); got != tt.want {
+				t.Errorf("FlashSale.AdmitRate() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFlashSale_PaymentWindow(t *testing.T) {
+	tests := []struct {
+		name    string
+		minutes int
+		want    time.Duration
+	}{
+		{"configured window", 5, 5 * time.Minute},
+		{"zero falls back to default", 0, DefaultPaymentWindowMinutes * time.Minute},
+		{"negative falls back to default", -1, DefaultPaymentWindowMinutes * time.Minute},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := &FlashSale{PaymentWindowMinutes: tt.minutes}
+			if got := f.PaymentWindow(); got != tt.want {
+				t.Errorf("FlashSale.PaymentWindow() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFlashSale_CanCancel(t *testing.T) {
+	tests := []struct {
+		status FlashSaleStatus
+		want   bool
+	}{
+		{FlashSaleStatusPending, true},
+		{FlashSaleStatusActive, true},
+		{FlashSaleStatusPaused, true},
+		{FlashSaleStatusFinished, false},
+		{FlashSaleStatusCancelled, false},
+	}
+
+	for _, tt := range tests {
+		f := &FlashSale{Status: tt.status}
+		if got := f.CanCancel(); got != tt.want {
+			t.Errorf("FlashSale{Status: %d}.CanCancel() = %v, want %v", tt.status, got, tt.want)
+		}
+	}
+}
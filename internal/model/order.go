@@ -2,7 +2,9 @@
 //
 // 對應資料表 orders，儲存使用者秒殺訂單
 // 狀態流轉：待付款(0) → 已付款(1) / 已取消(2)
-// 已付款訂單可退款 → 已退款(3)
+// 已付款訂單可申請退款 → 退款中(4)，審核通過並由支付供應商完成退款 → 已退款(3)，駁回或退款失敗 → 已付款(1)
+// 合法轉換定義於 order_state.go
+// 待付款訂單於 ExpiresAt（下單時間 + 活動付款時限）到期後自動取消
 package model
 
 import (
@@ -19,6 +21,7 @@ const (
 	OrderStatusPaid      OrderStatus = 1 // 已付款
 	OrderStatusCancelled OrderStatus = 2 // 已取消
 	OrderStatusRefunded  OrderStatus = 3 // 已退款
+	OrderStatusRefunding OrderStatus = 4 // 退款中（已申請，待審核或待供應商退款）
 )
 
 // String 返回狀態的字串表示
@@ -32,6 +35,8 @@ func (s OrderStatus) String() string {
 		return "cancelled"
 	case OrderStatusRefunded:
 		return "refunded"
+	case OrderStatusRefunding:
+		return "refunding"
 	default:
 		return "unknown"
 	}
@@ -45,13 +50,20 @@ type Order struct {
 	User        *User          `gorm:"foreignKey:UserID" json:"user,omitempty"`
 	FlashSaleID int64          `gorm:"index;not null" json:"flash_sale_id"`
 	FlashSale   *FlashSale     `gorm:"foreignKey:FlashSaleID" json:"flash_sale,omitempty"`
+	ItemID      *int64         `gorm:"index" json:"item_id,omitempty"` // 多規格活動的規格 ID
+	Item        *FlashSaleItem `gorm:"foreignKey:ItemID" json:"item,omitempty"`
 	Amount      float64        `gorm:"type:decimal(10,2);not null" json:"amount"` // 訂單金額
 	Quantity    int            `gorm:"default:1" json:"quantity"`
 	Status      OrderStatus    `gorm:"type:smallint;default:0" json:"status"`
 	CreatedAt   time.Time      `gorm:"autoCreateTime" json:"created_at"`
 	UpdatedAt   time.Time      `gorm:"autoUpdateTime" json:"updated_at"`
-	PaidAt      *time.Time     `json:"paid_at,omitempty"` // 付款時間
+	ExpiresAt   *time.Time     `gorm:"index" json:"expires_at,omitempty"` // 付款截止時間，供客戶端倒數
+	PaidAt      *time.Time     `json:"paid_at,omitempty"`                 // 付款時間
 	DeletedAt   gorm.DeletedAt `gorm:"index" json:"-"`
+
+	StockRestorePending bool `gorm:"not null;default:false" json:"-"` // 已取消但 Redis 庫存與限購尚未歸還（取消交易內設定，歸還後清除）
+
+	StatusHistory []OrderStatusHistory `gorm:"foreignKey:OrderID" json:"status_history,omitempty"` // 狀態變更歷史（僅訂單詳情載入）
 }
 
 // TableName 指定資料表名稱
@@ -59,17 +71,22 @@ func (Order) TableName() string {
 	return "orders"
 }
 
-// CanPay 檢查訂單是否可付款
+// CanPay 檢查訂單是否可付款（退款中 → 已付款為退款駁回，不算付款）
 func (o *Order) CanPay() bool {
 	return o.Status == OrderStatusPending
 }
 
+// IsExpired 檢查待付款訂單是否已超過付款截止時間
+func (o *Order) IsExpired(now time.Time) bool {
+	return o.Status == OrderStatusPending && o.ExpiresAt != nil && !now.Before(*o.ExpiresAt)
+}
+
 // CanCancel 檢查訂單是否可取消
 func (o *Order) CanCancel() bool {
-	return o.Status == OrderStatusPending
+	return o.Status.CanTransitionTo(OrderStatusCancelled)
 }
 
-// CanRefund 檢查訂單是否可退款
+// CanRefund 檢查訂單是否可申請退款
 func (o *Order) CanRefund() bool {
-	return o.Status == OrderStatusPaid
+	return o.Status.CanTransitionTo(OrderStatusRefunding)
 }
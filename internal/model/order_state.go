@@ -0,0 +1,92 @@
+// 訂單狀態機
+//
+// 本檔案集中定義訂單的合法狀態轉換與狀態變更歷史
+// 待付款 → 已付款 / 已取消；已付款 → 退款中 → 已退款，退款駁回或失敗 → 已付款
+// 已付款訂單一律經由退款中才能到已退款（活動取消時亦建立退款單），確保每筆退款都有退款單與供應商退款記錄
+// 所有狀態變更都應經由 OrderRepository.Transition，非法轉換返回 *OrderTransitionError
+package model
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrInvalidOrderTransition 非法訂單狀態轉換（*OrderTransitionError 可用 errors.Is 比對）
+var ErrInvalidOrderTransition = errors.New("invalid order status transition")
+
+// orderTransitions 合法的訂單狀態轉換
+var orderTransitions = map[OrderStatus][]OrderStatus{
+	OrderStatusPending:   {OrderStatusPaid, OrderStatusCancelled},
+	OrderStatusPaid:      {OrderStatusRefunding},
+	OrderStatusRefunding: {OrderStatusRefunded, OrderStatusPaid},
+}
+
+// CanTransitionTo 檢查是否可轉換至目標狀態
+func (s OrderStatus) CanTransitionTo(to OrderStatus) bool {
+	for _, next := range orderTransitions[s] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// OrderTransitionError 非法訂單狀態轉換
+// From 為訂單實際所處狀態（並行變更時為最新狀態）
+type OrderTransitionError struct {
+	OrderID int64
+	From    OrderStatus
+	To      OrderStatus
+}
+
+func (e *OrderTransitionError) Error() string {
+	return fmt.Sprintf("order %d: cannot transition from %s to %s", e.OrderID, e.From, e.To)
+}
+
+// Unwrap 使 errors.Is(err, ErrInvalidOrderTransition) 成立
+func (e *OrderTransitionError) Unwrap() error {
+	return ErrInvalidOrderTransition
+}
+
+// Transition 檢查訂單能否轉換至目標狀態，不合法時返回 *OrderTransitionError
+func (o *Order) Transition(to OrderStatus) error {
+	if !o.Status.CanTransitionTo(to) {
+		return &OrderTransitionError{OrderID: o.ID, From: o.Status, To: to}
+	}
+	return nil
+}
+
+// OrderActor 狀態轉換的觸發來源
+type OrderActor string
+
+const (
+	OrderActorUser    OrderActor = "user"    // 使用者操作
+	OrderActorAdmin   OrderActor = "admin"   // 管理員操作
+	OrderActorPayment OrderActor = "payment" // 支付供應商確認（回調或主動查詢）
+	OrderActorSystem  OrderActor = "system"  // 定時任務、活動取消等系統流程
+)
+
+// OrderTrigger 觸發狀態轉換的來源與原因
+type OrderTrigger struct {
+	Actor   OrderActor
+	ActorID *int64 // 使用者或管理員 ID，系統與支付觸發時為空
+	Reason  string
+}
+
+// OrderStatusHistory 訂單狀態變更歷史
+type OrderStatusHistory struct {
+	ID         int64       `gorm:"primaryKey;autoIncrement" json:"id"`
+	OrderID    int64       `gorm:"index;not null" json:"order_id"`
+	FromStatus OrderStatus `gorm:"type:smallint;not null" json:"from_status"`
+	ToStatus   OrderStatus `gorm:"type:smallint;not null" json:"to_status"`
+	Actor      OrderActor  `gorm:"type:varchar(16);not null" json:"actor"`
+	ActorID    *int64      `json:"actor_id,omitempty"`
+	Reason     string      `gorm:"type:varchar(255)" json:"reason,omitempty"`
+	CreatedAt  time.Time   `gorm:"autoCreateTime" json:"created_at"`
+}
+
+// TableName 指定資料表名稱
+func (OrderStatusHistory) TableName() string {
+	return "order_status_history"
+}
@@ -0,0 +1,59 @@
+// 訂單狀態機單元測試
+//
+// 測試覆蓋：
+// - OrderStatus.CanTransitionTo: 所有狀態組合的合法性
+// - Order.Transition: 非法轉換返回 *OrderTransitionError，可用 errors.Is / errors.As 比對
+package model
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestOrderStatus_CanTransitionTo(t *testing.T) {
+	allowed := map[[2]OrderStatus]bool{
+		{OrderStatusPending, OrderStatusPaid}:       true,
+		{OrderStatusPending, OrderStatusCancelled}:  true,
+		{OrderStatusPaid, OrderStatusRefunding}:     true,
+		{OrderStatusRefunding, OrderStatusRefunded}: true,
+		{OrderStatusRefunding, OrderStatusPaid}:     true,
+	}
+
+	statuses := []OrderStatus{
+		OrderStatusPending, OrderStatusPaid, OrderStatusCancelled, OrderStatusRefunded, OrderStatusRefunding,
+	}
+
+	for _, from := range statuses {
+		for _, to := range statuses {
+			want := allowed[[2]OrderStatus{from, to}]
+			if got := from.CanTransitionTo(to); got != want {
+				t.Errorf("%s.CanTransitionTo(%s) = %v, want %v", from, to, got, want)
+			}
+		}
+	}
+}
+
+func TestOrder_Transition(t *testing.T) {
+	order := &Order{ID: 42, Status: OrderStatusCancelled}
+
+	err := order.Transition(OrderStatusPaid)
+	if err == nil {
+		t.Fatal("Transition() from cancelled to paid should fail")
+	}
+	if !errors.Is(err, ErrInvalidOrderTransition) {
+		t.Errorf("errors.Is(err, ErrInvalidOrderTransition) = false, err = %v", err)
+	}
+
+	var transitionErr *OrderTransitionError
+	if !errors.As(err, &transitionErr) {
+		t.Fatalf("errors.As(err, *OrderTransitionError) = false, err = %v", err)
+	}
+	if transitionErr.OrderID != 42 || transitionErr.From != OrderStatusCancelled || transitionErr.To != OrderStatusPaid {
+		t.Errorf("OrderTransitionError = %+v", transitionErr)
+	}
+
+	order.Status = OrderStatusPending
+	if err := order.Transition(OrderStatusPaid); err != nil {
+		t.Errorf("Transition() from pending to paid error = %v", err)
+	}
+}
@@ -3,12 +3,14 @@
 // 測試覆蓋：
 // - Order.CanPay: 訂單是否可付款（僅待付款狀態可付款）
 // - Order.CanCancel: 訂單是否可取消（僅待付款狀態可取消）
-// - Order.CanRefund: 訂單是否可退款（僅已付款狀態可退款）
+// - Order.CanRefund: 訂單是否可申請退款（僅已付款狀態可申請）
+// - Order.IsExpired: 待付款訂單是否已超過付款截止時間
 // - OrderStatus.String: 狀態枚舉字串轉換
 package model
 
 import (
 	"testing"
+	"time"
 )
 
 func TestOrder_CanPay(t *testing.T) {
@@ -106,6 +108,11 @@ func TestOrder_CanRefund(t *testing.T) {
 			order: &Order{Status: OrderStatusRefunded},
 			want:  false,
 		},
+		{
+			name:  "refund already requested",
+			order: &Order{Status: OrderStatusRefunding},
+			want:  false,
+		},
 	}
 
 	for _, tt := range tests {
@@ -117,6 +124,32 @@ func TestOrder_CanRefund(t *testing.T) {
 	}
 }
 
+func TestOrder_IsExpired(t *testing.T) {
+	now := time.Now()
+	past := now.Add(-time.Second)
+	future := now.Add(time.Minute)
+
+	tests := []struct {
+		name  string
+		order *Order
+		want  bool
+	}{
+		{"pending order past deadline", &Order{Status: OrderStatusPending, ExpiresAt: &past}, true},
+		{"pending order at deadline", &Order{Status: OrderStatusPending, ExpiresAt: &now}, true},
+		{"pending order before deadline", &Order{Status: OrderStatusPending, ExpiresAt: &future}, false},
+		{"pending order without deadline", &Order{Status: OrderStatusPending}, false},
+		{"paid order past deadline", &Order{Status: OrderStatusPaid, ExpiresAt: &past}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.order.IsExpired(now); got != tt.want {
+				t.Errorf("Order.IsExpired() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
 func TestOrderStatus_String(t *testing.T) {
 	tests := []struct {
 		status OrderStatus
@@ -126,6 +159,7 @@ func TestOrderStatus_String(t *testing.T) {
 		{OrderStatusPaid, "paid"},
 		{OrderStatusCancelled, "cancelled"},
 		{OrderStatusRefunded, "refunded"},
+		{OrderStatusRefunding, "refunding"},
 		{OrderStatus(99), "unknown"},
 	}
 
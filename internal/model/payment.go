@@ -0,0 +1,64 @@
+// 支付單資料模型
+//
+// 對應資料表 payments，記錄訂單的每次支付嘗試
+// 一筆訂單可有多次支付嘗試（前次失敗後重新發起），最多一筆成功
+// 狀態流轉：待支付(0) → 支付成功(1) / 支付失敗(2)；支付成功可退款 → 已退款(3)
+package model
+
+import (
+	"time"
+)
+
+// PaymentStatus 支付單狀態
+type PaymentStatus int8
+
+const (
+	PaymentStatusPending   PaymentStatus = 0 // 待支付
+	PaymentStatusSucceeded PaymentStatus = 1 // 支付成功
+	PaymentStatusFailed    PaymentStatus = 2 // 支付失敗
+	PaymentStatusRefunded  PaymentStatus = 3 // 已退款
+)
+
+// String 返回狀態的字串表示
+func (s PaymentStatus) String() string {
+	switch s {
+	case PaymentStatusPending:
+		return "pending"
+	case PaymentStatusSucceeded:
+		return "succeeded"
+	case PaymentStatusFailed:
+		return "failed"
+	case PaymentStatusRefunded:
+		return "refunded"
+	default:
+		return "unknown"
+	}
+}
+
+// Payment 支付單模型
+type Payment struct {
+	ID            int64         `gorm:"primaryKey;autoIncrement" json:"id"`
+	PaymentNo     string        `gorm:"type:varchar(32);uniqueIndex;not null" json:"payment_no"` // 商戶支付單號，傳給供應商作為冪等鍵
+	OrderID       int64         `gorm:"index;not null" json:"order_id"`
+	OrderNo       string        `gorm:"type:varchar(32);index;not null" json:"order_no"`
+	UserID        int64         `gorm:"index;not null" json:"user_id"`
+	Provider      string        `gorm:"type:varchar(32);uniqueIndex:idx_payments_provider_ref;not null" json:"provider"`
+	ProviderRef   *string       `gorm:"type:varchar(64);uniqueIndex:idx_payments_provider_ref" json:"provider_ref,omitempty"` // 供應商支付意圖 ID
+	PayURL        string        `gorm:"type:varchar(512)" json:"pay_url,omitempty"`                                           // 付款頁面位址
+	Amount        float64       `gorm:"type:decimal(10,2);not null" json:"amount"`
+	Status        PaymentStatus `gorm:"type:smallint;default:0;index" json:"status"`
+	FailureReason string        `gorm:"type:varchar(255)" json:"failure_reason,omitempty"`
+	CreatedAt     time.Time     `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt     time.Time     `gorm:"autoUpdateTime" json:"updated_at"`
+	PaidAt        *time.Time    `json:"paid_at,omitempty"` // 供應商確認成功的時間
+}
+
+// TableName 指定資料表名稱
+func (Payment) TableName() string {
+	return "payments"
+}
+
+// IsFinal 是否已是終態（不再接受供應商狀態變更）
+func (p *Payment) IsFinal() bool {
+	return p.Status != PaymentStatusPending
+}
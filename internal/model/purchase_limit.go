@@ -0,0 +1,107 @@
+// 跨活動限購策略資料模型
+//
+// 對應資料表 purchase_limit_policies，限制使用者在多場秒殺活動間的合計購買數量
+// 範圍：同一商品（scope=product）或同一行銷檔期（scope=campaign，對應 FlashSale.Campaign）
+// 週期：自然日、自然週（週一起算）、自然月，或不分週期（lifetime），依策略時區劃分
+// 計數器存放於 Redis，Key 包含週期起點，TTL 為週期結束時間；lifetime 計數器隨最後一場相關活動結束後過期
+// 僅套用於搶購活動，抽籤活動不計入
+package model
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// PurchaseLimitScope 限購範圍
+type PurchaseLimitScope string
+
+const (
+	PurchaseLimitScopeProduct  PurchaseLimitScope = "product"  // 同一商品的所有活動
+	PurchaseLimitScopeCampaign PurchaseLimitScope = "campaign" // 同一檔期的所有活動
+)
+
+// PurchaseLimitWindow 限購週期
+type PurchaseLimitWindow string
+
+const (
+	PurchaseLimitWindowDay      PurchaseLimitWindow = "day"
+	PurchaseLimitWindowWeek     PurchaseLimitWindow = "week"
+	PurchaseLimitWindowMonth    PurchaseLimitWindow = "month"
+	PurchaseLimitWindowLifetime PurchaseLimitWindow = "lifetime"
+)
+
+// PurchaseLimitPolicy 跨活動限購策略
+type PurchaseLimitPolicy struct {
+	ID          int64               `gorm:"primaryKey;autoIncrement" json:"id"`
+	Name        string              `gorm:"type:varchar(100);not null" json:"name"`
+	Scope       PurchaseLimitScope  `gorm:"type:varchar(16);not null" json:"scope"`
+	ProductID   *int64              `gorm:"index" json:"product_id,omitempty"`                                 // scope=product 時必填
+	Campaign    string              `gorm:"type:varchar(64);index" json:"campaign,omitempty"`                  // scope=campaign 時必填
+	MaxQuantity int                 `gorm:"not null" json:"max_quantity"`                                      // 週期內最多購買數量
+	Window      PurchaseLimitWindow `gorm:"column:limit_window;type:varchar(16);not null" json:"window"`       // WINDOW 為 SQL 保留字
+	Timezone    string              `gorm:"type:varchar(64);not null;default:'Asia/Shanghai'" json:"timezone"` // 劃分自然日/週/月的時區
+	Enabled     bool                `gorm:"default:true;index" json:"enabled"`
+	CreatedAt   time.Time           `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt   time.Time           `gorm:"autoUpdateTime" json:"updated_at"`
+	DeletedAt   gorm.DeletedAt      `gorm:"index" json:"-"`
+}
+
+// TableName 指定資料表名稱
+func (PurchaseLimitPolicy) TableName() string {
+	return "purchase_limit_policies"
+}
+
+// Applies 判斷策略是否適用於指定活動（停用策略與抽籤活動不適用）
+func (p *PurchaseLimitPolicy) Applies(flashSale *FlashSale) bool {
+	if !p.Enabled || flashSale.IsRaffle() {
+		return false
+	}
+	switch p.Scope {
+	case PurchaseLimitScopeProduct:
+		return p.ProductID != nil && *p.ProductID == flashSale.ProductID
+	case PurchaseLimitScopeCampaign:
+		return p.Campaign != "" && p.Campaign == flashSale.Campaign
+	default:
+		return false
+	}
+}
+
+// Location 取得策略時區，未設定時使用預設時區
+func (p *PurchaseLimitPolicy) Location() (*time.Location, error) {
+	if p.Timezone == "" {
+		return time.LoadLocation(DefaultTemplateTimezone)
+	}
+	return time.LoadLocation(p.Timezone)
+}
+
+// Period 計算 t 所在的限購週期，返回週期標識（用於計數器 Key）與週期結束時間
+// lifetime 週期標識固定為 "all"，結束時間為零值
+func (p *PurchaseLimitPolicy) Period(t time.Time) (string, time.Time, error) {
+	period, _, end, err := p.PeriodRange(t)
+	return period, end, err
+}
+
+// PeriodRange 計算 t 所在的限購週期標識與起訖時間（起點含、終點不含），lifetime 起訖皆為零值
+func (p *PurchaseLimitPolicy) PeriodRange(t time.Time) (string, time.Time, time.Time, error) {
+	loc, err := p.Location()
+	if err != nil {
+		return "", time.Time{}, time.Time{}, err
+	}
+	t = t.In(loc)
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc)
+
+	switch p.Window {
+	case PurchaseLimitWindowDay:
+		return day.Format("20060102"), day, day.AddDate(0, 0, 1), nil
+	case PurchaseLimitWindowWeek:
+		offset := (int(day.Weekday()) + 6) % 7 // 週一為 0
+		start := day.AddDate(0, 0, -offset)
+		return "w" + start.Format("20060102"), start, start.AddDate(0, 0, 7), nil
+	case PurchaseLimitWindowMonth:
+		start := time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, loc)
+		return start.Format("200601"), start, start.AddDate(0, 1, 0), nil
+	default:
+		return "all", time.Time{}, time.Time{}, nil
+	}
+}
@@ -0,0 +1,87 @@
+// 跨活動限購策略模型單元測試
+//
+// 測試覆蓋：
+// - PurchaseLimitPolicy.Applies: 商品範圍、檔期範圍、停用策略、抽籤活動
+// - PurchaseLimitPolicy.PeriodRange: 自然日/週/月的週期標識與起訖時間、lifetime、跨時區
+package model
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPurchaseLimitPolicy_Applies(t *testing.T) {
+	productID := int64(7)
+	productPolicy := PurchaseLimitPolicy{Scope: PurchaseLimitScopeProduct, ProductID: &productID, Enabled: true}
+	campaignPolicy := PurchaseLimitPolicy{Scope: PurchaseLimitScopeCampaign, Campaign: "double11", Enabled: true}
+	disabled := productPolicy
+	disabled.Enabled = false
+
+	tests := []struct {
+		name   string
+		policy PurchaseLimitPolicy
+		sale   FlashSale
+		want   bool
+	}{
+		{"same product", productPolicy, FlashSale{ProductID: 7}, true},
+		{"other product", productPolicy, FlashSale{ProductID: 8}, false},
+		{"same campaign", campaignPolicy, FlashSale{ProductID: 8, Campaign: "double11"}, true},
+		{"other campaign", campaignPolicy, FlashSale{Campaign: "618"}, false},
+		{"no campaign", campaignPolicy, FlashSale{}, false},
+		{"disabled", disabled, FlashSale{ProductID: 7}, false},
+		{"raffle", productPolicy, FlashSale{ProductID: 7, SaleType: FlashSaleTypeRaffle}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.policy.Applies(&tt.sale); got != tt.want {
+				t.Errorf("Applies() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPurchaseLimitPolicy_PeriodRange(t *testing.T) {
+	// 2026-10-17 為週六；UTC 17:30 在上海已是 10-18（週日）01:30
+	at := time.Date(2026, 10, 17, 17, 30, 0, 0, time.UTC)
+	shanghai, _ := time.LoadLocation("Asia/Shanghai")
+
+	tests := []struct {
+		name      string
+		window    PurchaseLimitWindow
+		timezone  string
+		wantKey   string
+		wantStart time.Time
+		wantEnd   time.Time
+	}{
+		{"day utc", PurchaseLimitWindowDay, "UTC", "20261017", time.Date(2026, 10, 17, 0, 0, 0, 0, time.UTC), time.Date(2026, 10, 18, 0, 0, 0, 0, time.UTC)},
+		{"day shanghai", PurchaseLimitWindowDay, "", "20261018", time.Date(2026, 10, 18, 0, 0, 0, 0, shanghai), time.Date(2026, 10, 19, 0, 0, 0, 0, shanghai)},
+		{"week", PurchaseLimitWindowWeek, "UTC", "w20261012", time.Date(2026, 10, 12, 0, 0, 0, 0, time.UTC), time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC)},
+		{"month", PurchaseLimitWindowMonth, "UTC", "202610", time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC), time.Date(2026, 11, 1, 0, 0, 0, 0, time.UTC)},
+		{"lifetime", PurchaseLimitWindowLifetime, "UTC", "all", time.Time{}, time.Time{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy := &PurchaseLimitPolicy{Window: tt.window, Timezone: tt.timezone}
+			key, start, end, err := policy.PeriodRange(at)
+			if err != nil {
+				t.Fatalf("PeriodRange() error = %v", err)
+			}
+			if key != tt.wantKey {
+				t.Errorf("PeriodRange() key = %q, want %q", key, tt.wantKey)
+			}
+			if !start.Equal(tt.wantStart) {
+				t.Errorf("PeriodRange() start = %v, want %v", start, tt.wantStart)
+			}
+			if !end.Equal(tt.wantEnd) {
+				t.Errorf("PeriodRange() end = %v, want %v", end, tt.wantEnd)
+			}
+
+			// Period 與 PeriodRange 一致
+			if gotKey, gotEnd, _ := policy.Period(at); gotKey != key || !gotEnd.Equal(end) {
+				t.Errorf("Period() = %q, %v, want %q, %v", gotKey, gotEnd, key, end)
+			}
+		})
+	}
+}
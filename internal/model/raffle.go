@@ -0,0 +1,58 @@
+// 抽籤資料模型
+//
+// 對應資料表 raffle_entries、raffle_draws
+// RaffleEntry：使用者在抽籤活動中的登記，抽籤後記錄中籤結果
+// RaffleDraw：每個活動唯一的抽籤紀錄，保存種子、名單摘要與中籤名單供稽核
+package model
+
+import (
+	"time"
+)
+
+// RaffleResult 抽籤結果
+type RaffleResult int8
+
+const (
+	RaffleResultPending RaffleResult = 0 // 待抽籤
+	RaffleResultWon     RaffleResult = 1 // 中籤
+	RaffleResultLost    RaffleResult = 2 // 未中籤
+)
+
+// RaffleEntry 抽籤登記
+type RaffleEntry struct {
+	ID          int64        `gorm:"primaryKey;autoIncrement" json:"id"`
+	FlashSaleID int64        `gorm:"uniqueIndex:idx_raffle_entries_sale_user;not null" json:"flash_sale_id"`
+	UserID      int64        `gorm:"uniqueIndex:idx_raffle_entries_sale_user;not null;index" json:"user_id"`
+	Result      RaffleResult `gorm:"type:smallint;default:0" json:"result"`
+	OrderNo     string       `gorm:"type:varchar(32)" json:"order_no,omitempty"` // 中籤後建立的訂單號
+	CreatedAt   time.Time    `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt   time.Time    `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+// TableName 指定資料表名稱
+func (RaffleEntry) TableName() string {
+	return "raffle_entries"
+}
+
+// RaffleDraw 抽籤紀錄（每個活動僅一筆，唯一索引保證只抽一次）
+type RaffleDraw struct {
+	ID          int64      `gorm:"primaryKey;autoIncrement" json:"id"`
+	FlashSaleID int64      `gorm:"uniqueIndex;not null" json:"flash_sale_id"`
+	Seed        string     `gorm:"type:varchar(64);not null" json:"seed"`         // 抽籤種子
+	EntriesHash string     `gorm:"type:varchar(64);not null" json:"entries_hash"` // 參與者名單摘要
+	EntryCount  int        `gorm:"not null" json:"entry_count"`                   // 參與人數
+	WinnerCount int        `gorm:"not null" json:"winner_count"`                  // 中籤人數
+	Winners     string     `gorm:"type:text" json:"winners"`                      // 中籤使用者 ID（JSON 陣列，依抽籤順序）
+	FulfilledAt *time.Time `json:"fulfilled_at,omitempty"`                        // 中籤訂單全部建立完成的時間
+	DrawnAt     time.Time  `gorm:"not null" json:"drawn_at"`
+}
+
+// TableName 指定資料表名稱
+func (RaffleDraw) TableName() string {
+	return "raffle_draws"
+}
+
+// IsFulfilled 檢查中籤訂單是否已全部建立
+func (d *RaffleDraw) IsFulfilled() bool {
+	return d.FulfilledAt != nil
+}
@@ -0,0 +1,67 @@
+// 退款單資料模型
+//
+// 對應資料表 refunds，記錄訂單的退款申請與處理結果
+// 狀態流轉：待審核(0) → 退款中(1)（審核通過，已向供應商發起）→ 已退款(2) / 退款失敗(4)；待審核(0) → 已駁回(3)
+// 支付成功但訂單已不可付款時系統自動建立退款單，直接從退款中(1)開始
+package model
+
+import (
+	"time"
+)
+
+// RefundStatus 退款單狀態
+type RefundStatus int8
+
+const (
+	RefundStatusPending    RefundStatus = 0 // 待審核
+	RefundStatusProcessing RefundStatus = 1 // 退款中
+	RefundStatusSucceeded  RefundStatus = 2 // 已退款
+	RefundStatusRejected   RefundStatus = 3 // 已駁回
+	RefundStatusFailed     RefundStatus = 4 // 退款失敗
+)
+
+// String 返回狀態的字串表示
+func (s RefundStatus) String() string {
+	switch s {
+	case RefundStatusPending:
+		return "pending"
+	case RefundStatusProcessing:
+		return "processing"
+	case RefundStatusSucceeded:
+		return "succeeded"
+	case RefundStatusRejected:
+		return "rejected"
+	case RefundStatusFailed:
+		return "failed"
+	default:
+		return "unknown"
+	}
+}
+
+// Refund 退款單模型
+type Refund struct {
+	ID               int64        `gorm:"primaryKey;autoIncrement" json:"id"`
+	RefundNo         string       `gorm:"type:varchar(32);uniqueIndex;not null" json:"refund_no"` // 商戶退款單號，傳給供應商作為冪等鍵
+	OrderID          int64        `gorm:"index;not null" json:"order_id"`
+	OrderNo          string       `gorm:"type:varchar(32);index;not null" json:"order_no"`
+	UserID           int64        `gorm:"index;not null" json:"user_id"`
+	PaymentID        *int64       `gorm:"index" json:"payment_id,omitempty"` // 原支付單，無支付單的舊訂單為空
+	Provider         string       `gorm:"type:varchar(32)" json:"provider,omitempty"`
+	ProviderRefundID *string      `gorm:"type:varchar(64);index" json:"provider_refund_id,omitempty"` // 供應商退款 ID
+	Amount           float64      `gorm:"type:decimal(10,2);not null" json:"amount"`
+	Reason           string       `gorm:"type:varchar(255);not null" json:"reason"`
+	Status           RefundStatus `gorm:"type:smallint;default:0;index" json:"status"`
+	RestoreStock     bool         `gorm:"default:false" json:"restore_stock"` // 退款完成後將庫存歸還活動（僅活動仍進行中時生效）
+	ReviewerID       *int64       `json:"reviewer_id,omitempty"`
+	ReviewNote       string       `gorm:"type:varchar(255)" json:"review_note,omitempty"`
+	FailureReason    string       `gorm:"type:varchar(255)" json:"failure_reason,omitempty"`
+	CreatedAt        time.Time    `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt        time.Time    `gorm:"autoUpdateTime" json:"updated_at"`
+	ReviewedAt       *time.Time   `json:"reviewed_at,omitempty"`
+	RefundedAt       *time.Time   `json:"refunded_at,omitempty"`
+}
+
+// TableName 指定資料表名稱
+func (Refund) TableName() string {
+	return "refunds"
+}
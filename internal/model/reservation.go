@@ -0,0 +1,24 @@
+// 預約資料模型
+//
+// 對應資料表 reservations，記錄使用者對待開始秒殺活動的預約
+// 活動開始前依活動設定的提前分鐘數，透過 WebSocket 與郵件提醒已預約使用者
+// 活動開啟「僅限預約使用者」時，未預約者不能搶購
+package model
+
+import (
+	"time"
+)
+
+// Reservation 秒殺活動預約
+type Reservation struct {
+	ID          int64      `gorm:"primaryKey;autoIncrement" json:"id"`
+	FlashSaleID int64      `gorm:"uniqueIndex:idx_reservations_sale_user;not null" json:"flash_sale_id"`
+	UserID      int64      `gorm:"uniqueIndex:idx_reservations_sale_user;not null;index" json:"user_id"`
+	RemindedAt  *time.Time `gorm:"index" json:"reminded_at,omitempty"` // 已發送開賣提醒的時間
+	CreatedAt   time.Time  `gorm:"autoCreateTime" json:"created_at"`
+}
+
+// TableName 指定資料表名稱
+func (Reservation) TableName() string {
+	return "reservations"
+}
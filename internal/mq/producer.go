@@ -61,6 +61,7 @@ type FlashSaleOrderMessage struct {
 	Timestamp   time.Time `json:"timestamp"`
 	FlashSaleID int64     `json:"flash_sale_id"`
 	UserID      int64     `json:"user_id"`
+	ItemID      int64     `json:"item_id,omitempty"` // 規格 ID，單規格活動為 0
 	Quantity    int       `json:"quantity"`
 	Ticket      string    `json:"ticket"` // 排隊憑證，用於前端查詢訂單狀態
 }
@@ -33,6 +33,7 @@ const (
 	CodeFlashSaleNotActive = 1003 // 秒殺活動未開始或已結束
 	CodeOrderNotFound      = 1004 // 訂單不存在
 	CodeOrderStatusInvalid = 1005 // 訂單狀態不允許此操作
+	CodeValidationFailed   = 1006 // 業務規則驗證失敗（附欄位錯誤）
 )
 
 // 錯誤碼對應訊息
@@ -50,6 +51,7 @@ var codeMessages = map[int]string{
 	CodeFlashSaleNotActive: "秒杀活动未开始或已结束",
 	CodeOrderNotFound:      "订单不存在",
 	CodeOrderStatusInvalid: "订单状态不允许此操作",
+	CodeValidationFailed:   "参数校验失败",
 }
 
 // Success 成功回應
@@ -141,3 +143,12 @@ func LimitExceeded(c *gin.Context) {
 func FlashSaleNotActive(c *gin.Context) {
 	Error(c, http.StatusOK, CodeFlashSaleNotActive, "")
 }
+
+// ValidationFailed 業務規則驗證失敗，errors 為欄位錯誤列表
+func ValidationFailed(c *gin.Context, errors interface{}) {
+	c.JSON(http.StatusBadRequest, Response{
+		Code:    CodeValidationFailed,
+		Message: codeMessages[CodeValidationFailed],
+		Data:    gin.H{"errors": errors},
+	})
+}
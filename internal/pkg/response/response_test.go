@@ -2,11 +2,12 @@
 //
 // 測試覆蓋：
 // - Response 結構體: Code, Message, Data 欄位
-// - 業務錯誤碼常量: 0-500 標準碼 + 1001-1005 業務碼
+// - 業務錯誤碼常量: 0-500 標準碼 + 1001-1006 業務碼
 // - Success/SuccessWithMessage: 成功回應
 // - BadRequest/Unauthorized/Forbidden/NotFound/Conflict: HTTP 錯誤回應
 // - TooManyRequests/InternalError: 限流與伺服器錯誤
 // - StockInsufficient/LimitExceeded/FlashSaleNotActive: 秒殺業務錯誤
+// - ValidationFailed: 欄位驗證錯誤回應
 // - Error 空消息時使用預設訊息
 // - Error 未知錯誤碼時返回 "unknown error"
 package response
@@ -61,6 +62,7 @@ func TestBusinessCodes(t *testing.T) {
 		{"flash sale not active", CodeFlashSaleNotActive, 1003},
 		{"order not found", CodeOrderNotFound, 1004},
 		{"order status invalid", CodeOrderStatusInvalid, 1005},
+		{"validation failed", CodeValidationFailed, 1006},
 	}
 
 	for _, tt := range tests {
@@ -337,3 +339,32 @@ func TestError_UnknownCode_UsesUnknownError(t *testing.T) {
 		t.Errorf("Response.Message = %v, want %v", resp.Message, "unknown error")
 	}
 }
+
+func TestValidationFailed(t *testing.T) {
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+
+	ValidationFailed(c, []map[string]string{{"field": "flash_price", "message": "秒杀价必须低于原价"}})
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("HTTP status = %v, want %v", w.Code, http.StatusBadRequest)
+	}
+
+	var resp struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+		Data    struct {
+			Errors []map[string]string `json:"errors"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+
+	if resp.Code != CodeValidationFailed {
+		t.Errorf("Response.Code = %v, want %v", resp.Code, CodeValidationFailed)
+	}
+	if len(resp.Data.Errors) != 1 || resp.Data.Errors[0]["field"] != "flash_price" {
+		t.Errorf("Response.Data.Errors = %v, want one flash_price error", resp.Data.Errors)
+	}
+}
@@ -0,0 +1,156 @@
+// 週期排程表達式工具
+//
+// 本檔案實現標準 5 欄位 cron 表達式解析：分 時 日 月 週
+// 每個欄位支援 *、數值、範圍 a-b、列表 a,b、步長 */n 與 a-b/n
+// 週欄位 0 與 7 均代表週日；日與週同時指定時任一符合即觸發（與 crontab 一致）
+// 時間計算以傳入時間的時區為準
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrInvalidCron cron 表達式格式錯誤
+var ErrInvalidCron = errors.New("invalid cron expression")
+
+// cronSearchLimit Next 向後搜尋的上限，避免如 2 月 30 日等永不觸發的表達式無限迴圈
+const cronSearchLimit = 5 * 366 * 24 * time.Hour
+
+// CronSchedule 解析後的排程，每個欄位以位元遮罩表示允許的值
+type CronSchedule struct {
+	minute, hour, dom, month, dow uint64
+	domAny, dowAny                bool // 欄位為 * 時不參與日/週的「或」判斷
+}
+
+type cronField struct {
+	name     string
+	min, max int
+}
+
+var cronFields = [5]cronField{
+	{"minute", 0, 59},
+	{"hour", 0, 23},
+	{"day of month", 1, 31},
+	{"month", 1, 12},
+	{"day of week", 0, 7},
+}
+
+// ParseCron 解析 5 欄位 cron 表達式
+func ParseCron(expr string) (*CronSchedule, error) {
+	parts := strings.Fields(expr)
+	if len(parts) != len(cronFields) {
+		return nil, fmt.Errorf("%w: expected 5 fields, got %d", ErrInvalidCron, len(parts))
+	}
+
+	var masks [5]uint64
+	for i, part := range parts {
+		mask, err := parseCronField(part, cronFields[i])
+		if err != nil {
+			return nil, err
+		}
+		masks[i] = mask
+	}
+
+	// 週日 7 與 0 等價
+	if masks[4]&(1<<7) != 0 {
+		masks[4] = masks[4]&^(1<<7) | 1
+	}
+
+	return &CronSchedule{
+		minute: masks[0],
+		hour:   masks[1],
+		dom:    masks[2],
+		month:  masks[3],
+		dow:    masks[4],
+		domAny: parts[2] == "*",
+		dowAny: parts[4] == "*",
+	}, nil
+}
+
+// parseCronField 解析單一欄位（逗號分隔的多個項目）
+func parseCronField(field string, spec cronField) (uint64, error) {
+	var mask uint64
+	for _, item := range strings.Split(field, ",") {
+		rangePart, step := item, 1
+		if idx := strings.Index(item, "/"); idx >= 0 {
+			n, err := strconv.Atoi(item[idx+1:])
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("%w: invalid step %q in %s", ErrInvalidCron, item, spec.name)
+			}
+			rangePart, step = item[:idx], n
+		}
+
+		lo, hi := spec.min, spec.max
+		switch {
+		case rangePart == "*":
+		case strings.Contains(rangePart, "-"):
+			bounds := strings.SplitN(rangePart, "-", 2)
+			var err1, err2 error
+			lo, err1 = strconv.Atoi(bounds[0])
+			hi, err2 = strconv.Atoi(bounds[1])
+			if err1 != nil || err2 != nil || lo > hi {
+				return 0, fmt.Errorf("%w: invalid range %q in %s", ErrInvalidCron, item, spec.name)
+			}
+		default:
+			n, err := strconv.Atoi(rangePart)
+			if err != nil {
+				return 0, fmt.Errorf("%w: invalid value %q in %s", ErrInvalidCron, item, spec.name)
+			}
+			lo, hi = n, n
+			if step > 1 {
+				hi = spec.max // a/n 等同 a-max/n
+			}
+		}
+
+		if lo < spec.min || hi > spec.max {
+			return 0, fmt.Errorf("%w: %q out of range [%d-%d] in %s", ErrInvalidCron, item, spec.min, spec.max, spec.name)
+		}
+		for v := lo; v <= hi; v += step {
+			mask |= 1 << uint(v)
+		}
+	}
+	return mask, nil
+}
+
+// Next 返回嚴格晚於 after 的下一次觸發時間（精確到分鐘）
+// 找不到時（如 2 月 30 日）返回零值
+func (s *CronSchedule) Next(after time.Time) time.Time {
+	loc := after.Location()
+	t := after.Truncate(time.Minute).Add(time.Minute)
+	limit := after.Add(cronSearchLimit)
+
+	for t.Before(limit) {
+		if s.month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc)
+			continue
+		}
+		if !s.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc)
+			continue
+		}
+		if s.hour&(1<<uint(t.Hour())) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, loc)
+			continue
+		}
+		if s.minute&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
+
+// dayMatches 日與週欄位的判斷：兩者皆有限制時任一符合即可
+func (s *CronSchedule) dayMatches(t time.Time) bool {
+	domOK := s.dom&(1<<uint(t.Day())) != 0
+	dowOK := s.dow&(1<<uint(t.Weekday())) != 0
+	if !s.domAny && !s.dowAny {
+		return domOK || dowOK
+	}
+	return domOK && dowOK
+}
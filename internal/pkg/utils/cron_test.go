@@ -0,0 +1,83 @@
+// 週期排程表達式單元測試
+//
+// 測試覆蓋：
+// - ParseCron: 欄位數量、數值範圍、範圍/列表/步長語法
+// - Next: 每日多時段、步長、週幾、日與週的「或」判斷、跨月跨年、永不觸發
+package utils
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestParseCron(t *testing.T) {
+	tests := []struct {
+		name    string
+		expr    string
+		wantErr bool
+	}{
+		{"every minute", "* * * * *", false},
+		{"daily twice", "0 10,20 * * *", false},
+		{"step", "*/15 * * * *", false},
+		{"range with step", "0 9-18/3 * * 1-5", false},
+		{"sunday as 7", "0 0 * * 7", false},
+		{"too few fields", "0 10 * *", true},
+		{"too many fields", "0 10 * * * *", true},
+		{"minute out of range", "60 * * * *", true},
+		{"hour out of range", "0 24 * * *", true},
+		{"day of month zero", "0 0 0 * *", true},
+		{"inverted range", "0 18-9 * * *", true},
+		{"zero step", "*/0 * * * *", true},
+		{"not a number", "a * * * *", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseCron(tt.expr)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseCron(%q) error = %v, wantErr %v", tt.expr, err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, ErrInvalidCron) {
+				t.Errorf("ParseCron(%q) error = %v, want ErrInvalidCron", tt.expr, err)
+			}
+		})
+	}
+}
+
+func TestCronScheduleNext(t *testing.T) {
+	loc := time.FixedZone("CST", 8*3600)
+	at := func(year int, month time.Month, day, hour, min int) time.Time {
+		return time.Date(year, month, day, hour, min, 0, 0, loc)
+	}
+
+	tests := []struct {
+		name  string
+		expr  string
+		after time.Time
+		want  time.Time
+	}{
+		{"same day morning", "0 10,20 * * *", at(2026, 3, 2, 8, 30), at(2026, 3, 2, 10, 0)},
+		{"same day evening", "0 10,20 * * *", at(2026, 3, 2, 10, 0), at(2026, 3, 2, 20, 0)},
+		{"next day", "0 10,20 * * *", at(2026, 3, 2, 20, 0), at(2026, 3, 3, 10, 0)},
+		{"step minutes", "*/15 * * * *", at(2026, 3, 2, 8, 1), at(2026, 3, 2, 8, 15)},
+		{"weekday only", "0 9 * * 1-5", at(2026, 3, 6, 9, 0), at(2026, 3, 9, 9, 0)},
+		{"sunday as 7", "0 0 * * 7", at(2026, 3, 2, 0, 0), at(2026, 3, 8, 0, 0)},
+		{"day or weekday", "0 0 15 * 1", at(2026, 3, 10, 0, 0), at(2026, 3, 15, 0, 0)},
+		{"end of year", "0 0 1 1 *", at(2026, 6, 1, 0, 0), at(2027, 1, 1, 0, 0)},
+		{"leap day", "0 0 29 2 *", at(2026, 3, 1, 0, 0), at(2028, 2, 29, 0, 0)},
+		{"never", "0 0 30 2 *", at(2026, 3, 1, 0, 0), time.Time{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			schedule, err := ParseCron(tt.expr)
+			if err != nil {
+				t.Fatalf("ParseCron(%q) error = %v", tt.expr, err)
+			}
+			if got := schedule.Next(tt.after); !got.Equal(tt.want) {
+				t.Errorf("Next(%v) = %v, want %v", tt.after, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,92 @@
+// 抽籤工具
+//
+// 本檔案實現可驗證的種子抽籤演算法
+// 每位參與者的排序分數 = SHA-256(種子 + ":" + 使用者ID)，分數最小的前 N 位中籤
+// 結果只取決於種子與參與者名單，公開兩者即可由任何人重算驗證
+package utils
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"sort"
+	"strconv"
+)
+
+// NewDrawSeed 產生 32 位元組的隨機抽籤種子（十六進位字串）
+func NewDrawSeed() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// DrawScore 計算參與者的排序分數
+func DrawScore(seed string, userID int64) []byte {
+	sum := sha256.Sum256([]byte(seed + ":" + strconv.FormatInt(userID, 10)))
+	return sum[:]
+}
+
+// DrawWinners 依種子從參與者中抽出 n 位中籤者，返回中籤者與未中籤者
+// 參與者順序不影響結果，重複的使用者 ID 只計一次
+func DrawWinners(seed string, candidates []int64, n int) (winners, losers []int64) {
+	type scored struct {
+		userID int64
+		score  []byte
+	}
+
+	seen := make(map[int64]struct{}, len(candidates))
+	list := make([]scored, 0, len(candidates))
+	for _, id := range candidates {
+		if _, ok := seen[id]; ok {
+			continue
+		}
+		seen[id] = struct{}{}
+		list = append(list, scored{userID: id, score: DrawScore(seed, id)})
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		if c := bytes.Compare(list[i].score, list[j].score); c != 0 {
+			return c < 0
+		}
+		return list[i].userID < list[j].userID
+	})
+
+	if n < 0 {
+		n = 0
+	}
+	if n > len(list) {
+		n = len(list)
+	}
+
+	winners = make([]int64, 0, n)
+	losers = make([]int64, 0, len(list)-n)
+	for i, s := range list {
+		if i < n {
+			winners = append(winners, s.userID)
+		} else {
+			losers = append(losers, s.userID)
+		}
+	}
+	return winners, losers
+}
+
+// EntriesDigest 計算參與者名單摘要（排序後的使用者 ID 以逗號串接再取 SHA-256）
+// 與種子一同保存，用於稽核抽籤時的名單未被竄改
+func EntriesDigest(candidates []int64) string {
+	ids := make([]int64, len(candidates))
+	copy(ids, candidates)
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	var buf bytes.Buffer
+	for i, id := range ids {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		buf.WriteString(strconv.FormatInt(id, 10))
+	}
+	sum := sha256.Sum256(buf.Bytes())
+	return hex.EncodeToString(sum[:])
+}
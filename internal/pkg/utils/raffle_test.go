@@ -0,0 +1,87 @@
+// 抽籤工具單元測試
+//
+// 測試覆蓋：
+// - NewDrawSeed: 種子長度與隨機性
+// - DrawWinners: 相同種子結果可重現、與名單順序無關、去重、名額邊界
+// - EntriesDigest: 與名單順序無關
+package utils
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNewDrawSeed(t *testing.T) {
+	a, err := NewDrawSeed()
+	if err != nil {
+		t.Fatalf("NewDrawSeed() error = %v", err)
+	}
+	b, _ := NewDrawSeed()
+
+	if len(a) != 64 {
+		t.Errorf("NewDrawSeed() length = %d, want 64", len(a))
+	}
+	if a == b {
+		t.Error("NewDrawSeed() returned the same seed twice")
+	}
+}
+
+func TestDrawWinners_Deterministic(t *testing.T) {
+	candidates := []int64{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}
+	shuffled := []int64{7, 3, 10, 1, 5, 9, 2, 8, 6, 4}
+
+	w1, l1 := DrawWinners("seed-a", candidates, 3)
+	w2, l2 := DrawWinners("seed-a", shuffled, 3)
+
+	if !reflect.DeepEqual(w1, w2) || !reflect.DeepEqual(l1, l2) {
+		t.Errorf("DrawWinners() depends on candidate order: %v/%v vs %v/%v", w1, l1, w2, l2)
+	}
+	if len(w1) != 3 || len(l1) != 7 {
+		t.Errorf("DrawWinners() = %d winners, %d losers, want 3 and 7", len(w1), len(l1))
+	}
+
+	w3, _ := DrawWinners("seed-b", candidates, 3)
+	w4, _ := DrawWinners("seed-c", candidates, 3)
+	if reflect.DeepEqual(w1, w3) && reflect.DeepEqual(w1, w4) {
+		t.Error("DrawWinners() returned identical winners for different seeds")
+	}
+}
+
+func TestDrawWinners_Bounds(t *testing.T) {
+	tests := []struct {
+		name        string
+		candidates  []int64
+		n           int
+		wantWinners int
+		wantLosers  int
+	}{
+		{"more slots than entries", []int64{1, 2}, 5, 2, 0},
+		{"zero slots", []int64{1, 2, 3}, 0, 0, 3},
+		{"negative slots", []int64{1, 2, 3}, -1, 0, 3},
+		{"duplicate entries", []int64{1, 1, 2, 2, 3}, 2, 2, 1},
+		{"no entries", nil, 3, 0, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			winners, losers := DrawWinners("seed", tt.candidates, tt.n)
+			if len(winners) != tt.wantWinners || len(losers) != tt.wantLosers {
+				t.Errorf("DrawWinners() = %d winners, %d losers, want %d and %d",
+					len(winners), len(losers), tt.wantWinners, tt.wantLosers)
+			}
+		})
+	}
+}
+
+func TestEntriesDigest(t *testing.T) {
+	a := EntriesDigest([]int64{3, 1, 2})
+	b := EntriesDigest([]int64{1, 2, 3})
+	c := EntriesDigest([]int64{1, 2, 4})
+
+	if a != b {
+		t.Error("EntriesDigest() depends on candidate order")
+	}
+	if a == c {
+		t.Error("EntriesDigest() returned the same digest for different entries")
+	}
+}
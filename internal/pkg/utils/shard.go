@@ -0,0 +1,44 @@
+// 分片工具
+//
+// 本檔案提供庫存分片使用的分桶與均分演算法
+// 使用者依 ID 雜湊固定落在同一分片，均分時餘數由前面的分片各多分一件
+package utils
+
+import (
+	"encoding/binary"
+	"hash/fnv"
+)
+
+// ShardIndex 依使用者 ID 計算所屬分片（FNV-1a），shards <= 1 時固定為 0
+func ShardIndex(userID int64, shards int) int {
+	if shards <= 1 {
+		return 0
+	}
+
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], uint64(userID))
+	h := fnv.New32a()
+	_, _ = h.Write(buf[:])
+	return int(h.Sum32() % uint32(shards))
+}
+
+// SplitEven 將 total 均分為 parts 份，餘數由前面的分片各多分一件
+// total 為負數時視為 0，parts <= 0 返回 nil
+func SplitEven(total, parts int) []int {
+	if parts <= 0 {
+		return nil
+	}
+	if total < 0 {
+		total = 0
+	}
+
+	result := make([]int, parts)
+	base, rem := total/parts, total%parts
+	for i := range result {
+		result[i] = base
+		if i < rem {
+			result[i]++
+		}
+	}
+	return result
+}
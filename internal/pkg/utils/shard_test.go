@@ -0,0 +1,64 @@
+// 分片工具單元測試
+//
+// 測試覆蓋：
+// - ShardIndex: 範圍、穩定性、不分片時固定為 0、分布大致均勻
+// - SplitEven: 均分、餘數分配、邊界值
+package utils
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestShardIndex(t *testing.T) {
+	for _, shards := range []int{0, 1} {
+		if got := ShardIndex(12345, shards); got != 0 {
+			t.Errorf("ShardIndex(12345, %d) = %d, want 0", shards, got)
+		}
+	}
+
+	const shards = 8
+	counts := make([]int, shards)
+	for userID := int64(1); userID <= 8000; userID++ {
+		idx := ShardIndex(userID, shards)
+		if idx < 0 || idx >= shards {
+			t.Fatalf("ShardIndex(%d, %d) = %d, out of range", userID, shards, idx)
+		}
+		if again := ShardIndex(userID, shards); again != idx {
+			t.Fatalf("ShardIndex(%d) not stable: %d then %d", userID, idx, again)
+		}
+		counts[idx]++
+	}
+
+	// 連續 ID 應大致均勻分布，每個分片不少於平均值的一半
+	for i, c := range counts {
+		if c < 500 {
+			t.Errorf("shard %d got %d users, distribution too skewed: %v", i, c, counts)
+		}
+	}
+}
+
+func TestSplitEven(t *testing.T) {
+	tests := []struct {
+		name  string
+		total int
+		parts int
+		want  []int
+	}{
+		{"exact", 12, 4, []int{3, 3, 3, 3}},
+		{"remainder", 10, 4, []int{3, 3, 2, 2}},
+		{"fewer than parts", 2, 4, []int{1, 1, 0, 0}},
+		{"zero total", 0, 3, []int{0, 0, 0}},
+		{"negative total", -5, 2, []int{0, 0}},
+		{"single part", 7, 1, []int{7}},
+		{"no parts", 7, 0, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := SplitEven(tt.total, tt.parts); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("SplitEven(%d, %d) = %v, want %v", tt.total, tt.parts, got, tt.want)
+			}
+		})
+	}
+}
@@ -88,3 +88,15 @@ func GenerateTicket() string {
 	id := GenerateID()
 	return fmt.Sprintf("TK%d", id)
 }
+
+// GeneratePaymentNo 生成支付單號（PY 前綴）
+func GeneratePaymentNo() string {
+	id := GenerateID()
+	return fmt.Sprintf("PY%d", id)
+}
+
+// GenerateRefundNo 生成退款單號（RF 前綴）
+func GenerateRefundNo() string {
+	id := GenerateID()
+	return fmt.Sprintf("RF%d", id)
+}
@@ -1,12 +1,13 @@
 // 資料驗證工具
 //
 // 本檔案提供各類業務資料驗證方法
-// 包含：使用者名稱、郵件、密碼、手機號、訂單號等
+// 包含：使用者名稱、郵件、密碼、手機號、訂單號、秒殺價格與時間等
 // 返回結構化驗證錯誤
 package validator
 
 import (
 	"regexp"
+	"time"
 	"unicode"
 )
 
@@ -148,3 +149,26 @@ func ValidateMessage(message string) *ValidationError {
 	}
 	return nil
 }
+
+// ValidateFlashPrice 驗證秒殺價必須大於 0 且低於商品原價
+func ValidateFlashPrice(flashPrice, originalPrice float64) *ValidationError {
+	if flashPrice <= 0 {
+		return &ValidationError{Field: "flash_price", Message: "秒杀价必须大于0"}
+	}
+	if flashPrice >= originalPrice {
+		return &ValidationError{Field: "flash_price", Message: "秒杀价必须低于商品原价"}
+	}
+	return nil
+}
+
+// ValidateFlashSaleTime 驗證活動時間：開始時間須晚於 now，結束時間須晚於開始時間
+func ValidateFlashSaleTime(start, end, now time.Time) []*ValidationError {
+	var errs []*ValidationError
+	if !start.After(now) {
+		errs = append(errs, &ValidationError{Field: "start_time", Message: "开始时间必须晚于当前时间"})
+	}
+	if !end.After(start) {
+		errs = append(errs, &ValidationError{Field: "end_time", Message: "结束时间必须晚于开始时间"})
+	}
+	return errs
+}
@@ -10,11 +10,14 @@
 // - ValidateOrderNo: 訂單號格式驗證
 // - ValidateSessionID: 會話 ID 驗證
 // - ValidateMessage: 消息內容長度驗證
+// - ValidateFlashPrice: 秒殺價與原價比較
+// - ValidateFlashSaleTime: 活動起訖時間驗證
 // - ValidationError: 錯誤結構體方法測試
 package validator
 
 import (
 	"testing"
+	"time"
 )
 
 func TestValidateUsername(t *testing.T) {
@@ -260,3 +263,61 @@ func TestValidationError_Error(t *testing.T) {
 		t.Errorf("ValidationError.Error() = %v, want %v", err.Error(), "用户名至少3个字符")
 	}
 }
+
+func TestValidateFlashPrice(t *testing.T) {
+	tests := []struct {
+		name          string
+		flashPrice    float64
+		originalPrice float64
+		wantErr       bool
+	}{
+		{"below original", 59.9, 99, false},
+		{"equal to original", 99, 99, true},
+		{"above original", 120, 99, true},
+		{"zero", 0, 99, true},
+		{"negative", -1, 99, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateFlashPrice(tt.flashPrice, tt.originalPrice)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidateFlashPrice(%v, %v) error = %v, wantErr %v", tt.flashPrice, tt.originalPrice, err, tt.wantErr)
+			}
+			if err != nil && err.Field != "flash_price" {
+				t.Errorf("ValidateFlashPrice() field = %v, want flash_price", err.Field)
+			}
+		})
+	}
+}
+
+func TestValidateFlashSaleTime(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name       string
+		start      time.Time
+		end        time.Time
+		wantFields []string
+	}{
+		{"valid", now.Add(time.Hour), now.Add(2 * time.Hour), nil},
+		{"start in past", now.Add(-time.Hour), now.Add(time.Hour), []string{"start_time"}},
+		{"start equals now", now, now.Add(time.Hour), []string{"start_time"}},
+		{"end before start", now.Add(2 * time.Hour), now.Add(time.Hour), []string{"end_time"}},
+		{"both invalid", now.Add(-time.Hour), now.Add(-2 * time.Hour), []string{"start_time", "end_time"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			errs := ValidateFlashSaleTime(tt.start, tt.end, now)
+			if len(errs) != len(tt.wantFields) {
+				t.Fatalf("ValidateFlashSaleTime() got %d errors, want %d", len(errs), len(tt.wantFields))
+			}
+			for i, field := range tt.wantFields {
+				if errs[i].Field != field {
+					t.Errorf("ValidateFlashSaleTime() errs[%d].Field = %v, want %v", i, errs[i].Field, field)
+				}
+			}
+		})
+	}
+}
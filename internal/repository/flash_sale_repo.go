@@ -1,7 +1,7 @@
 // 秒殺活動資料存取層
 //
 // 本檔案封裝秒殺活動表的 CRUD 操作
-// 包含：列表查詢、狀態更新、庫存扣減/恢復
+// 包含：列表查詢、狀態更新、庫存扣減/恢復、管理員編輯與庫存調整
 package repository
 
 import (
@@ -12,6 +12,7 @@ import (
 	"github.com/Mag1cFall/magtrade/internal/database"
 	"github.com/Mag1cFall/magtrade/internal/model"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 var (
@@ -27,15 +28,20 @@ func NewFlashSaleRepository() *FlashSaleRepository {
 	return &FlashSaleRepository{db: database.Get()}
 }
 
-// Create 建立秒殺活動
+// preloadItems 規格按顯示排序預載
+func preloadItems(db *gorm.DB) *gorm.DB {
+	return db.Order("sort ASC, id ASC")
+}
+
+// Create 建立秒殺活動（含 Items 時一併建立規格）
 func (r *FlashSaleRepository) Create(ctx context.Context, flashSale *model.FlashSale) error {
 	return r.db.WithContext(ctx).Create(flashSale).Error
 }
 
-// GetByID 根據 ID 查詢（預載 Product）
+// GetByID 根據 ID 查詢（預載 Product 與 Items）
 func (r *FlashSaleRepository) GetByID(ctx context.Context, id int64) (*model.FlashSale, error) {
 	var flashSale model.FlashSale
-	result := r.db.WithContext(ctx).Preload("Product").First(&flashSale, id)
+	result := r.db.WithContext(ctx).Preload("Product").Preload("Items", preloadItems).First(&flashSale, id)
 	if result.Error != nil {
 		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
 			return nil, ErrFlashSaleNotFound
@@ -103,21 +109,60 @@ func (r *FlashSaleRepository) Update(ctx context.Context, flashSale *model.Flash
 	return r.db.WithContext(ctx).Save(flashSale).Error
 }
 
-// DecrementStock 扣減 DB 庫存（樂觀鎖）
-func (r *FlashSaleRepository) DecrementStock(ctx context.Context, id int64, quantity int) error {
+// UpdateFields 更新活動欄位（僅當狀態仍為 status 時更新，避免編輯已開始的活動）
+func (r *FlashSaleRepository) UpdateFields(ctx context.Context, id int64, status model.FlashSaleStatus, fields map[string]interface{}) (bool, error) {
+	result := r.db.WithContext(ctx).
+		Model(&model.FlashSale{}).
+		Where("id = ? AND status = ?", id, status).
+		Updates(fields)
+
+	return result.RowsAffected > 0, result.Error
+}
+
+// Delete 軟刪除活動
+func (r *FlashSaleRepository) Delete(ctx context.Context, id int64) error {
+	return r.db.WithContext(ctx).Delete(&model.FlashSale{}, id).Error
+}
+
+// AdjustStock 調整活動總庫存與剩餘庫存（調整後剩餘庫存不得為負）
+func (r *FlashSaleRepository) AdjustStock(ctx context.Context, id int64, delta int) error {
 	result := r.db.WithContext(ctx).
 		Model(&model.FlashSale{}).
-		Where("id = ? AND available_stock >= ?", id, quantity). // 樂觀鎖條件
-		UpdateColumn("available_stock", gorm.Expr("available_stock - ?", quantity))
+		Where("id = ? AND available_stock + ? >= 0", id, delta).
+		UpdateColumns(map[string]interface{}{
+			"total_stock":     gorm.Expr("total_stock + ?", delta),
+			"available_stock": gorm.Expr("available_stock + ?", delta),
+		})
 
+	if result.Error != nil {
+		return result.Error
+	}
 	if result.RowsAffected == 0 {
 		return errors.New("insufficient stock or flash sale not found")
 	}
+	return nil
+}
 
-	return result.Error
+// AdjustItemStock 調整規格總庫存與剩餘庫存（調整後剩餘庫存不得為負）
+func (r *FlashSaleRepository) AdjustItemStock(ctx context.Context, itemID int64, delta int) error {
+	result := r.db.WithContext(ctx).
+		Model(&model.FlashSaleItem{}).
+		Where("id = ? AND available_stock + ? >= 0", itemID, delta).
+		UpdateColumns(map[string]interface{}{
+			"total_stock":     gorm.Expr("total_stock + ?", delta),
+			"available_stock": gorm.Expr("available_stock + ?", delta),
+		})
+
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errors.New("insufficient item stock or item not found")
+	}
+	return nil
 }
 
-// IncrementStock 恢復 DB 庫存（取消訂單時）
+// IncrementStock 恢復 DB 庫存（退款恢復庫存時；取消訂單於狀態轉換交易內恢復）
 func (r *FlashSaleRepository) IncrementStock(ctx context.Context, id int64, quantity int) error {
 	return r.db.WithContext(ctx).
 		Model(&model.FlashSale{}).
@@ -126,24 +171,124 @@ func (r *FlashSaleRepository) IncrementStock(ctx context.Context, id int64, quan
 		Error
 }
 
-// UpdatePendingToActive 批量更新待開始 → 進行中
-func (r *FlashSaleRepository) UpdatePendingToActive(ctx context.Context) (int64, error) {
-	now := time.Now()
+// IncrementItemStock 恢復規格 DB 庫存（退款恢復庫存時）
+func (r *FlashSaleRepository) IncrementItemStock(ctx context.Context, itemID int64, quantity int) error {
+	return r.db.WithContext(ctx).
+		Model(&model.FlashSaleItem{}).
+		Where("id = ?", itemID).
+		UpdateColumn("available_stock", gorm.Expr("available_stock + ?", quantity)).
+		Error
+}
+
+// CompareAndSetStock 修正 DB 庫存（僅當庫存仍為 expected 時才更新，避免覆蓋併發扣減）
+func (r *FlashSaleRepository) CompareAndSetStock(ctx context.Context, id int64, expected, stock int) (bool, error) {
 	result := r.db.WithContext(ctx).
 		Model(&model.FlashSale{}).
-		Where("status = ? AND start_time <= ?", model.FlashSaleStatusPending, now).
-		Update("status", model.FlashSaleStatusActive)
+		Where("id = ? AND available_stock = ?", id, expected).
+		UpdateColumn("available_stock", stock)
 
-	return result.RowsAffected, result.Error
+	return result.RowsAffected > 0, result.Error
 }
 
-// UpdateActiveToFinished 批量更新進行中 → 已結束
-func (r *FlashSaleRepository) UpdateActiveToFinished(ctx context.Context) (int64, error) {
-	now := time.Now()
+// CompareAndSetItemStock 修正規格 DB 庫存（僅當庫存仍為 expected 時才更新）
+func (r *FlashSaleRepository) CompareAndSetItemStock(ctx context.Context, itemID int64, expected, stock int) (bool, error) {
+	result := r.db.WithContext(ctx).
+		Model(&model.FlashSaleItem{}).
+		Where("id = ? AND available_stock = ?", itemID, expected).
+		UpdateColumn("available_stock", stock)
+
+	return result.RowsAffected > 0, result.Error
+}
+
+// ListForReconcile 查詢需要對帳的活動（待開始、進行中、以及 since 之後結束的活動），預載 Items
+func (r *FlashSaleRepository) ListForReconcile(ctx context.Context, since time.Time) ([]model.FlashSale, error) {
+	var flashSales []model.FlashSale
+
+	result := r.db.WithContext(ctx).
+		Preload("Items", preloadItems).
+		Where("status IN ? OR (status = ? AND end_time > ?)",
+			[]model.FlashSaleStatus{model.FlashSaleStatusPending, model.FlashSaleStatusActive, model.FlashSaleStatusPaused},
+			model.FlashSaleStatusFinished, since).
+		Order("id ASC").
+		Find(&flashSales)
+
+	return flashSales, result.Error
+}
+
+// ListForWarmUp 查詢需要預熱庫存的活動（進行中、已暫停，或在 before 之前開始的待開始活動）
+func (r *FlashSaleRepository) ListForWarmUp(ctx context.Context, before time.Time) ([]model.FlashSale, error) {
+	var flashSales []model.FlashSale
+
+	result := r.db.WithContext(ctx).
+		Preload("Items", preloadItems).
+		Where("status IN ? OR (status = ? AND start_time <= ?)",
+			[]model.FlashSaleStatus{model.FlashSaleStatusActive, model.FlashSaleStatusPaused},
+			model.FlashSaleStatusPending, before).
+		Order("start_time ASC").
+		Find(&flashSales)
+
+	return flashSales, result.Error
+}
+
+// ListPendingDue 查詢已到開始時間的待開始活動
+func (r *FlashSaleRepository) ListPendingDue(ctx context.Context) ([]model.FlashSale, error) {
+	var flashSales []model.FlashSale
+
+	result := r.db.WithContext(ctx).
+		Preload("Items", preloadItems).
+		Where("status = ? AND start_time <= ?", model.FlashSaleStatusPending, time.Now()).
+		Order("start_time ASC").
+		Find(&flashSales)
+
+	return flashSales, result.Error
+}
+
+// ListOverlapping 查詢同商品中時間區間重疊且未結束的活動（待開始/進行中/暫停）
+// excludeID 為編輯中的活動本身，建立時傳 0
+func (r *FlashSaleRepository) ListOverlapping(ctx context.Context, productID int64, start, end time.Time, excludeID int64) ([]model.FlashSale, error) {
+	var flashSales []model.FlashSale
+
+	result := r.db.WithContext(ctx).
+		Where("product_id = ? AND id <> ? AND status IN ?", productID, excludeID, []model.FlashSaleStatus{
+			model.FlashSaleStatusPending,
+			model.FlashSaleStatusActive,
+			model.FlashSaleStatusPaused,
+		}).
+		Where("start_time < ? AND end_time > ?", end, start).
+		Order("start_time ASC").
+		Find(&flashSales)
+
+	return flashSales, result.Error
+}
+
+// UpdateStatus 更新活動狀態（樂觀鎖，僅當狀態仍為 from 時更新）
+func (r *FlashSaleRepository) UpdateStatus(ctx context.Context, id int64, from, to model.FlashSaleStatus) (bool, error) {
 	result := r.db.WithContext(ctx).
 		Model(&model.FlashSale{}).
-		Where("status = ? AND end_time <= ?", model.FlashSaleStatusActive, now).
+		Where("id = ? AND status = ?", id, from).
+		Update("status", to)
+
+	return result.RowsAffected > 0, result.Error
+}
+
+// UpdateActiveToFinished 批量更新進行中（含已暫停）→ 已結束，返回被結束的活動 ID
+func (r *FlashSaleRepository) UpdateActiveToFinished(ctx context.Context) ([]int64, error) {
+	var finished []model.FlashSale
+	now := time.Now()
+
+	result := r.db.WithContext(ctx).
+		Model(&finished).
+		Clauses(clause.Returning{Columns: []clause.Column{{Name: "id"}}}).
+		Where("status IN ? AND end_time <= ?",
+			[]model.FlashSaleStatus{model.FlashSaleStatusActive, model.FlashSaleStatusPaused}, now).
 		Update("status", model.FlashSaleStatusFinished)
+	if result.Error != nil {
+		return nil, result.Error
+	}
 
-	return result.RowsAffected, result.Error
+	ids := make([]int64, len(finished))
+	for i, flashSale := range finished {
+		ids[i] = flashSale.ID
+	}
+	return ids, nil
 }
@@ -0,0 +1,113 @@
+// 秒殺活動範本資料存取層
+//
+// 本檔案封裝活動範本表的讀寫
+// 包含：建立、查詢、分頁列表、啟用範本查詢、欄位更新、狀態切換、排程進度記錄
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/Mag1cFall/magtrade/internal/database"
+	"github.com/Mag1cFall/magtrade/internal/model"
+	"gorm.io/gorm"
+)
+
+var ErrFlashSaleTemplateNotFound = errors.New("flash sale template not found")
+
+// FlashSaleTemplateRepository 活動範本資料存取
+type FlashSaleTemplateRepository struct {
+	db *gorm.DB
+}
+
+func NewFlashSaleTemplateRepository() *FlashSaleTemplateRepository {
+	return &FlashSaleTemplateRepository{db: database.Get()}
+}
+
+// Create 建立範本
+func (r *FlashSaleTemplateRepository) Create(ctx context.Context, template *model.FlashSaleTemplate) error {
+	return r.db.WithContext(ctx).Create(template).Error
+}
+
+// GetByID 根據 ID 查詢（預載 Product）
+func (r *FlashSaleTemplateRepository) GetByID(ctx context.Context, id int64) (*model.FlashSaleTemplate, error) {
+	var template model.FlashSaleTemplate
+	result := r.db.WithContext(ctx).Preload("Product").First(&template, id)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, ErrFlashSaleTemplateNotFound
+		}
+		return nil, result.Error
+	}
+	return &template, nil
+}
+
+// List 分頁查詢範本
+func (r *FlashSaleTemplateRepository) List(ctx context.Context, page, pageSize int, status *model.FlashSaleTemplateStatus) ([]model.FlashSaleTemplate, int64, error) {
+	var templates []model.FlashSaleTemplate
+	var total int64
+
+	db := r.db.WithContext(ctx).Model(&model.FlashSaleTemplate{})
+
+	if status != nil {
+		db = db.Where("status = ?", *status)
+	}
+
+	if err := db.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	offset := (page - 1) * pageSize
+	if err := db.Preload("Product").Offset(offset).Limit(pageSize).Order("id DESC").Find(&templates).Error; err != nil {
+		return nil, 0, err
+	}
+
+	return templates, total, nil
+}
+
+// ListActive 查詢所有啟用中的範本
+func (r *FlashSaleTemplateRepository) ListActive(ctx context.Context) ([]model.FlashSaleTemplate, error) {
+	var templates []model.FlashSaleTemplate
+
+	result := r.db.WithContext(ctx).
+		Where("status = ?", model.FlashSaleTemplateStatusActive).
+		Order("id ASC").
+		Find(&templates)
+
+	return templates, result.Error
+}
+
+// UpdateFields 更新範本欄位
+func (r *FlashSaleTemplateRepository) UpdateFields(ctx context.Context, id int64, fields map[string]interface{}) error {
+	result := r.db.WithContext(ctx).
+		Model(&model.FlashSaleTemplate{}).
+		Where("id = ?", id).
+		Updates(fields)
+
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrFlashSaleTemplateNotFound
+	}
+	return nil
+}
+
+// UpdateStatus 更新範本狀態（樂觀鎖，僅當狀態仍為 from 時更新）
+func (r *FlashSaleTemplateRepository) UpdateStatus(ctx context.Context, id int64, from, to model.FlashSaleTemplateStatus) (bool, error) {
+	result := r.db.WithContext(ctx).
+		Model(&model.FlashSaleTemplate{}).
+		Where("id = ? AND status = ?", id, from).
+		Update("status", to)
+
+	return result.RowsAffected > 0, result.Error
+}
+
+// SetLastScheduled 記錄已產生的最後一場開始時間（只前進不後退）
+func (r *FlashSaleTemplateRepository) SetLastScheduled(ctx context.Context, id int64, startTime time.Time) error {
+	return r.db.WithContext(ctx).
+		Model(&model.FlashSaleTemplate{}).
+		Where("id = ? AND (last_scheduled_at IS NULL OR last_scheduled_at < ?)", id, startTime).
+		Update("last_scheduled_at", startTime).Error
+}
@@ -1,7 +1,8 @@
 // 訂單資料存取層
 //
 // 本檔案封裝訂單表的 CRUD 操作
-// 包含：訂單查詢、狀態更新、過期訂單批量取消
+// 包含：訂單查詢、狀態轉換（依狀態機並記錄歷史）、過期訂單領取
+// 過期訂單以 FOR UPDATE SKIP LOCKED 領取並在同一交易內取消，多實例同時掃描時每筆訂單只被取消一次
 package repository
 
 import (
@@ -12,6 +13,7 @@ import (
 	"github.com/Mag1cFall/magtrade/internal/database"
 	"github.com/Mag1cFall/magtrade/internal/model"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 var (
@@ -32,10 +34,22 @@ func (r *OrderRepository) Create(ctx context.Context, order *model.Order) error
 	return r.db.WithContext(ctx).Create(order).Error
 }
 
+// CreateWithStock 建立訂單並在同一交易內扣減活動與規格的 DB 庫存
+// 准入已在 Redis 扣減庫存，DB 庫存只跟隨訂單，不檢查下限（超賣由庫存對帳告警）；
+// 訂單與扣減同時提交，對帳不會讀到只完成其中一步的狀態
+func (r *OrderRepository) CreateWithStock(ctx context.Context, order *model.Order) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(order).Error; err != nil {
+			return err
+		}
+		return adjustOrderStock(tx, order, -order.Quantity)
+	})
+}
+
 // GetByID 根據 ID 查詢（預載關聯）
 func (r *OrderRepository) GetByID(ctx context.Context, id int64) (*model.Order, error) {
 	var order model.Order
-	result := r.db.WithContext(ctx).Preload("FlashSale.Product").First(&order, id)
+	result := r.db.WithContext(ctx).Preload("FlashSale.Product").Preload("Item").First(&order, id)
 	if result.Error != nil {
 		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
 			return nil, ErrOrderNotFound
@@ -48,7 +62,7 @@ func (r *OrderRepository) GetByID(ctx context.Context, id int64) (*model.Order,
 // GetByOrderNo 根據訂單號查詢
 func (r *OrderRepository) GetByOrderNo(ctx context.Context, orderNo string) (*model.Order, error) {
 	var order model.Order
-	result := r.db.WithContext(ctx).Preload("FlashSale.Product").Where("order_no = ?", orderNo).First(&order)
+	result := r.db.WithContext(ctx).Preload("FlashSale.Product").Preload("Item").Where("order_no = ?", orderNo).First(&order)
 	if result.Error != nil {
 		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
 			return nil, ErrOrderNotFound
@@ -74,6 +88,22 @@ func (r *OrderRepository) GetByUserAndFlashSale(ctx context.Context, userID, fla
 	return &order, nil
 }
 
+// GetCreatedSince 查詢使用者在某活動於 since 之後建立的訂單（含已取消）
+func (r *OrderRepository) GetCreatedSince(ctx context.Context, userID, flashSaleID int64, since time.Time) (*model.Order, error) {
+	var order model.Order
+	result := r.db.WithContext(ctx).
+		Where("user_id = ? AND flash_sale_id = ? AND created_at >= ?", userID, flashSaleID, since).
+		First(&order)
+
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, result.Error
+	}
+	return &order, nil
+}
+
 // ListByUser 分頁查詢使用者訂單
 func (r *OrderRepository) ListByUser(ctx context.Context, userID int64, page, pageSize int) ([]model.Order, int64, error) {
 	var orders []model.Order
@@ -86,111 +116,270 @@ func (r *OrderRepository) ListByUser(ctx context.Context, userID int64, page, pa
 	}
 
 	offset := (page - 1) * pageSize
-	if err := db.Preload("FlashSale.Product").Offset(offset).Limit(pageSize).Order("created_at DESC").Find(&orders).Error; err != nil {
+	if err := db.Preload("FlashSale.Product").Preload("Item").Offset(offset).Limit(pageSize).Order("created_at DESC").Find(&orders).Error; err != nil {
 		return nil, 0, err
 	}
 
 	return orders, total, nil
 }
 
-// UpdateStatus 更新訂單狀態（樂觀鎖）
-func (r *OrderRepository) UpdateStatus(ctx context.Context, id int64, oldStatus, newStatus model.OrderStatus) error {
+// Transition 依狀態機變更訂單狀態並記錄變更歷史（同一交易），成功後更新 order 的狀態欄位
+// 轉換不合法或訂單已被並行變更時返回 *model.OrderTransitionError
+func (r *OrderRepository) Transition(ctx context.Context, order *model.Order, to model.OrderStatus, trigger model.OrderTrigger) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return transitionOrder(tx, order, to, trigger)
+	})
+}
+
+// ListStatusHistory 查詢訂單狀態變更歷史（時間正序）
+func (r *OrderRepository) ListStatusHistory(ctx context.Context, orderID int64) ([]model.OrderStatusHistory, error) {
+	var history []model.OrderStatusHistory
 	result := r.db.WithContext(ctx).
-		Model(&model.Order{}).
-		Where("id = ? AND status = ?", id, oldStatus). // 樂觀鎖
-		Updates(map[string]interface{}{
-			"status":     newStatus,
-			"updated_at": time.Now(),
-		})
+		Where("order_id = ?", orderID).
+		Order("id ASC").
+		Find(&history)
+	return history, result.Error
+}
+
+// transitionOrder 在交易內執行狀態轉換：樂觀鎖更新 + 寫入歷史
+// 轉為已取消時同時恢復 DB 庫存並標記待歸還 Redis 庫存，取消與庫存恢復不會分離
+func transitionOrder(tx *gorm.DB, order *model.Order, to model.OrderStatus, trigger model.OrderTrigger) error {
+	if err := order.Transition(to); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	updates := map[string]interface{}{
+		"status":     to,
+		"updated_at": now,
+	}
+	if to == model.OrderStatusPaid && order.Status == model.OrderStatusPending {
+		updates["paid_at"] = now
+	}
+	if to == model.OrderStatusCancelled {
+		updates["stock_restore_pending"] = true
+	}
+
+	result := tx.Model(&model.Order{}).
+		Where("id = ? AND status = ?", order.ID, order.Status). // 樂觀鎖
+		Updates(updates)
+	if result.Error != nil {
+		return result.Error
+	}
 
 	if result.RowsAffected == 0 {
-		return errors.New("order status update failed: status mismatch or order not found")
+		var current model.Order
+		if err := tx.Select("id", "status").First(&current, order.ID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrOrderNotFound
+			}
+			return err
+		}
+		return &model.OrderTransitionError{OrderID: order.ID, From: current.Status, To: to}
 	}
 
-	return result.Error
+	history := &model.OrderStatusHistory{
+		OrderID:    order.ID,
+		FromStatus: order.Status,
+		ToStatus:   to,
+		Actor:      trigger.Actor,
+		ActorID:    trigger.ActorID,
+		Reason:     trigger.Reason,
+	}
+	if err := tx.Create(history).Error; err != nil {
+		return err
+	}
+
+	if to == model.OrderStatusCancelled {
+		if err := adjustOrderStock(tx, order, order.Quantity); err != nil {
+			return err
+		}
+		order.StockRestorePending = true
+	}
+
+	order.Status = to
+	if _, ok := updates["paid_at"]; ok {
+		order.PaidAt = &now
+	}
+	return nil
 }
 
-// Pay 支付訂單
-func (r *OrderRepository) Pay(ctx context.Context, id int64) error {
-	now := time.Now()
+// adjustOrderStock 在訂單建立或取消的交易內調整活動與規格的 DB 庫存（delta 為負表示扣減）
+func adjustOrderStock(tx *gorm.DB, order *model.Order, delta int) error {
+	err := tx.Model(&model.FlashSale{}).
+		Where("id = ?", order.FlashSaleID).
+		UpdateColumn("available_stock", gorm.Expr("available_stock + ?", delta)).
+		Error
+	if err != nil {
+		return err
+	}
+
+	if order.ItemID == nil {
+		return nil
+	}
+	return tx.Model(&model.FlashSaleItem{}).
+		Where("id = ?", *order.ItemID).
+		UpdateColumn("available_stock", gorm.Expr("available_stock + ?", delta)).
+		Error
+}
+
+// ListActiveByFlashSale 查詢活動中待付款與已付款的訂單（取消活動時批量處理）
+func (r *OrderRepository) ListActiveByFlashSale(ctx context.Context, flashSaleID int64) ([]model.Order, error) {
+	var orders []model.Order
+	result := r.db.WithContext(ctx).
+		Where("flash_sale_id = ? AND status IN ?", flashSaleID,
+			[]model.OrderStatus{model.OrderStatusPending, model.OrderStatusPaid}).
+		Order("id ASC").
+		Find(&orders)
+
+	return orders, result.Error
+}
+
+// SumActiveQuantity 統計活動中未取消訂單的購買數量合計（庫存對帳用）
+func (r *OrderRepository) SumActiveQuantity(ctx context.Context, flashSaleID int64) (int, error) {
+	var sum int
 	result := r.db.WithContext(ctx).
 		Model(&model.Order{}).
-		Where("id = ? AND status = ?", id, model.OrderStatusPending).
-		Updates(map[string]interface{}{
-			"status":     model.OrderStatusPaid,
-			"paid_at":    now,
-			"updated_at": now,
-		})
+		Where("flash_sale_id = ? AND status != ?", flashSaleID, model.OrderStatusCancelled).
+		Select("COALESCE(SUM(quantity), 0)").
+		Scan(&sum)
 
-	if result.RowsAffected == 0 {
-		return errors.New("order pay failed: not pending or not found")
-	}
+	return sum, result.Error
+}
 
-	return result.Error
+// UserQuantity 使用者購買數量統計
+type UserQuantity struct {
+	UserID   int64
+	Quantity int
 }
 
-// Cancel 取消訂單
-func (r *OrderRepository) Cancel(ctx context.Context, id int64) error {
+// SumActiveQuantityByUser 按使用者統計活動中未取消訂單的購買數量（回填限購計數用）
+func (r *OrderRepository) SumActiveQuantityByUser(ctx context.Context, flashSaleID int64) ([]UserQuantity, error) {
+	var rows []UserQuantity
 	result := r.db.WithContext(ctx).
 		Model(&model.Order{}).
-		Where("id = ? AND status = ?", id, model.OrderStatusPending).
-		Updates(map[string]interface{}{
-			"status":     model.OrderStatusCancelled,
-			"updated_at": time.Now(),
-		})
+		Where("flash_sale_id = ? AND status != ?", flashSaleID, model.OrderStatusCancelled).
+		Select("user_id, SUM(quantity) AS quantity").
+		Group("user_id").
+		Scan(&rows)
 
-	if result.RowsAffected == 0 {
-		return errors.New("order cancel failed: not pending or not found")
+	return rows, result.Error
+}
+
+// SumActiveQuantityByPolicy 按使用者統計限購策略範圍內（同商品或同檔期的搶購活動）since 之後未取消訂單的購買數量
+// since 為零值時不限時間（lifetime 策略）；用於對帳時重建限購計數器
+func (r *OrderRepository) SumActiveQuantityByPolicy(ctx context.Context, policy *model.PurchaseLimitPolicy, userIDs []int64, since time.Time) ([]UserQuantity, error) {
+	query := r.db.WithContext(ctx).
+		Model(&model.Order{}).
+		Joins("JOIN flash_sales ON flash_sales.id = orders.flash_sale_id AND flash_sales.deleted_at IS NULL").
+		Where("orders.user_id IN ? AND orders.status != ? AND flash_sales.sale_type != ?",
+			userIDs, model.OrderStatusCancelled, model.FlashSaleTypeRaffle)
+
+	switch policy.Scope {
+	case model.PurchaseLimitScopeProduct:
+		if policy.ProductID == nil {
+			return nil, nil
+		}
+		query = query.Where("flash_sales.product_id = ?", *policy.ProductID)
+	case model.PurchaseLimitScopeCampaign:
+		query = query.Where("flash_sales.campaign = ?", policy.Campaign)
+	default:
+		return nil, nil
+	}
+	if !since.IsZero() {
+		query = query.Where("orders.created_at >= ?", since)
 	}
 
-	return result.Error
+	var rows []UserQuantity
+	result := query.
+		Select("orders.user_id AS user_id, SUM(orders.quantity) AS quantity").
+		Group("orders.user_id").
+		Scan(&rows)
+
+	return rows, result.Error
+}
+
+// ItemQuantity 規格購買數量統計
+type ItemQuantity struct {
+	ItemID   int64
+	Quantity int
 }
 
-// CountExpiredPending 統計過期未付款訂單數量
-func (r *OrderRepository) CountExpiredPending(ctx context.Context, expireDuration time.Duration) (int64, error) {
+// SumActiveQuantityByItem 按規格統計活動中未取消訂單的購買數量（預熱規格庫存用）
+func (r *OrderRepository) SumActiveQuantityByItem(ctx context.Context, flashSaleID int64) ([]ItemQuantity, error) {
+	var rows []ItemQuantity
+	result := r.db.WithContext(ctx).
+		Model(&model.Order{}).
+		Where("flash_sale_id = ? AND status != ? AND item_id IS NOT NULL", flashSaleID, model.OrderStatusCancelled).
+		Select("item_id, SUM(quantity) AS quantity").
+		Group("item_id").
+		Scan(&rows)
+
+	return rows, result.Error
+}
+
+// CountExpiredPending 統計已超過付款截止時間的待付款訂單數量
+func (r *OrderRepository) CountExpiredPending(ctx context.Context, now time.Time) (int64, error) {
 	var count int64
-	expireTime := time.Now().Add(-expireDuration)
 
 	result := r.db.WithContext(ctx).
 		Model(&model.Order{}).
-		Where("status = ? AND created_at < ?", model.OrderStatusPending, expireTime).
+		Where("status = ? AND expires_at <= ?", model.OrderStatusPending, now).
 		Count(&count)
 
 	return count, result.Error
 }
 
-// CancelExpiredPending 批量取消過期訂單（返回被取消的訂單供庫存恢復）
-func (r *OrderRepository) CancelExpiredPending(ctx context.Context, expireDuration time.Duration, limit int) ([]model.Order, error) {
-	var orders []model.Order
-	expireTime := time.Now().Add(-expireDuration)
+// ClaimExpiredPending 領取已超過付款截止時間的待付款訂單並轉換為已取消（同一交易）
+// 以 FOR UPDATE SKIP LOCKED 鎖定，並行的掃描各自領取不同訂單、不互相等待
+// 返回的訂單已由本次呼叫取消並恢復 DB 庫存，呼叫方負責歸還 Redis 庫存
+func (r *OrderRepository) ClaimExpiredPending(ctx context.Context, now time.Time, limit int, trigger model.OrderTrigger) ([]model.Order, error) {
+	var claimed []model.Order
+
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var orders []model.Order
+		result := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("status = ? AND expires_at <= ?", model.OrderStatusPending, now).
+			Order("expires_at ASC").
+			Limit(limit).
+			Find(&orders)
+		if result.Error != nil {
+			return result.Error
+		}
 
-	// 先查詢要取消的訂單
-	if err := r.db.WithContext(ctx).
-		Where("status = ? AND created_at < ?", model.OrderStatusPending, expireTime).
-		Limit(limit).
-		Find(&orders).Error; err != nil {
+		for i := range orders {
+			if err := transitionOrder(tx, &orders[i], model.OrderStatusCancelled, trigger); err != nil {
+				return err
+			}
+		}
+		claimed = orders
+		return nil
+	})
+	if err != nil {
 		return nil, err
 	}
 
-	if len(orders) == 0 {
-		return orders, nil
-	}
+	return claimed, nil
+}
 
-	// 批量更新狀態
-	var ids []int64
-	for _, o := range orders {
-		ids = append(ids, o.ID)
-	}
+// ListStockRestorePending 查詢在 before 之前取消、Redis 庫存仍待歸還的訂單
+func (r *OrderRepository) ListStockRestorePending(ctx context.Context, before time.Time, limit int) ([]model.Order, error) {
+	var orders []model.Order
+	result := r.db.WithContext(ctx).
+		Where("stock_restore_pending = ? AND updated_at <= ?", true, before).
+		Order("updated_at ASC").
+		Limit(limit).
+		Find(&orders)
 
-	if err := r.db.WithContext(ctx).
+	return orders, result.Error
+}
+
+// ClearStockRestorePending 清除待歸還標記，返回 false 表示已被清除
+func (r *OrderRepository) ClearStockRestorePending(ctx context.Context, orderID int64) (bool, error) {
+	result := r.db.WithContext(ctx).
 		Model(&model.Order{}).
-		Where("id IN ?", ids).
-		Updates(map[string]interface{}{
-			"status":     model.OrderStatusCancelled,
-			"updated_at": time.Now(),
-		}).Error; err != nil {
-		return nil, err
-	}
+		Where("id = ? AND stock_restore_pending = ?", orderID, true).
+		UpdateColumn("stock_restore_pending", false)
 
-	return orders, nil
+	return result.RowsAffected > 0, result.Error
 }
@@ -0,0 +1,178 @@
+// 支付單資料存取層
+//
+// 本檔案封裝支付單表的讀寫
+// 包含：建立、依單號/供應商意圖查詢、查詢訂單待支付/已成功支付單、綁定意圖、狀態更新（樂觀鎖）、確認支付成功
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/Mag1cFall/magtrade/internal/database"
+	"github.com/Mag1cFall/magtrade/internal/model"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrPaymentNotFound       = errors.New("payment not found")
+	ErrPaymentStatusMismatch = errors.New("payment status update failed: status mismatch or payment not found")
+)
+
+// PaymentRepository 支付單資料存取
+type PaymentRepository struct {
+	db *gorm.DB
+}
+
+func NewPaymentRepository() *PaymentRepository {
+	return &PaymentRepository{db: database.Get()}
+}
+
+// Create 建立支付單
+func (r *PaymentRepository) Create(ctx context.Context, payment *model.Payment) error {
+	return r.db.WithContext(ctx).Create(payment).Error
+}
+
+// GetByID 根據 ID 查詢
+func (r *PaymentRepository) GetByID(ctx context.Context, id int64) (*model.Payment, error) {
+	var payment model.Payment
+	result := r.db.WithContext(ctx).First(&payment, id)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, ErrPaymentNotFound
+		}
+		return nil, result.Error
+	}
+	return &payment, nil
+}
+
+// GetByPaymentNo 根據支付單號查詢
+func (r *PaymentRepository) GetByPaymentNo(ctx context.Context, paymentNo string) (*model.Payment, error) {
+	var payment model.Payment
+	result := r.db.WithContext(ctx).Where("payment_no = ?", paymentNo).First(&payment)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, ErrPaymentNotFound
+		}
+		return nil, result.Error
+	}
+	return &payment, nil
+}
+
+// GetByProviderRef 根據供應商意圖 ID 查詢
+func (r *PaymentRepository) GetByProviderRef(ctx context.Context, provider, providerRef string) (*model.Payment, error) {
+	var payment model.Payment
+	result := r.db.WithContext(ctx).
+		Where("provider = ? AND provider_ref = ?", provider, providerRef).
+		First(&payment)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, ErrPaymentNotFound
+		}
+		return nil, result.Error
+	}
+	return &payment, nil
+}
+
+// GetPendingByOrder 查詢訂單最近一筆已綁定意圖的待支付單（重複發起支付時沿用），不存在返回 nil
+func (r *PaymentRepository) GetPendingByOrder(ctx context.Context, orderID int64, provider string) (*model.Payment, error) {
+	var payment model.Payment
+	result := r.db.WithContext(ctx).
+		Where("order_id = ? AND provider = ? AND status = ? AND provider_ref IS NOT NULL", orderID, provider, model.PaymentStatusPending).
+		Order("id DESC").
+		First(&payment)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, result.Error
+	}
+	return &payment, nil
+}
+
+// BindIntent 綁定供應商意圖 ID 與付款頁面位址
+func (r *PaymentRepository) BindIntent(ctx context.Context, id int64, providerRef, payURL string) error {
+	return r.db.WithContext(ctx).
+		Model(&model.Payment{}).
+		Where("id = ?", id).
+		Updates(map[string]interface{}{
+			"provider_ref": providerRef,
+			"pay_url":      payURL,
+			"updated_at":   time.Now(),
+		}).Error
+}
+
+// UpdateStatus 更新支付單狀態（樂觀鎖），fields 為需一併更新的欄位
+func (r *PaymentRepository) UpdateStatus(ctx context.Context, id int64, oldStatus, newStatus model.PaymentStatus, fields map[string]interface{}) error {
+	updates := map[string]interface{}{
+		"status":     newStatus,
+		"updated_at": time.Now(),
+	}
+	for k, v := range fields {
+		updates[k] = v
+	}
+
+	result := r.db.WithContext(ctx).
+		Model(&model.Payment{}).
+		Where("id = ? AND status = ?", id, oldStatus).
+		Updates(updates)
+
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrPaymentStatusMismatch
+	}
+	return nil
+}
+
+// Confirm 支付成功：同一交易中推進支付單並將訂單轉換為已付款（記錄狀態歷史）
+// 支付單已非待支付時返回 ErrPaymentStatusMismatch；
+// 訂單已不可付款時支付單仍記為成功並返回 orderPaid=false，由呼叫方退款
+func (r *PaymentRepository) Confirm(ctx context.Context, payment *model.Payment, order *model.Order, paidAt time.Time) (orderPaid bool, err error) {
+	err = r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&model.Payment{}).
+			Where("id = ? AND status = ?", payment.ID, model.PaymentStatusPending).
+			Updates(map[string]interface{}{
+				"status":     model.PaymentStatusSucceeded,
+				"paid_at":    paidAt,
+				"updated_at": paidAt,
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrPaymentStatusMismatch
+		}
+
+		err := transitionOrder(tx, order, model.OrderStatusPaid, model.OrderTrigger{
+			Actor:  model.OrderActorPayment,
+			Reason: "支付单 " + payment.PaymentNo + " 支付成功",
+		})
+		if errors.Is(err, model.ErrInvalidOrderTransition) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		orderPaid = true
+		return nil
+	})
+	return orderPaid, err
+}
+
+// GetSucceededByOrder 查詢訂單已成功的支付單，不存在返回 nil
+func (r *PaymentRepository) GetSucceededByOrder(ctx context.Context, orderID int64) (*model.Payment, error) {
+	var payment model.Payment
+	result := r.db.WithContext(ctx).
+		Where("order_id = ? AND status = ?", orderID, model.PaymentStatusSucceeded).
+		Order("id DESC").
+		First(&payment)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, result.Error
+	}
+	return &payment, nil
+}
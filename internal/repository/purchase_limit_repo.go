@@ -0,0 +1,88 @@
+// 跨活動限購策略資料存取層
+//
+// 本檔案封裝限購策略表的讀寫
+// 包含：建立、查詢、列表、啟用策略查詢、欄位更新、刪除
+package repository
+
+import (
+	"context"
+	"errors"
+
+	"github.com/Mag1cFall/magtrade/internal/database"
+	"github.com/Mag1cFall/magtrade/internal/model"
+	"gorm.io/gorm"
+)
+
+var ErrPurchaseLimitPolicyNotFound = errors.New("purchase limit policy not found")
+
+// PurchaseLimitRepository 限購策略資料存取
+type PurchaseLimitRepository struct {
+	db *gorm.DB
+}
+
+func NewPurchaseLimitRepository() *PurchaseLimitRepository {
+	return &PurchaseLimitRepository{db: database.Get()}
+}
+
+// Create 建立策略
+func (r *PurchaseLimitRepository) Create(ctx context.Context, policy *model.PurchaseLimitPolicy) error {
+	return r.db.WithContext(ctx).Create(policy).Error
+}
+
+// GetByID 根據 ID 查詢
+func (r *PurchaseLimitRepository) GetByID(ctx context.Context, id int64) (*model.PurchaseLimitPolicy, error) {
+	var policy model.PurchaseLimitPolicy
+	result := r.db.WithContext(ctx).First(&policy, id)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, ErrPurchaseLimitPolicyNotFound
+		}
+		return nil, result.Error
+	}
+	return &policy, nil
+}
+
+// List 查詢所有策略（策略數量有限，不分頁）
+func (r *PurchaseLimitRepository) List(ctx context.Context) ([]model.PurchaseLimitPolicy, error) {
+	var policies []model.PurchaseLimitPolicy
+	result := r.db.WithContext(ctx).Order("id DESC").Find(&policies)
+	return policies, result.Error
+}
+
+// ListEnabled 查詢所有啟用中的策略
+func (r *PurchaseLimitRepository) ListEnabled(ctx context.Context) ([]model.PurchaseLimitPolicy, error) {
+	var policies []model.PurchaseLimitPolicy
+	result := r.db.WithContext(ctx).
+		Where("enabled = ?", true).
+		Order("id ASC").
+		Find(&policies)
+	return policies, result.Error
+}
+
+// UpdateFields 更新策略欄位
+func (r *PurchaseLimitRepository) UpdateFields(ctx context.Context, id int64, fields map[string]interface{}) error {
+	result := r.db.WithContext(ctx).
+		Model(&model.PurchaseLimitPolicy{}).
+		Where("id = ?", id).
+		Updates(fields)
+
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrPurchaseLimitPolicyNotFound
+	}
+	return nil
+}
+
+// Delete 刪除策略（軟刪除）
+func (r *PurchaseLimitRepository) Delete(ctx context.Context, id int64) error {
+	result := r.db.WithContext(ctx).Delete(&model.PurchaseLimitPolicy{}, id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrPurchaseLimitPolicyNotFound
+	}
+	return nil
+}
@@ -0,0 +1,157 @@
+// 抽籤資料存取層
+//
+// 本檔案封裝抽籤登記與抽籤紀錄的讀寫
+// 抽籤紀錄以 flash_sale_id 唯一索引保證每個活動只抽一次，多實例同時抽籤時只有一個會成功
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/Mag1cFall/magtrade/internal/database"
+	"github.com/Mag1cFall/magtrade/internal/model"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrRaffleAlreadyEntered = errors.New("already entered this raffle")
+	ErrRaffleAlreadyDrawn   = errors.New("raffle already drawn")
+)
+
+// RaffleRepository 抽籤資料存取
+type RaffleRepository struct {
+	db *gorm.DB
+}
+
+func NewRaffleRepository() *RaffleRepository {
+	return &RaffleRepository{db: database.Get()}
+}
+
+// CreateEntry 建立抽籤登記（同一活動每人僅能登記一次）
+func (r *RaffleRepository) CreateEntry(ctx context.Context, entry *model.RaffleEntry) error {
+	result := r.db.WithContext(ctx).Create(entry)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrDuplicatedKey) {
+			return ErrRaffleAlreadyEntered
+		}
+		return result.Error
+	}
+	return nil
+}
+
+// GetEntry 查詢使用者的抽籤登記，未登記返回 nil
+func (r *RaffleRepository) GetEntry(ctx context.Context, flashSaleID, userID int64) (*model.RaffleEntry, error) {
+	var entry model.RaffleEntry
+	result := r.db.WithContext(ctx).
+		Where("flash_sale_id = ? AND user_id = ?", flashSaleID, userID).
+		First(&entry)
+
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, result.Error
+	}
+	return &entry, nil
+}
+
+// CountEntries 統計活動登記人數
+func (r *RaffleRepository) CountEntries(ctx context.Context, flashSaleID int64) (int64, error) {
+	var count int64
+	result := r.db.WithContext(ctx).
+		Model(&model.RaffleEntry{}).
+		Where("flash_sale_id = ?", flashSaleID).
+		Count(&count)
+
+	return count, result.Error
+}
+
+// ListEntryUserIDs 列出活動所有登記的使用者 ID
+func (r *RaffleRepository) ListEntryUserIDs(ctx context.Context, flashSaleID int64) ([]int64, error) {
+	var userIDs []int64
+	result := r.db.WithContext(ctx).
+		Model(&model.RaffleEntry{}).
+		Where("flash_sale_id = ?", flashSaleID).
+		Order("user_id ASC").
+		Pluck("user_id", &userIDs)
+
+	return userIDs, result.Error
+}
+
+// GetDraw 查詢活動的抽籤紀錄，尚未抽籤返回 nil
+func (r *RaffleRepository) GetDraw(ctx context.Context, flashSaleID int64) (*model.RaffleDraw, error) {
+	var draw model.RaffleDraw
+	result := r.db.WithContext(ctx).Where("flash_sale_id = ?", flashSaleID).First(&draw)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, result.Error
+	}
+	return &draw, nil
+}
+
+// SaveDraw 保存抽籤紀錄並更新登記結果（同一交易）
+// 已有抽籤紀錄時返回 ErrRaffleAlreadyDrawn
+func (r *RaffleRepository) SaveDraw(ctx context.Context, draw *model.RaffleDraw, winners, losers []int64) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(draw).Error; err != nil {
+			if errors.Is(err, gorm.ErrDuplicatedKey) {
+				return ErrRaffleAlreadyDrawn
+			}
+			return err
+		}
+
+		if len(winners) > 0 {
+			if err := tx.Model(&model.RaffleEntry{}).
+				Where("flash_sale_id = ? AND user_id IN ?", draw.FlashSaleID, winners).
+				Update("result", model.RaffleResultWon).Error; err != nil {
+				return err
+			}
+		}
+
+		if len(losers) > 0 {
+			if err := tx.Model(&model.RaffleEntry{}).
+				Where("flash_sale_id = ? AND user_id IN ?", draw.FlashSaleID, losers).
+				Update("result", model.RaffleResultLost).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// SetEntryOrder 記錄中籤者的訂單號
+func (r *RaffleRepository) SetEntryOrder(ctx context.Context, flashSaleID, userID int64, orderNo string) error {
+	return r.db.WithContext(ctx).
+		Model(&model.RaffleEntry{}).
+		Where("flash_sale_id = ? AND user_id = ?", flashSaleID, userID).
+		Update("order_no", orderNo).
+		Error
+}
+
+// MarkFulfilled 標記中籤訂單已全部建立
+func (r *RaffleRepository) MarkFulfilled(ctx context.Context, drawID int64) error {
+	return r.db.WithContext(ctx).
+		Model(&model.RaffleDraw{}).
+		Where("id = ?", drawID).
+		Update("fulfilled_at", time.Now()).
+		Error
+}
+
+// ListDue 查詢登記已截止但尚未完成抽籤（未抽籤或中籤訂單未建立完成）的抽籤活動
+func (r *RaffleRepository) ListDue(ctx context.Context) ([]model.FlashSale, error) {
+	var flashSales []model.FlashSale
+
+	result := r.db.WithContext(ctx).
+		Where("sale_type = ? AND status != ? AND end_time <= ?",
+			model.FlashSaleTypeRaffle, model.FlashSaleStatusCancelled, time.Now()).
+		Where("id NOT IN (?)", r.db.Model(&model.RaffleDraw{}).
+			Select("flash_sale_id").
+			Where("fulfilled_at IS NOT NULL")).
+		Order("end_time ASC").
+		Find(&flashSales)
+
+	return flashSales, result.Error
+}
@@ -0,0 +1,119 @@
+// 退款單資料存取層
+//
+// 本檔案封裝退款單表的讀寫
+// 包含：建立、依單號/供應商退款 ID 查詢、分頁列表、綁定供應商退款、狀態更新（樂觀鎖）
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/Mag1cFall/magtrade/internal/database"
+	"github.com/Mag1cFall/magtrade/internal/model"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrRefundNotFound       = errors.New("refund not found")
+	ErrRefundStatusMismatch = errors.New("refund status update failed: status mismatch or refund not found")
+)
+
+// RefundRepository 退款單資料存取
+type RefundRepository struct {
+	db *gorm.DB
+}
+
+func NewRefundRepository() *RefundRepository {
+	return &RefundRepository{db: database.Get()}
+}
+
+// Create 建立退款單
+func (r *RefundRepository) Create(ctx context.Context, refund *model.Refund) error {
+	return r.db.WithContext(ctx).Create(refund).Error
+}
+
+// GetByRefundNo 根據退款單號查詢
+func (r *RefundRepository) GetByRefundNo(ctx context.Context, refundNo string) (*model.Refund, error) {
+	var refund model.Refund
+	result := r.db.WithContext(ctx).Where("refund_no = ?", refundNo).First(&refund)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, ErrRefundNotFound
+		}
+		return nil, result.Error
+	}
+	return &refund, nil
+}
+
+// GetByProviderRefundID 根據供應商退款 ID 查詢
+func (r *RefundRepository) GetByProviderRefundID(ctx context.Context, provider, providerRefundID string) (*model.Refund, error) {
+	var refund model.Refund
+	result := r.db.WithContext(ctx).
+		Where("provider = ? AND provider_refund_id = ?", provider, providerRefundID).
+		First(&refund)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, ErrRefundNotFound
+		}
+		return nil, result.Error
+	}
+	return &refund, nil
+}
+
+// List 分頁查詢退款單，status 為 nil 時查詢全部
+func (r *RefundRepository) List(ctx context.Context, status *model.RefundStatus, page, pageSize int) ([]model.Refund, int64, error) {
+	var refunds []model.Refund
+	var total int64
+
+	db := r.db.WithContext(ctx).Model(&model.Refund{})
+	if status != nil {
+		db = db.Where("status = ?", *status)
+	}
+
+	if err := db.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	offset := (page - 1) * pageSize
+	if err := db.Offset(offset).Limit(pageSize).Order("created_at DESC").Find(&refunds).Error; err != nil {
+		return nil, 0, err
+	}
+
+	return refunds, total, nil
+}
+
+// BindProviderRefund 綁定供應商退款 ID
+func (r *RefundRepository) BindProviderRefund(ctx context.Context, id int64, providerRefundID string) error {
+	return r.db.WithContext(ctx).
+		Model(&model.Refund{}).
+		Where("id = ?", id).
+		Updates(map[string]interface{}{
+			"provider_refund_id": providerRefundID,
+			"updated_at":         time.Now(),
+		}).Error
+}
+
+// UpdateStatus 更新退款單狀態（樂觀鎖），fields 為需一併更新的欄位
+func (r *RefundRepository) UpdateStatus(ctx context.Context, id int64, oldStatus, newStatus model.RefundStatus, fields map[string]interface{}) error {
+	updates := map[string]interface{}{
+		"status":     newStatus,
+		"updated_at": time.Now(),
+	}
+	for k, v := range fields {
+		updates[k] = v
+	}
+
+	result := r.db.WithContext(ctx).
+		Model(&model.Refund{}).
+		Where("id = ? AND status = ?", id, oldStatus).
+		Updates(updates)
+
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrRefundStatusMismatch
+	}
+	return nil
+}
@@ -0,0 +1,133 @@
+// 預約資料存取層
+//
+// 本檔案封裝活動預約表的讀寫
+// 包含：預約/取消、名單查詢、到期提醒查詢與標記
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/Mag1cFall/magtrade/internal/database"
+	"github.com/Mag1cFall/magtrade/internal/model"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrAlreadyReserved     = errors.New("already reserved this flash sale")
+	ErrReservationNotFound = errors.New("reservation not found")
+)
+
+// ReservationRepository 預約資料存取
+type ReservationRepository struct {
+	db *gorm.DB
+}
+
+func NewReservationRepository() *ReservationRepository {
+	return &ReservationRepository{db: database.Get()}
+}
+
+// Create 建立預約（同一活動每人僅能預約一次）
+func (r *ReservationRepository) Create(ctx context.Context, reservation *model.Reservation) error {
+	result := r.db.WithContext(ctx).Create(reservation)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrDuplicatedKey) {
+			return ErrAlreadyReserved
+		}
+		return result.Error
+	}
+	return nil
+}
+
+// Delete 取消預約
+func (r *ReservationRepository) Delete(ctx context.Context, flashSaleID, userID int64) error {
+	result := r.db.WithContext(ctx).
+		Where("flash_sale_id = ? AND user_id = ?", flashSaleID, userID).
+		Delete(&model.Reservation{})
+
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrReservationNotFound
+	}
+	return nil
+}
+
+// Exists 檢查使用者是否已預約
+func (r *ReservationRepository) Exists(ctx context.Context, flashSaleID, userID int64) (bool, error) {
+	var count int64
+	result := r.db.WithContext(ctx).
+		Model(&model.Reservation{}).
+		Where("flash_sale_id = ? AND user_id = ?", flashSaleID, userID).
+		Count(&count)
+
+	return count > 0, result.Error
+}
+
+// Count 統計活動預約人數
+func (r *ReservationRepository) Count(ctx context.Context, flashSaleID int64) (int64, error) {
+	var count int64
+	result := r.db.WithContext(ctx).
+		Model(&model.Reservation{}).
+		Where("flash_sale_id = ?", flashSaleID).
+		Count(&count)
+
+	return count, result.Error
+}
+
+// ListUserIDs 列出活動所有預約使用者 ID（重建快取用）
+func (r *ReservationRepository) ListUserIDs(ctx context.Context, flashSaleID int64) ([]int64, error) {
+	var userIDs []int64
+	result := r.db.WithContext(ctx).
+		Model(&model.Reservation{}).
+		Where("flash_sale_id = ?", flashSaleID).
+		Pluck("user_id", &userIDs)
+
+	return userIDs, result.Error
+}
+
+// DueReminder 待發送的開賣提醒
+type DueReminder struct {
+	ReservationID int64
+	FlashSaleID   int64
+	UserID        int64
+	Email         string
+	Username      string
+	ProductName   string
+	StartTime     time.Time
+}
+
+// ListDueReminders 查詢已進入提醒時間但尚未提醒的預約
+// 提醒時間 = 活動開始時間 − 活動設定的提前分鐘數（未設定使用預設值）
+func (r *ReservationRepository) ListDueReminders(ctx context.Context, limit int) ([]DueReminder, error) {
+	var reminders []DueReminder
+	now := time.Now()
+
+	result := r.db.WithContext(ctx).
+		Table("reservations AS r").
+		Select("r.id AS reservation_id, r.flash_sale_id, r.user_id, u.email, u.username, p.name AS product_name, fs.start_time").
+		Joins("JOIN flash_sales fs ON fs.id = r.flash_sale_id AND fs.deleted_at IS NULL").
+		Joins("JOIN users u ON u.id = r.user_id").
+		Joins("JOIN products p ON p.id = fs.product_id").
+		Where("r.reminded_at IS NULL AND fs.status = ? AND fs.start_time > ?", model.FlashSaleStatusPending, now).
+		Where("fs.start_time - COALESCE(NULLIF(fs.remind_minutes, 0), ?) * INTERVAL '1 minute' <= ?", model.DefaultRemindMinutes, now).
+		Order("fs.start_time ASC, r.id ASC").
+		Limit(limit).
+		Scan(&reminders)
+
+	return reminders, result.Error
+}
+
+// MarkReminded 標記預約已提醒
+func (r *ReservationRepository) MarkReminded(ctx context.Context, ids []int64) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	return r.db.WithContext(ctx).
+		Model(&model.Reservation{}).
+		Where("id IN ? AND reminded_at IS NULL", ids).
+		Update("reminded_at", time.Now()).
+		Error
+}
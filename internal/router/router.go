@@ -12,13 +12,14 @@ import (
 	"github.com/Mag1cFall/magtrade/internal/handler"
 	"github.com/Mag1cFall/magtrade/internal/middleware"
 	"github.com/Mag1cFall/magtrade/internal/mq"
+	"github.com/Mag1cFall/magtrade/internal/service"
 	"github.com/Mag1cFall/magtrade/internal/service/ai"
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
 )
 
 // Setup 配置並返回 Gin 引擎
-func Setup(cfg *config.Config, producer *mq.Producer, wsHub *handler.WSHub, log *zap.Logger) *gin.Engine {
+func Setup(cfg *config.Config, deps *service.CacheDeps, producer *mq.Producer, wsHub *handler.WSHub, log *zap.Logger) *gin.Engine {
 	if cfg.Server.Mode == "release" {
 		gin.SetMode(gin.ReleaseMode)
 	}
@@ -40,8 +41,11 @@ func Setup(cfg *config.Config, producer *mq.Producer, wsHub *handler.WSHub, log
 	authHandler := handler.NewAuthHandler(&cfg.JWT, &cfg.Email)
 	productHandler := handler.NewProductHandler()
 	anomalyDetector := ai.NewAnomalyDetector(log)
-	flashSaleHandler := handler.NewFlashSaleHandler(producer, anomalyDetector, log)
-	orderHandler := handler.NewOrderHandler(producer, log)
+	flashSaleHandler := handler.NewFlashSaleHandler(deps, producer, &cfg.Email, &cfg.Rush, &cfg.Payment, anomalyDetector, log)
+	templateHandler := handler.NewFlashSaleTemplateHandler(deps, producer, log)
+	limitHandler := handler.NewPurchaseLimitHandler(log)
+	orderHandler := handler.NewOrderHandler(deps, producer, &cfg.Payment, log)
+	paymentHandler := handler.NewPaymentHandler(deps, producer, &cfg.Payment, log)
 	aiHandler := handler.NewAIHandler(&cfg.AI, log)
 	wsHandler := handler.NewWSHandler(wsHub, &cfg.JWT, log)
 
@@ -104,6 +108,7 @@ func Setup(cfg *config.Config, producer *mq.Producer, wsHub *handler.WSHub, log
 			flashSales.GET("", flashSaleHandler.List)
 			flashSales.GET("/:id", flashSaleHandler.GetByID)
 			flashSales.GET("/:id/stock", flashSaleHandler.GetStock)
+			flashSales.GET("/:id/stock/stream", flashSaleHandler.StreamStock)
 
 			// 搶購需要認證和特殊限流
 			flashSaleRateLimiter := middleware.NewFlashSaleRateLimiter()
@@ -112,6 +117,13 @@ func Setup(cfg *config.Config, producer *mq.Producer, wsHub *handler.WSHub, log
 				middleware.FlashSaleRateLimit(flashSaleRateLimiter),
 				flashSaleHandler.Rush,
 			)
+			flashSales.GET("/:id/queue", middleware.Auth(&cfg.JWT), flashSaleHandler.QueueStatus)
+			flashSales.GET("/tickets/:ticket", middleware.Auth(&cfg.JWT), flashSaleHandler.TicketStatus)
+			flashSales.POST("/:id/raffle", middleware.Auth(&cfg.JWT), flashSaleHandler.EnterRaffle)
+			flashSales.GET("/:id/raffle", middleware.Auth(&cfg.JWT), flashSaleHandler.RaffleStatus)
+			flashSales.POST("/:id/reserve", middleware.Auth(&cfg.JWT), flashSaleHandler.Reserve)
+			flashSales.DELETE("/:id/reserve", middleware.Auth(&cfg.JWT), flashSaleHandler.CancelReservation)
+			flashSales.GET("/:id/reserve", middleware.Auth(&cfg.JWT), flashSaleHandler.ReservationStatus)
 		}
 
 		// 訂單（需認證）
@@ -122,6 +134,14 @@ func Setup(cfg *config.Config, producer *mq.Producer, wsHub *handler.WSHub, log
 			orders.GET("/:order_no", orderHandler.GetByOrderNo)
 			orders.POST("/:order_no/pay", orderHandler.Pay)
 			orders.POST("/:order_no/cancel", orderHandler.Cancel)
+			orders.POST("/:order_no/refund", orderHandler.Refund)
+		}
+
+		// 支付：查詢需認證，供應商回調以簽名驗證
+		payments := v1.Group("/payments")
+		{
+			payments.GET("/:payment_no", middleware.Auth(&cfg.JWT), paymentHandler.GetByPaymentNo)
+			payments.POST("/webhook/:provider", paymentHandler.Webhook)
 		}
 
 		// AI 功能（需認證）
@@ -146,6 +166,30 @@ func Setup(cfg *config.Config, producer *mq.Producer, wsHub *handler.WSHub, log
 			admin.POST("/upload", uploadHandler.Upload)
 
 			admin.POST("/flash-sales", flashSaleHandler.Create)
+			admin.PUT("/flash-sales/:id", flashSaleHandler.Update)
+			admin.DELETE("/flash-sales/:id", flashSaleHandler.Delete)
+			admin.POST("/flash-sales/:id/pause", flashSaleHandler.Pause)
+			admin.POST("/flash-sales/:id/resume", flashSaleHandler.Resume)
+			admin.POST("/flash-sales/:id/cancel", flashSaleHandler.Cancel)
+			admin.POST("/flash-sales/:id/stock", flashSaleHandler.AdjustStock)
+			admin.POST("/flash-sales/:id/reconcile", flashSaleHandler.Reconcile)
+
+			admin.GET("/flash-sale-templates", templateHandler.List)
+			admin.POST("/flash-sale-templates", templateHandler.Create)
+			admin.GET("/flash-sale-templates/:id", templateHandler.GetByID)
+			admin.PUT("/flash-sale-templates/:id", templateHandler.Update)
+			admin.POST("/flash-sale-templates/:id/pause", templateHandler.Pause)
+			admin.POST("/flash-sale-templates/:id/resume", templateHandler.Resume)
+
+			admin.GET("/purchase-limits", limitHandler.List)
+			admin.POST("/purchase-limits", limitHandler.Create)
+			admin.PUT("/purchase-limits/:id", limitHandler.Update)
+			admin.DELETE("/purchase-limits/:id", limitHandler.Delete)
+			admin.GET("/users/:id/purchase-limits", limitHandler.UserUsage)
+
+			admin.GET("/refunds", paymentHandler.ListRefunds)
+			admin.POST("/refunds/:refund_no/approve", paymentHandler.ApproveRefund)
+			admin.POST("/refunds/:refund_no/reject", paymentHandler.RejectRefund)
 
 			admin.POST("/ai/analyze/:flash_sale_id", aiHandler.TriggerAnalysis)
 		}
@@ -33,7 +33,7 @@ type CustomerService struct {
 	flashSaleRepo *repository.FlashSaleRepository
 	orderRepo     *repository.OrderRepository
 	userRepo      *repository.UserRepository
-	stockService  *cache.StockService
+	stockService  cache.StockStore
 	log           *zap.Logger
 }
 
@@ -35,7 +35,7 @@ type StrategyAdvisor struct {
 	llm           *LLMClient
 	flashSaleRepo *repository.FlashSaleRepository
 	recRepo       *repository.AIRecommendationRepository
-	stockService  *cache.StockService
+	stockService  cache.StockStore
 	log           *zap.Logger
 }
 
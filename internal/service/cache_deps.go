@@ -0,0 +1,100 @@
+// 服務層快取依賴
+//
+// 秒殺、訂單、支付等服務經由本檔案定義的介面使用 Redis 快取，依賴於建構時注入而非在服務內部建立
+// NewRedisCacheDeps 組裝 Redis 實作（需先完成 cache.Init），由 main 建立一份後傳給各 Handler 與 Worker
+// 單元測試以 cache.MemoryStockStore 等行程內實作替換，不需要 Redis
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/Mag1cFall/magtrade/internal/cache"
+	"github.com/Mag1cFall/magtrade/internal/model"
+	"go.uber.org/zap"
+)
+
+// FlashSaleMetaStore 活動中繼資料快取（准入腳本讀取的中繼資料亦由此寫入）
+type FlashSaleMetaStore interface {
+	Get(ctx context.Context, flashSaleID int64, load cache.FlashSaleLoader) (*model.FlashSale, error)
+	Refresh(ctx context.Context, flashSaleID int64, load cache.FlashSaleLoader) (*model.FlashSale, error)
+	Invalidate(ctx context.Context, flashSaleID int64) error
+}
+
+// SaleFlagStore 本地售罄/關閉旗標
+type SaleFlagStore interface {
+	Check(flashSaleID int64) cache.SaleFlag
+	Set(ctx context.Context, flashSaleID int64, flag cache.SaleFlag) error
+	Clear(ctx context.Context, flashSaleID int64, flag cache.SaleFlag) error
+}
+
+// OutboxRegistry 訂單訊息 Outbox 的註冊檢查（Stream 與消費者群組由扣減腳本在寫入時建立）
+type OutboxRegistry interface {
+	Register(ctx context.Context, flashSaleID int64) error
+}
+
+// RushQueue 排隊模式佇列
+type RushQueue interface {
+	Enqueue(ctx context.Context, entry *cache.QueueEntry, ttl time.Duration) (*cache.QueueEntry, int, bool, error)
+	Position(ctx context.Context, flashSaleID, userID int64) (*cache.QueueEntry, int, int64, error)
+	Drain(ctx context.Context, flashSaleID int64, rate, batch int) ([]cache.QueueEntry, error)
+	Clear(ctx context.Context, flashSaleID int64) ([]cache.QueueEntry, error)
+	ActiveQueues(ctx context.Context) ([]int64, error)
+}
+
+// ReservationSet 預約名單快取
+type ReservationSet interface {
+	IsReserved(ctx context.Context, flashSaleID, userID int64) (reserved, loaded bool, err error)
+	Load(ctx context.Context, flashSaleID int64, userIDs []int64, ttl time.Duration) error
+}
+
+// TicketRecorder 搶購憑證狀態記錄（盡力而為，不返回錯誤）
+type TicketRecorder interface {
+	Record(ctx context.Context, record *cache.TicketRecord)
+}
+
+// LimitReserver 跨活動限購計數器的兩階段預扣與歸還
+type LimitReserver interface {
+	Reserve(ctx context.Context, flashSale *model.FlashSale, userID int64, quantity int, ticket string) (*LimitReservation, *model.PurchaseLimitPolicy, error)
+	Confirm(ctx context.Context, reservation *LimitReservation)
+	Release(ctx context.Context, reservation *LimitReservation)
+	ReleaseOrder(ctx context.Context, flashSale *model.FlashSale, order *model.Order)
+}
+
+// OrderExpiryScheduler 待付款訂單的到期排程
+type OrderExpiryScheduler interface {
+	Schedule(ctx context.Context, orderID int64, expiresAt time.Time) error
+	Claim(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]int64, error)
+	Remove(ctx context.Context, orderIDs ...int64) error
+}
+
+// CacheDeps 服務層的快取依賴
+type CacheDeps struct {
+	Stock        cache.StockStore // 搶購熱路徑的庫存操作，可替換為遠端庫存服務
+	StockCache   cache.StockCache // 庫存佈建、預熱與分片
+	Metas        FlashSaleMetaStore
+	Flags        SaleFlagStore
+	Outbox       OutboxRegistry
+	Queue        RushQueue
+	Reservations ReservationSet
+	Tickets      TicketRecorder
+	Limits       LimitReserver
+	Expiry       OrderExpiryScheduler
+}
+
+// NewRedisCacheDeps 組裝以 Redis 為後端的快取依賴
+func NewRedisCacheDeps(log *zap.Logger) *CacheDeps {
+	stock := cache.NewStockService()
+	return &CacheDeps{
+		Stock:        stock,
+		StockCache:   stock,
+		Metas:        cache.FlashSaleMetas(),
+		Flags:        cache.SaleFlags(),
+		Outbox:       cache.NewOutboxService(),
+		Queue:        cache.NewQueueService(),
+		Reservations: cache.NewReservationCache(),
+		Tickets:      NewTicketService(log),
+		Limits:       NewPurchaseLimitService(log),
+		Expiry:       cache.NewOrderExpiryQueue(),
+	}
+}
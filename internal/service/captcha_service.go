@@ -17,10 +17,10 @@ import (
 
 // CaptchaService 驗證碼服務
 type CaptchaService struct {
-	redis *redis.Client
+	redis redis.UniversalClient
 }
 
-func NewCaptchaService(rdb *redis.Client) *CaptchaService {
+func NewCaptchaService(rdb redis.UniversalClient) *CaptchaService {
 	return &CaptchaService{redis: rdb}
 }
 
@@ -1,7 +1,7 @@
 // 郵件服務
 //
 // 本檔案提供郵件發送功能
-// 用於發送註冊驗證碼、密碼重置等郵件
+// 用於發送註冊驗證碼、密碼重置、秒殺開賣提醒等郵件
 // 支援 TLS 加密的 SMTP 連線
 package service
 
@@ -25,11 +25,11 @@ var (
 
 // EmailService 郵件服務
 type EmailService struct {
-	redis *redis.Client
+	redis redis.UniversalClient
 	cfg   *config.EmailConfig
 }
 
-func NewEmailService(rdb *redis.Client, cfg *config.EmailConfig) *EmailService {
+func NewEmailService(rdb redis.UniversalClient, cfg *config.EmailConfig) *EmailService {
 	return &EmailService{
 		redis: rdb,
 		cfg:   cfg,
@@ -106,6 +106,41 @@ func (s *EmailService) VerifyEmailCode(ctx context.Context, email, code string)
 	return false
 }
 
+// SendFlashSaleReminder 發送秒殺開賣提醒郵件（預約使用者）
+func (s *EmailService) SendFlashSaleReminder(email, username, productName string, flashSaleID int64, startTime time.Time) error {
+	// 開發環境：輸出到控制台
+	if s.cfg == nil || s.cfg.SMTPHost == "" {
+		fmt.Printf("[DEV MODE] Flash sale reminder for %s: #%d %s starts at %s\n",
+			email, flashSaleID, productName, startTime.Format(time.RFC3339))
+		return nil
+	}
+
+	subject := fmt.Sprintf("您预约的秒杀即将开始 - %s", productName)
+	body := fmt.Sprintf(`
+<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"></head>
+<body style="font-family: Arial, sans-serif; max-width: 600px; margin: 0 auto; padding: 20px;">
+<div style="background: linear-gradient(135deg, #667eea 0%%, #764ba2 100%%); padding: 30px; border-radius: 10px; text-align: center;">
+<h1 style="color: white; margin: 0;">MagTrade</h1>
+<p style="color: rgba(255,255,255,0.9); margin-top: 10px;">高并发分布式秒杀系统</p>
+</div>
+<div style="padding: 30px 0;">
+<p>%s，您好：</p>
+<p>您预约的秒杀活动 <strong>%s</strong> 即将开始。</p>
+<div style="background: #f5f5f5; padding: 20px; text-align: center; border-radius: 8px; margin: 20px 0;">
+<span style="font-size: 20px; font-weight: bold; color: #667eea;">开始时间：%s</span>
+</div>
+<p>请提前登录，准时参与抢购。</p>
+<p style="color: #999; font-size: 12px; margin-top: 30px;">您收到此邮件是因为预约了该活动，如需取消请在活动页取消预约。</p>
+</div>
+</body>
+</html>
+`, username, productName, startTime.Format("2006-01-02 15:04:05"))
+
+	return s.sendEmail(email, subject, body)
+}
+
 // sendEmail 發送郵件（TLS 連線）
 func (s *EmailService) sendEmail(to, subject, body string) error {
 	if s.cfg == nil {
@@ -0,0 +1,402 @@
+// 秒殺活動管理（管理員）
+//
+// 本檔案提供管理員對秒殺活動的編輯、暫停/恢復、取消、刪除與庫存調整
+// 狀態變更一律使用樂觀鎖（UpdateStatus），避免與排程的自動開啟/結束互相覆蓋
+// 庫存調整以 Redis 為準先調整，DB 失敗時回滾 Redis，保持兩者一致
+// 同一活動的庫存調整與對帳修復以分散式鎖互斥，等待逾時返回 ErrStockAdjustBusy
+// 任何變更後清除活動中繼資料快取，讓搶購熱路徑讀到最新設定
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/Mag1cFall/magtrade/internal/cache"
+	"github.com/Mag1cFall/magtrade/internal/model"
+	"go.uber.org/zap"
+)
+
+var (
+	ErrFlashSalePaused        = errors.New("flash sale is paused")
+	ErrFlashSaleCancelled     = errors.New("flash sale has been cancelled")
+	ErrFlashSaleNotEditable   = errors.New("only flash sales that have not started can be edited")
+	ErrFlashSaleStatusInvalid = errors.New("flash sale status does not allow this operation")
+	ErrFlashSaleHasOrders     = errors.New("flash sale has orders")
+	ErrInvalidStockDelta      = errors.New("invalid stock delta")
+	ErrStockAdjustBusy        = errors.New("another stock adjustment is in progress")
+
+	ErrFlashSaleCancelUnsupported = errors.New("flash sale service was built without payment service")
+)
+
+// stockAdjustLockWait 等待庫存調整鎖的最長時間
+const stockAdjustLockWait = 3 * time.Second
+
+// UpdateFlashSaleRequest 編輯秒殺活動請求（僅限尚未開始的活動，未提供的欄位不變）
+type UpdateFlashSaleRequest struct {
+	FlashPrice           *float64 `json:"flash_price" binding:"omitempty,gt=0"`
+	PerUserLimit         *int     `json:"per_user_limit" binding:"omitempty,gt=0"`
+	StartTime            *string  `json:"start_time"` // RFC3339 格式
+	EndTime              *string  `json:"end_time"`
+	ReservedOnly         *bool    `json:"reserved_only"`
+	RemindMinutes        *int     `json:"remind_minutes" binding:"omitempty,gte=0"`
+	QueueEnabled         *bool    `json:"queue_enabled"`
+	QueueRate            *int     `json:"queue_rate" binding:"omitempty,gte=0"`
+	Campaign             *string  `json:"campaign" binding:"omitempty,max=64"`                       // 空字串表示移出檔期
+	PaymentWindowMinutes *int     `json:"payment_window_minutes" binding:"omitempty,gte=0,lte=1440"` // 0 表示使用預設值，僅影響之後建立的訂單
+}
+
+// AdjustStockRequest 庫存調整請求
+type AdjustStockRequest struct {
+	ItemID int64 `json:"item_id" binding:"omitempty,gt=0"` // 多規格活動必填
+	Delta  int   `json:"delta" binding:"required"`         // 正數增加 / 負數減少
+}
+
+// AdjustStockResponse 庫存調整結果
+type AdjustStockResponse struct {
+	FlashSaleID  int64 `json:"flash_sale_id"`
+	ItemID       int64 `json:"item_id,omitempty"`
+	Delta        int   `json:"delta"`
+	CurrentStock int   `json:"current_stock"` // 調整後 Redis 活動庫存
+}
+
+// CancelFlashSaleResponse 取消活動結果
+type CancelFlashSaleResponse struct {
+	FlashSale       *model.FlashSale `json:"flash_sale"`
+	CancelledOrders int              `json:"cancelled_orders"` // 取消的待付款訂單數
+	RefundingOrders int              `json:"refunding_orders"` // 發起退款的已付款訂單數（退款結果見退款單）
+	FailedOrders    int              `json:"failed_orders"`    // 處理失敗的訂單數，大於 0 時應再次呼叫取消
+}
+
+// Update 編輯尚未開始的活動（價格、時間、限購、預約、排隊設定與所屬檔期）
+func (s *FlashSaleService) Update(ctx context.Context, id int64, req *UpdateFlashSaleRequest) (*model.FlashSale, error) {
+	flashSale, err := s.flashSaleRepo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if !flashSale.IsEditable() {
+		return nil, ErrFlashSaleNotEditable
+	}
+
+	fields := make(map[string]interface{})
+
+	if req.FlashPrice != nil {
+		if flashSale.HasItems() {
+			return nil, errors.New("flash_price of a multi-sku flash sale is derived from its items")
+		}
+		fields["flash_price"] = *req.FlashPrice
+	}
+	if req.PerUserLimit != nil {
+		fields["per_user_limit"] = *req.PerUserLimit
+	}
+
+	startTime, endTime := flashSale.StartTime, flashSale.EndTime
+	if req.StartTime != nil {
+		if startTime, err = time.Parse(time.RFC3339, *req.StartTime); err != nil {
+			return nil, errors.New("invalid start_time format, use RFC3339")
+		}
+		fields["start_time"] = startTime
+	}
+	if req.EndTime != nil {
+		if endTime, err = time.Parse(time.RFC3339, *req.EndTime); err != nil {
+			return nil, errors.New("invalid end_time format, use RFC3339")
+		}
+		fields["end_time"] = endTime
+	}
+
+	timeChanged := req.StartTime != nil || req.EndTime != nil
+	fieldErrs, err := s.validateUpdate(ctx, flashSale, req.FlashPrice, startTime, endTime, timeChanged)
+	if err != nil {
+		return nil, err
+	}
+	if len(fieldErrs) > 0 {
+		return nil, &ValidationFailedError{Errors: fieldErrs}
+	}
+
+	if req.ReservedOnly != nil {
+		fields["reserved_only"] = *req.ReservedOnly
+	}
+	if req.RemindMinutes != nil {
+		fields["remind_minutes"] = *req.RemindMinutes
+	}
+	if req.QueueEnabled != nil {
+		if *req.QueueEnabled && flashSale.IsRaffle() {
+			return nil, errors.New("raffle flash sale does not support items or queue mode")
+		}
+		fields["queue_enabled"] = *req.QueueEnabled
+	}
+	if req.QueueRate != nil {
+		fields["queue_rate"] = *req.QueueRate
+	}
+	if req.Campaign != nil {
+		fields["campaign"] = *req.Campaign
+	}
+	if req.PaymentWindowMinutes != nil {
+		fields["payment_window_minutes"] = *req.PaymentWindowMinutes
+	}
+
+	if len(fields) > 0 {
+		ok, err := s.flashSaleRepo.UpdateFields(ctx, id, model.FlashSaleStatusPending, fields)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, ErrFlashSaleNotEditable
+		}
+		s.invalidateFlashSale(ctx, id)
+	}
+
+	updated, err := s.flashSaleRepo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	// 時間變更後延長或縮短 Redis 快取 TTL
+	if err := s.WarmUpStock(ctx, updated); err != nil {
+		s.log.Error("failed to refresh flash sale cache after update", zap.Int64("flash_sale_id", id), zap.Error(err))
+	}
+
+	s.log.Info("flash sale updated", zap.Int64("flash_sale_id", id), zap.Int("fields", len(fields)))
+	return updated, nil
+}
+
+// Pause 暫停進行中的活動，暫停期間搶購被拒絕、排隊請求保留
+func (s *FlashSaleService) Pause(ctx context.Context, id int64) (*model.FlashSale, error) {
+	return s.transition(ctx, id, model.FlashSaleStatusActive, model.FlashSaleStatusPaused)
+}
+
+// Resume 恢復已暫停的活動（已過結束時間則不可恢復）
+func (s *FlashSaleService) Resume(ctx context.Context, id int64) (*model.FlashSale, error) {
+	flashSale, err := s.flashSaleRepo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if !time.Now().Before(flashSale.EndTime) {
+		return nil, ErrFlashSaleEnded
+	}
+	return s.transition(ctx, id, model.FlashSaleStatusPaused, model.FlashSaleStatusActive)
+}
+
+// transition 以樂觀鎖變更活動狀態並返回最新資料
+func (s *FlashSaleService) transition(ctx context.Context, id int64, from, to model.FlashSaleStatus) (*model.FlashSale, error) {
+	ok, err := s.flashSaleRepo.UpdateStatus(ctx, id, from, to)
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		s.invalidateFlashSale(ctx, id)
+	}
+
+	flashSale, err := s.flashSaleRepo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrFlashSaleStatusInvalid
+	}
+
+	// 暫停/取消立即讓所有實例的搶購請求在本地被拒絕，恢復時清除暫停旗標
+	switch to {
+	case model.FlashSaleStatusPaused:
+		s.setFlag(ctx, id, cache.SaleFlagPaused)
+	case model.FlashSaleStatusCancelled:
+		s.setFlag(ctx, id, cache.SaleFlagClosed)
+	case model.FlashSaleStatusActive:
+		if err := s.flags.Clear(ctx, id, cache.SaleFlagPaused); err != nil {
+			s.log.Warn("failed to publish sale flag", zap.Int64("flash_sale_id", id), zap.Error(err))
+		}
+	}
+
+	s.log.Info("flash sale status changed",
+		zap.Int64("flash_sale_id", id),
+		zap.Int8("from", int8(from)),
+		zap.Int8("to", int8(to)),
+	)
+	return flashSale, nil
+}
+
+// Cancel 取消活動：待付款訂單自動取消並恢復庫存、已付款訂單經由支付服務退款（退款完成後恢復庫存）
+// 排隊中的請求由 QueueWorker 在下一輪清空並通知
+// 對已取消的活動再次呼叫只重跑訂單處理（略過已取消或退款中的訂單），供部分訂單處理失敗後重試
+func (s *FlashSaleService) Cancel(ctx context.Context, id int64) (*CancelFlashSaleResponse, error) {
+	if s.payments == nil {
+		return nil, ErrFlashSaleCancelUnsupported
+	}
+
+	flashSale, err := s.flashSaleRepo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	cancelledSale := flashSale
+	if flashSale.Status == model.FlashSaleStatusCancelled {
+		s.setFlag(ctx, id, cache.SaleFlagClosed) // 前次發布旗標可能失敗
+	} else {
+		if !flashSale.CanCancel() {
+			return nil, ErrFlashSaleStatusInvalid
+		}
+		cancelledSale, err = s.transition(ctx, id, flashSale.Status, model.FlashSaleStatusCancelled)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	cancelled, refunding, failed, err := s.payments.CancelFlashSaleOrders(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	s.log.Info("flash sale cancelled",
+		zap.Int64("flash_sale_id", id),
+		zap.Int("cancelled_orders", cancelled),
+		zap.Int("refunding_orders", refunding),
+		zap.Int("failed_orders", failed),
+	)
+
+	return &CancelFlashSaleResponse{
+		FlashSale:       cancelledSale,
+		CancelledOrders: cancelled,
+		RefundingOrders: refunding,
+		FailedOrders:    failed,
+	}, nil
+}
+
+// Delete 刪除活動（僅限待開始或已取消、且沒有有效訂單的活動）
+func (s *FlashSaleService) Delete(ctx context.Context, id int64) error {
+	flashSale, err := s.flashSaleRepo.GetByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	if flashSale.Status != model.FlashSaleStatusPending && flashSale.Status != model.FlashSaleStatusCancelled {
+		return ErrFlashSaleStatusInvalid
+	}
+
+	sold, err := s.orderRepo.SumActiveQuantity(ctx, id)
+	if err != nil {
+		return err
+	}
+	if sold > 0 {
+		return ErrFlashSaleHasOrders
+	}
+
+	if err := s.flashSaleRepo.Delete(ctx, id); err != nil {
+		return err
+	}
+	s.setFlag(ctx, id, cache.SaleFlagClosed)
+	s.invalidateFlashSale(ctx, id)
+
+	itemIDs := make([]int64, len(flashSale.Items))
+	for i, item := range flashSale.Items {
+		itemIDs[i] = item.ID
+	}
+	if err := s.stockCache.DeleteStock(ctx, id, itemIDs); err != nil {
+		s.log.Error("failed to delete redis stock", zap.Int64("flash_sale_id", id), zap.Error(err))
+	}
+
+	s.log.Info("flash sale deleted", zap.Int64("flash_sale_id", id))
+	return nil
+}
+
+// lockStockAdjust 取得活動庫存調整鎖，返回解鎖函式
+// 看門狗在 Redis 與 DB 兩階段調整期間續期，避免慢查詢讓鎖中途過期
+func lockStockAdjust(ctx context.Context, flashSaleID int64) (func(), error) {
+	lock := cache.NewRenewableLock(cache.StockAdjustLockKey(flashSaleID), cache.LockOptions{})
+	acquired, err := lock.TryLock(ctx, stockAdjustLockWait)
+	if err != nil {
+		return nil, err
+	}
+	if !acquired {
+		return nil, ErrStockAdjustBusy
+	}
+	return func() { _ = lock.Unlock(ctx) }, nil
+}
+
+// AdjustStock 增減活動庫存，Redis 與 DB 同步調整
+func (s *FlashSaleService) AdjustStock(ctx context.Context, id int64, req *AdjustStockRequest) (*AdjustStockResponse, error) {
+	if req.Delta == 0 {
+		return nil, ErrInvalidStockDelta
+	}
+
+	unlock, err := lockStockAdjust(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	flashSale, err := s.flashSaleRepo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if flashSale.Status == model.FlashSaleStatusFinished || flashSale.Status == model.FlashSaleStatusCancelled {
+		return nil, ErrFlashSaleStatusInvalid
+	}
+
+	var itemID int64
+	if flashSale.HasItems() {
+		if req.ItemID == 0 {
+			return nil, ErrItemRequired
+		}
+		if flashSale.FindItem(req.ItemID) == nil {
+			return nil, ErrItemNotFound
+		}
+		itemID = req.ItemID
+	}
+
+	// 確保 Redis 庫存已載入，避免對不存在的 Key 調整
+	if err := s.WarmUpStock(ctx, flashSale); err != nil {
+		return nil, err
+	}
+
+	stock, err := s.stockCache.AdjustStock(ctx, id, itemID, req.Delta)
+	if err != nil {
+		if err == cache.ErrStockNegative {
+			return nil, ErrInvalidStockDelta
+		}
+		return nil, err
+	}
+
+	if err := s.adjustDBStock(ctx, id, itemID, req.Delta); err != nil {
+		// DB 調整失敗時回滾 Redis，保持兩者一致
+		if _, rbErr := s.stockCache.AdjustStock(ctx, id, itemID, -req.Delta); rbErr != nil {
+			s.log.Error("failed to roll back redis stock adjustment",
+				zap.Int64("flash_sale_id", id),
+				zap.Int("delta", req.Delta),
+				zap.Error(rbErr),
+			)
+		}
+		return nil, err
+	}
+	s.invalidateFlashSale(ctx, id)
+
+	s.log.Info("flash sale stock adjusted",
+		zap.Int64("flash_sale_id", id),
+		zap.Int64("item_id", itemID),
+		zap.Int("delta", req.Delta),
+		zap.Int("stock", stock),
+	)
+
+	return &AdjustStockResponse{
+		FlashSaleID:  id,
+		ItemID:       itemID,
+		Delta:        req.Delta,
+		CurrentStock: stock,
+	}, nil
+}
+
+// adjustDBStock 調整 DB 活動庫存與規格庫存，規格失敗時回補活動庫存
+func (s *FlashSaleService) adjustDBStock(ctx context.Context, id, itemID int64, delta int) error {
+	if err := s.flashSaleRepo.AdjustStock(ctx, id, delta); err != nil {
+		return err
+	}
+	if itemID == 0 {
+		return nil
+	}
+
+	if err := s.flashSaleRepo.AdjustItemStock(ctx, itemID, delta); err != nil {
+		if rbErr := s.flashSaleRepo.AdjustStock(ctx, id, -delta); rbErr != nil {
+			s.log.Error("failed to roll back db stock adjustment", zap.Int64("flash_sale_id", id), zap.Error(rbErr))
+		}
+		return err
+	}
+	return nil
+}
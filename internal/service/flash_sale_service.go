@@ -3,11 +3,16 @@
 // 本檔案是整個秒殺系統的核心，包含：
 // - 活動建立、查詢、狀態管理
 // - Rush 方法：秒殺搶購核心流程
-// 流程：驗證 → 限購檢查 → 分散式鎖 → Redis 扣減 → Kafka 非同步下單
+// 流程：本地旗標快速拒絕 → 驗證 → 准入腳本（狀態/時間、查重、限購、扣減、寫入 Outbox 一次完成）→ Relay 投遞 Kafka
+// 有適用的跨活動限購策略時，扣減前先暫扣限購計數器，扣減成功後確認、被拒絕時取消，結果未知時暫扣自行到期
+// 舊流程（legacy_admission）：驗證 → DB 查重 → 分散式鎖 → Redis 扣減並寫入 Outbox
+// 分片活動：先扣減使用者所屬庫存分片，再以准入腳本完成其餘檢查，准入失敗歸還分片
+// 排隊模式：驗證 → 入列 → QueueWorker 依速率出列 → Redis 扣減並寫入 Outbox
 package service
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"time"
 
@@ -27,110 +32,223 @@ var (
 	ErrAlreadyPurchased    = errors.New("already purchased in this flash sale")
 	ErrFlashSaleNotStarted = errors.New("flash sale has not started")
 	ErrFlashSaleEnded      = errors.New("flash sale has ended")
+	ErrItemRequired        = errors.New("flash sale item is required")
+	ErrItemNotFound        = errors.New("flash sale item not found")
+	ErrRaffleSale          = errors.New("raffle flash sale does not accept rush")
 )
 
 // FlashSaleService 秒殺業務服務
 type FlashSaleService struct {
 	flashSaleRepo *repository.FlashSaleRepository
+	productRepo   *repository.ProductRepository
 	orderRepo     *repository.OrderRepository
-	stockService  *cache.StockService // Redis 庫存操作
-	producer      *mq.Producer        // Kafka 訊息生產者
+	orderService  *OrderService
+	payments      *PaymentService  // 取消活動時退款，不取消活動的呼叫方為 nil
+	stock         cache.StockStore // 熱路徑庫存操作（查詢、准入、舊流程扣減），可替換為其他後端
+	stockCache    cache.StockCache // 庫存佈建、預熱與分片
+	outbox        OutboxRegistry   // 訂單訊息 Outbox
+	queue         RushQueue        // 排隊模式佇列
+	tickets       TicketRecorder   // 搶購憑證狀態
+	limits        LimitReserver    // 跨活動限購
+	flags         SaleFlagStore    // 本地售罄/關閉旗標
+	metas         FlashSaleMetaStore
+	reservedCache ReservationSet
+	reservations  *repository.ReservationRepository
+	producer      *mq.Producer // Kafka 訊息生產者
 	log           *zap.Logger
+
+	legacyAdmission bool // 使用舊搶購流程（DB 查重 + 使用者鎖）
 }
 
-func NewFlashSaleService(producer *mq.Producer, log *zap.Logger) *FlashSaleService {
+// cacheRetention 庫存 Key 在活動結束後的保留時間，取消訂單時仍能恢復 Redis 庫存
+// Outbox Stream 不設 TTL，由 Relay 在投遞完畢並閒置後刪除
+const cacheRetention = 24 * time.Hour
+
+// NewFlashSaleService 建立秒殺服務，payments 僅取消活動時使用（排程、排隊放行等不取消活動的呼叫方可傳 nil）
+func NewFlashSaleService(deps *CacheDeps, payments *PaymentService, producer *mq.Producer, log *zap.Logger) *FlashSaleService {
 	return &FlashSaleService{
 		flashSaleRepo: repository.NewFlashSaleRepository(),
+		productRepo:   repository.NewProductRepository(),
 		orderRepo:     repository.NewOrderRepository(),
-		stockService:  cache.NewStockService(),
+		orderService:  NewOrderService(deps, producer, log),
+		payments:      payments,
+		stock:         deps.Stock,
+		stockCache:    deps.StockCache,
+		outbox:        deps.Outbox,
+		queue:         deps.Queue,
+		tickets:       deps.Tickets,
+		limits:        deps.Limits,
+		flags:         deps.Flags,
+		metas:         deps.Metas,
+		reservedCache: deps.Reservations,
+		reservations:  repository.NewReservationRepository(),
 		producer:      producer,
 		log:           log,
 	}
 }
 
+// SetLegacyAdmission 切換搶購准入流程，true 使用舊流程（DB 查重 + 使用者鎖 + 扣減腳本）
+func (s *FlashSaleService) SetLegacyAdmission(legacy bool) {
+	s.legacyAdmission = legacy
+}
+
 // CreateFlashSaleRequest 建立秒殺活動請求
+// 提供 Items 時為多規格活動，總庫存與秒殺價由規格推算（總庫存 = 規格庫存之和，價格取最低價）
 type CreateFlashSaleRequest struct {
-	ProductID    int64   `json:"product_id" binding:"required"`
-	FlashPrice   float64 `json:"flash_price" binding:"required,gt=0"`
-	TotalStock   int     `json:"total_stock" binding:"required,gt=0"`
-	PerUserLimit int     `json:"per_user_limit" binding:"omitempty,gt=0"`
-	StartTime    string  `json:"start_time" binding:"required"` // RFC3339 格式
-	EndTime      string  `json:"end_time" binding:"required"`
+	ProductID            int64                        `json:"product_id" binding:"required"`
+	FlashPrice           float64                      `json:"flash_price" binding:"omitempty,gt=0"`
+	TotalStock           int                          `json:"total_stock" binding:"omitempty,gt=0"`
+	PerUserLimit         int                          `json:"per_user_limit" binding:"omitempty,gt=0"`
+	StartTime            string                       `json:"start_time" binding:"required"` // RFC3339 格式
+	EndTime              string                       `json:"end_time" binding:"required"`
+	SaleType             model.FlashSaleType          `json:"sale_type" binding:"omitempty,oneof=0 1"`                  // 0 搶購 / 1 抽籤
+	ReservedOnly         bool                         `json:"reserved_only"`                                            // 僅限預約使用者搶購
+	RemindMinutes        int                          `json:"remind_minutes" binding:"omitempty,gt=0"`                  // 開始前幾分鐘提醒預約使用者
+	QueueEnabled         bool                         `json:"queue_enabled"`                                            // 開啟排隊模式
+	QueueRate            int                          `json:"queue_rate" binding:"omitempty,gt=0"`                      // 每秒放行數
+	StockShards          int                          `json:"stock_shards" binding:"omitempty,gte=0,lte=64"`            // Redis 庫存分片數，熱門活動使用
+	Campaign             string                       `json:"campaign" binding:"omitempty,max=64"`                      // 所屬行銷檔期，供跨活動限購比對
+	PaymentWindowMinutes int                          `json:"payment_window_minutes" binding:"omitempty,gt=0,lte=1440"` // 下單後付款時限（分鐘），未提供使用預設值
+	Items                []CreateFlashSaleItemRequest `json:"items" binding:"omitempty,dive"`
+	TemplateID           *int64                       `json:"-"` // 由範本排程產生時設定
+}
+
+// CreateFlashSaleItemRequest 建立活動規格請求
+type CreateFlashSaleItemRequest struct {
+	Name       string  `json:"name" binding:"required,max=100"`
+	SKU        string  `json:"sku" binding:"omitempty,max=64"`
+	FlashPrice float64 `json:"flash_price" binding:"required,gt=0"`
+	TotalStock int     `json:"total_stock" binding:"required,gt=0"`
+	Sort       int     `json:"sort"`
 }
 
 // FlashSaleDetailResponse 活動詳情回應（含即時庫存）
 type FlashSaleDetailResponse struct {
-	FlashSale    *model.FlashSale `json:"flash_sale"`
-	CurrentStock int              `json:"current_stock"` // 從 Redis 取得的即時庫存
-	ServerTime   time.Time        `json:"server_time"`   // 伺服器時間，用於前端倒數同步
+	FlashSale    *model.FlashSale     `json:"flash_sale"`
+	CurrentStock int                  `json:"current_stock"`   // 從 Redis 取得的即時庫存
+	Items        []FlashSaleItemStock `json:"items,omitempty"` // 多規格活動的規格即時庫存
+	ServerTime   time.Time            `json:"server_time"`     // 伺服器時間，用於前端倒數同步
+}
+
+// FlashSaleItemStock 規格即時庫存
+type FlashSaleItemStock struct {
+	ItemID       int64   `json:"item_id"`
+	Name         string  `json:"name"`
+	FlashPrice   float64 `json:"flash_price"`
+	TotalStock   int     `json:"total_stock"`
+	CurrentStock int     `json:"current_stock"`
 }
 
 // RushRequest 秒殺搶購請求
 type RushRequest struct {
-	Quantity int `json:"quantity" binding:"omitempty,gt=0"`
+	ItemID   int64 `json:"item_id" binding:"omitempty,gt=0"` // 多規格活動必填
+	Quantity int   `json:"quantity" binding:"omitempty,gt=0"`
 }
 
 // RushResponse 秒殺搶購回應
 type RushResponse struct {
-	Success  bool   `json:"success"`
-	Ticket   string `json:"ticket,omitempty"`   // 排隊憑證，用於查詢訂單狀態
-	Position int    `json:"position,omitempty"` // 排隊位置（保留欄位）
-	Message  string `json:"message"`
-	OrderNo  string `json:"order_no,omitempty"` // 若已購買過則返回訂單號
+	Success       bool   `json:"success"`
+	Ticket        string `json:"ticket,omitempty"`         // 排隊憑證，用於查詢訂單狀態
+	Position      int    `json:"position,omitempty"`       // 排隊位置（排隊模式，從 1 開始）
+	EstimatedWait int    `json:"estimated_wait,omitempty"` // 預估等待秒數（排隊模式）
+	Message       string `json:"message"`
+	OrderNo       string `json:"order_no,omitempty"` // 若已購買過則返回訂單號
 }
 
 // Create 建立秒殺活動
 func (s *FlashSaleService) Create(ctx context.Context, req *CreateFlashSaleRequest) (*model.FlashSale, error) {
-	startTime, err := time.Parse(time.RFC3339, req.StartTime)
+	fieldErrs, err := s.ValidateCreate(ctx, req)
 	if err != nil {
-		return nil, errors.New("invalid start_time format, use RFC3339")
+		return nil, err
 	}
-
-	endTime, err := time.Parse(time.RFC3339, req.EndTime)
-	if err != nil {
-		return nil, errors.New("invalid end_time format, use RFC3339")
+	if len(fieldErrs) > 0 {
+		return nil, &ValidationFailedError{Errors: fieldErrs}
 	}
 
-	if endTime.Before(startTime) {
-		return nil, errors.New("end_time must be after start_time")
-	}
+	// 格式已於 ValidateCreate 驗證
+	startTime, _ := time.Parse(time.RFC3339, req.StartTime)
+	endTime, _ := time.Parse(time.RFC3339, req.EndTime)
 
 	perUserLimit := req.PerUserLimit
 	if perUserLimit <= 0 {
 		perUserLimit = 1 // 預設每人限購 1 件
 	}
 
+	flashPrice, totalStock := req.FlashPrice, req.TotalStock
+	items := make([]model.FlashSaleItem, 0, len(req.Items))
+	if len(req.Items) > 0 {
+		flashPrice, totalStock = 0, 0
+		for _, item := range req.Items {
+			items = append(items, model.FlashSaleItem{
+				Name:           item.Name,
+				SKU:            item.SKU,
+				FlashPrice:     item.FlashPrice,
+				TotalStock:     item.TotalStock,
+				AvailableStock: item.TotalStock,
+				Sort:           item.Sort,
+			})
+			totalStock += item.TotalStock
+			if flashPrice == 0 || item.FlashPrice < flashPrice {
+				flashPrice = item.FlashPrice // 列表顯示最低價
+			}
+		}
+	}
+
 	flashSale := &model.FlashSale{
-		ProductID:      req.ProductID,
-		FlashPrice:     req.FlashPrice,
-		TotalStock:     req.TotalStock,
-		AvailableStock: req.TotalStock,
-		PerUserLimit:   perUserLimit,
-		StartTime:      startTime,
-		EndTime:        endTime,
-		Status:         model.FlashSaleStatusPending,
+		ProductID:            req.ProductID,
+		TemplateID:           req.TemplateID,
+		Items:                items,
+		FlashPrice:           flashPrice,
+		TotalStock:           totalStock,
+		AvailableStock:       totalStock,
+		SaleType:             req.SaleType,
+		ReservedOnly:         req.ReservedOnly,
+		RemindMinutes:        req.RemindMinutes,
+		PerUserLimit:         perUserLimit,
+		QueueEnabled:         req.QueueEnabled,
+		QueueRate:            req.QueueRate,
+		StockShards:          req.StockShards,
+		Campaign:             req.Campaign,
+		PaymentWindowMinutes: req.PaymentWindowMinutes,
+		StartTime:            startTime,
+		EndTime:              endTime,
+		Status:               model.FlashSaleStatusPending,
 	}
 
 	if err := s.flashSaleRepo.Create(ctx, flashSale); err != nil {
 		return nil, err
 	}
 
-	// 同步初始化 Redis 庫存
-	if err := s.stockService.InitStock(ctx, flashSale.ID, req.TotalStock); err != nil {
+	// 同步初始化 Redis 庫存，TTL 覆蓋至活動結束後
+	ttl := cacheTTL(flashSale)
+	if flashSale.IsSharded() {
+		if err := s.stockCache.SetShardedStock(ctx, flashSale.ID, totalStock, flashSale.StockShards, ttl); err != nil {
+			s.log.Error("failed to init redis stock shards", zap.Int64("flash_sale_id", flashSale.ID), zap.Error(err))
+		}
+	} else if err := s.stockCache.SetStock(ctx, flashSale.ID, totalStock, ttl); err != nil {
 		s.log.Error("failed to init redis stock", zap.Int64("flash_sale_id", flashSale.ID), zap.Error(err))
 	}
+	for _, item := range flashSale.Items {
+		if err := s.stockCache.SetItemStock(ctx, flashSale.ID, item.ID, item.TotalStock, ttl); err != nil {
+			s.log.Error("failed to init redis item stock",
+				zap.Int64("flash_sale_id", flashSale.ID),
+				zap.Int64("item_id", item.ID),
+				zap.Error(err),
+			)
+		}
+	}
 
 	return flashSale, nil
 }
 
 // GetByID 查詢活動詳情（含即時庫存）
 func (s *FlashSaleService) GetByID(ctx context.Context, id int64) (*FlashSaleDetailResponse, error) {
-	flashSale, err := s.flashSaleRepo.GetByID(ctx, id)
+	flashSale, err := s.getFlashSale(ctx, id)
 	if err != nil {
 		return nil, err
 	}
 
-	stock, err := s.stockService.GetStock(ctx, id)
+	stock, err := s.stock.GetStock(ctx, id)
 	if err != nil {
 		stock = flashSale.AvailableStock // Redis 失敗時降級使用 DB 庫存
 	}
@@ -138,10 +256,44 @@ func (s *FlashSaleService) GetByID(ctx context.Context, id int64) (*FlashSaleDet
 	return &FlashSaleDetailResponse{
 		FlashSale:    flashSale,
 		CurrentStock: stock,
+		Items:        s.itemStocks(ctx, flashSale),
 		ServerTime:   time.Now(),
 	}, nil
 }
 
+// itemStocks 查詢各規格即時庫存，Redis 失敗時降級使用 DB 庫存
+func (s *FlashSaleService) itemStocks(ctx context.Context, flashSale *model.FlashSale) []FlashSaleItemStock {
+	if !flashSale.HasItems() {
+		return nil
+	}
+
+	itemIDs := make([]int64, len(flashSale.Items))
+	for i, item := range flashSale.Items {
+		itemIDs[i] = item.ID
+	}
+
+	stocks, err := s.stockCache.GetItemStocks(ctx, flashSale.ID, itemIDs)
+	if err != nil {
+		s.log.Warn("failed to get redis item stock", zap.Int64("flash_sale_id", flashSale.ID), zap.Error(err))
+	}
+
+	result := make([]FlashSaleItemStock, len(flashSale.Items))
+	for i, item := range flashSale.Items {
+		current, ok := stocks[item.ID]
+		if !ok {
+			current = item.AvailableStock
+		}
+		result[i] = FlashSaleItemStock{
+			ItemID:       item.ID,
+			Name:         item.Name,
+			FlashPrice:   item.FlashPrice,
+			TotalStock:   item.TotalStock,
+			CurrentStock: current,
+		}
+	}
+	return result
+}
+
 // List 分頁查詢活動列表
 func (s *FlashSaleService) List(ctx context.Context, page, pageSize int, status *model.FlashSaleStatus) ([]model.FlashSale, int64, error) {
 	if page < 1 {
@@ -159,20 +311,71 @@ func (s *FlashSaleService) ListActive(ctx context.Context) ([]model.FlashSale, e
 	return s.flashSaleRepo.ListActive(ctx)
 }
 
-// GetStock 查詢即時庫存
+// GetStock 查詢即時庫存，Redis 失敗時降級使用快取中的 DB 庫存
 func (s *FlashSaleService) GetStock(ctx context.Context, id int64) (int, error) {
-	return s.stockService.GetStock(ctx, id)
+	flashSale, err := s.getFlashSale(ctx, id)
+	if err != nil {
+		return 0, err
+	}
+
+	stock, err := s.stock.GetStock(ctx, id)
+	if err != nil {
+		s.log.Warn("failed to get redis stock", zap.Int64("flash_sale_id", id), zap.Error(err))
+		return flashSale.AvailableStock, nil
+	}
+	return stock, nil
+}
+
+// SubscribeStock 訂閱活動庫存更新並返回當前庫存作為初始值，使用完畢需關閉訂閱
+func (s *FlashSaleService) SubscribeStock(ctx context.Context, id int64) (*cache.StockSubscription, cache.StockUpdate, error) {
+	stock, err := s.GetStock(ctx, id)
+	if err != nil {
+		return nil, cache.StockUpdate{}, err
+	}
+
+	initial := cache.StockUpdate{
+		FlashSaleID: id,
+		Stock:       stock,
+		SoldOut:     stock <= 0,
+		Timestamp:   time.Now().UnixMilli(),
+	}
+	return cache.StockEvents().Subscribe(id), initial, nil
+}
+
+// getFlashSale 經由中繼資料快取查詢活動（本地 → Redis → DB），用於搶購熱路徑與公開查詢
+func (s *FlashSaleService) getFlashSale(ctx context.Context, id int64) (*model.FlashSale, error) {
+	return s.metas.Get(ctx, id, func(ctx context.Context) (*model.FlashSale, error) {
+		return s.flashSaleRepo.GetByID(ctx, id)
+	})
+}
+
+// invalidateFlashSale 活動資料變更後清除所有實例的中繼資料快取
+func (s *FlashSaleService) invalidateFlashSale(ctx context.Context, id int64) {
+	if err := s.metas.Invalidate(ctx, id); err != nil {
+		s.log.Warn("failed to invalidate flash sale meta", zap.Int64("flash_sale_id", id), zap.Error(err))
+	}
 }
 
 // Rush 秒殺搶購核心邏輯
 // 這是整個系統最關鍵的方法，包含完整的併發控制流程
-func (s *FlashSaleService) Rush(ctx context.Context, userID, flashSaleID int64, quantity int) (*RushResponse, error) {
+func (s *FlashSaleService) Rush(ctx context.Context, userID, flashSaleID int64, req *RushRequest) (*RushResponse, error) {
+	quantity := req.Quantity
 	if quantity <= 0 {
 		quantity = 1
 	}
 
-	// 階段一：驗證活動狀態
-	flashSale, err := s.flashSaleRepo.GetByID(ctx, flashSaleID)
+	// 階段零：命中本地旗標直接拒絕，不查詢 DB 與 Redis
+	switch s.flags.Check(flashSaleID) {
+	case cache.SaleFlagSoldOut:
+		return &RushResponse{Success: false, Message: "已售罄"}, ErrStockInsufficient
+	case cache.SaleFlagClosed:
+		return &RushResponse{Success: false, Message: "秒杀活动已结束"}, ErrFlashSaleEnded
+	case cache.SaleFlagPaused:
+		return &RushResponse{Success: false, Message: "秒杀活动已暂停"}, ErrFlashSalePaused
+	}
+
+	// 階段一：驗證活動狀態（讀取快取的活動資料）
+	flashSale, err := s.getFlashSale(ctx, flashSaleID)
 	if err != nil {
 		return nil, err
 	}
@@ -184,12 +387,20 @@ func (s *FlashSaleService) Rush(ctx context.Context, userID, flashSaleID int64,
 			Message: "秒杀活动尚未开始",
 		}, ErrFlashSaleNotStarted
 	}
-	if now.After(flashSale.EndTime) {
+	if now.After(flashSale.EndTime) || flashSale.Status == model.FlashSaleStatusFinished || flashSale.Status == model.FlashSaleStatusCancelled {
+		s.setFlag(ctx, flashSaleID, cache.SaleFlagClosed)
 		return &RushResponse{
 			Success: false,
 			Message: "秒杀活动已结束",
 		}, ErrFlashSaleEnded
 	}
+	if flashSale.IsPaused() {
+		s.setFlag(ctx, flashSaleID, cache.SaleFlagPaused)
+		return &RushResponse{
+			Success: false,
+			Message: "秒杀活动已暂停",
+		}, ErrFlashSalePaused
+	}
 	if flashSale.Status != model.FlashSaleStatusActive {
 		return &RushResponse{
 			Success: false,
@@ -197,6 +408,42 @@ func (s *FlashSaleService) Rush(ctx context.Context, userID, flashSaleID int64,
 		}, ErrFlashSaleNotActive
 	}
 
+	// 抽籤活動只能登記，不開放搶購
+	if flashSale.IsRaffle() {
+		return &RushResponse{Success: false, Message: "抽签活动请登记参与"}, ErrRaffleSale
+	}
+
+	// 僅限預約使用者搶購
+	if flashSale.ReservedOnly {
+		reserved, err := s.isReserved(ctx, flashSale, userID)
+		if err != nil {
+			return nil, err
+		}
+		if !reserved {
+			return &RushResponse{Success: false, Message: "仅限预约用户参与"}, ErrNotReserved
+		}
+	}
+
+	// 多規格活動必須指定規格，單規格活動忽略 item_id
+	var itemID int64
+	if flashSale.HasItems() {
+		if req.ItemID == 0 {
+			return &RushResponse{Success: false, Message: "请选择商品规格"}, ErrItemRequired
+		}
+		if flashSale.FindItem(req.ItemID) == nil {
+			return &RushResponse{Success: false, Message: "商品规格不存在"}, ErrItemNotFound
+		}
+		itemID = req.ItemID
+	}
+
+	if !s.legacyAdmission {
+		// 查重、限購與扣減皆由准入腳本完成，同一使用者的併發請求在腳本內序列化
+		if flashSale.QueueEnabled {
+			return s.enqueue(ctx, flashSale, userID, itemID, quantity)
+		}
+		return s.admit(ctx, flashSale, userID, itemID, quantity, utils.GenerateTicket())
+	}
+
 	// 階段二：檢查使用者是否已購買
 	existingOrder, err := s.orderRepo.GetByUserAndFlashSale(ctx, userID, flashSaleID)
 	if err != nil {
@@ -210,9 +457,14 @@ func (s *FlashSaleService) Rush(ctx context.Context, userID, flashSaleID int64,
 		}, ErrAlreadyPurchased
 	}
 
-	// 階段三：取得分散式鎖（防止同一使用者併發重複提交）
-	lock := cache.NewDistributedLock(flashSaleID, userID)
-	acquired, err := lock.Lock(ctx, 10000) // 鎖 10 秒
+	// 排隊模式：依到達順序入列，由 QueueWorker 以固定速率放行
+	if flashSale.QueueEnabled {
+		return s.enqueue(ctx, flashSale, userID, itemID, quantity)
+	}
+
+	// 階段三：取得分散式鎖（防止同一使用者併發重複提交），看門狗在扣減期間續期
+	lock := cache.NewRenewableLock(cache.LockKey(flashSaleID, userID), cache.LockOptions{})
+	acquired, err := lock.Lock(ctx)
 	if err != nil {
 		s.log.Error("failed to acquire lock", zap.Error(err))
 		return nil, errors.New("system busy, please retry")
@@ -224,84 +476,566 @@ func (s *FlashSaleService) Rush(ctx context.Context, userID, flashSaleID int64,
 		}, nil
 	}
 	defer func() {
-		if err := lock.Unlock(ctx); err != nil {
+		if err := lock.Unlock(ctx); err != nil && !errors.Is(err, cache.ErrLockNotHeld) {
 			s.log.Error("failed to release lock", zap.Error(err))
 		}
 	}()
 
-	// 階段四：Redis 原子扣減庫存
-	result, err := s.stockService.DeductStock(ctx, flashSaleID, userID, quantity, flashSale.PerUserLimit)
+	// 階段四、五：扣減庫存並寫入 Outbox
+	return s.admit(ctx, flashSale, userID, itemID, quantity, utils.GenerateTicket())
+}
+
+// setFlag 設定本地旗標並廣播，廣播失敗只記日誌（其他實例的旗標在本地 TTL 後失效）
+func (s *FlashSaleService) setFlag(ctx context.Context, flashSaleID int64, flag cache.SaleFlag) {
+	if err := s.flags.Set(ctx, flashSaleID, flag); err != nil {
+		s.log.Warn("failed to publish sale flag", zap.Int64("flash_sale_id", flashSaleID), zap.Error(err))
+	}
+}
+
+// isReserved 判斷使用者是否已預約，快取名單未載入時從 DB 重建
+func (s *FlashSaleService) isReserved(ctx context.Context, flashSale *model.FlashSale, userID int64) (bool, error) {
+	reserved, loaded, err := s.reservedCache.IsReserved(ctx, flashSale.ID, userID)
+	if err == nil && loaded {
+		return reserved, nil
+	}
 	if err != nil {
-		return nil, err
+		s.log.Warn("failed to check reservation cache", zap.Int64("flash_sale_id", flashSale.ID), zap.Error(err))
 	}
 
-	if !result.Success {
-		switch result.Code {
-		case -1: // 庫存不足
-			return &RushResponse{Success: false, Message: result.Message}, ErrStockInsufficient
-		case -2: // 超過限購
-			return &RushResponse{Success: false, Message: result.Message}, ErrLimitExceeded
-		default:
-			return &RushResponse{Success: false, Message: result.Message}, nil
-		}
+	userIDs, err := s.reservations.ListUserIDs(ctx, flashSale.ID)
+	if err != nil {
+		return false, err
+	}
+	if err := s.reservedCache.Load(ctx, flashSale.ID, userIDs, cacheTTL(flashSale)); err != nil {
+		s.log.Warn("failed to load reservation cache", zap.Int64("flash_sale_id", flashSale.ID), zap.Error(err))
 	}
 
-	// 階段五：發送 Kafka 非同步訂單消息
-	ticket := utils.GenerateTicket() // 生成排隊憑證
+	for _, id := range userIDs {
+		if id == userID {
+			return true, nil
+		}
+	}
+	return false, nil
+}
 
-	msg := &mq.FlashSaleOrderMessage{
+// admit 放行搶購請求：Redis 原子扣減庫存，同時將訂單訊息寫入 Outbox
+// 直接搶購與排隊出列共用此流程
+func (s *FlashSaleService) admit(ctx context.Context, flashSale *model.FlashSale, userID, itemID int64, quantity int, ticket string) (*RushResponse, error) {
+	payload, err := json.Marshal(&mq.FlashSaleOrderMessage{
 		MessageID:   ticket,
 		Timestamp:   time.Now(),
-		FlashSaleID: flashSaleID,
+		FlashSaleID: flashSale.ID,
 		UserID:      userID,
+		ItemID:      itemID,
 		Quantity:    quantity,
 		Ticket:      ticket,
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	if err := s.producer.SendFlashSaleOrder(ctx, msg); err != nil {
-		// 發送失敗，必須回滾 Redis 庫存
-		s.log.Error("failed to send order message, restoring stock",
-			zap.Error(err),
-			zap.Int64("user_id", userID),
-			zap.Int64("flash_sale_id", flashSaleID),
-		)
+	// 跨活動限購：先暫扣計數器，准入成功後確認、被拒絕時取消
+	// 計數器以使用者為 hash tag，無法併入准入腳本；兩者之間崩潰時暫扣自行到期
+	reservation, exceeded, err := s.limits.Reserve(ctx, flashSale, userID, quantity, ticket)
+	if err != nil {
+		return nil, err
+	}
+	if exceeded != nil {
+		return &RushResponse{Success: false, Ticket: ticket, Message: "超出限购：" + exceeded.Name}, ErrLimitExceeded
+	}
+
+	rejected, err := s.deduct(ctx, flashSale, userID, itemID, quantity, string(payload))
+	if rejected != nil {
+		s.limits.Release(ctx, reservation)
+		rejected.Ticket = ticket
+		return rejected, err
+	}
+	if err != nil {
+		// 腳本可能已執行，保留暫扣至到期：未准入時不誤判超出限購，已准入時短少的計數由對帳補足
+		return nil, err
+	}
+	s.limits.Confirm(ctx, reservation)
+
+	// 訊息已持久化於 Outbox，由 OutboxRelay 非同步投遞至 Kafka
+	s.tickets.Record(ctx, &cache.TicketRecord{
+		Ticket:      ticket,
+		UserID:      userID,
+		FlashSaleID: flashSale.ID,
+		Status:      cache.TicketStatusProcessing,
+	})
+
+	return &RushResponse{
+		Success: true,
+		Ticket:  ticket,
+		Message: "排队中，请等待结果",
+	}, nil
+}
+
+// deduct 扣減庫存並寫入 Outbox，被拒絕時返回拒絕回應（不含 Ticket），成功時返回 nil
+// 返回 nil 回應與錯誤表示執行失敗、結果未知
+func (s *FlashSaleService) deduct(ctx context.Context, flashSale *model.FlashSale, userID, itemID int64, quantity int, payload string) (*RushResponse, error) {
+	// 分片活動的庫存不在單一 Key，舊扣減腳本無法處理，一律走准入腳本
+	if s.legacyAdmission && !flashSale.IsSharded() {
+		result, err := s.stock.Deduct(ctx, &cache.DeductRequest{
+			FlashSaleID: flashSale.ID,
+			UserID:      userID,
+			ItemID:      itemID,
+			Quantity:    quantity,
+			Limit:       flashSale.PerUserLimit,
+			Payload:     payload,
+			BoughtTTL:   cacheTTL(flashSale),
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		if !result.Success {
+			switch result.Code {
+			case -1: // 庫存不足
+				return &RushResponse{Success: false, Message: result.Message}, ErrStockInsufficient
+			case -2: // 超過限購
+				return &RushResponse{Success: false, Message: result.Message}, ErrLimitExceeded
+			default:
+				return &RushResponse{Success: false, Message: result.Message}, nil
+			}
+		}
+	} else {
+		req := &cache.AdmitRequest{
+			FlashSaleID: flashSale.ID,
+			UserID:      userID,
+			ItemID:      itemID,
+			Quantity:    quantity,
+			Payload:     payload,
+			Retention:   cacheRetention,
+		}
+
+		// 分片活動先從使用者所屬分片扣減，准入腳本只做驗證、查重與寫入 Outbox
+		shard := -1
+		if flashSale.IsSharded() {
+			taken, err := s.stockCache.DeductShard(ctx, flashSale.ID, userID, flashSale.StockShards, quantity)
+			if err != nil {
+				return nil, err
+			}
+			if !taken.Success {
+				return &RushResponse{Success: false, Message: "库存不足"}, ErrStockInsufficient
+			}
+			shard, req.StockTaken = taken.Shard, true
+		}
 
-		if restoreErr := s.stockService.RestoreStock(ctx, flashSaleID, userID, quantity); restoreErr != nil {
-			s.log.Error("failed to restore stock", zap.Error(restoreErr))
+		result, err := s.runAdmit(ctx, flashSale.ID, req)
+		if err != nil {
+			// 腳本可能已執行，不歸還分片庫存（寧可少賣），由對帳修正
+			return nil, err
 		}
+		if result.Code != cache.AdmitOK {
+			if shard >= 0 {
+				if err := s.stockCache.ReleaseShard(ctx, flashSale.ID, shard, quantity); err != nil {
+					s.log.Error("failed to release stock shard",
+						zap.Int64("flash_sale_id", flashSale.ID),
+						zap.Int("shard", shard),
+						zap.Error(err),
+					)
+				}
+			}
+			return &RushResponse{Success: false, Message: result.Message}, admitError(result.Code)
+		}
+	}
+	return nil, nil
+}
 
+// runAdmit 執行准入腳本，中繼資料 Hash 未載入時從 DB 載入後重試一次
+func (s *FlashSaleService) runAdmit(ctx context.Context, flashSaleID int64, req *cache.AdmitRequest) (*cache.AdmitResult, error) {
+	result, err := s.stock.Admit(ctx, req)
+	if err != nil || result.Code != cache.AdmitMetaMissing {
+		return result, err
+	}
+
+	if _, err := s.metas.Refresh(ctx, flashSaleID, func(ctx context.Context) (*model.FlashSale, error) {
+		return s.flashSaleRepo.GetByID(ctx, flashSaleID)
+	}); err != nil {
+		return nil, err
+	}
+	return s.stock.Admit(ctx, req)
+}
+
+// admitError 准入結果碼對應業務錯誤
+func admitError(code cache.AdmitCode) error {
+	switch code {
+	case cache.AdmitSoldOut:
+		return ErrStockInsufficient
+	case cache.AdmitLimitExceeded:
+		return ErrLimitExceeded
+	case cache.AdmitAlreadyPurchased:
+		return ErrAlreadyPurchased
+	case cache.AdmitNotStarted:
+		return ErrFlashSaleNotStarted
+	case cache.AdmitEnded:
+		return ErrFlashSaleEnded
+	default:
+		return ErrFlashSaleNotActive
+	}
+}
+
+// enqueue 排隊模式入列，返回真實排隊位置與預估等待時間
+func (s *FlashSaleService) enqueue(ctx context.Context, flashSale *model.FlashSale, userID, itemID int64, quantity int) (*RushResponse, error) {
+	entry, position, added, err := s.queue.Enqueue(ctx, &cache.QueueEntry{
+		Ticket:      utils.GenerateTicket(),
+		FlashSaleID: flashSale.ID,
+		UserID:      userID,
+		ItemID:      itemID,
+		Quantity:    quantity,
+		EnqueuedAt:  time.Now(),
+	}, cacheTTL(flashSale))
+	if err != nil {
+		s.log.Error("failed to enqueue rush request", zap.Int64("flash_sale_id", flashSale.ID), zap.Error(err))
 		return nil, errors.New("system busy, please retry")
 	}
 
-	// 搶購成功，返回排隊憑證
+	message := "排队中，请等待结果"
+	if !added {
+		message = "您已在排队中"
+	} else {
+		s.tickets.Record(ctx, &cache.TicketRecord{
+			Ticket:      entry.Ticket,
+			UserID:      userID,
+			FlashSaleID: flashSale.ID,
+			Status:      cache.TicketStatusQueued,
+		})
+	}
+
 	return &RushResponse{
-		Success:  true,
-		Ticket:   ticket,
-		Position: 0,
-		Message:  "排队中，请等待结果",
+		Success:       true,
+		Ticket:        entry.Ticket,
+		Position:      position,
+		EstimatedWait: estimatedWait(position, flashSale.AdmitRate()),
+		Message:       message,
 	}, nil
 }
 
+// estimatedWait 依放行速率估算排隊等待秒數
+func estimatedWait(position, rate int) int {
+	if position <= 0 || rate <= 0 {
+		return 0
+	}
+	return (position + rate - 1) / rate
+}
+
+// QueueStatusResponse 排隊狀態回應
+type QueueStatusResponse struct {
+	FlashSaleID   int64  `json:"flash_sale_id"`
+	InQueue       bool   `json:"in_queue"`
+	Ticket        string `json:"ticket,omitempty"`
+	Position      int    `json:"position,omitempty"`
+	QueueLength   int64  `json:"queue_length"`
+	EstimatedWait int    `json:"estimated_wait,omitempty"` // 預估等待秒數
+}
+
+// QueueStatus 查詢使用者在活動中的排隊狀態
+func (s *FlashSaleService) QueueStatus(ctx context.Context, userID, flashSaleID int64) (*QueueStatusResponse, error) {
+	flashSale, err := s.getFlashSale(ctx, flashSaleID)
+	if err != nil {
+		return nil, err
+	}
+
+	entry, position, length, err := s.queue.Position(ctx, flashSaleID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &QueueStatusResponse{
+		FlashSaleID: flashSaleID,
+		QueueLength: length,
+	}
+	if entry != nil {
+		resp.InQueue = true
+		resp.Ticket = entry.Ticket
+		resp.Position = position
+		resp.EstimatedWait = estimatedWait(position, flashSale.AdmitRate())
+	}
+	return resp, nil
+}
+
+// QueueOutcome 排隊請求的放行結果（供 Worker 推送通知）
+type QueueOutcome struct {
+	Entry    cache.QueueEntry
+	Response *RushResponse
+	Err      error
+}
+
+// queueTicksPerSecond 每秒出列輪數，與 QueueWorker 輪詢間隔對應
+const queueTicksPerSecond = 10
+
+// DrainQueue 依放行速率出列並執行扣減
+// 活動已結束或總庫存售罄時清空佇列，剩餘請求以失敗結果返回
+func (s *FlashSaleService) DrainQueue(ctx context.Context, flashSaleID int64) ([]QueueOutcome, error) {
+	flashSale, err := s.getFlashSale(ctx, flashSaleID)
+	if err != nil {
+		return nil, err
+	}
+
+	// 暫停期間保留排隊順序，恢復後繼續放行
+	if flashSale.IsPaused() && time.Now().Before(flashSale.EndTime) {
+		return nil, nil
+	}
+	if flashSale.Status == model.FlashSaleStatusCancelled {
+		return s.clearQueue(ctx, flashSale, "秒杀活动已取消", ErrFlashSaleNotActive)
+	}
+	if !flashSale.IsActive() {
+		return s.clearQueue(ctx, flashSale, "秒杀活动已结束", ErrFlashSaleEnded)
+	}
+
+	rate := flashSale.AdmitRate()
+	batch := (rate + queueTicksPerSecond - 1) / queueTicksPerSecond // 平均分攤到每輪，避免每秒開頭突發
+
+	entries, err := s.queue.Drain(ctx, flashSaleID, rate, batch)
+	if err != nil {
+		return nil, err
+	}
+
+	outcomes := make([]QueueOutcome, 0, len(entries))
+	soldOut := false
+	for _, entry := range entries {
+		resp, err := s.admit(ctx, flashSale, entry.UserID, entry.ItemID, entry.Quantity, entry.Ticket)
+		if resp == nil && err != nil {
+			resp = &RushResponse{Success: false, Ticket: entry.Ticket, Message: "系统繁忙，请稍后重试"}
+		}
+		outcomes = append(outcomes, QueueOutcome{Entry: entry, Response: resp, Err: err})
+
+		if err == ErrStockInsufficient {
+			if stock, err := s.stock.GetStock(ctx, flashSaleID); err == nil && stock <= 0 {
+				soldOut = true
+			}
+		}
+	}
+
+	s.recordQueueFailures(ctx, outcomes)
+
+	if soldOut {
+		cleared, err := s.clearQueue(ctx, flashSale, "已售罄", ErrStockInsufficient)
+		if err != nil {
+			return outcomes, err
+		}
+		outcomes = append(outcomes, cleared...)
+	}
+
+	return outcomes, nil
+}
+
+// recordQueueFailures 記錄未放行成功的排隊憑證（成功者已於 admit 記錄為 processing）
+func (s *FlashSaleService) recordQueueFailures(ctx context.Context, outcomes []QueueOutcome) {
+	for _, outcome := range outcomes {
+		if outcome.Response.Success {
+			continue
+		}
+		s.tickets.Record(ctx, &cache.TicketRecord{
+			Ticket:      outcome.Entry.Ticket,
+			UserID:      outcome.Entry.UserID,
+			FlashSaleID: outcome.Entry.FlashSaleID,
+			Status:      cache.TicketStatusFailed,
+			Reason:      outcome.Response.Message,
+		})
+	}
+}
+
+// clearQueue 清空佇列，將剩餘請求標記為失敗
+func (s *FlashSaleService) clearQueue(ctx context.Context, flashSale *model.FlashSale, message string, reason error) ([]QueueOutcome, error) {
+	entries, err := s.queue.Clear(ctx, flashSale.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(entries) > 0 {
+		s.log.Info("flash sale queue cleared",
+			zap.Int64("flash_sale_id", flashSale.ID),
+			zap.Int("count", len(entries)),
+			zap.Error(reason),
+		)
+	}
+
+	outcomes := make([]QueueOutcome, len(entries))
+	for i, entry := range entries {
+		outcomes[i] = QueueOutcome{
+			Entry:    entry,
+			Response: &RushResponse{Success: false, Ticket: entry.Ticket, Message: message},
+			Err:      reason,
+		}
+	}
+	s.recordQueueFailures(ctx, outcomes)
+	return outcomes, nil
+}
+
+// ActiveQueues 列出目前有排隊請求的活動
+func (s *FlashSaleService) ActiveQueues(ctx context.Context) ([]int64, error) {
+	return s.queue.ActiveQueues(ctx)
+}
+
+// cacheTTL 計算活動 Redis 快取（庫存、已購數量）的存活時間
+func cacheTTL(flashSale *model.FlashSale) time.Duration {
+	return time.Until(flashSale.EndTime) + cacheRetention
+}
+
+// warmUpStock 依是否分片預熱活動庫存
+func (s *FlashSaleService) warmUpStock(ctx context.Context, flashSale *model.FlashSale, stock int, ttl time.Duration) (bool, error) {
+	if flashSale.IsSharded() {
+		return s.stockCache.WarmUpShardedStock(ctx, flashSale.ID, stock, flashSale.StockShards, ttl)
+	}
+	return s.stockCache.WarmUpStock(ctx, flashSale.ID, stock, ttl)
+}
+
+// WarmUpStock 預熱單一活動的 Redis 快取
+// 庫存 Key 缺失（過期、Redis 重啟或清空）時依 DB 訂單推算重新載入，並回填使用者已購數量
+func (s *FlashSaleService) WarmUpStock(ctx context.Context, flashSale *model.FlashSale) error {
+	ttl := cacheTTL(flashSale)
+
+	_, exists, err := s.stockCache.PeekStock(ctx, flashSale.ID)
+	if err != nil {
+		return err
+	}
+
+	if !exists {
+		sold, err := s.orderRepo.SumActiveQuantity(ctx, flashSale.ID)
+		if err != nil {
+			return err
+		}
+
+		stock := flashSale.TotalStock - sold
+		if stock < 0 {
+			stock = 0
+		}
+
+		loaded, err := s.warmUpStock(ctx, flashSale, stock, ttl)
+		if err != nil {
+			return err
+		}
+
+		if loaded {
+			if err := s.restoreBought(ctx, flashSale.ID, ttl); err != nil {
+				return err
+			}
+			s.log.Info("flash sale stock rehydrated",
+				zap.Int64("flash_sale_id", flashSale.ID),
+				zap.Int("stock", stock),
+				zap.Int("sold", sold),
+			)
+		}
+	} else if _, err := s.warmUpStock(ctx, flashSale, 0, ttl); err != nil { // 只延長 TTL
+		return err
+	}
+
+	if err := s.warmUpItemStocks(ctx, flashSale, ttl); err != nil {
+		return err
+	}
+
+	return s.outbox.Register(ctx, flashSale.ID)
+}
+
+// warmUpItemStocks 預熱多規格活動的規格庫存，缺失的 Key 依規格已售數量重新載入
+func (s *FlashSaleService) warmUpItemStocks(ctx context.Context, flashSale *model.FlashSale, ttl time.Duration) error {
+	if !flashSale.HasItems() {
+		return nil
+	}
+
+	rows, err := s.orderRepo.SumActiveQuantityByItem(ctx, flashSale.ID)
+	if err != nil {
+		return err
+	}
+
+	sold := make(map[int64]int, len(rows))
+	for _, row := range rows {
+		sold[row.ItemID] = row.Quantity
+	}
+
+	for _, item := range flashSale.Items {
+		stock := item.TotalStock - sold[item.ID]
+		if stock < 0 {
+			stock = 0
+		}
+		if _, err := s.stockCache.WarmUpItemStock(ctx, flashSale.ID, item.ID, stock, ttl); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// restoreBought 從訂單回填使用者已購數量，避免重新載入後限購失效
+func (s *FlashSaleService) restoreBought(ctx context.Context, flashSaleID int64, ttl time.Duration) error {
+	rows, err := s.orderRepo.SumActiveQuantityByUser(ctx, flashSaleID)
+	if err != nil {
+		return err
+	}
+
+	bought := make(map[int64]int, len(rows))
+	for _, row := range rows {
+		bought[row.UserID] = row.Quantity
+	}
+	return s.stockCache.RestoreBought(ctx, flashSaleID, bought, ttl)
+}
+
+// WarmUpFlashSales 預熱所有進行中及 horizon 內即將開始的活動（啟動時與定時任務呼叫）
+func (s *FlashSaleService) WarmUpFlashSales(ctx context.Context, horizon time.Duration) error {
+	flashSales, err := s.flashSaleRepo.ListForWarmUp(ctx, time.Now().Add(horizon))
+	if err != nil {
+		return err
+	}
+
+	for i := range flashSales {
+		if err := s.WarmUpStock(ctx, &flashSales[i]); err != nil {
+			s.log.Error("failed to warm up flash sale stock",
+				zap.Int64("flash_sale_id", flashSales[i].ID),
+				zap.Error(err),
+			)
+		}
+	}
+	return nil
+}
+
 // ActivatePendingFlashSales 自動開啟已到時間的待開始活動
+// 開啟前先預熱 Redis 快取，預熱失敗的活動暫不開啟，待下次排程重試
 func (s *FlashSaleService) ActivatePendingFlashSales(ctx context.Context) error {
-	affected, err := s.flashSaleRepo.UpdatePendingToActive(ctx)
+	flashSales, err := s.flashSaleRepo.ListPendingDue(ctx)
 	if err != nil {
 		return err
 	}
-	if affected > 0 {
-		s.log.Info("activated flash sales", zap.Int64("count", affected))
+
+	var activated int
+	for i := range flashSales {
+		flashSale := &flashSales[i]
+
+		if err := s.WarmUpStock(ctx, flashSale); err != nil {
+			s.log.Error("refusing to activate flash sale, cache not primed",
+				zap.Int64("flash_sale_id", flashSale.ID),
+				zap.Error(err),
+			)
+			continue
+		}
+
+		ok, err := s.flashSaleRepo.UpdateStatus(ctx, flashSale.ID, model.FlashSaleStatusPending, model.FlashSaleStatusActive)
+		if err != nil {
+			return err
+		}
+		if ok {
+			s.invalidateFlashSale(ctx, flashSale.ID)
+			activated++
+		}
+	}
+
+	if activated > 0 {
+		s.log.Info("activated flash sales", zap.Int("count", activated))
 	}
 	return nil
 }
 
 // FinishExpiredFlashSales 自動結束已過期的進行中活動
 func (s *FlashSaleService) FinishExpiredFlashSales(ctx context.Context) error {
-	affected, err := s.flashSaleRepo.UpdateActiveToFinished(ctx)
+	finished, err := s.flashSaleRepo.UpdateActiveToFinished(ctx)
 	if err != nil {
 		return err
 	}
-	if affected > 0 {
-		s.log.Info("finished flash sales", zap.Int64("count", affected))
+	for _, id := range finished {
+		s.invalidateFlashSale(ctx, id)
+	}
+	if len(finished) > 0 {
+		s.log.Info("finished flash sales", zap.Int("count", len(finished)))
 	}
 	return nil
 }
@@ -0,0 +1,488 @@
+// 秒殺服務單元測試
+//
+// 以 cache.MemoryStockStore 與行程內替身注入快取依賴，不需要 Redis 與資料庫
+// 測試覆蓋：
+// - Rush: 准入成功寫入 Outbox 與憑證、重複搶購、超出限購、售罄、未開始、准入時狀態已變更
+// - Rush: 多規格活動的規格檢查與規格庫存、分片活動准入失敗歸還分片
+// - Rush: 跨活動限購超限不扣庫存、准入被拒時歸還預扣
+// - Rush: 中繼資料未載入時重新載入後准入
+// - 併發搶購不超賣
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Mag1cFall/magtrade/internal/cache"
+	"github.com/Mag1cFall/magtrade/internal/model"
+	"github.com/Mag1cFall/magtrade/internal/mq"
+	"github.com/Mag1cFall/magtrade/internal/pkg/utils"
+	"go.uber.org/zap"
+)
+
+// memoryMetas 行程內中繼資料快取，sales 視為資料庫內容，Refresh 時寫入庫存後端供准入讀取
+type memoryMetas struct {
+	mu    sync.Mutex
+	store *cache.MemoryStockStore
+	sales map[int64]*model.FlashSale
+}
+
+func (m *memoryMetas) Get(_ context.Context, flashSaleID int64, _ cache.FlashSaleLoader) (*model.FlashSale, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	flashSale, ok := m.sales[flashSaleID]
+	if !ok {
+		return nil, errors.New("flash sale not found")
+	}
+	cp := *flashSale
+	return &cp, nil
+}
+
+func (m *memoryMetas) Refresh(ctx context.Context, _ int64, _ cache.FlashSaleLoader) (*model.FlashSale, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, flashSale := range m.sales {
+		m.store.SetMeta(flashSale)
+	}
+	return nil, nil
+}
+
+func (m *memoryMetas) Invalidate(_ context.Context, flashSaleID int64) error {
+	m.store.DeleteMeta(flashSaleID)
+	return nil
+}
+
+type memoryFlags struct {
+	mu    sync.Mutex
+	flags map[int64]cache.SaleFlag
+}
+
+func (f *memoryFlags) Check(flashSaleID int64) cache.SaleFlag {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.flags[flashSaleID]
+}
+
+func (f *memoryFlags) Set(_ context.Context, flashSaleID int64, flag cache.SaleFlag) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.flags[flashSaleID] = flag
+	return nil
+}
+
+func (f *memoryFlags) Clear(_ context.Context, flashSaleID int64, flag cache.SaleFlag) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.flags[flashSaleID] == flag {
+		delete(f.flags, flashSaleID)
+	}
+	return nil
+}
+
+type memoryOutbox struct{}
+
+func (memoryOutbox) Register(context.Context, int64) error { return nil }
+
+type memoryTickets struct {
+	mu      sync.Mutex
+	records map[string]*cache.TicketRecord
+}
+
+func (t *memoryTickets) Record(_ context.Context, record *cache.TicketRecord) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.records[record.Ticket] = record
+}
+
+// memoryLimits 跨活動限購替身：exceeded 非空時一律超限，否則記錄暫扣、確認與歸還數量
+type memoryLimits struct {
+	mu        sync.Mutex
+	exceeded  *model.PurchaseLimitPolicy
+	reserved  int
+	confirmed int
+	released  int
+}
+
+func (l *memoryLimits) Reserve(_ context.Context, _ *model.FlashSale, _ int64, quantity int, ticket string) (*LimitReservation, *model.PurchaseLimitPolicy, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.exceeded != nil {
+		return nil, l.exceeded, nil
+	}
+	l.reserved += quantity
+	return &LimitReservation{Charges: []cache.LimitCharge{{Key: "limit"}}, Quantity: quantity, Ticket: ticket}, nil, nil
+}
+
+func (l *memoryLimits) Confirm(_ context.Context, reservation *LimitReservation) {
+	if reservation == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.confirmed += reservation.Quantity
+}
+
+func (l *memoryLimits) Release(_ context.Context, reservation *LimitReservation) {
+	if reservation == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.released += reservation.Quantity
+}
+
+func (l *memoryLimits) ReleaseOrder(_ context.Context, _ *model.FlashSale, order *model.Order) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.released += order.Quantity
+}
+
+type memoryExpiry struct {
+	mu      sync.Mutex
+	pending map[int64]time.Time
+}
+
+func (e *memoryExpiry) Schedule(_ context.Context, orderID int64, expiresAt time.Time) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.pending[orderID] = expiresAt
+	return nil
+}
+
+func (e *memoryExpiry) Claim(_ context.Context, now time.Time, _ time.Duration, limit int) ([]int64, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	var ids []int64
+	for id, at := range e.pending {
+		if len(ids) < limit && !at.After(now) {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+func (e *memoryExpiry) Remove(_ context.Context, orderIDs ...int64) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for _, id := range orderIDs {
+		delete(e.pending, id)
+	}
+	return nil
+}
+
+// testCacheDeps 以行程內實作組裝的快取依賴
+type testCacheDeps struct {
+	*CacheDeps
+	store   *cache.MemoryStockStore
+	metas   *memoryMetas
+	tickets *memoryTickets
+	limits  *memoryLimits
+	expiry  *memoryExpiry
+}
+
+func newTestCacheDeps() *testCacheDeps {
+	utils.GenerateID() // 預先初始化 ID 產生器，避免併發測試中重複初始化
+
+	store := cache.NewMemoryStockStore()
+	deps := &testCacheDeps{
+		store:   store,
+		metas:   &memoryMetas{store: store, sales: make(map[int64]*model.FlashSale)},
+		tickets: &memoryTickets{records: make(map[string]*cache.TicketRecord)},
+		limits:  &memoryLimits{},
+		expiry:  &memoryExpiry{pending: make(map[int64]time.Time)},
+	}
+	deps.CacheDeps = &CacheDeps{
+		Stock:      store,
+		StockCache: store,
+		Metas:      deps.metas,
+		Flags:      &memoryFlags{flags: make(map[int64]cache.SaleFlag)},
+		Outbox:     memoryOutbox{},
+		Tickets:    deps.tickets,
+		Limits:     deps.limits,
+		Expiry:     deps.expiry,
+	}
+	return deps
+}
+
+// addSale 載入進行中的活動：寫入中繼資料與庫存（對應預熱）
+func (d *testCacheDeps) addSale(t *testing.T, flashSale *model.FlashSale) {
+	t.Helper()
+	ctx := context.Background()
+
+	d.metas.sales[flashSale.ID] = flashSale
+	d.store.SetMeta(flashSale)
+	if err := d.store.SetStock(ctx, flashSale.ID, flashSale.TotalStock, 0); err != nil {
+		t.Fatal(err)
+	}
+	for _, item := range flashSale.Items {
+		if err := d.store.SetItemStock(ctx, flashSale.ID, item.ID, item.TotalStock, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// newTestFlashSaleService 建立只使用快取依賴的秒殺服務（搶購路徑不存取資料庫）
+func newTestFlashSaleService(deps *CacheDeps) *FlashSaleService {
+	return &FlashSaleService{
+		stock:      deps.Stock,
+		stockCache: deps.StockCache,
+		outbox:     deps.Outbox,
+		queue:      deps.Queue,
+		tickets:    deps.Tickets,
+		limits:     deps.Limits,
+		flags:      deps.Flags,
+		metas:      deps.Metas,
+		log:        zap.NewNop(),
+	}
+}
+
+func activeSale(id int64, stock int) *model.FlashSale {
+	now := time.Now()
+	return &model.FlashSale{
+		ID:           id,
+		TotalStock:   stock,
+		PerUserLimit: 1,
+		StartTime:    now.Add(-time.Minute),
+		EndTime:      now.Add(time.Hour),
+		Status:       model.FlashSaleStatusActive,
+	}
+}
+
+func TestFlashSaleService_Rush(t *testing.T) {
+	ctx := context.Background()
+	deps := newTestCacheDeps()
+	deps.addSale(t, activeSale(1, 2))
+	svc := newTestFlashSaleService(deps.CacheDeps)
+
+	resp, err := svc.Rush(ctx, 100, 1, &RushRequest{})
+	if err != nil {
+		t.Fatalf("Rush() error = %v", err)
+	}
+	if !resp.Success || resp.Ticket == "" {
+		t.Fatalf("Rush() = %+v, want success with ticket", resp)
+	}
+
+	if got, _ := deps.store.GetStock(ctx, 1); got != 1 {
+		t.Errorf("stock = %d, want 1", got)
+	}
+	outbox := deps.store.Outbox(1)
+	if len(outbox) != 1 {
+		t.Fatalf("outbox size = %d, want 1", len(outbox))
+	}
+	var msg mq.FlashSaleOrderMessage
+	if err := json.Unmarshal([]byte(outbox[0]), &msg); err != nil {
+		t.Fatal(err)
+	}
+	if msg.UserID != 100 || msg.FlashSaleID != 1 || msg.Quantity != 1 || msg.Ticket != resp.Ticket {
+		t.Errorf("outbox message = %+v", msg)
+	}
+	if record := deps.tickets.records[resp.Ticket]; record == nil || record.Status != cache.TicketStatusProcessing {
+		t.Errorf("ticket record = %+v, want processing", record)
+	}
+
+	// 同一使用者再次搶購
+	if _, err := svc.Rush(ctx, 100, 1, &RushRequest{}); !errors.Is(err, ErrAlreadyPurchased) {
+		t.Errorf("second Rush() error = %v, want ErrAlreadyPurchased", err)
+	}
+	// 超出每人限購
+	if _, err := svc.Rush(ctx, 200, 1, &RushRequest{Quantity: 2}); !errors.Is(err, ErrLimitExceeded) {
+		t.Errorf("Rush(quantity=2) error = %v, want ErrLimitExceeded", err)
+	}
+
+	if _, err := svc.Rush(ctx, 200, 1, &RushRequest{}); err != nil {
+		t.Fatalf("Rush() error = %v", err)
+	}
+	if _, err := svc.Rush(ctx, 300, 1, &RushRequest{}); !errors.Is(err, ErrStockInsufficient) {
+		t.Errorf("Rush() after sold out error = %v, want ErrStockInsufficient", err)
+	}
+	if got := len(deps.store.Outbox(1)); got != 2 {
+		t.Errorf("outbox size = %d, want 2", got)
+	}
+}
+
+func TestFlashSaleService_RushRejected(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name    string
+		prepare func(deps *testCacheDeps, flashSale *model.FlashSale)
+		wantErr error
+	}{
+		{
+			name: "not started",
+			prepare: func(_ *testCacheDeps, flashSale *model.FlashSale) {
+				flashSale.StartTime = time.Now().Add(time.Minute)
+			},
+			wantErr: ErrFlashSaleNotStarted,
+		},
+		{
+			name: "ended",
+			prepare: func(_ *testCacheDeps, flashSale *model.FlashSale) {
+				flashSale.EndTime = time.Now().Add(-time.Second)
+			},
+			wantErr: ErrFlashSaleEnded,
+		},
+		{
+			// 本地快取仍為進行中，准入讀取的中繼資料已暫停
+			name: "paused after cached",
+			prepare: func(deps *testCacheDeps, flashSale *model.FlashSale) {
+				paused := *flashSale
+				paused.Status = model.FlashSaleStatusPaused
+				deps.store.SetMeta(&paused)
+			},
+			wantErr: ErrFlashSaleNotActive,
+		},
+		{
+			name: "campaign limit exceeded",
+			prepare: func(deps *testCacheDeps, _ *model.FlashSale) {
+				deps.limits.exceeded = &model.PurchaseLimitPolicy{Name: "双十一每人 1 件"}
+			},
+			wantErr: ErrLimitExceeded,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			deps := newTestCacheDeps()
+			flashSale := activeSale(1, 5)
+			deps.addSale(t, flashSale)
+			tt.prepare(deps, flashSale)
+			svc := newTestFlashSaleService(deps.CacheDeps)
+
+			resp, err := svc.Rush(ctx, 100, 1, &RushRequest{})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Rush() error = %v, want %v", err, tt.wantErr)
+			}
+			if resp == nil || resp.Success {
+				t.Errorf("Rush() = %+v, want rejection", resp)
+			}
+			if got, _ := deps.store.GetStock(ctx, 1); got != 5 {
+				t.Errorf("stock = %d, want 5", got)
+			}
+			if got := len(deps.store.Outbox(1)); got != 0 {
+				t.Errorf("outbox size = %d, want 0", got)
+			}
+			if deps.limits.reserved != deps.limits.released || deps.limits.confirmed != 0 {
+				t.Errorf("limit reserved = %d released = %d confirmed = %d, want all released", deps.limits.reserved, deps.limits.released, deps.limits.confirmed)
+			}
+		})
+	}
+}
+
+func TestFlashSaleService_RushItems(t *testing.T) {
+	ctx := context.Background()
+	deps := newTestCacheDeps()
+	flashSale := activeSale(1, 3)
+	flashSale.Items = []model.FlashSaleItem{
+		{ID: 11, FlashSaleID: 1, TotalStock: 1},
+		{ID: 12, FlashSaleID: 1, TotalStock: 2},
+	}
+	deps.addSale(t, flashSale)
+	svc := newTestFlashSaleService(deps.CacheDeps)
+
+	if _, err := svc.Rush(ctx, 100, 1, &RushRequest{}); !errors.Is(err, ErrItemRequired) {
+		t.Errorf("Rush() without item error = %v, want ErrItemRequired", err)
+	}
+	if _, err := svc.Rush(ctx, 100, 1, &RushRequest{ItemID: 99}); !errors.Is(err, ErrItemNotFound) {
+		t.Errorf("Rush() unknown item error = %v, want ErrItemNotFound", err)
+	}
+	if _, err := svc.Rush(ctx, 100, 1, &RushRequest{ItemID: 11}); err != nil {
+		t.Fatalf("Rush() error = %v", err)
+	}
+	if _, err := svc.Rush(ctx, 200, 1, &RushRequest{ItemID: 11}); !errors.Is(err, ErrStockInsufficient) {
+		t.Errorf("Rush() sold out item error = %v, want ErrStockInsufficient", err)
+	}
+	if _, err := svc.Rush(ctx, 200, 1, &RushRequest{ItemID: 12}); err != nil {
+		t.Fatalf("Rush() other item error = %v", err)
+	}
+
+	if got := deps.store.ItemStock(1, 11); got != 0 {
+		t.Errorf("item 11 stock = %d, want 0", got)
+	}
+	if got := deps.store.ItemStock(1, 12); got != 1 {
+		t.Errorf("item 12 stock = %d, want 1", got)
+	}
+	if got, _ := deps.store.GetStock(ctx, 1); got != 1 {
+		t.Errorf("stock = %d, want 1", got)
+	}
+	if deps.limits.confirmed != 2 || deps.limits.reserved-deps.limits.released != 2 {
+		t.Errorf("limit reserved = %d released = %d confirmed = %d, want 2 confirmed", deps.limits.reserved, deps.limits.released, deps.limits.confirmed)
+	}
+}
+
+func TestFlashSaleService_RushSharded(t *testing.T) {
+	ctx := context.Background()
+	deps := newTestCacheDeps()
+	flashSale := activeSale(1, 2)
+	flashSale.StockShards = 4
+	deps.addSale(t, flashSale)
+	svc := newTestFlashSaleService(deps.CacheDeps)
+
+	if _, err := svc.Rush(ctx, 100, 1, &RushRequest{}); err != nil {
+		t.Fatalf("Rush() error = %v", err)
+	}
+	// 分片已扣減但准入腳本拒絕（重複搶購），分片庫存須歸還
+	if _, err := svc.Rush(ctx, 100, 1, &RushRequest{}); !errors.Is(err, ErrAlreadyPurchased) {
+		t.Errorf("second Rush() error = %v, want ErrAlreadyPurchased", err)
+	}
+	if got, _ := deps.store.GetStock(ctx, 1); got != 1 {
+		t.Errorf("stock = %d, want 1", got)
+	}
+}
+
+func TestFlashSaleService_RushReloadsMeta(t *testing.T) {
+	ctx := context.Background()
+	deps := newTestCacheDeps()
+	deps.addSale(t, activeSale(1, 1))
+	deps.store.DeleteMeta(1) // 中繼資料 Hash 過期
+	svc := newTestFlashSaleService(deps.CacheDeps)
+
+	if _, err := svc.Rush(ctx, 100, 1, &RushRequest{}); err != nil {
+		t.Fatalf("Rush() error = %v", err)
+	}
+	if got, _ := deps.store.GetStock(ctx, 1); got != 0 {
+		t.Errorf("stock = %d, want 0", got)
+	}
+}
+
+func TestFlashSaleService_RushConcurrent(t *testing.T) {
+	ctx := context.Background()
+	deps := newTestCacheDeps()
+	deps.addSale(t, activeSale(1, 20))
+	svc := newTestFlashSaleService(deps.CacheDeps)
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	success := 0
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func(userID int64) {
+			defer wg.Done()
+			// 每位使用者併發送出兩次請求，只能成功一次
+			for j := 0; j < 2; j++ {
+				if resp, err := svc.Rush(ctx, userID, 1, &RushRequest{}); err == nil && resp.Success {
+					mu.Lock()
+					success++
+					mu.Unlock()
+				}
+			}
+		}(int64(i + 1))
+	}
+	wg.Wait()
+
+	if success != 20 {
+		t.Errorf("successful rushes = %d, want 20", success)
+	}
+	if got, _ := deps.store.GetStock(ctx, 1); got != 0 {
+		t.Errorf("stock = %d, want 0", got)
+	}
+	if got := len(deps.store.Outbox(1)); got != 20 {
+		t.Errorf("outbox size = %d, want 20", got)
+	}
+}
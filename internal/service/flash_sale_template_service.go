@@ -0,0 +1,383 @@
+// 週期性秒殺活動範本服務
+//
+// 本檔案提供活動範本的建立、編輯、暫停/恢復，以及排程產生具體活動
+// 排程器每次在 [now, now+horizon] 內依 cron 規則計算開始時間，
+// 透過 FlashSaleService.Create 建立活動（沿用建立驗證並初始化 Redis 庫存）
+// 已產生的最後一場開始時間記錄於範本，搭配 (template_id, start_time) 唯一索引避免重複
+// 編輯範本只影響之後產生的活動，已產生的活動需個別編輯
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/Mag1cFall/magtrade/internal/model"
+	"github.com/Mag1cFall/magtrade/internal/mq"
+	"github.com/Mag1cFall/magtrade/internal/pkg/utils"
+	"github.com/Mag1cFall/magtrade/internal/pkg/validator"
+	"github.com/Mag1cFall/magtrade/internal/repository"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+var ErrFlashSaleTemplateStatusInvalid = errors.New("flash sale template status does not allow this operation")
+
+// templateSpacingSamples 檢查相鄰兩場間隔時取樣的場次數
+const templateSpacingSamples = 64
+
+// FlashSaleTemplateService 活動範本服務
+type FlashSaleTemplateService struct {
+	templateRepo     *repository.FlashSaleTemplateRepository
+	productRepo      *repository.ProductRepository
+	flashSaleService *FlashSaleService
+	log              *zap.Logger
+}
+
+func NewFlashSaleTemplateService(deps *CacheDeps, producer *mq.Producer, log *zap.Logger) *FlashSaleTemplateService {
+	return &FlashSaleTemplateService{
+		templateRepo:     repository.NewFlashSaleTemplateRepository(),
+		productRepo:      repository.NewProductRepository(),
+		flashSaleService: NewFlashSaleService(deps, nil, producer, log),
+		log:              log,
+	}
+}
+
+// CreateFlashSaleTemplateRequest 建立活動範本請求
+type CreateFlashSaleTemplateRequest struct {
+	Name            string  `json:"name" binding:"required,max=100"`
+	ProductID       int64   `json:"product_id" binding:"required"`
+	Recurrence      string  `json:"recurrence" binding:"required"` // cron 表達式，如 "0 10,20 * * *"
+	Timezone        string  `json:"timezone"`                      // 預設 Asia/Shanghai
+	DurationMinutes int     `json:"duration_minutes" binding:"required,gt=0"`
+	FlashPrice      float64 `json:"flash_price" binding:"required,gt=0"`
+	TotalStock      int     `json:"total_stock" binding:"required,gt=0"`
+	PerUserLimit    int     `json:"per_user_limit" binding:"omitempty,gt=0"`
+}
+
+// UpdateFlashSaleTemplateRequest 編輯活動範本請求（未提供的欄位不變）
+type UpdateFlashSaleTemplateRequest struct {
+	Name            *string  `json:"name" binding:"omitempty,max=100"`
+	Recurrence      *string  `json:"recurrence"`
+	Timezone        *string  `json:"timezone"`
+	DurationMinutes *int     `json:"duration_minutes" binding:"omitempty,gt=0"`
+	FlashPrice      *float64 `json:"flash_price" binding:"omitempty,gt=0"`
+	TotalStock      *int     `json:"total_stock" binding:"omitempty,gt=0"`
+	PerUserLimit    *int     `json:"per_user_limit" binding:"omitempty,gt=0"`
+}
+
+// FlashSaleTemplateListResponse 範本列表回應
+type FlashSaleTemplateListResponse struct {
+	Templates []model.FlashSaleTemplate `json:"templates"`
+	Total     int64                     `json:"total"`
+	Page      int                       `json:"page"`
+	PageSize  int                       `json:"page_size"`
+}
+
+// Create 建立範本，建立後由排程器在下一輪產生活動
+func (s *FlashSaleTemplateService) Create(ctx context.Context, req *CreateFlashSaleTemplateRequest) (*model.FlashSaleTemplate, error) {
+	perUserLimit := req.PerUserLimit
+	if perUserLimit <= 0 {
+		perUserLimit = 1
+	}
+
+	timezone := req.Timezone
+	if timezone == "" {
+		timezone = model.DefaultTemplateTimezone
+	}
+
+	template := &model.FlashSaleTemplate{
+		Name:            req.Name,
+		ProductID:       req.ProductID,
+		Recurrence:      req.Recurrence,
+		Timezone:        timezone,
+		DurationMinutes: req.DurationMinutes,
+		FlashPrice:      req.FlashPrice,
+		TotalStock:      req.TotalStock,
+		PerUserLimit:    perUserLimit,
+		Status:          model.FlashSaleTemplateStatusActive,
+	}
+
+	if err := s.validate(ctx, template); err != nil {
+		return nil, err
+	}
+
+	if err := s.templateRepo.Create(ctx, template); err != nil {
+		return nil, err
+	}
+
+	s.log.Info("flash sale template created",
+		zap.Int64("template_id", template.ID),
+		zap.String("recurrence", template.Recurrence),
+	)
+	return template, nil
+}
+
+// GetByID 查詢範本
+func (s *FlashSaleTemplateService) GetByID(ctx context.Context, id int64) (*model.FlashSaleTemplate, error) {
+	return s.templateRepo.GetByID(ctx, id)
+}
+
+// List 分頁查詢範本
+func (s *FlashSaleTemplateService) List(ctx context.Context, page, pageSize int, status *model.FlashSaleTemplateStatus) (*FlashSaleTemplateListResponse, error) {
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 20
+	}
+
+	templates, total, err := s.templateRepo.List(ctx, page, pageSize, status)
+	if err != nil {
+		return nil, err
+	}
+
+	return &FlashSaleTemplateListResponse{
+		Templates: templates,
+		Total:     total,
+		Page:      page,
+		PageSize:  pageSize,
+	}, nil
+}
+
+// Update 編輯範本（僅影響之後產生的活動）
+func (s *FlashSaleTemplateService) Update(ctx context.Context, id int64, req *UpdateFlashSaleTemplateRequest) (*model.FlashSaleTemplate, error) {
+	template, err := s.templateRepo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	fields := make(map[string]interface{})
+	if req.Name != nil {
+		template.Name = *req.Name
+		fields["name"] = *req.Name
+	}
+	if req.Recurrence != nil {
+		template.Recurrence = *req.Recurrence
+		fields["recurrence"] = *req.Recurrence
+	}
+	if req.Timezone != nil {
+		template.Timezone = *req.Timezone
+		fields["timezone"] = *req.Timezone
+	}
+	if req.DurationMinutes != nil {
+		template.DurationMinutes = *req.DurationMinutes
+		fields["duration_minutes"] = *req.DurationMinutes
+	}
+	if req.FlashPrice != nil {
+		template.FlashPrice = *req.FlashPrice
+		fields["flash_price"] = *req.FlashPrice
+	}
+	if req.TotalStock != nil {
+		template.TotalStock = *req.TotalStock
+		fields["total_stock"] = *req.TotalStock
+	}
+	if req.PerUserLimit != nil {
+		template.PerUserLimit = *req.PerUserLimit
+		fields["per_user_limit"] = *req.PerUserLimit
+	}
+
+	if len(fields) == 0 {
+		return template, nil
+	}
+
+	if err := s.validate(ctx, template); err != nil {
+		return nil, err
+	}
+
+	if err := s.templateRepo.UpdateFields(ctx, id, fields); err != nil {
+		return nil, err
+	}
+
+	s.log.Info("flash sale template updated", zap.Int64("template_id", id), zap.Int("fields", len(fields)))
+	return s.templateRepo.GetByID(ctx, id)
+}
+
+// Pause 暫停範本，已產生的活動不受影響
+func (s *FlashSaleTemplateService) Pause(ctx context.Context, id int64) (*model.FlashSaleTemplate, error) {
+	return s.transition(ctx, id, model.FlashSaleTemplateStatusActive, model.FlashSaleTemplateStatusPaused)
+}
+
+// Resume 恢復範本，暫停期間錯過的場次不補產生
+func (s *FlashSaleTemplateService) Resume(ctx context.Context, id int64) (*model.FlashSaleTemplate, error) {
+	return s.transition(ctx, id, model.FlashSaleTemplateStatusPaused, model.FlashSaleTemplateStatusActive)
+}
+
+func (s *FlashSaleTemplateService) transition(ctx context.Context, id int64, from, to model.FlashSaleTemplateStatus) (*model.FlashSaleTemplate, error) {
+	if _, err := s.templateRepo.GetByID(ctx, id); err != nil {
+		return nil, err
+	}
+
+	ok, err := s.templateRepo.UpdateStatus(ctx, id, from, to)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrFlashSaleTemplateStatusInvalid
+	}
+
+	s.log.Info("flash sale template status changed",
+		zap.Int64("template_id", id),
+		zap.Int8("from", int8(from)),
+		zap.Int8("to", int8(to)),
+	)
+	return s.templateRepo.GetByID(ctx, id)
+}
+
+// MaterializeDue 為所有啟用範本產生 horizon 內尚未產生的活動，返回新建活動數
+func (s *FlashSaleTemplateService) MaterializeDue(ctx context.Context, horizon time.Duration) (int, error) {
+	templates, err := s.templateRepo.ListActive(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	created := 0
+	for i := range templates {
+		n, err := s.materialize(ctx, &templates[i], horizon)
+		created += n
+		if err != nil {
+			s.log.Error("failed to materialize flash sale template",
+				zap.Int64("template_id", templates[i].ID),
+				zap.Error(err),
+			)
+		}
+	}
+
+	if created > 0 {
+		s.log.Info("materialized flash sales from templates", zap.Int("count", created))
+	}
+	return created, nil
+}
+
+// materialize 產生單一範本在 horizon 內的場次
+// 驗證失敗（如商品下架、時間重疊）的場次記錄日誌後跳過，其他錯誤中止並於下一輪重試
+func (s *FlashSaleTemplateService) materialize(ctx context.Context, template *model.FlashSaleTemplate, horizon time.Duration) (int, error) {
+	schedule, err := utils.ParseCron(template.Recurrence)
+	if err != nil {
+		return 0, err
+	}
+	loc, err := template.Location()
+	if err != nil {
+		return 0, err
+	}
+
+	now := time.Now()
+	from := now
+	if template.LastScheduledAt != nil && template.LastScheduledAt.After(now) {
+		from = *template.LastScheduledAt
+	}
+	until := now.Add(horizon)
+
+	created := 0
+	for start := schedule.Next(from.In(loc)); !start.IsZero() && !start.After(until); start = schedule.Next(start) {
+		req := &CreateFlashSaleRequest{
+			ProductID:    template.ProductID,
+			FlashPrice:   template.FlashPrice,
+			TotalStock:   template.TotalStock,
+			PerUserLimit: template.PerUserLimit,
+			StartTime:    start.Format(time.RFC3339),
+			EndTime:      start.Add(template.Duration()).Format(time.RFC3339),
+			TemplateID:   &template.ID,
+		}
+
+		flashSale, err := s.flashSaleService.Create(ctx, req)
+		var validationErr *ValidationFailedError
+		switch {
+		case err == nil:
+			created++
+			s.log.Info("flash sale materialized from template",
+				zap.Int64("template_id", template.ID),
+				zap.Int64("flash_sale_id", flashSale.ID),
+				zap.Time("start_time", start),
+			)
+		case errors.Is(err, gorm.ErrDuplicatedKey):
+			// 其他實例已產生此場次
+		case errors.As(err, &validationErr):
+			s.log.Warn("skipped template occurrence that failed validation",
+				zap.Int64("template_id", template.ID),
+				zap.Time("start_time", start),
+				zap.Error(err),
+			)
+		default:
+			return created, err
+		}
+
+		if err := s.templateRepo.SetLastScheduled(ctx, template.ID, start); err != nil {
+			return created, err
+		}
+	}
+
+	return created, nil
+}
+
+// validate 驗證範本設定：cron 與時區可解析、商品存在且已上架、秒殺價低於原價、相鄰場次不重疊
+func (s *FlashSaleTemplateService) validate(ctx context.Context, template *model.FlashSaleTemplate) error {
+	var errs []*validator.ValidationError
+
+	schedule, err := utils.ParseCron(template.Recurrence)
+	if err != nil {
+		errs = append(errs, &validator.ValidationError{Field: "recurrence", Message: "周期规则格式错误，请使用 5 段 cron 表达式"})
+	}
+	loc, err := template.Location()
+	if err != nil {
+		errs = append(errs, &validator.ValidationError{Field: "timezone", Message: "无效的时区"})
+	}
+
+	if schedule != nil && loc != nil {
+		if gap, ok := minSpacing(schedule, time.Now().In(loc)); !ok {
+			errs = append(errs, &validator.ValidationError{Field: "recurrence", Message: "周期规则不会产生任何场次"})
+		} else if template.Duration() > gap {
+			errs = append(errs, &validator.ValidationError{
+				Field:   "duration_minutes",
+				Message: fmt.Sprintf("持续时间不能超过相邻两场的最短间隔（%d分钟）", int(gap/time.Minute)),
+			})
+		}
+	}
+
+	product, err := s.productRepo.GetByID(ctx, template.ProductID)
+	if err != nil {
+		if !errors.Is(err, repository.ErrProductNotFound) {
+			return err
+		}
+		errs = append(errs, &validator.ValidationError{Field: "product_id", Message: "商品不存在"})
+	} else {
+		if product.Status != model.ProductStatusOnShelf {
+			errs = append(errs, &validator.ValidationError{Field: "product_id", Message: "商品未上架"})
+		}
+		if fieldErr := validator.ValidateFlashPrice(template.FlashPrice, product.OriginalPrice); fieldErr != nil {
+			errs = append(errs, fieldErr)
+		}
+	}
+
+	if len(errs) > 0 {
+		return &ValidationFailedError{Errors: errs}
+	}
+	return nil
+}
+
+// minSpacing 取樣接下來的場次，返回相鄰兩場的最短間隔；規則不產生場次時 ok 為 false
+func minSpacing(schedule *utils.CronSchedule, from time.Time) (time.Duration, bool) {
+	prev := schedule.Next(from)
+	if prev.IsZero() {
+		return 0, false
+	}
+
+	gap := time.Duration(0)
+	for i := 0; i < templateSpacingSamples; i++ {
+		next := schedule.Next(prev)
+		if next.IsZero() {
+			break
+		}
+		if d := next.Sub(prev); gap == 0 || d < gap {
+			gap = d
+		}
+		prev = next
+	}
+
+	if gap == 0 {
+		gap = time.Duration(math.MaxInt64) // 僅一場，無間隔限制
+	}
+	return gap, true
+}
@@ -0,0 +1,157 @@
+// 秒殺活動建立/編輯的業務規則驗證
+//
+// 規則：商品存在且已上架、秒殺價低於商品原價、開始時間在未來、
+// 同商品不得有時間重疊的待開始/進行中/暫停活動
+// 所有違規以欄位錯誤收集後一次返回，供 dry-run 預覽或 response.ValidationFailed 輸出
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Mag1cFall/magtrade/internal/model"
+	"github.com/Mag1cFall/magtrade/internal/pkg/validator"
+	"github.com/Mag1cFall/magtrade/internal/repository"
+)
+
+// ValidationFailedError 業務規則驗證失敗，攜帶全部欄位錯誤
+type ValidationFailedError struct {
+	Errors []*validator.ValidationError
+}
+
+func (e *ValidationFailedError) Error() string {
+	messages := make([]string, 0, len(e.Errors))
+	for _, fieldErr := range e.Errors {
+		messages = append(messages, fieldErr.Field+": "+fieldErr.Message)
+	}
+	return "validation failed: " + strings.Join(messages, "; ")
+}
+
+// ValidateFlashSaleResponse dry-run 驗證結果
+type ValidateFlashSaleResponse struct {
+	Valid  bool                         `json:"valid"`
+	Errors []*validator.ValidationError `json:"errors"`
+}
+
+// ValidateCreate 驗證建立請求，返回全部欄位錯誤；error 僅表示查詢失敗
+func (s *FlashSaleService) ValidateCreate(ctx context.Context, req *CreateFlashSaleRequest) ([]*validator.ValidationError, error) {
+	errs := make([]*validator.ValidationError, 0)
+
+	startTime, startErr := time.Parse(time.RFC3339, req.StartTime)
+	if startErr != nil {
+		errs = append(errs, &validator.ValidationError{Field: "start_time", Message: "开始时间格式错误，请使用 RFC3339"})
+	}
+	endTime, endErr := time.Parse(time.RFC3339, req.EndTime)
+	if endErr != nil {
+		errs = append(errs, &validator.ValidationError{Field: "end_time", Message: "结束时间格式错误，请使用 RFC3339"})
+	}
+	timeValid := startErr == nil && endErr == nil
+	if timeValid {
+		timeErrs := validator.ValidateFlashSaleTime(startTime, endTime, time.Now())
+		errs = append(errs, timeErrs...)
+		timeValid = len(timeErrs) == 0
+	}
+
+	if req.SaleType == model.FlashSaleTypeRaffle && (len(req.Items) > 0 || req.QueueEnabled) {
+		errs = append(errs, &validator.ValidationError{Field: "sale_type", Message: "抽签活动不支持多规格或排队模式"})
+	}
+	if req.StockShards > 1 && (len(req.Items) > 0 || req.SaleType == model.FlashSaleTypeRaffle) {
+		errs = append(errs, &validator.ValidationError{Field: "stock_shards", Message: "库存分片仅支持单规格抢购活动"})
+	}
+	if len(req.Items) == 0 && (req.FlashPrice <= 0 || req.TotalStock <= 0) {
+		errs = append(errs, &validator.ValidationError{Field: "flash_price", Message: "未提供规格时秒杀价与总库存为必填"})
+	}
+
+	product, err := s.productRepo.GetByID(ctx, req.ProductID)
+	if err != nil {
+		if !errors.Is(err, repository.ErrProductNotFound) {
+			return nil, err
+		}
+		errs = append(errs, &validator.ValidationError{Field: "product_id", Message: "商品不存在"})
+	} else {
+		if product.Status != model.ProductStatusOnShelf {
+			errs = append(errs, &validator.ValidationError{Field: "product_id", Message: "商品未上架"})
+		}
+		errs = append(errs, priceErrors(req.FlashPrice, req.Items, product.OriginalPrice)...)
+	}
+
+	if timeValid {
+		overlapErrs, err := s.overlapErrors(ctx, req.ProductID, startTime, endTime, 0)
+		if err != nil {
+			return nil, err
+		}
+		errs = append(errs, overlapErrs...)
+	}
+
+	return errs, nil
+}
+
+// validateUpdate 驗證編輯後的價格與時間區間
+func (s *FlashSaleService) validateUpdate(ctx context.Context, flashSale *model.FlashSale, flashPrice *float64, start, end time.Time, timeChanged bool) ([]*validator.ValidationError, error) {
+	errs := make([]*validator.ValidationError, 0)
+
+	if timeChanged {
+		timeErrs := validator.ValidateFlashSaleTime(start, end, time.Now())
+		if len(timeErrs) > 0 {
+			return timeErrs, nil
+		}
+		overlapErrs, err := s.overlapErrors(ctx, flashSale.ProductID, start, end, flashSale.ID)
+		if err != nil {
+			return nil, err
+		}
+		errs = append(errs, overlapErrs...)
+	}
+
+	if flashPrice != nil {
+		product, err := s.productRepo.GetByID(ctx, flashSale.ProductID)
+		if err != nil {
+			return nil, err
+		}
+		if fieldErr := validator.ValidateFlashPrice(*flashPrice, product.OriginalPrice); fieldErr != nil {
+			errs = append(errs, fieldErr)
+		}
+	}
+
+	return errs, nil
+}
+
+// priceErrors 檢查秒殺價（或各規格秒殺價）低於商品原價
+func priceErrors(flashPrice float64, items []CreateFlashSaleItemRequest, originalPrice float64) []*validator.ValidationError {
+	var errs []*validator.ValidationError
+	if len(items) == 0 {
+		if flashPrice > 0 {
+			if fieldErr := validator.ValidateFlashPrice(flashPrice, originalPrice); fieldErr != nil {
+				errs = append(errs, fieldErr)
+			}
+		}
+		return errs
+	}
+	for i, item := range items {
+		if fieldErr := validator.ValidateFlashPrice(item.FlashPrice, originalPrice); fieldErr != nil {
+			fieldErr.Field = fmt.Sprintf("items[%d].flash_price", i)
+			errs = append(errs, fieldErr)
+		}
+	}
+	return errs
+}
+
+// overlapErrors 每個時間重疊的活動產生一筆錯誤，方便管理員定位衝突
+func (s *FlashSaleService) overlapErrors(ctx context.Context, productID int64, start, end time.Time, excludeID int64) ([]*validator.ValidationError, error) {
+	overlapping, err := s.flashSaleRepo.ListOverlapping(ctx, productID, start, end, excludeID)
+	if err != nil {
+		return nil, err
+	}
+
+	errs := make([]*validator.ValidationError, 0, len(overlapping))
+	for _, other := range overlapping {
+		errs = append(errs, &validator.ValidationError{
+			Field: "start_time",
+			Message: fmt.Sprintf("该商品已有时间重叠的秒杀活动（ID: %d，%s ~ %s）",
+				other.ID, other.StartTime.Format(time.RFC3339), other.EndTime.Format(time.RFC3339)),
+		})
+	}
+	return errs, nil
+}
@@ -1,12 +1,16 @@
 // 訂單業務服務
 //
 // 本檔案處理訂單相關業務邏輯
-// 包含：從 Kafka 消息建立訂單、付款、取消、過期訂單處理
-// 取消訂單會恢復 Redis 和 DB 庫存
+// 包含：從 Kafka 消息建立訂單（活動已取消時建單後立即取消）、訂單詳情（含狀態歷史）、取消、過期訂單處理、活動取消時取消待付款訂單（已付款訂單的退款見 payment_refund.go）
+// 訂單依活動付款時限設定截止時間並加入 Redis 到期佇列，到期即取消；DB 掃描作為佇列遺失時的兜底
+// 狀態變更一律經由 OrderRepository.Transition（狀態機檢查 + 變更歷史）
+// 取消訂單在狀態轉換交易內恢復 DB 庫存並標記待歸還，提交後再歸還 Redis 庫存與跨活動限購計數器；
+// 提交後歸還失敗或實例崩潰時，由 RestorePendingStock 依標記補做
 package service
 
 import (
 	"context"
+	"errors"
 	"time"
 
 	"github.com/Mag1cFall/magtrade/internal/cache"
@@ -21,16 +25,20 @@ import (
 type OrderService struct {
 	orderRepo     *repository.OrderRepository
 	flashSaleRepo *repository.FlashSaleRepository
-	stockService  *cache.StockService
+	stock         cache.StockStore
+	expiry        OrderExpiryScheduler
+	limits        LimitReserver
 	producer      *mq.Producer
 	log           *zap.Logger
 }
 
-func NewOrderService(producer *mq.Producer, log *zap.Logger) *OrderService {
+func NewOrderService(deps *CacheDeps, producer *mq.Producer, log *zap.Logger) *OrderService {
 	return &OrderService{
 		orderRepo:     repository.NewOrderRepository(),
 		flashSaleRepo: repository.NewFlashSaleRepository(),
-		stockService:  cache.NewStockService(),
+		stock:         deps.Stock,
+		expiry:        deps.Expiry,
+		limits:        deps.Limits,
 		producer:      producer,
 		log:           log,
 	}
@@ -50,6 +58,9 @@ func (s *OrderService) CreateFromMessage(ctx context.Context, msg *mq.FlashSaleO
 	if err != nil {
 		return nil, err
 	}
+	if flashSale.Status == model.FlashSaleStatusCancelled {
+		return nil, s.discardForCancelledSale(ctx, flashSale, msg)
+	}
 
 	// 冪等性檢查：防止重複建立
 	existing, err := s.orderRepo.GetByUserAndFlashSale(ctx, msg.UserID, msg.FlashSaleID)
@@ -64,6 +75,33 @@ func (s *OrderService) CreateFromMessage(ctx context.Context, msg *mq.FlashSaleO
 		return existing, nil
 	}
 
+	order, err := newOrderFromMessage(flashSale, msg)
+	if err != nil {
+		return nil, err
+	}
+
+	// 訂單與 DB 庫存扣減同一交易提交，失敗時訊息重試
+	if err := s.orderRepo.CreateWithStock(ctx, order); err != nil {
+		return nil, err
+	}
+
+	// 加入失敗時由 DB 掃描兜底取消
+	if err := s.expiry.Schedule(ctx, order.ID, *order.ExpiresAt); err != nil {
+		s.log.Error("failed to schedule order expiry", zap.String("order_no", order.OrderNo), zap.Error(err))
+	}
+
+	s.log.Info("order created",
+		zap.String("order_no", order.OrderNo),
+		zap.Int64("user_id", msg.UserID),
+		zap.Int64("flash_sale_id", msg.FlashSaleID),
+	)
+
+	return order, nil
+}
+
+// newOrderFromMessage 依准入訊息建立待付款訂單（尚未寫入），多規格活動以規格價格計價
+func newOrderFromMessage(flashSale *model.FlashSale, msg *mq.FlashSaleOrderMessage) (*model.Order, error) {
+	expiresAt := time.Now().Add(flashSale.PaymentWindow())
 	order := &model.Order{
 		OrderNo:     utils.GenerateOrderNo(),
 		UserID:      msg.UserID,
@@ -71,27 +109,65 @@ func (s *OrderService) CreateFromMessage(ctx context.Context, msg *mq.FlashSaleO
 		Amount:      flashSale.FlashPrice * float64(msg.Quantity),
 		Quantity:    msg.Quantity,
 		Status:      model.OrderStatusPending,
+		ExpiresAt:   &expiresAt,
 	}
 
-	if err := s.orderRepo.Create(ctx, order); err != nil {
-		return nil, err
+	if msg.ItemID > 0 {
+		item := flashSale.FindItem(msg.ItemID)
+		if item == nil {
+			return nil, repository.ErrFlashSaleNotFound
+		}
+		itemID := item.ID
+		order.ItemID = &itemID
+		order.Amount = item.FlashPrice * float64(msg.Quantity)
 	}
+	return order, nil
+}
 
-	// 同步扣減 DB 庫存
-	if err := s.flashSaleRepo.DecrementStock(ctx, msg.FlashSaleID, msg.Quantity); err != nil {
-		s.log.Error("failed to decrement db stock", zap.Error(err))
+// discardForCancelledSale 處理活動取消後才到達的准入訊息（Outbox 或 Kafka 在途），返回 ErrFlashSaleCancelled
+// 照常建單後立即以活動取消原因取消，經由取消流程恢復 DB 庫存並歸還 Redis 庫存與限購計數器，使用者不會拿到可付款的訂單
+// 活動取消後已建立過訂單（訊息重送）時不再建單，避免重複歸還；取消前留下的待付款訂單一併取消
+// 活動取消後不可再編輯，UpdatedAt 即為取消時間
+func (s *OrderService) discardForCancelledSale(ctx context.Context, flashSale *model.FlashSale, msg *mq.FlashSaleOrderMessage) error {
+	order, err := s.orderRepo.GetByUserAndFlashSale(ctx, msg.UserID, msg.FlashSaleID)
+	if err != nil {
+		return err
 	}
 
-	s.log.Info("order created",
+	if order == nil {
+		discarded, err := s.orderRepo.GetCreatedSince(ctx, msg.UserID, msg.FlashSaleID, flashSale.UpdatedAt)
+		if err != nil {
+			return err
+		}
+		if discarded != nil {
+			return ErrFlashSaleCancelled
+		}
+
+		order, err = newOrderFromMessage(flashSale, msg)
+		if err != nil {
+			return err
+		}
+		if err := s.orderRepo.CreateWithStock(ctx, order); err != nil {
+			return err
+		}
+	}
+
+	// 已付款訂單由活動取消的重試退款
+	if order.Status == model.OrderStatusPending {
+		if err := s.cancelForFlashSale(ctx, order); err != nil {
+			return err
+		}
+	}
+
+	s.log.Warn("order message arrived after flash sale cancellation",
 		zap.String("order_no", order.OrderNo),
 		zap.Int64("user_id", msg.UserID),
 		zap.Int64("flash_sale_id", msg.FlashSaleID),
 	)
-
-	return order, nil
+	return ErrFlashSaleCancelled
 }
 
-// GetByOrderNo 根據訂單號查詢（需驗證使用者）
+// GetByOrderNo 根據訂單號查詢（需驗證使用者），附帶狀態變更歷史
 func (s *OrderService) GetByOrderNo(ctx context.Context, userID int64, orderNo string) (*model.Order, error) {
 	order, err := s.orderRepo.GetByOrderNo(ctx, orderNo)
 	if err != nil {
@@ -102,6 +178,12 @@ func (s *OrderService) GetByOrderNo(ctx context.Context, userID int64, orderNo s
 		return nil, repository.ErrOrderNotFound
 	}
 
+	history, err := s.orderRepo.ListStatusHistory(ctx, order.ID)
+	if err != nil {
+		return nil, err
+	}
+	order.StatusHistory = history
+
 	return order, nil
 }
 
@@ -127,8 +209,8 @@ func (s *OrderService) ListByUser(ctx context.Context, userID int64, page, pageS
 	}, nil
 }
 
-// Pay 支付訂單（模擬支付）
-func (s *OrderService) Pay(ctx context.Context, userID int64, orderNo string) (*model.Order, error) {
+// Cancel 取消訂單（恢復庫存）
+func (s *OrderService) Cancel(ctx context.Context, userID int64, orderNo string) (*model.Order, error) {
 	order, err := s.orderRepo.GetByOrderNo(ctx, orderNo)
 	if err != nil {
 		return nil, err
@@ -138,89 +220,255 @@ func (s *OrderService) Pay(ctx context.Context, userID int64, orderNo string) (*
 		return nil, repository.ErrOrderNotFound
 	}
 
-	if !order.CanPay() {
-		return nil, ErrOrderStatusInvalid
-	}
-
-	if err := s.orderRepo.Pay(ctx, order.ID); err != nil {
+	err = s.orderRepo.Transition(ctx, order, model.OrderStatusCancelled, model.OrderTrigger{
+		Actor:   model.OrderActorUser,
+		ActorID: &userID,
+		Reason:  "用户取消",
+	})
+	if err != nil {
 		return nil, err
 	}
 
-	s.notifyOrderStatusChange(ctx, order, model.OrderStatusPending, model.OrderStatusPaid)
+	s.restoreCancelledStock(ctx, order)
+	s.unscheduleExpiry(ctx, order)
 
-	order.Status = model.OrderStatusPaid
-	now := time.Now()
-	order.PaidAt = &now
+	s.notifyOrderStatusChange(ctx, order, model.OrderStatusPending, model.OrderStatusCancelled)
 
 	return order, nil
 }
 
-// Cancel 取消訂單（恢復庫存）
-func (s *OrderService) Cancel(ctx context.Context, userID int64, orderNo string) (*model.Order, error) {
-	order, err := s.orderRepo.GetByOrderNo(ctx, orderNo)
+// orderExpiryLease 到期佇列領取租約，處理中斷的訂單於租約到期後重新領取
+const orderExpiryLease = time.Minute
+
+// ProcessExpiryQueue 領取到期佇列中已到期的訂單逐筆取消（定時任務每秒呼叫）
+// 返回本次領取的數量，等於 limit 時呼叫方應繼續領取
+func (s *OrderService) ProcessExpiryQueue(ctx context.Context, limit int) (int, error) {
+	now := time.Now()
+	ids, err := s.expiry.Claim(ctx, now, orderExpiryLease, limit)
 	if err != nil {
-		return nil, err
+		return 0, err
 	}
 
-	if order.UserID != userID {
-		return nil, repository.ErrOrderNotFound
+	done := make([]int64, 0, len(ids))
+	for _, id := range ids {
+		order, err := s.orderRepo.GetByID(ctx, id)
+		if errors.Is(err, repository.ErrOrderNotFound) {
+			done = append(done, id)
+			continue
+		}
+		if err != nil {
+			s.log.Error("failed to load expiring order", zap.Int64("order_id", id), zap.Error(err))
+			continue // 租約到期後重試
+		}
+
+		if order.Status != model.OrderStatusPending {
+			done = append(done, id) // 已付款或已取消
+			continue
+		}
+
+		if !order.IsExpired(now) {
+			// 佇列分數與截止時間不一致（如舊資料無截止時間），依 DB 重新排程
+			if order.ExpiresAt != nil {
+				if err := s.expiry.Schedule(ctx, order.ID, *order.ExpiresAt); err != nil {
+					s.log.Error("failed to reschedule order expiry", zap.String("order_no", order.OrderNo), zap.Error(err))
+				}
+			} else {
+				done = append(done, id)
+			}
+			continue
+		}
+
+		if err := s.cancelExpired(ctx, order); err != nil && !errors.Is(err, ErrOrderStatusInvalid) {
+			s.log.Error("failed to cancel expired order", zap.String("order_no", order.OrderNo), zap.Error(err))
+			continue
+		}
+		done = append(done, id)
 	}
 
-	if !order.CanCancel() {
-		return nil, ErrOrderStatusInvalid
+	if err := s.expiry.Remove(ctx, done...); err != nil {
+		s.log.Error("failed to remove orders from expiry queue", zap.Error(err))
 	}
 
-	if err := s.orderRepo.Cancel(ctx, order.ID); err != nil {
-		return nil, err
+	return len(ids), nil
+}
+
+// expiredOrderTrigger 逾時未付款取消的觸發來源
+var expiredOrderTrigger = model.OrderTrigger{
+	Actor:  model.OrderActorSystem,
+	Reason: "支付超时",
+}
+
+// CancelExpiredOrders 以 DB 掃描取消已過付款截止時間的訂單（到期佇列的兜底，定時任務呼叫）
+// 訂單在領取的同一交易內取消並恢復 DB 庫存，多實例並行掃描或與到期佇列同時處理時，每筆訂單只恢復一次庫存
+// 返回本次取消的數量，等於 limit 時呼叫方應繼續掃描
+func (s *OrderService) CancelExpiredOrders(ctx context.Context, limit int) (int, error) {
+	orders, err := s.orderRepo.ClaimExpiredPending(ctx, time.Now(), limit, expiredOrderTrigger)
+	if err != nil {
+		return 0, err
+	}
+
+	for i := range orders {
+		order := &orders[i]
+
+		s.restoreCancelledStock(ctx, order)
+		s.unscheduleExpiry(ctx, order)
+
+		s.notifyOrderStatusChange(ctx, order, model.OrderStatusPending, model.OrderStatusCancelled)
 	}
 
-	// 恢復 Redis 庫存
-	if err := s.stockService.RestoreStock(ctx, order.FlashSaleID, userID, order.Quantity); err != nil {
-		s.log.Error("failed to restore redis stock", zap.Error(err))
+	if len(orders) > 0 {
+		s.log.Info("cancelled expired orders missed by expiry queue", zap.Int("count", len(orders)))
 	}
 
-	// 恢復 DB 庫存
-	if err := s.flashSaleRepo.IncrementStock(ctx, order.FlashSaleID, order.Quantity); err != nil {
-		s.log.Error("failed to restore db stock", zap.Error(err))
+	return len(orders), nil
+}
+
+// cancelExpired 將逾時未付款的訂單轉換為已取消並恢復庫存
+// 轉換以狀態為條件更新，與 DB 掃描或其他實例並行時只有一方成功，失敗方不恢復庫存
+func (s *OrderService) cancelExpired(ctx context.Context, order *model.Order) error {
+	if err := s.orderRepo.Transition(ctx, order, model.OrderStatusCancelled, expiredOrderTrigger); err != nil {
+		return err
 	}
 
+	s.restoreCancelledStock(ctx, order)
+
 	s.notifyOrderStatusChange(ctx, order, model.OrderStatusPending, model.OrderStatusCancelled)
 
-	order.Status = model.OrderStatusCancelled
-	return order, nil
+	s.log.Info("order expired",
+		zap.String("order_no", order.OrderNo),
+		zap.Timep("expires_at", order.ExpiresAt),
+	)
+	return nil
+}
+
+// unscheduleExpiry 將已離開待付款狀態的訂單移出到期佇列（失敗無妨，到期時會被略過）
+func (s *OrderService) unscheduleExpiry(ctx context.Context, order *model.Order) {
+	if err := s.expiry.Remove(ctx, order.ID); err != nil {
+		s.log.Warn("failed to remove order from expiry queue",
+			zap.String("order_no", order.OrderNo),
+			zap.Error(err),
+		)
+	}
 }
 
-// CancelExpiredOrders 取消過期未付款訂單（定時任務呼叫）
-func (s *OrderService) CancelExpiredOrders(ctx context.Context, expireDuration time.Duration) error {
-	orders, err := s.orderRepo.CancelExpiredPending(ctx, expireDuration, 100)
+// cancelForFlashSale 活動取消時取消待付款訂單並恢復庫存
+// 期間被使用者付款或取消的訂單返回轉換錯誤，不重複恢復庫存
+func (s *OrderService) cancelForFlashSale(ctx context.Context, order *model.Order) error {
+	err := s.orderRepo.Transition(ctx, order, model.OrderStatusCancelled, model.OrderTrigger{
+		Actor:  model.OrderActorSystem,
+		Reason: flashSaleCancelledReason,
+	})
 	if err != nil {
 		return err
 	}
 
-	for _, order := range orders {
-		// 恢復庫存
-		if err := s.stockService.RestoreStock(ctx, order.FlashSaleID, order.UserID, order.Quantity); err != nil {
-			s.log.Error("failed to restore redis stock for expired order",
-				zap.String("order_no", order.OrderNo),
-				zap.Error(err),
-			)
+	s.restoreCancelledStock(ctx, order)
+	s.unscheduleExpiry(ctx, order)
+	s.notifyOrderStatusChange(ctx, order, model.OrderStatusPending, model.OrderStatusCancelled)
+	return nil
+}
+
+// stockRestoreGrace 取消後超過此時間仍待歸還的訂單才由 RestorePendingStock 補做，避免與取消流程本身重複歸還
+const stockRestoreGrace = time.Minute
+
+// RestorePendingStock 補做已取消訂單的 Redis 庫存與限購歸還（取消後歸還失敗或實例崩潰時，定時任務呼叫）
+// DB 庫存已在取消交易內恢復；歸還後、清除標記前崩潰會重複歸還 Redis 庫存一次，由庫存對帳修正
+// 返回本次完成歸還的數量，等於 limit 時呼叫方應繼續處理
+func (s *OrderService) RestorePendingStock(ctx context.Context, limit int) (int, error) {
+	orders, err := s.orderRepo.ListStockRestorePending(ctx, time.Now().Add(-stockRestoreGrace), limit)
+	if err != nil {
+		return 0, err
+	}
+
+	restored := 0
+	for i := range orders {
+		if s.restoreCancelledStock(ctx, &orders[i]) {
+			restored++
 		}
+	}
+
+	if restored > 0 {
+		s.log.Info("restored stock for cancelled orders", zap.Int("count", restored))
+	}
+	return restored, nil
+}
+
+// restoreCancelledStock 歸還已取消訂單的 Redis 庫存與限購計數器並清除待歸還標記（DB 庫存已在取消交易內恢復）
+// 失敗時保留標記由 RestorePendingStock 重試，返回是否完成
+func (s *OrderService) restoreCancelledStock(ctx context.Context, order *model.Order) bool {
+	if err := s.restoreRedisStock(ctx, order); err != nil {
+		s.log.Error("failed to restore redis stock, will retry",
+			zap.String("order_no", order.OrderNo),
+			zap.Error(err),
+		)
+		return false
+	}
+	s.releaseLimit(ctx, order)
+
+	if _, err := s.orderRepo.ClearStockRestorePending(ctx, order.ID); err != nil {
+		s.log.Error("failed to clear stock restore flag",
+			zap.String("order_no", order.OrderNo),
+			zap.Error(err),
+		)
+		return false
+	}
+	return true
+}
+
+// restoreStock 恢復退款訂單的 Redis 與 DB 庫存（含規格庫存），並歸還限購計數器
+func (s *OrderService) restoreStock(ctx context.Context, order *model.Order) {
+	if err := s.restoreRedisStock(ctx, order); err != nil {
+		s.log.Error("failed to restore redis stock",
+			zap.String("order_no", order.OrderNo),
+			zap.Error(err),
+		)
+	}
+
+	if err := s.flashSaleRepo.IncrementStock(ctx, order.FlashSaleID, order.Quantity); err != nil {
+		s.log.Error("failed to restore db stock",
+			zap.String("order_no", order.OrderNo),
+			zap.Error(err),
+		)
+	}
 
-		if err := s.flashSaleRepo.IncrementStock(ctx, order.FlashSaleID, order.Quantity); err != nil {
-			s.log.Error("failed to restore db stock for expired order",
+	s.releaseLimit(ctx, order)
+
+	if order.ItemID != nil {
+		if err := s.flashSaleRepo.IncrementItemStock(ctx, *order.ItemID, order.Quantity); err != nil {
+			s.log.Error("failed to restore db item stock",
 				zap.String("order_no", order.OrderNo),
 				zap.Error(err),
 			)
 		}
-
-		s.notifyOrderStatusChange(ctx, &order, model.OrderStatusPending, model.OrderStatusCancelled)
 	}
+}
 
-	if len(orders) > 0 {
-		s.log.Info("cancelled expired orders", zap.Int("count", len(orders)))
+// restoreRedisStock 恢復訂單的 Redis 庫存（含規格庫存）並回滾使用者已購數量
+func (s *OrderService) restoreRedisStock(ctx context.Context, order *model.Order) error {
+	var itemID int64
+	if order.ItemID != nil {
+		itemID = *order.ItemID
 	}
 
-	return nil
+	return s.stock.Restore(ctx, &cache.RestoreRequest{
+		FlashSaleID: order.FlashSaleID,
+		UserID:      order.UserID,
+		ItemID:      itemID,
+		Quantity:    order.Quantity,
+	})
+}
+
+// releaseLimit 歸還訂單佔用的跨活動限購計數器
+func (s *OrderService) releaseLimit(ctx context.Context, order *model.Order) {
+	flashSale, err := s.flashSaleRepo.GetByID(ctx, order.FlashSaleID)
+	if err != nil {
+		s.log.Error("failed to load flash sale for purchase limit release",
+			zap.String("order_no", order.OrderNo),
+			zap.Error(err),
+		)
+		return
+	}
+	s.limits.ReleaseOrder(ctx, flashSale, order)
 }
 
 // notifyOrderStatusChange 發送訂單狀態變更消息
@@ -239,4 +487,5 @@ func (s *OrderService) notifyOrderStatusChange(ctx context.Context, order *model
 	}
 }
 
-var ErrOrderStatusInvalid = repository.ErrOrderNotFound
+// ErrOrderStatusInvalid 訂單狀態不允許此操作，狀態機拒絕的轉換（*model.OrderTransitionError）可用 errors.Is 比對
+var ErrOrderStatusInvalid = model.ErrInvalidOrderTransition
@@ -0,0 +1,473 @@
+// 訂單服務整合測試
+//
+// 庫存後端使用 cache.MemoryStockStore、快取依賴使用行程內替身，不需要 Redis
+// 測試覆蓋：
+// - CreateFromMessage: 建立待付款訂單、排入到期佇列、扣減 DB 庫存、重複訊息冪等
+// - CreateFromMessage: 活動已取消時建單後立即取消並歸還庫存與限購，重送的訊息不重複歸還
+// - Cancel: 恢復 Redis 與 DB 庫存、回滾已購數量、歸還限購、移出到期佇列
+// - ProcessExpiryQueue: 到期訂單取消並恢復庫存
+// - CancelExpiredOrders / ProcessExpiryQueue: 多個實例並行掃描與處理到期佇列時，每筆訂單只被取消一次、庫存只恢復一次
+// - RestorePendingStock: 取消交易已提交但 Redis 庫存未歸還（實例崩潰）的訂單由補做任務歸還
+// 需要可用的 PostgreSQL（請使用專用測試資料庫，測試會取消其中所有過期待付款訂單）：
+// POSTGRES_TEST_DSN="host=127.0.0.1 user=postgres password=postgres dbname=magtrade_test sslmode=disable" go test ./internal/service/
+// CI 的 integration 工作以 PostgreSQL 服務容器提供 DSN 執行
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Mag1cFall/magtrade/internal/cache"
+	"github.com/Mag1cFall/magtrade/internal/database"
+	"github.com/Mag1cFall/magtrade/internal/model"
+	"github.com/Mag1cFall/magtrade/internal/mq"
+	"github.com/Mag1cFall/magtrade/internal/repository"
+	"go.uber.org/zap"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// setupTestDB 連線測試用 PostgreSQL、遷移訂單相關資料表並設為全域連線，未設定 DSN 時略過（已設定則必須可連線）
+func setupTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+
+	dsn := os.Getenv("POSTGRES_TEST_DSN")
+	if dsn == "" {
+		t.Skip("POSTGRES_TEST_DSN not set")
+	}
+
+	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{
+		Logger:         logger.Default.LogMode(logger.Silent),
+		TranslateError: true,
+	})
+	if err != nil {
+		t.Fatalf("postgres unavailable: %v", err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sqlDB.Ping(); err != nil {
+		t.Fatalf("postgres unavailable: %v", err)
+	}
+	t.Cleanup(func() { _ = sqlDB.Close() })
+
+	if err := db.AutoMigrate(
+		&model.User{},
+		&model.Product{},
+		&model.FlashSale{},
+		&model.FlashSaleItem{},
+		&model.Order{},
+		&model.OrderStatusHistory{},
+	); err != nil {
+		t.Fatal(err)
+	}
+
+	database.Set(db)
+	t.Cleanup(func() { database.Set(nil) })
+	return db
+}
+
+// createTestSale 建立使用者、商品與進行中的活動（DB 庫存為 stock）
+func createTestSale(t *testing.T, db *gorm.DB, stock int) (*model.User, *model.FlashSale) {
+	t.Helper()
+
+	suffix := time.Now().UnixNano()
+	user := &model.User{
+		Username:     fmt.Sprintf("order_test_%d", suffix),
+		Email:        fmt.Sprintf("order_test_%d@example.com", suffix),
+		PasswordHash: "x",
+	}
+	if err := db.Create(user).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	product := &model.Product{Name: "order test product", OriginalPrice: 100}
+	if err := db.Create(product).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	flashSale := &model.FlashSale{
+		ProductID:      product.ID,
+		FlashPrice:     10,
+		TotalStock:     stock,
+		AvailableStock: stock,
+		PerUserLimit:   1,
+		StartTime:      now.Add(-time.Hour),
+		EndTime:        now.Add(time.Hour),
+		Status:         model.FlashSaleStatusActive,
+	}
+	if err := db.Create(flashSale).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		var ids []int64
+		db.Model(&model.Order{}).Where("flash_sale_id = ?", flashSale.ID).Pluck("id", &ids)
+		db.Where("order_id IN ?", ids).Delete(&model.OrderStatusHistory{})
+		db.Unscoped().Where("flash_sale_id = ?", flashSale.ID).Delete(&model.Order{})
+		db.Unscoped().Delete(flashSale)
+		db.Unscoped().Delete(product)
+		db.Unscoped().Delete(user)
+	})
+
+	return user, flashSale
+}
+
+// newTestOrderService 以行程內快取依賴建立訂單服務，Kafka 生產者不可用（狀態變更通知只記日誌）
+func newTestOrderService(deps *CacheDeps) *OrderService {
+	return NewOrderService(deps, &mq.Producer{}, zap.NewNop())
+}
+
+// admitTestOrder 模擬搶購准入並建立訂單
+func admitTestOrder(t *testing.T, deps *testCacheDeps, svc *OrderService, flashSale *model.FlashSale, userID int64) *model.Order {
+	t.Helper()
+	ctx := context.Background()
+
+	res, err := deps.store.Admit(ctx, &cache.AdmitRequest{FlashSaleID: flashSale.ID, UserID: userID, Quantity: 1, Payload: "order"})
+	if err != nil || res.Code != cache.AdmitOK {
+		t.Fatalf("Admit() = %+v, %v", res, err)
+	}
+
+	order, err := svc.CreateFromMessage(ctx, &mq.FlashSaleOrderMessage{FlashSaleID: flashSale.ID, UserID: userID, Quantity: 1})
+	if err != nil {
+		t.Fatalf("CreateFromMessage() error = %v", err)
+	}
+	return order
+}
+
+// createExpiredOrders 建立 n 筆已過付款截止時間的待付款訂單並排入到期佇列
+func createExpiredOrders(t *testing.T, deps *testCacheDeps, db *gorm.DB, flashSale *model.FlashSale, userID int64, n, quantity int) []model.Order {
+	t.Helper()
+
+	suffix := time.Now().UnixNano()
+	expiresAt := time.Now().Add(-time.Minute)
+	orders := make([]model.Order, n)
+	for i := range orders {
+		orders[i] = model.Order{
+			OrderNo:     fmt.Sprintf("T%d%04d", suffix, i),
+			UserID:      userID,
+			FlashSaleID: flashSale.ID,
+			Amount:      flashSale.FlashPrice * float64(quantity),
+			Quantity:    quantity,
+			Status:      model.OrderStatusPending,
+			ExpiresAt:   &expiresAt,
+		}
+	}
+	if err := db.Create(&orders).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	for i := range orders {
+		_ = deps.expiry.Schedule(context.Background(), orders[i].ID, expiresAt)
+	}
+	return orders
+}
+
+// assertStock 檢查庫存後端、DB 庫存與使用者已購數量
+func assertStock(t *testing.T, deps *testCacheDeps, db *gorm.DB, flashSaleID, userID int64, wantStock, wantBought int) {
+	t.Helper()
+
+	if got, _ := deps.store.GetStock(context.Background(), flashSaleID); got != wantStock {
+		t.Errorf("redis stock = %d, want %d", got, wantStock)
+	}
+	var flashSale model.FlashSale
+	if err := db.First(&flashSale, flashSaleID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if flashSale.AvailableStock != wantStock {
+		t.Errorf("db stock = %d, want %d", flashSale.AvailableStock, wantStock)
+	}
+	if got := deps.store.Bought(flashSaleID, userID); got != wantBought {
+		t.Errorf("bought = %d, want %d", got, wantBought)
+	}
+}
+
+func TestOrderService_CreateAndCancel(t *testing.T) {
+	db := setupTestDB(t)
+	ctx := context.Background()
+	user, flashSale := createTestSale(t, db, 5)
+
+	deps := newTestCacheDeps()
+	deps.addSale(t, flashSale)
+	svc := newTestOrderService(deps.CacheDeps)
+
+	order := admitTestOrder(t, deps, svc, flashSale, user.ID)
+	if order.Status != model.OrderStatusPending || order.ExpiresAt == nil {
+		t.Fatalf("order = %+v, want pending with deadline", order)
+	}
+	if _, ok := deps.expiry.pending[order.ID]; !ok {
+		t.Error("order not scheduled for expiry")
+	}
+	assertStock(t, deps, db, flashSale.ID, user.ID, 4, 1)
+
+	// 重複訊息返回既有訂單，不再扣減
+	again, err := svc.CreateFromMessage(ctx, &mq.FlashSaleOrderMessage{FlashSaleID: flashSale.ID, UserID: user.ID, Quantity: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.ID != order.ID {
+		t.Errorf("duplicate message created order %d, want %d", again.ID, order.ID)
+	}
+	assertStock(t, deps, db, flashSale.ID, user.ID, 4, 1)
+
+	if _, err := svc.Cancel(ctx, user.ID+1, order.OrderNo); err == nil {
+		t.Error("Cancel() by other user succeeded")
+	}
+	cancelled, err := svc.Cancel(ctx, user.ID, order.OrderNo)
+	if err != nil {
+		t.Fatalf("Cancel() error = %v", err)
+	}
+	if cancelled.Status != model.OrderStatusCancelled {
+		t.Errorf("status = %d, want cancelled", cancelled.Status)
+	}
+	assertStock(t, deps, db, flashSale.ID, user.ID, 5, 0)
+	if _, ok := deps.expiry.pending[order.ID]; ok {
+		t.Error("cancelled order still scheduled for expiry")
+	}
+	if deps.limits.released != 1 {
+		t.Errorf("limit released = %d, want 1", deps.limits.released)
+	}
+
+	// 已取消的訂單不能再取消，庫存不重複恢復
+	if _, err := svc.Cancel(ctx, user.ID, order.OrderNo); err == nil {
+		t.Error("second Cancel() succeeded")
+	}
+	assertStock(t, deps, db, flashSale.ID, user.ID, 5, 0)
+}
+
+func TestOrderService_CreateFromMessage_CancelledSale(t *testing.T) {
+	db := setupTestDB(t)
+	ctx := context.Background()
+	user, flashSale := createTestSale(t, db, 5)
+
+	deps := newTestCacheDeps()
+	deps.addSale(t, flashSale)
+	svc := newTestOrderService(deps.CacheDeps)
+
+	// 准入後、訊息消費前活動被取消
+	res, err := deps.store.Admit(ctx, &cache.AdmitRequest{FlashSaleID: flashSale.ID, UserID: user.ID, Quantity: 1, Payload: "order"})
+	if err != nil || res.Code != cache.AdmitOK {
+		t.Fatalf("Admit() = %+v, %v", res, err)
+	}
+	if err := db.Model(flashSale).Update("status", model.FlashSaleStatusCancelled).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	msg := &mq.FlashSaleOrderMessage{FlashSaleID: flashSale.ID, UserID: user.ID, Quantity: 1}
+	for i := 0; i < 2; i++ { // 第二次為訊息重送
+		if _, err := svc.CreateFromMessage(ctx, msg); !errors.Is(err, ErrFlashSaleCancelled) {
+			t.Fatalf("CreateFromMessage() #%d error = %v, want ErrFlashSaleCancelled", i+1, err)
+		}
+		assertStock(t, deps, db, flashSale.ID, user.ID, 5, 0)
+		if deps.limits.released != 1 {
+			t.Errorf("limit released = %d after #%d, want 1", deps.limits.released, i+1)
+		}
+	}
+
+	var orders []model.Order
+	if err := db.Where("flash_sale_id = ?", flashSale.ID).Find(&orders).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(orders) != 1 || orders[0].Status != model.OrderStatusCancelled {
+		t.Fatalf("orders = %+v, want one cancelled", orders)
+	}
+	if _, ok := deps.expiry.pending[orders[0].ID]; ok {
+		t.Error("discarded order scheduled for expiry")
+	}
+}
+
+func TestOrderService_ProcessExpiryQueue(t *testing.T) {
+	db := setupTestDB(t)
+	ctx := context.Background()
+	user, flashSale := createTestSale(t, db, 5)
+
+	deps := newTestCacheDeps()
+	deps.addSale(t, flashSale)
+	svc := newTestOrderService(deps.CacheDeps)
+
+	order := admitTestOrder(t, deps, svc, flashSale, user.ID)
+
+	// 尚未到期：不處理
+	if _, err := svc.ProcessExpiryQueue(ctx, 10); err != nil {
+		t.Fatal(err)
+	}
+	assertStock(t, deps, db, flashSale.ID, user.ID, 4, 1)
+
+	past := time.Now().Add(-time.Second)
+	if err := db.Model(&model.Order{}).Where("id = ?", order.ID).Update("expires_at", past).Error; err != nil {
+		t.Fatal(err)
+	}
+	_ = deps.expiry.Schedule(ctx, order.ID, past)
+
+	if _, err := svc.ProcessExpiryQueue(ctx, 10); err != nil {
+		t.Fatal(err)
+	}
+
+	var got model.Order
+	if err := db.First(&got, order.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if got.Status != model.OrderStatusCancelled {
+		t.Errorf("status = %d, want cancelled", got.Status)
+	}
+	assertStock(t, deps, db, flashSale.ID, user.ID, 5, 0)
+	if len(deps.expiry.pending) != 0 {
+		t.Errorf("expiry queue size = %d, want 0", len(deps.expiry.pending))
+	}
+}
+
+func TestOrderService_CancelExpiredOrders_Concurrent(t *testing.T) {
+	db := setupTestDB(t)
+	ctx := context.Background()
+
+	const (
+		orderCount = 60
+		quantity   = 2
+		scanners   = 4 // 模擬多個實例的 DB 兜底掃描
+		queues     = 4 // 模擬多個實例的到期佇列處理
+	)
+	user, flashSale := createTestSale(t, db, 0)
+
+	deps := newTestCacheDeps()
+	deps.addSale(t, flashSale)
+	orders := createExpiredOrders(t, deps, db, flashSale, user.ID, orderCount, quantity)
+
+	var wg sync.WaitGroup
+	start := make(chan struct{})
+
+	for i := 0; i < scanners; i++ {
+		svc := newTestOrderService(deps.CacheDeps)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			for {
+				n, err := svc.CancelExpiredOrders(ctx, 5)
+				if err != nil {
+					t.Errorf("CancelExpiredOrders() error = %v", err)
+					return
+				}
+				if n < 5 {
+					return
+				}
+			}
+		}()
+	}
+
+	for i := 0; i < queues; i++ {
+		svc := newTestOrderService(deps.CacheDeps)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			for {
+				n, err := svc.ProcessExpiryQueue(ctx, 5)
+				if err != nil {
+					t.Errorf("ProcessExpiryQueue() error = %v", err)
+					return
+				}
+				if n == 0 {
+					return
+				}
+			}
+		}()
+	}
+
+	close(start)
+	wg.Wait()
+
+	assertStock(t, deps, db, flashSale.ID, user.ID, orderCount*quantity, 0)
+	if deps.limits.released != orderCount*quantity {
+		t.Errorf("limit released = %d, want %d", deps.limits.released, orderCount*quantity)
+	}
+	if len(deps.expiry.pending) != 0 {
+		t.Errorf("expiry queue size = %d, want 0", len(deps.expiry.pending))
+	}
+
+	ids := make([]int64, len(orders))
+	for i := range orders {
+		ids[i] = orders[i].ID
+	}
+
+	var cancelled int64
+	if err := db.Model(&model.Order{}).
+		Where("id IN ? AND status = ?", ids, model.OrderStatusCancelled).
+		Count(&cancelled).Error; err != nil {
+		t.Fatal(err)
+	}
+	if cancelled != orderCount {
+		t.Errorf("cancelled orders = %d, want %d", cancelled, orderCount)
+	}
+
+	var history int64
+	if err := db.Model(&model.OrderStatusHistory{}).
+		Where("order_id IN ? AND to_status = ?", ids, model.OrderStatusCancelled).
+		Count(&history).Error; err != nil {
+		t.Fatal(err)
+	}
+	if history != orderCount {
+		t.Errorf("cancel history rows = %d, want %d", history, orderCount)
+	}
+
+	var pending int64
+	if err := db.Model(&model.Order{}).
+		Where("id IN ? AND stock_restore_pending", ids).
+		Count(&pending).Error; err != nil {
+		t.Fatal(err)
+	}
+	if pending != 0 {
+		t.Errorf("orders pending stock restore = %d, want 0", pending)
+	}
+}
+
+func TestOrderService_RestorePendingStock(t *testing.T) {
+	db := setupTestDB(t)
+	ctx := context.Background()
+	user, flashSale := createTestSale(t, db, 5)
+
+	deps := newTestCacheDeps()
+	deps.addSale(t, flashSale)
+	svc := newTestOrderService(deps.CacheDeps)
+
+	order := admitTestOrder(t, deps, svc, flashSale, user.ID)
+
+	// 取消交易已提交（DB 庫存已恢復），Redis 歸還前實例崩潰
+	err := repository.NewOrderRepository().Transition(ctx, order, model.OrderStatusCancelled, expiredOrderTrigger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := deps.store.GetStock(ctx, flashSale.ID); got != 4 {
+		t.Fatalf("redis stock = %d, want 4 before restore", got)
+	}
+
+	// 寬限期內不補做，避免與取消流程重複歸還
+	if n, err := svc.RestorePendingStock(ctx, 10); err != nil || n != 0 {
+		t.Fatalf("RestorePendingStock() within grace = %d, %v", n, err)
+	}
+
+	past := time.Now().Add(-2 * stockRestoreGrace)
+	if err := db.Model(&model.Order{}).Where("id = ?", order.ID).UpdateColumn("updated_at", past).Error; err != nil {
+		t.Fatal(err)
+	}
+	if n, err := svc.RestorePendingStock(ctx, 10); err != nil || n != 1 {
+		t.Fatalf("RestorePendingStock() = %d, %v, want 1", n, err)
+	}
+	assertStock(t, deps, db, flashSale.ID, user.ID, 5, 0)
+	if deps.limits.released != 1 {
+		t.Errorf("limit released = %d, want 1", deps.limits.released)
+	}
+
+	// 標記已清除，不重複歸還
+	if n, err := svc.RestorePendingStock(ctx, 10); err != nil || n != 0 {
+		t.Fatalf("second RestorePendingStock() = %d, %v", n, err)
+	}
+	assertStock(t, deps, db, flashSale.ID, user.ID, 5, 0)
+}
@@ -0,0 +1,327 @@
+// 本地模擬支付供應商
+//
+// 本檔案實作開發與壓測使用的模擬支付
+// 建立支付意圖後經過配置的延遲自動完成（成功 / 失敗 / 依成功率隨機），並以簽名回調通知 NotifyURL
+// 退款同樣在延遲後完成（一律成功）並回調
+// 回調失敗時以指數退避重試，模擬真實供應商的至少一次投遞
+// 意圖狀態保存在行程記憶體中，僅適用單實例部署
+package payment
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	mathrand "math/rand/v2"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/Mag1cFall/magtrade/internal/config"
+	"go.uber.org/zap"
+)
+
+const (
+	MockProviderName        = "mock"
+	MockSignatureHeader     = "X-Mock-Signature"
+	mockCallbackMaxAttempts = 4
+)
+
+// mockIntent 模擬支付意圖
+type mockIntent struct {
+	id        string
+	paymentNo string
+	amount    float64
+	notifyURL string
+	status    Status
+	refundID  string // 已發起的退款，每個意圖僅允許一次全額退款
+}
+
+// mockRefund 模擬退款
+type mockRefund struct {
+	id        string
+	refundNo  string
+	intentID  string
+	notifyURL string
+	status    Status
+}
+
+// MockProvider 本地模擬支付供應商
+type MockProvider struct {
+	cfg        *config.MockPaymentConfig
+	httpClient *http.Client
+	log        *zap.Logger
+
+	mu          sync.Mutex
+	intents     map[string]*mockIntent // 意圖 ID → 意圖
+	byPaymentNo map[string]string      // 商戶支付單號 → 意圖 ID
+	refunds     map[string]*mockRefund // 退款 ID → 退款
+	byRefundNo  map[string]string      // 商戶退款單號 → 退款 ID
+
+	retryDelay time.Duration // 首次回調重試間隔
+	now        func() time.Time
+}
+
+func NewMockProvider(cfg *config.MockPaymentConfig, log *zap.Logger) *MockProvider {
+	return &MockProvider{
+		cfg:         cfg,
+		httpClient:  &http.Client{Timeout: 5 * time.Second},
+		log:         log,
+		intents:     make(map[string]*mockIntent),
+		byPaymentNo: make(map[string]string),
+		refunds:     make(map[string]*mockRefund),
+		byRefundNo:  make(map[string]string),
+		retryDelay:  time.Second,
+		now:         time.Now,
+	}
+}
+
+var (
+	sharedMock     *MockProvider
+	sharedMockOnce sync.Once
+)
+
+// Mock 取得行程共用的模擬供應商（意圖狀態需在建立支付與處理回調的服務間共用）
+func Mock(cfg *config.MockPaymentConfig, log *zap.Logger) *MockProvider {
+	sharedMockOnce.Do(func() {
+		sharedMock = NewMockProvider(cfg, log)
+	})
+	return sharedMock
+}
+
+// Name 供應商名稱
+func (p *MockProvider) Name() string {
+	return MockProviderName
+}
+
+// CreateIntent 建立支付意圖，並排程在延遲後完成
+func (p *MockProvider) CreateIntent(ctx context.Context, req *IntentRequest) (*Intent, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if id, ok := p.byPaymentNo[req.PaymentNo]; ok {
+		return p.intentOf(id), nil
+	}
+
+	id, err := newMockID("mpi_")
+	if err != nil {
+		return nil, err
+	}
+
+	p.intents[id] = &mockIntent{
+		id:        id,
+		paymentNo: req.PaymentNo,
+		amount:    req.Amount,
+		notifyURL: req.NotifyURL,
+		status:    StatusPending,
+	}
+	p.byPaymentNo[req.PaymentNo] = id
+
+	time.AfterFunc(p.cfg.Delay, func() { p.complete(id) })
+
+	return p.intentOf(id), nil
+}
+
+// QueryStatus 查詢支付意圖狀態
+func (p *MockProvider) QueryStatus(ctx context.Context, intentID string) (Status, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	intent, ok := p.intents[intentID]
+	if !ok {
+		return "", ErrIntentNotFound
+	}
+	return intent.status, nil
+}
+
+// ParseCallback 驗證簽名並解析回調事件
+func (p *MockProvider) ParseCallback(header http.Header, body []byte) (*CallbackEvent, error) {
+	if err := VerifySignature(p.cfg.Secret, header.Get(MockSignatureHeader), body, p.now()); err != nil {
+		return nil, err
+	}
+
+	var event CallbackEvent
+	if err := json.Unmarshal(body, &event); err != nil {
+		return nil, fmt.Errorf("invalid callback payload: %w", err)
+	}
+	if event.Type == "" {
+		event.Type = EventPayment
+	}
+	if event.IntentID == "" || (event.Type == EventRefund && event.RefundID == "") {
+		return nil, fmt.Errorf("invalid callback payload: missing id")
+	}
+	return &event, nil
+}
+
+// Refund 發起全額退款，延遲後完成並回調
+func (p *MockProvider) Refund(ctx context.Context, req *RefundRequest) (*RefundResult, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if id, ok := p.byRefundNo[req.RefundNo]; ok {
+		return &RefundResult{RefundID: id, Status: p.refunds[id].status}, nil
+	}
+
+	intent, ok := p.intents[req.IntentID]
+	if !ok {
+		return nil, ErrIntentNotFound
+	}
+	if intent.status != StatusSucceeded || intent.refundID != "" {
+		return nil, ErrRefundNotAllowed
+	}
+
+	id, err := newMockID("mrf_")
+	if err != nil {
+		return nil, err
+	}
+
+	p.refunds[id] = &mockRefund{
+		id:        id,
+		refundNo:  req.RefundNo,
+		intentID:  intent.id,
+		notifyURL: req.NotifyURL,
+		status:    StatusPending,
+	}
+	p.byRefundNo[req.RefundNo] = id
+	intent.refundID = id
+
+	time.AfterFunc(p.cfg.Delay, func() { p.completeRefund(id) })
+
+	return &RefundResult{RefundID: id, Status: StatusPending}, nil
+}
+
+// QueryRefund 查詢退款狀態
+func (p *MockProvider) QueryRefund(ctx context.Context, refundID string) (Status, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	refund, ok := p.refunds[refundID]
+	if !ok {
+		return "", ErrRefundNotFound
+	}
+	return refund.status, nil
+}
+
+// complete 依配置決定支付結果，並發送回調
+func (p *MockProvider) complete(id string) {
+	p.mu.Lock()
+	intent, ok := p.intents[id]
+	if !ok || intent.status != StatusPending {
+		p.mu.Unlock()
+		return
+	}
+	intent.status = p.outcome()
+	event := CallbackEvent{Type: EventPayment, IntentID: intent.id, PaymentNo: intent.paymentNo, Status: intent.status}
+	notifyURL := intent.notifyURL
+	p.mu.Unlock()
+
+	p.deliver(notifyURL, &event)
+}
+
+// completeRefund 完成退款，並發送回調
+func (p *MockProvider) completeRefund(id string) {
+	p.mu.Lock()
+	refund, ok := p.refunds[id]
+	if !ok || refund.status != StatusPending {
+		p.mu.Unlock()
+		return
+	}
+	refund.status = StatusSucceeded
+	intent := p.intents[refund.intentID]
+	intent.status = StatusRefunded
+	event := CallbackEvent{
+		Type:      EventRefund,
+		IntentID:  intent.id,
+		PaymentNo: intent.paymentNo,
+		RefundID:  refund.id,
+		RefundNo:  refund.refundNo,
+		Status:    refund.status,
+	}
+	notifyURL := refund.notifyURL
+	p.mu.Unlock()
+
+	p.deliver(notifyURL, &event)
+}
+
+// deliver 發送簽名回調，失敗時以指數退避重試
+func (p *MockProvider) deliver(notifyURL string, event *CallbackEvent) {
+	if notifyURL == "" {
+		return
+	}
+
+	body, err := json.Marshal(event)
+	if err != nil {
+		return
+	}
+
+	delay := p.retryDelay
+	for attempt := 1; attempt <= mockCallbackMaxAttempts; attempt++ {
+		err = p.notify(notifyURL, body)
+		if err == nil {
+			return
+		}
+		if attempt < mockCallbackMaxAttempts {
+			time.Sleep(delay)
+			delay *= 2
+		}
+	}
+
+	p.log.Warn("mock payment callback failed",
+		zap.String("type", string(event.Type)),
+		zap.String("intent_id", event.IntentID),
+		zap.String("notify_url", notifyURL),
+		zap.Error(err),
+	)
+}
+
+// notify 發送一次簽名回調，非 2xx 回應視為失敗
+func (p *MockProvider) notify(url string, body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(MockSignatureHeader, SignPayload(p.cfg.Secret, p.now(), body))
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// outcome 依配置決定模擬結果
+func (p *MockProvider) outcome() Status {
+	switch p.cfg.Outcome {
+	case "fail":
+		return StatusFailed
+	case "random":
+		if mathrand.Float64() < p.cfg.SuccessRate {
+			return StatusSucceeded
+		}
+		return StatusFailed
+	default:
+		return StatusSucceeded
+	}
+}
+
+// intentOf 組裝對外的意圖資訊（呼叫方需持有鎖）
+func (p *MockProvider) intentOf(id string) *Intent {
+	return &Intent{ID: id, PayURL: "mock://checkout/" + id}
+}
+
+// newMockID 生成帶前綴的隨機 ID
+func newMockID(prefix string) (string, error) {
+	b := make([]byte, 12)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return prefix + hex.EncodeToString(b), nil
+}
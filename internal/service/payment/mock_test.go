@@ -0,0 +1,145 @@
+// 模擬支付供應商與回調簽名單元測試
+//
+// 測試覆蓋：
+// - VerifySignature: 正確簽名、竄改內容、錯誤密鑰、過期時間戳、空密鑰
+// - MockProvider: 延遲後依配置完成並發送可驗簽的回調、相同支付單/退款單號冪等、退款僅允許一次
+package payment
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Mag1cFall/magtrade/internal/config"
+	"go.uber.org/zap"
+)
+
+func TestVerifySignature(t *testing.T) {
+	body := []byte(`{"intent_id":"mpi_1","status":"succeeded"}`)
+	now := time.Unix(1_800_000_000, 0)
+	header := SignPayload("secret", now, body)
+
+	tests := []struct {
+		name    string
+		secret  string
+		header  string
+		body    []byte
+		now     time.Time
+		wantErr bool
+	}{
+		{"valid", "secret", header, body, now, false},
+		{"tampered body", "secret", header, []byte(`{"intent_id":"mpi_1","status":"failed"}`), now, true},
+		{"wrong secret", "other", header, body, now, true},
+		{"expired", "secret", header, body, now.Add(SignatureTolerance + time.Second), true},
+		{"empty secret", "", SignPayload("", now, body), body, now, true},
+		{"malformed header", "secret", "v1=abc", body, now, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := VerifySignature(tt.secret, tt.header, tt.body, tt.now)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("VerifySignature() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestMockProvider_Callback(t *testing.T) {
+	tests := []struct {
+		outcome string
+		want    Status
+	}{
+		{"success", StatusSucceeded},
+		{"fail", StatusFailed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.outcome, func(t *testing.T) {
+			cfg := &config.MockPaymentConfig{Secret: "secret", Delay: 10 * time.Millisecond, Outcome: tt.outcome}
+			p := NewMockProvider(cfg, zap.NewNop())
+
+			events := make(chan *CallbackEvent, 1)
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, _ := io.ReadAll(r.Body)
+				event, err := p.ParseCallback(r.Header, body)
+				if err != nil {
+					w.WriteHeader(http.StatusUnauthorized)
+					return
+				}
+				events <- event
+			}))
+			defer srv.Close()
+
+			ctx := context.Background()
+			intent, err := p.CreateIntent(ctx, &IntentRequest{PaymentNo: "PY1", Amount: 9.9, NotifyURL: srv.URL})
+			if err != nil {
+				t.Fatalf("CreateIntent() error = %v", err)
+			}
+
+			if status, _ := p.QueryStatus(ctx, intent.ID); status != StatusPending {
+				t.Errorf("status before delay = %s, want pending", status)
+			}
+
+			select {
+			case event := <-events:
+				if event.IntentID != intent.ID || event.PaymentNo != "PY1" || event.Status != tt.want {
+					t.Errorf("callback = %+v, want intent %s status %s", event, intent.ID, tt.want)
+				}
+			case <-time.After(2 * time.Second):
+				t.Fatal("callback not received")
+			}
+
+			if status, _ := p.QueryStatus(ctx, intent.ID); status != tt.want {
+				t.Errorf("status after callback = %s, want %s", status, tt.want)
+			}
+		})
+	}
+}
+
+func TestMockProvider_IdempotentAndRefund(t *testing.T) {
+	cfg := &config.MockPaymentConfig{Secret: "secret", Delay: time.Hour, Outcome: "success"}
+	p := NewMockProvider(cfg, zap.NewNop())
+	ctx := context.Background()
+
+	first, err := p.CreateIntent(ctx, &IntentRequest{PaymentNo: "PY1", Amount: 1})
+	if err != nil {
+		t.Fatalf("CreateIntent() error = %v", err)
+	}
+	second, _ := p.CreateIntent(ctx, &IntentRequest{PaymentNo: "PY1", Amount: 1})
+	if first.ID != second.ID {
+		t.Errorf("same payment_no created different intents: %s, %s", first.ID, second.ID)
+	}
+
+	if _, err := p.Refund(ctx, &RefundRequest{IntentID: first.ID, RefundNo: "RF1"}); err != ErrRefundNotAllowed {
+		t.Errorf("Refund() on pending intent error = %v, want ErrRefundNotAllowed", err)
+	}
+
+	p.complete(first.ID)
+	refund, err := p.Refund(ctx, &RefundRequest{IntentID: first.ID, RefundNo: "RF2"})
+	if err != nil {
+		t.Fatalf("Refund() error = %v", err)
+	}
+	if refund.Status != StatusPending {
+		t.Errorf("refund status = %s, want pending", refund.Status)
+	}
+
+	again, err := p.Refund(ctx, &RefundRequest{IntentID: first.ID, RefundNo: "RF2"})
+	if err != nil || again.RefundID != refund.RefundID {
+		t.Errorf("same refund_no Refund() = %+v, %v, want refund %s", again, err, refund.RefundID)
+	}
+	if _, err := p.Refund(ctx, &RefundRequest{IntentID: first.ID, RefundNo: "RF3"}); err != ErrRefundNotAllowed {
+		t.Errorf("second refund error = %v, want ErrRefundNotAllowed", err)
+	}
+
+	p.completeRefund(refund.RefundID)
+	if status, _ := p.QueryRefund(ctx, refund.RefundID); status != StatusSucceeded {
+		t.Errorf("refund status after completion = %s, want succeeded", status)
+	}
+	if status, _ := p.QueryStatus(ctx, first.ID); status != StatusRefunded {
+		t.Errorf("intent status after refund = %s, want refunded", status)
+	}
+}
@@ -0,0 +1,94 @@
+// 支付供應商抽象
+//
+// 本檔案定義支付供應商介面與共用型別
+// 流程：建立支付意圖 → 使用者至付款頁面付款 → 供應商非同步回調 → 主動查詢確認 → 標記訂單已付款
+// 退款：發起退款 → 供應商非同步回調 → QueryRefund 查詢確認
+// 回調內容僅作為「狀態可能已變更」的通知，最終狀態以 QueryStatus / QueryRefund 查詢結果為準
+package payment
+
+import (
+	"context"
+	"errors"
+	"net/http"
+)
+
+var (
+	ErrInvalidSignature = errors.New("invalid payment callback signature")
+	ErrIntentNotFound   = errors.New("payment intent not found")
+	ErrRefundNotAllowed = errors.New("payment intent cannot be refunded")
+	ErrRefundNotFound   = errors.New("refund not found")
+)
+
+// Status 供應商側的支付狀態
+type Status string
+
+const (
+	StatusPending   Status = "pending"
+	StatusSucceeded Status = "succeeded"
+	StatusFailed    Status = "failed"
+	StatusRefunded  Status = "refunded"
+)
+
+// IntentRequest 建立支付意圖參數
+type IntentRequest struct {
+	PaymentNo string  // 商戶支付單號，供應商以此去重
+	Amount    float64 // 付款金額
+	Subject   string  // 付款頁面顯示的標題
+	NotifyURL string  // 非同步回調位址
+}
+
+// Intent 支付意圖
+type Intent struct {
+	ID     string `json:"id"`      // 供應商支付意圖 ID
+	PayURL string `json:"pay_url"` // 付款頁面位址
+}
+
+// EventType 回調事件類型
+type EventType string
+
+const (
+	EventPayment EventType = "payment" // 支付意圖狀態變更
+	EventRefund  EventType = "refund"  // 退款狀態變更
+)
+
+// CallbackEvent 已驗簽的回調事件
+type CallbackEvent struct {
+	Type      EventType `json:"type"`
+	IntentID  string    `json:"intent_id"`
+	PaymentNo string    `json:"payment_no"`
+	RefundID  string    `json:"refund_id,omitempty"` // Type 為 refund 時有值
+	RefundNo  string    `json:"refund_no,omitempty"`
+	Status    Status    `json:"status"`
+}
+
+// RefundRequest 退款參數
+type RefundRequest struct {
+	IntentID  string
+	RefundNo  string // 商戶退款單號，供應商以此去重
+	Amount    float64
+	Reason    string
+	NotifyURL string // 退款結果回調位址
+}
+
+// RefundResult 退款結果
+type RefundResult struct {
+	RefundID string `json:"refund_id"`
+	Status   Status `json:"status"`
+}
+
+// Provider 支付供應商
+type Provider interface {
+	// Name 供應商名稱，對應回調路徑 /api/v1/payments/webhook/{name}
+	Name() string
+	// CreateIntent 建立支付意圖，相同 PaymentNo 重複呼叫返回同一意圖
+	CreateIntent(ctx context.Context, req *IntentRequest) (*Intent, error)
+	// QueryStatus 主動查詢支付意圖狀態
+	QueryStatus(ctx context.Context, intentID string) (Status, error)
+	// ParseCallback 驗證回調簽名並解析事件，簽名無效時返回 ErrInvalidSignature
+	ParseCallback(header http.Header, body []byte) (*CallbackEvent, error)
+	// Refund 對已成功的支付意圖全額退款，相同 RefundNo 重複呼叫返回同一退款
+	// 返回狀態為 pending 時結果以回調或 QueryRefund 為準
+	Refund(ctx context.Context, req *RefundRequest) (*RefundResult, error)
+	// QueryRefund 主動查詢退款狀態
+	QueryRefund(ctx context.Context, refundID string) (Status, error)
+}
@@ -0,0 +1,70 @@
+// 回調簽名
+//
+// 本檔案實作 HMAC-SHA256 回調簽名與驗證
+// 簽名標頭格式：t={unix 秒},v1={hex(HMAC(secret, "{t}.{body}"))}
+// 時間戳納入簽名並限制容忍範圍，防止截獲的回調被重放
+package payment
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SignatureTolerance 回調時間戳與本機時間的最大允許差距
+const SignatureTolerance = 5 * time.Minute
+
+// SignPayload 生成回調簽名標頭值
+func SignPayload(secret string, timestamp time.Time, body []byte) string {
+	ts := strconv.FormatInt(timestamp.Unix(), 10)
+	return "t=" + ts + ",v1=" + computeSignature(secret, ts, body)
+}
+
+// VerifySignature 驗證回調簽名標頭，secret 為空時一律拒絕
+func VerifySignature(secret, header string, body []byte, now time.Time) error {
+	if secret == "" || header == "" {
+		return ErrInvalidSignature
+	}
+
+	var ts, sig string
+	for _, part := range strings.Split(header, ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			continue
+		}
+		switch key {
+		case "t":
+			ts = value
+		case "v1":
+			sig = value
+		}
+	}
+
+	unix, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil || sig == "" {
+		return ErrInvalidSignature
+	}
+
+	skew := now.Sub(time.Unix(unix, 0))
+	if skew > SignatureTolerance || skew < -SignatureTolerance {
+		return ErrInvalidSignature
+	}
+
+	expected := computeSignature(secret, ts, body)
+	if !hmac.Equal([]byte(expected), []byte(sig)) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// computeSignature 計算 hex(HMAC-SHA256(secret, "{ts}.{body}"))
+func computeSignature(secret, ts string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(ts))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,471 @@
+// 退款流程
+//
+// 本檔案提供支付服務的退款相關操作
+// 使用者申請：已付款訂單 → 退款中，建立待審核退款單
+// 管理員審核：通過後向原支付供應商發起退款（可選擇退款完成後歸還活動庫存），駁回則訂單回到已付款
+// 活動取消：待付款訂單直接取消，已付款訂單進入退款中並建立免審核退款單，向原支付供應商退款
+// 退款完成以供應商回調 + 主動查詢確認，重複回調冪等；每次訂單狀態變更都發送狀態變更消息
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Mag1cFall/magtrade/internal/model"
+	"github.com/Mag1cFall/magtrade/internal/pkg/utils"
+	"github.com/Mag1cFall/magtrade/internal/repository"
+	"github.com/Mag1cFall/magtrade/internal/service/payment"
+	"go.uber.org/zap"
+)
+
+var ErrRefundStatusInvalid = errors.New("refund status does not allow this operation")
+
+// autoRefundReason 支付成功但訂單已不可付款時自動退款的原因
+const autoRefundReason = "订单已不可支付，自动退款"
+
+// flashSaleCancelledReason 活動取消時訂單取消與退款的原因
+const flashSaleCancelledReason = "活动已取消"
+
+// CreateRefundRequest 申請退款請求
+type CreateRefundRequest struct {
+	Reason string `json:"reason" binding:"required,max=255"`
+}
+
+// ReviewRefundRequest 審核退款請求
+type ReviewRefundRequest struct {
+	RestoreStock bool   `json:"restore_stock"` // 退款完成後歸還活動庫存（僅審核通過時有效）
+	Note         string `json:"note" binding:"max=255"`
+}
+
+// RefundListResponse 退款單列表回應
+type RefundListResponse struct {
+	Refunds  []model.Refund `json:"refunds"`
+	Total    int64          `json:"total"`
+	Page     int            `json:"page"`
+	PageSize int            `json:"page_size"`
+}
+
+// RequestRefund 使用者申請退款（全額），訂單進入退款中等待審核
+func (s *PaymentService) RequestRefund(ctx context.Context, userID int64, orderNo string, req *CreateRefundRequest) (*model.Refund, error) {
+	order, err := s.orderRepo.GetByOrderNo(ctx, orderNo)
+	if err != nil {
+		return nil, err
+	}
+
+	if order.UserID != userID {
+		return nil, repository.ErrOrderNotFound
+	}
+
+	p, err := s.paymentRepo.GetSucceededByOrder(ctx, order.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	// 狀態機樂觀鎖推進訂單，並行申請只有一個成功
+	err = s.orderRepo.Transition(ctx, order, model.OrderStatusRefunding, model.OrderTrigger{
+		Actor:   model.OrderActorUser,
+		ActorID: &userID,
+		Reason:  req.Reason,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	refund := &model.Refund{
+		RefundNo: utils.GenerateRefundNo(),
+		OrderID:  order.ID,
+		OrderNo:  order.OrderNo,
+		UserID:   order.UserID,
+		Amount:   order.Amount,
+		Reason:   req.Reason,
+		Status:   model.RefundStatusPending,
+	}
+	if p != nil {
+		refund.PaymentID = &p.ID
+		refund.Provider = p.Provider
+	}
+
+	if err := s.refundRepo.Create(ctx, refund); err != nil {
+		rollbackErr := s.orderRepo.Transition(ctx, order, model.OrderStatusPaid, model.OrderTrigger{
+			Actor:  model.OrderActorSystem,
+			Reason: "退款单创建失败",
+		})
+		if rollbackErr != nil {
+			s.log.Error("failed to roll back refunding order",
+				zap.String("order_no", order.OrderNo),
+				zap.Error(rollbackErr),
+			)
+		}
+		return nil, err
+	}
+
+	s.orderService.notifyOrderStatusChange(ctx, order, model.OrderStatusPaid, model.OrderStatusRefunding)
+
+	s.log.Info("refund requested",
+		zap.String("refund_no", refund.RefundNo),
+		zap.String("order_no", order.OrderNo),
+	)
+
+	return refund, nil
+}
+
+// CancelFlashSaleOrders 活動取消時批量處理訂單：待付款訂單取消並恢復庫存，已付款訂單建立退款單並向供應商退款
+// 退款完成後歸還庫存與限購計數器；退款失敗時訂單回到已付款，由管理員另行處理
+// 返回取消數、發起退款數與處理失敗數（含期間被使用者付款或取消的訂單）
+// 只處理待付款與已付款訂單，可重複呼叫：重試時已取消或退款中的訂單不再列出，期間被付款的訂單改為退款
+func (s *PaymentService) CancelFlashSaleOrders(ctx context.Context, flashSaleID int64) (cancelled, refunding, failed int, err error) {
+	orders, err := s.orderRepo.ListActiveByFlashSale(ctx, flashSaleID)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+
+	for i := range orders {
+		order := &orders[i]
+
+		if order.Status == model.OrderStatusPending {
+			if err := s.orderService.cancelForFlashSale(ctx, order); err != nil {
+				s.log.Warn("failed to cancel order during flash sale cancellation",
+					zap.String("order_no", order.OrderNo),
+					zap.Error(err),
+				)
+				failed++
+				continue
+			}
+			cancelled++
+			continue
+		}
+
+		if err := s.refundForCancelledSale(ctx, order); err != nil {
+			s.log.Warn("failed to refund order during flash sale cancellation",
+				zap.String("order_no", order.OrderNo),
+				zap.Error(err),
+			)
+			failed++
+			continue
+		}
+		refunding++
+	}
+
+	return cancelled, refunding, failed, nil
+}
+
+// refundForCancelledSale 已付款訂單進入退款中，建立免審核的退款單並向供應商發起退款
+func (s *PaymentService) refundForCancelledSale(ctx context.Context, order *model.Order) error {
+	p, err := s.paymentRepo.GetSucceededByOrder(ctx, order.ID)
+	if err != nil {
+		return err
+	}
+
+	err = s.orderRepo.Transition(ctx, order, model.OrderStatusRefunding, model.OrderTrigger{
+		Actor:  model.OrderActorSystem,
+		Reason: flashSaleCancelledReason,
+	})
+	if err != nil {
+		return err
+	}
+
+	refund := &model.Refund{
+		RefundNo:     utils.GenerateRefundNo(),
+		OrderID:      order.ID,
+		OrderNo:      order.OrderNo,
+		UserID:       order.UserID,
+		Amount:       order.Amount,
+		Reason:       flashSaleCancelledReason,
+		Status:       model.RefundStatusProcessing,
+		RestoreStock: true,
+	}
+	if p != nil {
+		refund.PaymentID = &p.ID
+		refund.Provider = p.Provider
+	}
+
+	if err := s.refundRepo.Create(ctx, refund); err != nil {
+		rollbackErr := s.orderRepo.Transition(ctx, order, model.OrderStatusPaid, model.OrderTrigger{
+			Actor:  model.OrderActorSystem,
+			Reason: "退款单创建失败",
+		})
+		if rollbackErr != nil {
+			s.log.Error("failed to roll back refunding order",
+				zap.String("order_no", order.OrderNo),
+				zap.Error(rollbackErr),
+			)
+		}
+		return err
+	}
+
+	s.orderService.notifyOrderStatusChange(ctx, order, model.OrderStatusPaid, model.OrderStatusRefunding)
+
+	s.log.Info("refund created for cancelled flash sale",
+		zap.String("refund_no", refund.RefundNo),
+		zap.String("order_no", order.OrderNo),
+	)
+
+	return s.executeRefund(ctx, refund)
+}
+
+// ListRefunds 分頁查詢退款單（管理員），status 為 nil 時查詢全部
+func (s *PaymentService) ListRefunds(ctx context.Context, status *model.RefundStatus, page, pageSize int) (*RefundListResponse, error) {
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 20
+	}
+
+	refunds, total, err := s.refundRepo.List(ctx, status, page, pageSize)
+	if err != nil {
+		return nil, err
+	}
+
+	return &RefundListResponse{
+		Refunds:  refunds,
+		Total:    total,
+		Page:     page,
+		PageSize: pageSize,
+	}, nil
+}
+
+// ApproveRefund 審核通過並向供應商發起退款
+func (s *PaymentService) ApproveRefund(ctx context.Context, reviewerID int64, refundNo string, req *ReviewRefundRequest) (*model.Refund, error) {
+	refund, err := s.refundRepo.GetByRefundNo(ctx, refundNo)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	err = s.refundRepo.UpdateStatus(ctx, refund.ID, model.RefundStatusPending, model.RefundStatusProcessing,
+		map[string]interface{}{
+			"reviewer_id":   reviewerID,
+			"review_note":   req.Note,
+			"restore_stock": req.RestoreStock,
+			"reviewed_at":   now,
+		})
+	if err != nil {
+		if errors.Is(err, repository.ErrRefundStatusMismatch) {
+			return nil, ErrRefundStatusInvalid
+		}
+		return nil, err
+	}
+	refund.Status = model.RefundStatusProcessing
+	refund.RestoreStock = req.RestoreStock
+	refund.ReviewerID = &reviewerID
+
+	s.log.Info("refund approved",
+		zap.String("refund_no", refund.RefundNo),
+		zap.Int64("reviewer_id", reviewerID),
+	)
+
+	if err := s.executeRefund(ctx, refund); err != nil {
+		return nil, err
+	}
+
+	return s.refundRepo.GetByRefundNo(ctx, refundNo)
+}
+
+// RejectRefund 駁回退款申請，訂單回到已付款
+func (s *PaymentService) RejectRefund(ctx context.Context, reviewerID int64, refundNo string, req *ReviewRefundRequest) (*model.Refund, error) {
+	refund, err := s.refundRepo.GetByRefundNo(ctx, refundNo)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.refundRepo.UpdateStatus(ctx, refund.ID, model.RefundStatusPending, model.RefundStatusRejected,
+		map[string]interface{}{
+			"reviewer_id": reviewerID,
+			"review_note": req.Note,
+			"reviewed_at": time.Now(),
+		})
+	if err != nil {
+		if errors.Is(err, repository.ErrRefundStatusMismatch) {
+			return nil, ErrRefundStatusInvalid
+		}
+		return nil, err
+	}
+
+	reason := "退款申请被驳回"
+	if req.Note != "" {
+		reason += "：" + req.Note
+	}
+	s.revertRefundingOrder(ctx, refund, model.OrderTrigger{
+		Actor:   model.OrderActorAdmin,
+		ActorID: &reviewerID,
+		Reason:  reason,
+	})
+
+	return s.refundRepo.GetByRefundNo(ctx, refundNo)
+}
+
+// executeRefund 向供應商發起已核准的退款，無支付單的舊訂單直接完成
+func (s *PaymentService) executeRefund(ctx context.Context, refund *model.Refund) error {
+	if refund.PaymentID == nil {
+		return s.completeRefund(ctx, refund)
+	}
+
+	p, err := s.paymentRepo.GetByID(ctx, *refund.PaymentID)
+	if err != nil {
+		return err
+	}
+
+	provider, err := s.provider(p.Provider)
+	if err != nil {
+		s.failRefund(ctx, refund, err.Error())
+		return err
+	}
+
+	result, err := provider.Refund(ctx, &payment.RefundRequest{
+		IntentID:  *p.ProviderRef,
+		RefundNo:  refund.RefundNo,
+		Amount:    refund.Amount,
+		Reason:    refund.Reason,
+		NotifyURL: s.notifyURL(provider.Name()),
+	})
+	if err != nil {
+		s.failRefund(ctx, refund, "provider refund failed: "+err.Error())
+		return fmt.Errorf("failed to refund payment %s: %w", p.PaymentNo, err)
+	}
+
+	if err := s.refundRepo.BindProviderRefund(ctx, refund.ID, result.RefundID); err != nil {
+		return err
+	}
+	refund.ProviderRefundID = &result.RefundID
+
+	switch result.Status {
+	case payment.StatusSucceeded:
+		return s.completeRefund(ctx, refund)
+	case payment.StatusFailed:
+		s.failRefund(ctx, refund, "provider reported failure")
+	}
+	return nil
+}
+
+// syncRefund 向供應商查詢退款狀態並推進退款單
+func (s *PaymentService) syncRefund(ctx context.Context, provider payment.Provider, refund *model.Refund) error {
+	if refund.Status != model.RefundStatusProcessing || refund.ProviderRefundID == nil {
+		return nil
+	}
+
+	status, err := provider.QueryRefund(ctx, *refund.ProviderRefundID)
+	if err != nil {
+		return err
+	}
+
+	switch status {
+	case payment.StatusSucceeded:
+		return s.completeRefund(ctx, refund)
+	case payment.StatusFailed:
+		s.failRefund(ctx, refund, "provider reported failure")
+	}
+	return nil
+}
+
+// completeRefund 退款完成：推進退款單、支付單與訂單，並依設定歸還庫存
+func (s *PaymentService) completeRefund(ctx context.Context, refund *model.Refund) error {
+	err := s.refundRepo.UpdateStatus(ctx, refund.ID, model.RefundStatusProcessing, model.RefundStatusSucceeded,
+		map[string]interface{}{"refunded_at": time.Now()})
+	if err != nil {
+		if errors.Is(err, repository.ErrRefundStatusMismatch) {
+			return nil // 重複回調
+		}
+		return err
+	}
+
+	if refund.PaymentID != nil {
+		err := s.paymentRepo.UpdateStatus(ctx, *refund.PaymentID, model.PaymentStatusSucceeded, model.PaymentStatusRefunded, nil)
+		if err != nil && !errors.Is(err, repository.ErrPaymentStatusMismatch) {
+			s.log.Error("failed to mark payment refunded",
+				zap.String("refund_no", refund.RefundNo),
+				zap.Error(err),
+			)
+		}
+	}
+
+	order, err := s.orderRepo.GetByID(ctx, refund.OrderID)
+	if err != nil {
+		return err
+	}
+
+	// 自動退款的訂單已是取消狀態，不變更訂單
+	if order.Status != model.OrderStatusRefunding {
+		return nil
+	}
+
+	trigger := model.OrderTrigger{Actor: model.OrderActorPayment, Reason: "退款单 " + refund.RefundNo + " 退款成功"}
+	if refund.PaymentID == nil { // 無支付單的舊訂單由審核直接完成
+		trigger = model.OrderTrigger{Actor: model.OrderActorAdmin, ActorID: refund.ReviewerID, Reason: "退款单 " + refund.RefundNo + " 退款成功"}
+	}
+	if err := s.orderRepo.Transition(ctx, order, model.OrderStatusRefunded, trigger); err != nil {
+		return err
+	}
+	s.orderService.notifyOrderStatusChange(ctx, order, model.OrderStatusRefunding, model.OrderStatusRefunded)
+
+	s.log.Info("order refunded",
+		zap.String("order_no", order.OrderNo),
+		zap.String("refund_no", refund.RefundNo),
+	)
+
+	// 活動已取消時仍歸還，保持 DB 庫存與限購計數器一致
+	if refund.RestoreStock {
+		if order.FlashSale != nil && (order.FlashSale.IsActive() || order.FlashSale.Status == model.FlashSaleStatusCancelled) {
+			s.orderService.restoreStock(ctx, order)
+		} else {
+			s.log.Info("flash sale no longer active, skip refund stock return",
+				zap.String("order_no", order.OrderNo),
+				zap.Int64("flash_sale_id", order.FlashSaleID),
+			)
+		}
+	}
+
+	return nil
+}
+
+// failRefund 退款失敗：退款單標記失敗，訂單回到已付款
+func (s *PaymentService) failRefund(ctx context.Context, refund *model.Refund, reason string) {
+	err := s.refundRepo.UpdateStatus(ctx, refund.ID, model.RefundStatusProcessing, model.RefundStatusFailed,
+		map[string]interface{}{"failure_reason": truncatePaymentReason(reason)})
+	if err != nil {
+		if !errors.Is(err, repository.ErrRefundStatusMismatch) {
+			s.log.Error("failed to mark refund failed",
+				zap.String("refund_no", refund.RefundNo),
+				zap.Error(err),
+			)
+		}
+		return
+	}
+
+	s.log.Warn("refund failed",
+		zap.String("refund_no", refund.RefundNo),
+		zap.String("reason", reason),
+	)
+
+	s.revertRefundingOrder(ctx, refund, model.OrderTrigger{
+		Actor:  model.OrderActorPayment,
+		Reason: "退款单 " + refund.RefundNo + " 退款失败",
+	})
+}
+
+// revertRefundingOrder 退款駁回或失敗時將訂單從退款中還原為已付款
+func (s *PaymentService) revertRefundingOrder(ctx context.Context, refund *model.Refund, trigger model.OrderTrigger) {
+	order, err := s.orderRepo.GetByID(ctx, refund.OrderID)
+	if err != nil {
+		s.log.Error("failed to load order for refund revert",
+			zap.String("refund_no", refund.RefundNo),
+			zap.Error(err),
+		)
+		return
+	}
+
+	if order.Status != model.OrderStatusRefunding {
+		return
+	}
+
+	if err := s.orderRepo.Transition(ctx, order, model.OrderStatusPaid, trigger); err != nil {
+		s.log.Error("failed to revert refunding order",
+			zap.String("order_no", order.OrderNo),
+			zap.Error(err),
+		)
+		return
+	}
+	s.orderService.notifyOrderStatusChange(ctx, order, model.OrderStatusRefunding, model.OrderStatusPaid)
+}
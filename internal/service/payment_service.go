@@ -0,0 +1,312 @@
+// 支付服務
+//
+// 本檔案串接訂單與支付供應商：
+// 發起支付時建立支付單並向供應商建立支付意圖，返回付款頁面位址（不直接標記已付款）
+// 供應商回調驗簽後，以主動查詢的結果為準推進支付單狀態；支付成功才標記訂單已付款
+// 支付成功但訂單已被取消或過期（或已由另一筆支付單付款）時自動建立退款單並退款
+// 退款申請與審核見 payment_refund.go
+// 使用者查詢支付單時也會主動同步，回調遺失時不影響訂單狀態
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Mag1cFall/magtrade/internal/config"
+	"github.com/Mag1cFall/magtrade/internal/model"
+	"github.com/Mag1cFall/magtrade/internal/mq"
+	"github.com/Mag1cFall/magtrade/internal/pkg/utils"
+	"github.com/Mag1cFall/magtrade/internal/repository"
+	"github.com/Mag1cFall/magtrade/internal/service/payment"
+	"go.uber.org/zap"
+)
+
+var (
+	ErrPaymentProviderNotFound = errors.New("payment provider not found")
+	ErrOrderExpired            = errors.New("order payment window has expired")
+)
+
+// paymentWebhookPath 供應商回調路徑前綴，完整路徑為 {notify_base_url}/api/v1/payments/webhook/{provider}
+const paymentWebhookPath = "/api/v1/payments/webhook/"
+
+// PaymentService 支付服務
+type PaymentService struct {
+	paymentRepo  *repository.PaymentRepository
+	refundRepo   *repository.RefundRepository
+	orderRepo    *repository.OrderRepository
+	orderService *OrderService
+	providers    map[string]payment.Provider
+	cfg          *config.PaymentConfig
+	log          *zap.Logger
+}
+
+func NewPaymentService(cfg *config.PaymentConfig, deps *CacheDeps, producer *mq.Producer, log *zap.Logger) *PaymentService {
+	s := &PaymentService{
+		paymentRepo:  repository.NewPaymentRepository(),
+		refundRepo:   repository.NewRefundRepository(),
+		orderRepo:    repository.NewOrderRepository(),
+		orderService: NewOrderService(deps, producer, log),
+		providers:    make(map[string]payment.Provider),
+		cfg:          cfg,
+		log:          log,
+	}
+	s.RegisterProvider(payment.Mock(&cfg.Mock, log))
+	return s
+}
+
+// RegisterProvider 註冊支付供應商（同名覆蓋）
+func (s *PaymentService) RegisterProvider(provider payment.Provider) {
+	s.providers[provider.Name()] = provider
+}
+
+// Pay 發起支付，返回帶付款頁面位址的支付單
+// provider 為空時使用配置的預設供應商；訂單已有進行中的支付單時直接沿用
+func (s *PaymentService) Pay(ctx context.Context, userID int64, orderNo, providerName string) (*model.Payment, error) {
+	order, err := s.orderRepo.GetByOrderNo(ctx, orderNo)
+	if err != nil {
+		return nil, err
+	}
+
+	if order.UserID != userID {
+		return nil, repository.ErrOrderNotFound
+	}
+
+	if !order.CanPay() {
+		return nil, ErrOrderStatusInvalid
+	}
+	if order.FlashSale != nil && order.FlashSale.Status == model.FlashSaleStatusCancelled {
+		return nil, ErrFlashSaleCancelled // 尚未被活動取消流程取消
+	}
+	if order.IsExpired(time.Now()) {
+		return nil, ErrOrderExpired // 尚未被到期佇列取消
+	}
+
+	provider, err := s.provider(providerName)
+	if err != nil {
+		return nil, err
+	}
+
+	existing, err := s.paymentRepo.GetPendingByOrder(ctx, order.ID, provider.Name())
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		return existing, nil
+	}
+
+	p := &model.Payment{
+		PaymentNo: utils.GeneratePaymentNo(),
+		OrderID:   order.ID,
+		OrderNo:   order.OrderNo,
+		UserID:    order.UserID,
+		Provider:  provider.Name(),
+		Amount:    order.Amount,
+		Status:    model.PaymentStatusPending,
+	}
+	if err := s.paymentRepo.Create(ctx, p); err != nil {
+		return nil, err
+	}
+
+	intent, err := provider.CreateIntent(ctx, &payment.IntentRequest{
+		PaymentNo: p.PaymentNo,
+		Amount:    p.Amount,
+		Subject:   "MagTrade 订单 " + order.OrderNo,
+		NotifyURL: s.notifyURL(provider.Name()),
+	})
+	if err != nil {
+		s.fail(ctx, p, "create intent failed: "+err.Error())
+		return nil, fmt.Errorf("failed to create payment intent: %w", err)
+	}
+
+	if err := s.paymentRepo.BindIntent(ctx, p.ID, intent.ID, intent.PayURL); err != nil {
+		return nil, err
+	}
+	p.ProviderRef = &intent.ID
+	p.PayURL = intent.PayURL
+
+	s.log.Info("payment intent created",
+		zap.String("payment_no", p.PaymentNo),
+		zap.String("order_no", order.OrderNo),
+		zap.String("provider", provider.Name()),
+		zap.String("intent_id", intent.ID),
+	)
+
+	return p, nil
+}
+
+// GetByPaymentNo 查詢支付單（需驗證使用者），待支付時先向供應商同步狀態
+func (s *PaymentService) GetByPaymentNo(ctx context.Context, userID int64, paymentNo string) (*model.Payment, error) {
+	p, err := s.paymentRepo.GetByPaymentNo(ctx, paymentNo)
+	if err != nil {
+		return nil, err
+	}
+
+	if p.UserID != userID {
+		return nil, repository.ErrPaymentNotFound
+	}
+
+	if p.IsFinal() || p.ProviderRef == nil {
+		return p, nil
+	}
+
+	provider, err := s.provider(p.Provider)
+	if err != nil {
+		return p, nil
+	}
+	if err := s.sync(ctx, provider, p); err != nil {
+		s.log.Warn("failed to sync payment status",
+			zap.String("payment_no", p.PaymentNo),
+			zap.Error(err),
+		)
+		return p, nil
+	}
+
+	return s.paymentRepo.GetByPaymentNo(ctx, paymentNo)
+}
+
+// HandleCallback 處理供應商非同步回調，重複回調冪等
+// 簽名無效返回 payment.ErrInvalidSignature；回調內容不直接採信，以主動查詢結果為準
+func (s *PaymentService) HandleCallback(ctx context.Context, providerName string, header http.Header, body []byte) error {
+	provider, ok := s.providers[providerName]
+	if !ok {
+		return ErrPaymentProviderNotFound
+	}
+
+	event, err := provider.ParseCallback(header, body)
+	if err != nil {
+		return err
+	}
+
+	if event.Type == payment.EventRefund {
+		refund, err := s.refundRepo.GetByProviderRefundID(ctx, provider.Name(), event.RefundID)
+		if err != nil {
+			return err
+		}
+		return s.syncRefund(ctx, provider, refund)
+	}
+
+	p, err := s.paymentRepo.GetByProviderRef(ctx, provider.Name(), event.IntentID)
+	if err != nil {
+		return err
+	}
+
+	return s.sync(ctx, provider, p)
+}
+
+// sync 向供應商查詢支付意圖狀態並推進支付單
+func (s *PaymentService) sync(ctx context.Context, provider payment.Provider, p *model.Payment) error {
+	if p.IsFinal() {
+		return nil
+	}
+
+	status, err := provider.QueryStatus(ctx, *p.ProviderRef)
+	if err != nil {
+		return err
+	}
+
+	switch status {
+	case payment.StatusSucceeded:
+		return s.confirm(ctx, p)
+	case payment.StatusFailed:
+		s.fail(ctx, p, "provider reported failure")
+	}
+	return nil
+}
+
+// confirm 支付成功：推進支付單並標記訂單已付款（同一交易），訂單已不可付款時自動退款
+func (s *PaymentService) confirm(ctx context.Context, p *model.Payment) error {
+	order, err := s.orderRepo.GetByID(ctx, p.OrderID)
+	if err != nil {
+		return err
+	}
+
+	orderPaid, err := s.paymentRepo.Confirm(ctx, p, order, time.Now())
+	if err != nil {
+		if errors.Is(err, repository.ErrPaymentStatusMismatch) {
+			return nil // 並行回調已處理
+		}
+		return err
+	}
+
+	if orderPaid {
+		s.orderService.unscheduleExpiry(ctx, order)
+		s.orderService.notifyOrderStatusChange(ctx, order, model.OrderStatusPending, model.OrderStatusPaid)
+		s.log.Info("order paid",
+			zap.String("order_no", order.OrderNo),
+			zap.String("payment_no", p.PaymentNo),
+		)
+		return nil
+	}
+
+	// 款項已收但訂單已取消、過期或已由另一筆支付單付款，原路退回
+	s.log.Warn("payment succeeded for unpayable order, refunding",
+		zap.String("order_no", order.OrderNo),
+		zap.String("payment_no", p.PaymentNo),
+		zap.String("order_status", order.Status.String()),
+	)
+
+	refund := &model.Refund{
+		RefundNo:  utils.GenerateRefundNo(),
+		OrderID:   order.ID,
+		OrderNo:   order.OrderNo,
+		UserID:    order.UserID,
+		PaymentID: &p.ID,
+		Provider:  p.Provider,
+		Amount:    p.Amount,
+		Reason:    autoRefundReason,
+		Status:    model.RefundStatusProcessing,
+	}
+	if err := s.refundRepo.Create(ctx, refund); err != nil {
+		return err
+	}
+
+	return s.executeRefund(ctx, refund)
+}
+
+// fail 將待支付單標記為失敗
+func (s *PaymentService) fail(ctx context.Context, p *model.Payment, reason string) {
+	err := s.paymentRepo.UpdateStatus(ctx, p.ID, model.PaymentStatusPending, model.PaymentStatusFailed,
+		map[string]interface{}{"failure_reason": truncatePaymentReason(reason)})
+	if err != nil && !errors.Is(err, repository.ErrPaymentStatusMismatch) {
+		s.log.Error("failed to mark payment failed",
+			zap.String("payment_no", p.PaymentNo),
+			zap.Error(err),
+		)
+	}
+}
+
+// provider 取得供應商，name 為空時使用預設供應商
+func (s *PaymentService) provider(name string) (payment.Provider, error) {
+	if name == "" {
+		name = s.cfg.Provider
+	}
+	if name == "" {
+		name = payment.MockProviderName
+	}
+
+	provider, ok := s.providers[name]
+	if !ok {
+		return nil, ErrPaymentProviderNotFound
+	}
+	return provider, nil
+}
+
+// notifyURL 組裝供應商回調位址，未配置站點位址時不回調（僅靠主動查詢同步）
+func (s *PaymentService) notifyURL(provider string) string {
+	if s.cfg.NotifyBaseURL == "" {
+		return ""
+	}
+	return strings.TrimRight(s.cfg.NotifyBaseURL, "/") + paymentWebhookPath + provider
+}
+
+// truncatePaymentReason 截斷失敗原因至欄位長度（255 字元）
+func truncatePaymentReason(reason string) string {
+	if r := []rune(reason); len(r) > 255 {
+		return string(r[:255])
+	}
+	return reason
+}
@@ -0,0 +1,493 @@
+// 跨活動限購策略服務
+//
+// 本檔案提供限購策略的管理（建立、編輯、刪除、列表）與使用者計數器查詢，
+// 以及搶購時的兩階段預扣與訂單取消時的歸還：
+// 搶購放行前對所有適用策略暫扣計數器（單一 Redis 腳本，任一超限則不暫扣），暫扣於 limitHoldTTL 後自行到期；
+// 准入成功後確認暫扣（累加計數器），被拒絕時刪除暫扣；訂單取消時依下單時間所在週期歸還
+// 預扣與准入腳本無法合併（計數器跨活動、位於不同 slot）：准入腳本失敗或崩潰時暫扣自行到期，不會誤判超出限購；
+// 准入成功但未確認（崩潰或暫扣已到期）時計數器短少，由 ReconcileCounters 依訂單補足
+// 啟用策略快取於本地記憶體，其他實例最多在 limitPolicyCacheTTL 後看到策略變更
+package service
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/Mag1cFall/magtrade/internal/cache"
+	"github.com/Mag1cFall/magtrade/internal/model"
+	"github.com/Mag1cFall/magtrade/internal/pkg/validator"
+	"github.com/Mag1cFall/magtrade/internal/repository"
+	"go.uber.org/zap"
+)
+
+// limitPolicyCacheTTL 本地啟用策略快取的存活時間
+const limitPolicyCacheTTL = 10 * time.Second
+
+// limitCounterGrace 週期計數器在週期結束後額外保留的時間，容忍實例間時鐘偏差
+const limitCounterGrace = time.Minute
+
+// limitHoldTTL 搶購暫扣的存活時間，須遠大於一次准入腳本的執行時間
+const limitHoldTTL = 30 * time.Second
+
+// PurchaseLimitService 限購策略服務
+type PurchaseLimitService struct {
+	policyRepo    *repository.PurchaseLimitRepository
+	productRepo   *repository.ProductRepository
+	orderRepo     *repository.OrderRepository
+	flashSaleRepo *repository.FlashSaleRepository
+	counters      *cache.LimitCounterService
+	log           *zap.Logger
+
+	mu       sync.Mutex
+	policies []model.PurchaseLimitPolicy // 啟用策略快取
+	loadedAt time.Time
+}
+
+func NewPurchaseLimitService(log *zap.Logger) *PurchaseLimitService {
+	return &PurchaseLimitService{
+		policyRepo:    repository.NewPurchaseLimitRepository(),
+		productRepo:   repository.NewProductRepository(),
+		orderRepo:     repository.NewOrderRepository(),
+		flashSaleRepo: repository.NewFlashSaleRepository(),
+		counters:      cache.NewLimitCounterService(),
+		log:           log,
+	}
+}
+
+// CreatePurchaseLimitRequest 建立限購策略請求
+type CreatePurchaseLimitRequest struct {
+	Name        string                    `json:"name" binding:"required,max=100"`
+	Scope       model.PurchaseLimitScope  `json:"scope" binding:"required,oneof=product campaign"`
+	ProductID   *int64                    `json:"product_id"`                          // scope=product 時必填
+	Campaign    string                    `json:"campaign" binding:"omitempty,max=64"` // scope=campaign 時必填
+	MaxQuantity int                       `json:"max_quantity" binding:"required,gt=0"`
+	Window      model.PurchaseLimitWindow `json:"window" binding:"required,oneof=day week month lifetime"`
+	Timezone    string                    `json:"timezone"` // 預設 Asia/Shanghai
+	Enabled     *bool                     `json:"enabled"`  // 預設啟用
+}
+
+// UpdatePurchaseLimitRequest 編輯限購策略請求（未提供的欄位不變；範圍與對象不可修改）
+// 修改週期或時區後，既有計數器不再被讀取並於原 TTL 到期後清除
+type UpdatePurchaseLimitRequest struct {
+	Name        *string                    `json:"name" binding:"omitempty,max=100"`
+	MaxQuantity *int                       `json:"max_quantity" binding:"omitempty,gt=0"`
+	Window      *model.PurchaseLimitWindow `json:"window" binding:"omitempty,oneof=day week month lifetime"`
+	Timezone    *string                    `json:"timezone"`
+	Enabled     *bool                      `json:"enabled"`
+}
+
+// PurchaseLimitUsage 使用者在單一策略當前週期的用量
+type PurchaseLimitUsage struct {
+	Policy    *model.PurchaseLimitPolicy `json:"policy"`
+	Period    string                     `json:"period"` // 週期標識，lifetime 為 "all"
+	Used      int                        `json:"used"`
+	Remaining int                        `json:"remaining"`
+	ResetsAt  *time.Time                 `json:"resets_at,omitempty"` // 計數器過期時間，未購買時為空
+}
+
+// LimitReservation 搶購時暫扣的計數器，准入成功後據此確認、被拒絕時據此取消
+type LimitReservation struct {
+	Charges  []cache.LimitCharge
+	Quantity int
+	Ticket   string
+}
+
+// LimitCounterDrift 限購計數器與訂單推算用量的偏差
+type LimitCounterDrift struct {
+	PolicyID int64 `json:"policy_id"`
+	UserID   int64 `json:"user_id"`
+	Counter  int   `json:"counter"`  // 計數器當前值
+	Expected int   `json:"expected"` // 策略範圍內目前週期未取消訂單的數量合計
+	Repaired bool  `json:"repaired"`
+}
+
+// Create 建立策略
+func (s *PurchaseLimitService) Create(ctx context.Context, req *CreatePurchaseLimitRequest) (*model.PurchaseLimitPolicy, error) {
+	timezone := req.Timezone
+	if timezone == "" {
+		timezone = model.DefaultTemplateTimezone
+	}
+	enabled := true
+	if req.Enabled != nil {
+		enabled = *req.Enabled
+	}
+
+	policy := &model.PurchaseLimitPolicy{
+		Name:        req.Name,
+		Scope:       req.Scope,
+		MaxQuantity: req.MaxQuantity,
+		Window:      req.Window,
+		Timezone:    timezone,
+		Enabled:     enabled,
+	}
+	switch req.Scope {
+	case model.PurchaseLimitScopeProduct:
+		policy.ProductID = req.ProductID
+	case model.PurchaseLimitScopeCampaign:
+		policy.Campaign = req.Campaign
+	}
+
+	if err := s.validate(ctx, policy); err != nil {
+		return nil, err
+	}
+
+	if err := s.policyRepo.Create(ctx, policy); err != nil {
+		return nil, err
+	}
+	s.invalidate()
+
+	s.log.Info("purchase limit policy created",
+		zap.Int64("policy_id", policy.ID),
+		zap.String("scope", string(policy.Scope)),
+		zap.String("window", string(policy.Window)),
+		zap.Int("max_quantity", policy.MaxQuantity),
+	)
+	return policy, nil
+}
+
+// List 查詢所有策略
+func (s *PurchaseLimitService) List(ctx context.Context) ([]model.PurchaseLimitPolicy, error) {
+	return s.policyRepo.List(ctx)
+}
+
+// Update 編輯策略
+func (s *PurchaseLimitService) Update(ctx context.Context, id int64, req *UpdatePurchaseLimitRequest) (*model.PurchaseLimitPolicy, error) {
+	policy, err := s.policyRepo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	fields := make(map[string]interface{})
+	if req.Name != nil {
+		policy.Name = *req.Name
+		fields["name"] = *req.Name
+	}
+	if req.MaxQuantity != nil {
+		policy.MaxQuantity = *req.MaxQuantity
+		fields["max_quantity"] = *req.MaxQuantity
+	}
+	if req.Window != nil {
+		policy.Window = *req.Window
+		fields["limit_window"] = *req.Window
+	}
+	if req.Timezone != nil {
+		policy.Timezone = *req.Timezone
+		fields["timezone"] = *req.Timezone
+	}
+	if req.Enabled != nil {
+		policy.Enabled = *req.Enabled
+		fields["enabled"] = *req.Enabled
+	}
+
+	if len(fields) == 0 {
+		return policy, nil
+	}
+
+	if err := s.validate(ctx, policy); err != nil {
+		return nil, err
+	}
+
+	if err := s.policyRepo.UpdateFields(ctx, id, fields); err != nil {
+		return nil, err
+	}
+	s.invalidate()
+
+	s.log.Info("purchase limit policy updated", zap.Int64("policy_id", id), zap.Int("fields", len(fields)))
+	return s.policyRepo.GetByID(ctx, id)
+}
+
+// Delete 刪除策略，既有計數器於 TTL 到期後清除
+func (s *PurchaseLimitService) Delete(ctx context.Context, id int64) error {
+	if err := s.policyRepo.Delete(ctx, id); err != nil {
+		return err
+	}
+	s.invalidate()
+
+	s.log.Info("purchase limit policy deleted", zap.Int64("policy_id", id))
+	return nil
+}
+
+// UserUsage 查詢使用者在所有啟用策略當前週期的用量（直接讀取 DB，不使用本地快取）
+func (s *PurchaseLimitService) UserUsage(ctx context.Context, userID int64) ([]PurchaseLimitUsage, error) {
+	policies, err := s.policyRepo.ListEnabled(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	usages := make([]PurchaseLimitUsage, 0, len(policies))
+	keys := make([]string, 0, len(policies))
+	for i := range policies {
+		period, _, err := policies[i].Period(now)
+		if err != nil {
+			return nil, err
+		}
+		usages = append(usages, PurchaseLimitUsage{Policy: &policies[i], Period: period})
+		keys = append(keys, cache.PurchaseLimitKey(userID, policies[i].ID, period))
+	}
+
+	counters, err := s.counters.Counters(ctx, keys)
+	if err != nil {
+		return nil, err
+	}
+	for i, counter := range counters {
+		usages[i].Used = counter.Used
+		usages[i].Remaining = max(usages[i].Policy.MaxQuantity-counter.Used, 0)
+		if counter.TTL > 0 {
+			resetsAt := now.Add(counter.TTL)
+			usages[i].ResetsAt = &resetsAt
+		}
+	}
+	return usages, nil
+}
+
+// Reserve 以搶購憑證對活動適用的所有策略暫扣計數器
+// 返回暫扣紀錄（無適用策略時為 nil）與超出上限的策略（未超限時為 nil，此時未暫扣任何計數器）
+func (s *PurchaseLimitService) Reserve(ctx context.Context, flashSale *model.FlashSale, userID int64, quantity int, ticket string) (*LimitReservation, *model.PurchaseLimitPolicy, error) {
+	policies, err := s.applicable(ctx, flashSale)
+	if err != nil || len(policies) == 0 {
+		return nil, nil, err
+	}
+
+	now := time.Now()
+	charges := make([]cache.LimitCharge, len(policies))
+	for i := range policies {
+		period, end, err := policies[i].Period(now)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		charges[i] = cache.LimitCharge{
+			Key: cache.PurchaseLimitKey(userID, policies[i].ID, period),
+			Max: policies[i].MaxQuantity,
+			TTL: limitCounterTTL(flashSale, end, now),
+		}
+	}
+
+	exceeded, err := s.counters.Reserve(ctx, charges, quantity, ticket, limitHoldTTL)
+	if err != nil {
+		return nil, nil, err
+	}
+	if exceeded >= 0 {
+		return nil, &policies[exceeded], nil
+	}
+
+	return &LimitReservation{Charges: charges, Quantity: quantity, Ticket: ticket}, nil, nil
+}
+
+// Confirm 准入成功後確認暫扣，失敗只記日誌（暫扣到期後計數器短少，由對帳補足）
+func (s *PurchaseLimitService) Confirm(ctx context.Context, reservation *LimitReservation) {
+	if reservation == nil {
+		return
+	}
+	if err := s.counters.Confirm(ctx, reservation.Charges, reservation.Quantity, reservation.Ticket); err != nil {
+		s.log.Error("failed to confirm purchase limit hold", zap.String("ticket", reservation.Ticket), zap.Error(err))
+	}
+}
+
+// Release 准入被拒絕時取消暫扣，失敗只記日誌（暫扣於 limitHoldTTL 後自行到期）
+func (s *PurchaseLimitService) Release(ctx context.Context, reservation *LimitReservation) {
+	if reservation == nil {
+		return
+	}
+	if err := s.counters.Cancel(ctx, reservation.Charges, reservation.Ticket); err != nil {
+		s.log.Error("failed to cancel purchase limit hold", zap.String("ticket", reservation.Ticket), zap.Error(err))
+	}
+}
+
+// ReleaseOrder 訂單取消時歸還下單時間所在週期的計數器，失敗只記日誌（計數器於週期結束後自然過期）
+// 以目前適用的策略計算，下單後新增的策略不會有對應計數器（歸還腳本略過不存在的 Key）
+func (s *PurchaseLimitService) ReleaseOrder(ctx context.Context, flashSale *model.FlashSale, order *model.Order) {
+	policies, err := s.applicable(ctx, flashSale)
+	if err != nil {
+		s.log.Error("failed to load purchase limit policies", zap.String("order_no", order.OrderNo), zap.Error(err))
+		return
+	}
+	if len(policies) == 0 {
+		return
+	}
+
+	keys := make([]string, 0, len(policies))
+	for i := range policies {
+		period, _, err := policies[i].Period(order.CreatedAt)
+		if err != nil {
+			continue
+		}
+		keys = append(keys, cache.PurchaseLimitKey(order.UserID, policies[i].ID, period))
+	}
+	if err := s.counters.Release(ctx, keys, order.Quantity); err != nil {
+		s.log.Error("failed to release purchase limit counters", zap.Strings("keys", keys), zap.Error(err))
+	}
+}
+
+// ReconcileCounters 依訂單重建在本活動下單的使用者於目前週期的限購計數器（庫存對帳時呼叫），返回偏差
+// 計數器低於訂單用量（計數器遺失或准入後未確認暫扣）時補足；高於訂單用量可能是已准入、尚未建單的在途訊息，
+// 只在策略適用的活動都未進行時下修。修正以 CompareAndSet 執行，期間有搶購或歸還時放棄
+func (s *PurchaseLimitService) ReconcileCounters(ctx context.Context, flashSale *model.FlashSale, repair bool) ([]LimitCounterDrift, error) {
+	policies, err := s.applicable(ctx, flashSale)
+	if err != nil || len(policies) == 0 {
+		return nil, err
+	}
+
+	rows, err := s.orderRepo.SumActiveQuantityByUser(ctx, flashSale.ID)
+	if err != nil || len(rows) == 0 {
+		return nil, err
+	}
+	userIDs := make([]int64, len(rows))
+	for i, row := range rows {
+		userIDs[i] = row.UserID
+	}
+
+	active, err := s.flashSaleRepo.ListActive(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	var drifts []LimitCounterDrift
+	for i := range policies {
+		policy := &policies[i]
+		period, start, end, err := policy.PeriodRange(now)
+		if err != nil {
+			return drifts, err
+		}
+
+		usage, err := s.orderRepo.SumActiveQuantityByPolicy(ctx, policy, userIDs, start)
+		if err != nil {
+			return drifts, err
+		}
+		expected := make(map[int64]int, len(usage))
+		for _, row := range usage {
+			expected[row.UserID] = row.Quantity
+		}
+
+		keys := make([]string, len(userIDs))
+		for j, userID := range userIDs {
+			keys[j] = cache.PurchaseLimitKey(userID, policy.ID, period)
+		}
+		counters, err := s.counters.Counters(ctx, keys)
+		if err != nil {
+			return drifts, err
+		}
+
+		canLower := !policyInProgress(policy, active)
+		ttl := limitCounterTTL(flashSale, end, now)
+		for j, userID := range userIDs {
+			drift := LimitCounterDrift{
+				PolicyID: policy.ID,
+				UserID:   userID,
+				Counter:  counters[j].Used,
+				Expected: expected[userID],
+			}
+			if drift.Counter == drift.Expected {
+				continue
+			}
+
+			if repair && ttl > 0 && (drift.Counter < drift.Expected || canLower) {
+				drift.Repaired, err = s.counters.CompareAndSet(ctx, keys[j], drift.Counter, drift.Expected, ttl)
+				if err != nil {
+					return drifts, err
+				}
+			}
+			drifts = append(drifts, drift)
+		}
+	}
+	return drifts, nil
+}
+
+// policyInProgress 判斷策略是否適用於任一進行中的活動（可能有在途訊息）
+func policyInProgress(policy *model.PurchaseLimitPolicy, active []model.FlashSale) bool {
+	for i := range active {
+		if policy.Applies(&active[i]) {
+			return true
+		}
+	}
+	return false
+}
+
+// limitCounterTTL 計數器存活時間：自然週期的計數器在週期結束後過期；
+// lifetime 計數器（end 為零值）保留至本場活動結束後（多場活動取最晚者）
+func limitCounterTTL(flashSale *model.FlashSale, end, now time.Time) time.Duration {
+	if end.IsZero() {
+		return cacheTTL(flashSale)
+	}
+	return end.Sub(now) + limitCounterGrace
+}
+
+// applicable 篩選適用於活動的啟用策略
+func (s *PurchaseLimitService) applicable(ctx context.Context, flashSale *model.FlashSale) ([]model.PurchaseLimitPolicy, error) {
+	policies, err := s.enabledPolicies(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var matched []model.PurchaseLimitPolicy
+	for i := range policies {
+		if policies[i].Applies(flashSale) {
+			matched = append(matched, policies[i])
+		}
+	}
+	return matched, nil
+}
+
+// enabledPolicies 取得啟用策略，本地快取過期時重新載入；載入失敗時沿用舊快取
+func (s *PurchaseLimitService) enabledPolicies(ctx context.Context) ([]model.PurchaseLimitPolicy, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.loadedAt.IsZero() && time.Since(s.loadedAt) < limitPolicyCacheTTL {
+		return s.policies, nil
+	}
+
+	policies, err := s.policyRepo.ListEnabled(ctx)
+	if err != nil {
+		if s.loadedAt.IsZero() {
+			return nil, err
+		}
+		s.log.Warn("failed to reload purchase limit policies, using cached", zap.Error(err))
+		return s.policies, nil
+	}
+
+	s.policies = policies
+	s.loadedAt = time.Now()
+	return policies, nil
+}
+
+// invalidate 清除本實例的策略快取
+func (s *PurchaseLimitService) invalidate() {
+	s.mu.Lock()
+	s.loadedAt = time.Time{}
+	s.mu.Unlock()
+}
+
+// validate 驗證策略：範圍與對象一致、商品存在、時區可解析
+func (s *PurchaseLimitService) validate(ctx context.Context, policy *model.PurchaseLimitPolicy) error {
+	var errs []*validator.ValidationError
+
+	switch policy.Scope {
+	case model.PurchaseLimitScopeProduct:
+		if policy.ProductID == nil {
+			errs = append(errs, &validator.ValidationError{Field: "product_id", Message: "商品限购必须指定商品"})
+		} else if _, err := s.productRepo.GetByID(ctx, *policy.ProductID); err != nil {
+			if !errors.Is(err, repository.ErrProductNotFound) {
+				return err
+			}
+			errs = append(errs, &validator.ValidationError{Field: "product_id", Message: "商品不存在"})
+		}
+	case model.PurchaseLimitScopeCampaign:
+		if policy.Campaign == "" {
+			errs = append(errs, &validator.ValidationError{Field: "campaign", Message: "档期限购必须指定档期"})
+		}
+	}
+
+	if _, err := policy.Location(); err != nil {
+		errs = append(errs, &validator.ValidationError{Field: "timezone", Message: "无效的时区"})
+	}
+
+	if len(errs) > 0 {
+		return &ValidationFailedError{Errors: errs}
+	}
+	return nil
+}
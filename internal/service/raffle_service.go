@@ -0,0 +1,286 @@
+// 抽籤業務服務
+//
+// 本檔案處理抽籤類型秒殺活動：登記、抽籤、中籤建單
+// 登記期間為活動開始至結束，截止後由排程以隨機種子抽出中籤者
+// 每位中籤者購買 1 件，名額 = 活動總庫存
+// 中籤者經 Redis 扣減庫存後走 OrderService 一般建單流程，重試時以訂單冪等檢查避免重複
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/Mag1cFall/magtrade/internal/cache"
+	"github.com/Mag1cFall/magtrade/internal/model"
+	"github.com/Mag1cFall/magtrade/internal/mq"
+	"github.com/Mag1cFall/magtrade/internal/pkg/utils"
+	"github.com/Mag1cFall/magtrade/internal/repository"
+	"go.uber.org/zap"
+)
+
+var (
+	ErrNotRaffleSale = errors.New("flash sale is not a raffle")
+	ErrRaffleClosed  = errors.New("raffle registration is closed")
+)
+
+// raffleQuantity 每位中籤者的購買數量
+const raffleQuantity = 1
+
+// RaffleService 抽籤業務服務
+type RaffleService struct {
+	raffleRepo    *repository.RaffleRepository
+	flashSaleRepo *repository.FlashSaleRepository
+	orderService  *OrderService
+	stockService  cache.StockStore
+	log           *zap.Logger
+}
+
+func NewRaffleService(deps *CacheDeps, producer *mq.Producer, log *zap.Logger) *RaffleService {
+	return &RaffleService{
+		raffleRepo:    repository.NewRaffleRepository(),
+		flashSaleRepo: repository.NewFlashSaleRepository(),
+		orderService:  NewOrderService(deps, producer, log),
+		stockService:  deps.Stock,
+		log:           log,
+	}
+}
+
+// RaffleStatusResponse 抽籤狀態回應
+type RaffleStatusResponse struct {
+	FlashSaleID int64              `json:"flash_sale_id"`
+	Entered     bool               `json:"entered"`
+	Entry       *model.RaffleEntry `json:"entry,omitempty"`
+	EntryCount  int64              `json:"entry_count"`
+	Draw        *model.RaffleDraw  `json:"draw,omitempty"` // 抽籤後公開種子與中籤名單，供驗證
+}
+
+// RaffleOutcome 抽籤結果（供 Worker 推送通知）
+type RaffleOutcome struct {
+	FlashSaleID int64
+	UserID      int64
+	Won         bool
+	OrderNo     string
+}
+
+// Enter 登記參與抽籤
+func (s *RaffleService) Enter(ctx context.Context, userID, flashSaleID int64) (*model.RaffleEntry, error) {
+	flashSale, err := s.flashSaleRepo.GetByID(ctx, flashSaleID)
+	if err != nil {
+		return nil, err
+	}
+
+	if !flashSale.IsRaffle() {
+		return nil, ErrNotRaffleSale
+	}
+	if !flashSale.IsActive() {
+		return nil, ErrRaffleClosed
+	}
+
+	entry := &model.RaffleEntry{
+		FlashSaleID: flashSaleID,
+		UserID:      userID,
+		Result:      model.RaffleResultPending,
+	}
+	if err := s.raffleRepo.CreateEntry(ctx, entry); err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+// Status 查詢使用者的抽籤狀態
+func (s *RaffleService) Status(ctx context.Context, userID, flashSaleID int64) (*RaffleStatusResponse, error) {
+	flashSale, err := s.flashSaleRepo.GetByID(ctx, flashSaleID)
+	if err != nil {
+		return nil, err
+	}
+	if !flashSale.IsRaffle() {
+		return nil, ErrNotRaffleSale
+	}
+
+	entry, err := s.raffleRepo.GetEntry(ctx, flashSaleID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	count, err := s.raffleRepo.CountEntries(ctx, flashSaleID)
+	if err != nil {
+		return nil, err
+	}
+
+	draw, err := s.raffleRepo.GetDraw(ctx, flashSaleID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &RaffleStatusResponse{
+		FlashSaleID: flashSaleID,
+		Entered:     entry != nil,
+		Entry:       entry,
+		EntryCount:  count,
+		Draw:        draw,
+	}, nil
+}
+
+// DrawDue 對登記已截止的抽籤活動抽籤並建立中籤訂單（定時任務呼叫）
+func (s *RaffleService) DrawDue(ctx context.Context) ([]RaffleOutcome, error) {
+	flashSales, err := s.raffleRepo.ListDue(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var outcomes []RaffleOutcome
+	for i := range flashSales {
+		result, err := s.Draw(ctx, &flashSales[i])
+		if err != nil {
+			s.log.Error("failed to draw raffle",
+				zap.Int64("flash_sale_id", flashSales[i].ID),
+				zap.Error(err),
+			)
+		}
+		outcomes = append(outcomes, result...)
+	}
+	return outcomes, nil
+}
+
+// Draw 對單一活動抽籤並建立中籤訂單
+// 抽籤紀錄已存在時沿用原結果，只補建尚未建立的中籤訂單
+func (s *RaffleService) Draw(ctx context.Context, flashSale *model.FlashSale) ([]RaffleOutcome, error) {
+	var outcomes []RaffleOutcome
+
+	draw, err := s.raffleRepo.GetDraw(ctx, flashSale.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	if draw == nil {
+		var losers []int64
+		draw, losers, err = s.newDraw(ctx, flashSale)
+		if errors.Is(err, repository.ErrRaffleAlreadyDrawn) {
+			return nil, nil // 其他實例已抽籤，由其完成建單
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		for _, userID := range losers {
+			outcomes = append(outcomes, RaffleOutcome{FlashSaleID: flashSale.ID, UserID: userID})
+		}
+	}
+
+	var winners []int64
+	if err := json.Unmarshal([]byte(draw.Winners), &winners); err != nil {
+		return outcomes, err
+	}
+
+	fulfilled := true
+	for _, userID := range winners {
+		orderNo, created, err := s.fulfill(ctx, flashSale, userID)
+		if err != nil {
+			fulfilled = false
+			s.log.Error("failed to create raffle order",
+				zap.Int64("flash_sale_id", flashSale.ID),
+				zap.Int64("user_id", userID),
+				zap.Error(err),
+			)
+			continue
+		}
+		if created {
+			outcomes = append(outcomes, RaffleOutcome{FlashSaleID: flashSale.ID, UserID: userID, Won: true, OrderNo: orderNo})
+		}
+	}
+
+	if fulfilled {
+		if err := s.raffleRepo.MarkFulfilled(ctx, draw.ID); err != nil {
+			return outcomes, err
+		}
+	}
+	return outcomes, nil
+}
+
+// newDraw 產生種子、抽出中籤者並保存抽籤紀錄
+func (s *RaffleService) newDraw(ctx context.Context, flashSale *model.FlashSale) (*model.RaffleDraw, []int64, error) {
+	userIDs, err := s.raffleRepo.ListEntryUserIDs(ctx, flashSale.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	seed, err := utils.NewDrawSeed()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	winners, losers := utils.DrawWinners(seed, userIDs, flashSale.TotalStock/raffleQuantity)
+
+	winnersJSON, err := json.Marshal(winners)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	draw := &model.RaffleDraw{
+		FlashSaleID: flashSale.ID,
+		Seed:        seed,
+		EntriesHash: utils.EntriesDigest(userIDs),
+		EntryCount:  len(userIDs),
+		WinnerCount: len(winners),
+		Winners:     string(winnersJSON),
+		DrawnAt:     time.Now(),
+	}
+
+	if err := s.raffleRepo.SaveDraw(ctx, draw, winners, losers); err != nil {
+		return nil, nil, err
+	}
+
+	s.log.Info("raffle drawn",
+		zap.Int64("flash_sale_id", flashSale.ID),
+		zap.String("seed", seed),
+		zap.Int("entries", len(userIDs)),
+		zap.Int("winners", len(winners)),
+	)
+	return draw, losers, nil
+}
+
+// fulfill 為中籤者扣減庫存並建立訂單，返回訂單號與本次是否新建
+func (s *RaffleService) fulfill(ctx context.Context, flashSale *model.FlashSale, userID int64) (string, bool, error) {
+	entry, err := s.raffleRepo.GetEntry(ctx, flashSale.ID, userID)
+	if err != nil {
+		return "", false, err
+	}
+	if entry != nil && entry.OrderNo != "" {
+		return entry.OrderNo, false, nil
+	}
+
+	// 扣減 Redis 庫存與已購計數；-2 表示先前重試已扣減過
+	result, err := s.stockService.Deduct(ctx, &cache.DeductRequest{
+		FlashSaleID: flashSale.ID,
+		UserID:      userID,
+		Quantity:    raffleQuantity,
+		Limit:       raffleQuantity,
+		BoughtTTL:   cacheTTL(flashSale),
+	})
+	if err != nil {
+		return "", false, err
+	}
+	if !result.Success && result.Code != -2 {
+		return "", false, errors.New(result.Message)
+	}
+
+	ticket := utils.GenerateTicket()
+	order, err := s.orderService.CreateFromMessage(ctx, &mq.FlashSaleOrderMessage{
+		MessageID:   ticket,
+		Timestamp:   time.Now(),
+		FlashSaleID: flashSale.ID,
+		UserID:      userID,
+		Quantity:    raffleQuantity,
+		Ticket:      ticket,
+	})
+	if err != nil {
+		return "", false, err
+	}
+
+	if err := s.raffleRepo.SetEntryOrder(ctx, flashSale.ID, userID, order.OrderNo); err != nil {
+		return "", false, err
+	}
+	return order.OrderNo, true, nil
+}
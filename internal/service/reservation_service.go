@@ -0,0 +1,154 @@
+// 活動預約業務服務
+//
+// 本檔案處理秒殺活動預約：預約、取消、查詢與開賣提醒
+// 只能預約尚未開始的活動；提醒由排程於開始前發送，郵件在此發送，WebSocket 推送由 Worker 負責
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/Mag1cFall/magtrade/internal/cache"
+	"github.com/Mag1cFall/magtrade/internal/config"
+	"github.com/Mag1cFall/magtrade/internal/model"
+	"github.com/Mag1cFall/magtrade/internal/repository"
+	"go.uber.org/zap"
+)
+
+var (
+	ErrReservationClosed = errors.New("flash sale is not open for reservation")
+	ErrNotReserved       = errors.New("flash sale is limited to reserved users")
+)
+
+// reminderBatchSize 每輪最多發送的提醒數量
+const reminderBatchSize = 200
+
+// ReservationService 預約業務服務
+type ReservationService struct {
+	reservationRepo *repository.ReservationRepository
+	flashSaleRepo   *repository.FlashSaleRepository
+	reservedCache   *cache.ReservationCache
+	emailService    *EmailService
+	log             *zap.Logger
+}
+
+func NewReservationService(emailCfg *config.EmailConfig, log *zap.Logger) *ReservationService {
+	return &ReservationService{
+		reservationRepo: repository.NewReservationRepository(),
+		flashSaleRepo:   repository.NewFlashSaleRepository(),
+		reservedCache:   cache.NewReservationCache(),
+		emailService:    NewEmailService(cache.GetClient(), emailCfg),
+		log:             log,
+	}
+}
+
+// ReservationStatusResponse 預約狀態回應
+type ReservationStatusResponse struct {
+	FlashSaleID  int64     `json:"flash_sale_id"`
+	Reserved     bool      `json:"reserved"`
+	ReservedOnly bool      `json:"reserved_only"` // 是否僅限預約使用者搶購
+	Count        int64     `json:"count"`         // 預約人數
+	RemindAt     time.Time `json:"remind_at"`     // 開賣提醒時間
+}
+
+// Reserve 預約活動
+func (s *ReservationService) Reserve(ctx context.Context, userID, flashSaleID int64) (*model.Reservation, error) {
+	flashSale, err := s.flashSaleRepo.GetByID(ctx, flashSaleID)
+	if err != nil {
+		return nil, err
+	}
+	if !flashSale.IsPending() {
+		return nil, ErrReservationClosed
+	}
+
+	reservation := &model.Reservation{
+		FlashSaleID: flashSaleID,
+		UserID:      userID,
+	}
+	if err := s.reservationRepo.Create(ctx, reservation); err != nil {
+		return nil, err
+	}
+
+	if err := s.reservedCache.Add(ctx, flashSaleID, userID); err != nil {
+		s.log.Error("failed to add reservation to cache", zap.Int64("flash_sale_id", flashSaleID), zap.Error(err))
+	}
+	return reservation, nil
+}
+
+// Cancel 取消預約（僅限活動開始前）
+func (s *ReservationService) Cancel(ctx context.Context, userID, flashSaleID int64) error {
+	flashSale, err := s.flashSaleRepo.GetByID(ctx, flashSaleID)
+	if err != nil {
+		return err
+	}
+	if !flashSale.IsPending() {
+		return ErrReservationClosed
+	}
+
+	if err := s.reservationRepo.Delete(ctx, flashSaleID, userID); err != nil {
+		return err
+	}
+
+	if err := s.reservedCache.Remove(ctx, flashSaleID, userID); err != nil {
+		s.log.Error("failed to remove reservation from cache", zap.Int64("flash_sale_id", flashSaleID), zap.Error(err))
+	}
+	return nil
+}
+
+// Status 查詢使用者的預約狀態
+func (s *ReservationService) Status(ctx context.Context, userID, flashSaleID int64) (*ReservationStatusResponse, error) {
+	flashSale, err := s.flashSaleRepo.GetByID(ctx, flashSaleID)
+	if err != nil {
+		return nil, err
+	}
+
+	reserved, err := s.reservationRepo.Exists(ctx, flashSaleID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	count, err := s.reservationRepo.Count(ctx, flashSaleID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ReservationStatusResponse{
+		FlashSaleID:  flashSaleID,
+		Reserved:     reserved,
+		ReservedOnly: flashSale.ReservedOnly,
+		Count:        count,
+		RemindAt:     flashSale.StartTime.Add(-flashSale.RemindBefore()),
+	}, nil
+}
+
+// SendDueReminders 發送已到提醒時間的開賣提醒郵件，返回本輪提醒的預約供推送 WebSocket
+// 郵件發送失敗只記錄日誌，仍標記已提醒，避免重複打擾使用者
+func (s *ReservationService) SendDueReminders(ctx context.Context) ([]repository.DueReminder, error) {
+	reminders, err := s.reservationRepo.ListDueReminders(ctx, reminderBatchSize)
+	if err != nil {
+		return nil, err
+	}
+	if len(reminders) == 0 {
+		return nil, nil
+	}
+
+	ids := make([]int64, 0, len(reminders))
+	for _, r := range reminders {
+		if err := s.emailService.SendFlashSaleReminder(r.Email, r.Username, r.ProductName, r.FlashSaleID, r.StartTime); err != nil {
+			s.log.Error("failed to send flash sale reminder email",
+				zap.Int64("flash_sale_id", r.FlashSaleID),
+				zap.Int64("user_id", r.UserID),
+				zap.Error(err),
+			)
+		}
+		ids = append(ids, r.ReservationID)
+	}
+
+	if err := s.reservationRepo.MarkReminded(ctx, ids); err != nil {
+		return nil, err
+	}
+
+	s.log.Info("sent flash sale reminders", zap.Int("count", len(reminders)))
+	return reminders, nil
+}
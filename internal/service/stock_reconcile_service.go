@@ -0,0 +1,346 @@
+// 庫存對帳服務
+//
+// 本檔案比對 Redis 庫存、DB 庫存與訂單推算的預期庫存，多規格活動同時比對各規格庫存
+// 預期庫存 = 總庫存 − 未取消訂單數量合計（規格以該規格的訂單計算）
+// DB 偏差以樂觀鎖自動修復；Redis 偏差只在活動已結束或取消超過 redisRepairGrace 且 Outbox 已清空時自動修復，其餘只告警
+// （已投遞至 Kafka 但尚未建單的訊息不在 Outbox 中，進行中或暫停的活動無法排除在途准入）
+// 同時依訂單重建本活動使用者的跨活動限購計數器（准入後未確認暫扣會少計，見 PurchaseLimitService.ReconcileCounters）
+// 修復時持有庫存調整鎖，與管理員調整庫存互斥
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Mag1cFall/magtrade/internal/cache"
+	"github.com/Mag1cFall/magtrade/internal/model"
+	"github.com/Mag1cFall/magtrade/internal/repository"
+	"go.uber.org/zap"
+)
+
+// StockReconcileReport 單一活動的對帳報告
+type StockReconcileReport struct {
+	FlashSaleID   int64                 `json:"flash_sale_id"`
+	Status        model.FlashSaleStatus `json:"status"`
+	TotalStock    int                   `json:"total_stock"`
+	SoldQuantity  int                   `json:"sold_quantity"`  // 未取消訂單數量合計
+	ExpectedStock int                   `json:"expected_stock"` // 推算的正確庫存
+	DBStock       int                   `json:"db_stock"`
+	DBDiff        int                   `json:"db_diff"` // DB 庫存 − 預期庫存
+	RedisStock    int                   `json:"redis_stock"`
+	RedisExists   bool                  `json:"redis_exists"`
+	RedisDiff     int                   `json:"redis_diff"` // Redis 庫存 − 預期庫存
+	InFlight      int64                 `json:"in_flight"`  // Outbox 中尚未建單的訊息數
+	Items         []ItemReconcileReport `json:"items,omitempty"`
+	LimitDrifts   []LimitCounterDrift   `json:"limit_drifts,omitempty"`
+	Consistent    bool                  `json:"consistent"`
+	DBRepaired    bool                  `json:"db_repaired"`
+	RedisRepaired bool                  `json:"redis_repaired"`
+	Alerts        []string              `json:"alerts,omitempty"`
+	CheckedAt     time.Time             `json:"checked_at"`
+}
+
+// ItemReconcileReport 多規格活動中單一規格的對帳結果
+type ItemReconcileReport struct {
+	ItemID        int64 `json:"item_id"`
+	TotalStock    int   `json:"total_stock"`
+	SoldQuantity  int   `json:"sold_quantity"`
+	ExpectedStock int   `json:"expected_stock"`
+	DBStock       int   `json:"db_stock"`
+	DBDiff        int   `json:"db_diff"`
+	RedisStock    int   `json:"redis_stock"`
+	RedisExists   bool  `json:"redis_exists"`
+	RedisDiff     int   `json:"redis_diff"`
+	DBRepaired    bool  `json:"db_repaired"`
+	RedisRepaired bool  `json:"redis_repaired"`
+}
+
+// StockReconcileService 庫存對帳服務
+type StockReconcileService struct {
+	flashSaleRepo *repository.FlashSaleRepository
+	orderRepo     *repository.OrderRepository
+	stockService  *cache.StockService
+	outbox        *cache.OutboxService
+	limits        *PurchaseLimitService
+	log           *zap.Logger
+}
+
+func NewStockReconcileService(log *zap.Logger) *StockReconcileService {
+	return &StockReconcileService{
+		flashSaleRepo: repository.NewFlashSaleRepository(),
+		orderRepo:     repository.NewOrderRepository(),
+		stockService:  cache.NewStockService(),
+		outbox:        cache.NewOutboxService(),
+		limits:        NewPurchaseLimitService(log),
+		log:           log,
+	}
+}
+
+// Reconcile 對單一活動進行對帳，repair 為 true 時嘗試自動修復
+func (s *StockReconcileService) Reconcile(ctx context.Context, flashSaleID int64, repair bool) (*StockReconcileReport, error) {
+	flashSale, err := s.flashSaleRepo.GetByID(ctx, flashSaleID)
+	if err != nil {
+		return nil, err
+	}
+	return s.reconcileLocked(ctx, flashSale, repair)
+}
+
+// ReconcileAll 對所有待開始、進行中及近期結束的活動進行對帳（定時任務呼叫）
+func (s *StockReconcileService) ReconcileAll(ctx context.Context, finishedWithin time.Duration) error {
+	flashSales, err := s.flashSaleRepo.ListForReconcile(ctx, time.Now().Add(-finishedWithin))
+	if err != nil {
+		return err
+	}
+
+	for i := range flashSales {
+		if _, err := s.reconcileLocked(ctx, &flashSales[i], true); err != nil {
+			s.log.Error("failed to reconcile flash sale stock",
+				zap.Int64("flash_sale_id", flashSales[i].ID),
+				zap.Error(err),
+			)
+		}
+	}
+	return nil
+}
+
+// reconcileLocked 修復模式下先取得庫存調整鎖，避免與管理員調整庫存同時修改
+func (s *StockReconcileService) reconcileLocked(ctx context.Context, flashSale *model.FlashSale, repair bool) (*StockReconcileReport, error) {
+	if repair {
+		unlock, err := lockStockAdjust(ctx, flashSale.ID)
+		if err != nil {
+			return nil, err
+		}
+		defer unlock()
+	}
+	return s.reconcile(ctx, flashSale, repair)
+}
+
+// reconcile 對帳主流程
+func (s *StockReconcileService) reconcile(ctx context.Context, flashSale *model.FlashSale, repair bool) (*StockReconcileReport, error) {
+	sold, err := s.orderRepo.SumActiveQuantity(ctx, flashSale.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	redisStock, redisExists, err := s.stockService.PeekStock(ctx, flashSale.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	inFlight, err := s.outbox.Pending(ctx, flashSale.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	expected := flashSale.TotalStock - sold
+	report := &StockReconcileReport{
+		FlashSaleID:   flashSale.ID,
+		Status:        flashSale.Status,
+		TotalStock:    flashSale.TotalStock,
+		SoldQuantity:  sold,
+		ExpectedStock: expected,
+		DBStock:       flashSale.AvailableStock,
+		DBDiff:        flashSale.AvailableStock - expected,
+		RedisStock:    redisStock,
+		RedisExists:   redisExists,
+		RedisDiff:     redisStock - expected,
+		InFlight:      inFlight,
+		CheckedAt:     time.Now(),
+	}
+	report.Consistent = report.DBDiff == 0 && report.RedisDiff == 0 && redisExists
+
+	if err := s.reconcileItems(ctx, flashSale, report, repair); err != nil {
+		return nil, err
+	}
+	s.reconcileLimits(ctx, flashSale, report, repair)
+
+	if report.Consistent {
+		return report, nil
+	}
+
+	if expected < 0 {
+		report.Alerts = append(report.Alerts, fmt.Sprintf("oversold: %d orders exceed total stock", -expected))
+	}
+
+	// DB 庫存：以樂觀鎖修正為預期值（訂單與 DB 扣減同一交易提交，進行中的活動也不會重複扣減）
+	if report.DBDiff != 0 {
+		if repair && expected >= 0 {
+			ok, err := s.flashSaleRepo.CompareAndSetStock(ctx, flashSale.ID, flashSale.AvailableStock, expected)
+			if err != nil {
+				return nil, err
+			}
+			report.DBRepaired = ok
+			if !ok {
+				report.Alerts = append(report.Alerts, "db stock changed during reconcile, retry later")
+			}
+		} else {
+			report.Alerts = append(report.Alerts, fmt.Sprintf("db stock drift: %+d", report.DBDiff))
+		}
+	}
+
+	// Redis 庫存：進行中的活動有在途訊息，只告警不修改
+	if report.RedisDiff != 0 || !redisExists {
+		safeToRepair := redisRepairable(flashSale, inFlight, report.CheckedAt) && redisExists
+		if repair && safeToRepair && expected >= 0 {
+			ok, err := s.stockService.CompareAndSetStock(ctx, flashSale.ID, redisStock, expected)
+			if err != nil {
+				return nil, err
+			}
+			report.RedisRepaired = ok
+			if !ok {
+				report.Alerts = append(report.Alerts, "redis stock changed during reconcile, retry later")
+			}
+		} else if !redisExists {
+			report.Alerts = append(report.Alerts, "redis stock key missing")
+		} else {
+			report.Alerts = append(report.Alerts, fmt.Sprintf("redis stock drift: %+d (in-flight %d)", report.RedisDiff, inFlight))
+		}
+	}
+
+	if len(report.Alerts) > 0 {
+		s.log.Warn("stock drift detected",
+			zap.Int64("flash_sale_id", flashSale.ID),
+			zap.Int("expected", expected),
+			zap.Int("db_stock", report.DBStock),
+			zap.Int("redis_stock", report.RedisStock),
+			zap.Int64("in_flight", inFlight),
+			zap.Strings("alerts", report.Alerts),
+		)
+	}
+
+	return report, nil
+}
+
+// redisRepairGrace 活動結束或取消後，等待 Kafka 中的在途訊息建單完成的時間
+const redisRepairGrace = 10 * time.Minute
+
+// redisRepairable 判斷 Redis 庫存可否直接修正為訂單推算值
+// 只有已結束或已取消、且狀態變更超過 redisRepairGrace、Outbox 已清空的活動才不會再有在途准入；
+// 暫停的活動可能恢復，Kafka 消費落後時修正會使恢復後超賣
+func redisRepairable(flashSale *model.FlashSale, inFlight int64, now time.Time) bool {
+	switch flashSale.Status {
+	case model.FlashSaleStatusFinished, model.FlashSaleStatusCancelled:
+	default:
+		return false
+	}
+	return inFlight == 0 && now.Sub(flashSale.UpdatedAt) >= redisRepairGrace
+}
+
+// reconcileItems 比對多規格活動各規格的 Redis、DB 庫存與訂單推算值，修復規則與活動庫存相同
+// 規格庫存由預熱依 SumActiveQuantityByItem 載入，此處以相同來源推算
+func (s *StockReconcileService) reconcileItems(ctx context.Context, flashSale *model.FlashSale, report *StockReconcileReport, repair bool) error {
+	if !flashSale.HasItems() {
+		return nil
+	}
+
+	rows, err := s.orderRepo.SumActiveQuantityByItem(ctx, flashSale.ID)
+	if err != nil {
+		return err
+	}
+	sold := make(map[int64]int, len(rows))
+	for _, row := range rows {
+		sold[row.ItemID] = row.Quantity
+	}
+
+	itemIDs := make([]int64, len(flashSale.Items))
+	for i, item := range flashSale.Items {
+		itemIDs[i] = item.ID
+	}
+	redisStocks, err := s.stockService.PeekItemStocks(ctx, flashSale.ID, itemIDs)
+	if err != nil {
+		return err
+	}
+
+	for _, item := range flashSale.Items {
+		expected := item.TotalStock - sold[item.ID]
+		redisStock, redisExists := redisStocks[item.ID]
+		itemReport := ItemReconcileReport{
+			ItemID:        item.ID,
+			TotalStock:    item.TotalStock,
+			SoldQuantity:  sold[item.ID],
+			ExpectedStock: expected,
+			DBStock:       item.AvailableStock,
+			DBDiff:        item.AvailableStock - expected,
+			RedisStock:    redisStock,
+			RedisExists:   redisExists,
+			RedisDiff:     redisStock - expected,
+		}
+		if itemReport.DBDiff == 0 && itemReport.RedisDiff == 0 && redisExists {
+			report.Items = append(report.Items, itemReport)
+			continue
+		}
+		report.Consistent = false
+
+		if expected < 0 {
+			report.Alerts = append(report.Alerts, fmt.Sprintf("item %d oversold: %d orders exceed total stock", item.ID, -expected))
+		}
+
+		if itemReport.DBDiff != 0 {
+			if repair && expected >= 0 {
+				ok, err := s.flashSaleRepo.CompareAndSetItemStock(ctx, item.ID, item.AvailableStock, expected)
+				if err != nil {
+					return err
+				}
+				itemReport.DBRepaired = ok
+				if !ok {
+					report.Alerts = append(report.Alerts, fmt.Sprintf("item %d db stock changed during reconcile, retry later", item.ID))
+				}
+			} else {
+				report.Alerts = append(report.Alerts, fmt.Sprintf("item %d db stock drift: %+d", item.ID, itemReport.DBDiff))
+			}
+		}
+
+		if itemReport.RedisDiff != 0 || !redisExists {
+			safeToRepair := redisRepairable(flashSale, report.InFlight, report.CheckedAt) && redisExists
+			if repair && safeToRepair && expected >= 0 {
+				ok, err := s.stockService.CompareAndSetItemStock(ctx, flashSale.ID, item.ID, redisStock, expected)
+				if err != nil {
+					return err
+				}
+				itemReport.RedisRepaired = ok
+				if !ok {
+					report.Alerts = append(report.Alerts, fmt.Sprintf("item %d redis stock changed during reconcile, retry later", item.ID))
+				}
+			} else if !redisExists {
+				report.Alerts = append(report.Alerts, fmt.Sprintf("item %d redis stock key missing", item.ID))
+			} else {
+				report.Alerts = append(report.Alerts, fmt.Sprintf("item %d redis stock drift: %+d (in-flight %d)", item.ID, itemReport.RedisDiff, report.InFlight))
+			}
+		}
+
+		report.Items = append(report.Items, itemReport)
+	}
+	return nil
+}
+
+// reconcileLimits 重建限購計數器並記入報告，失敗只告警（不影響庫存對帳）
+func (s *StockReconcileService) reconcileLimits(ctx context.Context, flashSale *model.FlashSale, report *StockReconcileReport, repair bool) {
+	drifts, err := s.limits.ReconcileCounters(ctx, flashSale, repair)
+	report.LimitDrifts = drifts
+	if err != nil {
+		report.Consistent = false
+		report.Alerts = append(report.Alerts, fmt.Sprintf("purchase limit reconcile failed: %v", err))
+		return
+	}
+	if len(drifts) == 0 {
+		return
+	}
+
+	report.Consistent = false
+	unrepaired := 0
+	for _, drift := range drifts {
+		if !drift.Repaired {
+			unrepaired++
+		}
+	}
+	if repaired := len(drifts) - unrepaired; repaired > 0 {
+		s.log.Info("purchase limit counters rebuilt from orders",
+			zap.Int64("flash_sale_id", flashSale.ID),
+			zap.Int("repaired", repaired),
+		)
+	}
+	if unrepaired > 0 {
+		report.Alerts = append(report.Alerts, fmt.Sprintf("purchase limit counter drift: %d counters", unrepaired))
+	}
+}
@@ -0,0 +1,43 @@
+// 庫存對帳服務單元測試
+//
+// 測試覆蓋：
+// - redisRepairable: 只有已結束或已取消超過寬限期、Outbox 已清空的活動可修正 Redis 庫存，暫停的活動不可
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Mag1cFall/magtrade/internal/model"
+)
+
+func TestRedisRepairable(t *testing.T) {
+	now := time.Now()
+	settled := now.Add(-2 * redisRepairGrace)
+	recent := now.Add(-redisRepairGrace / 2)
+
+	tests := []struct {
+		name      string
+		status    model.FlashSaleStatus
+		updatedAt time.Time
+		inFlight  int64
+		want      bool
+	}{
+		{"finished settled", model.FlashSaleStatusFinished, settled, 0, true},
+		{"cancelled settled", model.FlashSaleStatusCancelled, settled, 0, true},
+		{"finished within grace", model.FlashSaleStatusFinished, recent, 0, false},
+		{"finished with outbox", model.FlashSaleStatusFinished, settled, 1, false},
+		{"paused", model.FlashSaleStatusPaused, settled, 0, false},
+		{"active", model.FlashSaleStatusActive, settled, 0, false},
+		{"pending", model.FlashSaleStatusPending, settled, 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			flashSale := &model.FlashSale{Status: tt.status, UpdatedAt: tt.updatedAt}
+			if got := redisRepairable(flashSale, tt.inFlight, now); got != tt.want {
+				t.Errorf("redisRepairable() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
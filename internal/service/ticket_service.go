@@ -0,0 +1,55 @@
+// 搶購憑證查詢服務
+//
+// 本檔案封裝搶購憑證（Ticket）狀態的記錄與查詢
+// 記錄為盡力而為：寫入失敗只記日誌，不影響搶購與訂單流程
+// 查詢限本人：非本人的憑證與不存在同樣返回 ErrTicketNotFound，避免探測他人憑證
+package service
+
+import (
+	"context"
+	"errors"
+
+	"github.com/Mag1cFall/magtrade/internal/cache"
+	"go.uber.org/zap"
+)
+
+var ErrTicketNotFound = errors.New("ticket not found")
+
+// TicketService 搶購憑證服務
+type TicketService struct {
+	store *cache.TicketStore
+	log   *zap.Logger
+}
+
+func NewTicketService(log *zap.Logger) *TicketService {
+	return &TicketService{
+		store: cache.NewTicketStore(),
+		log:   log,
+	}
+}
+
+// Record 記錄憑證狀態（無憑證的訊息忽略）
+func (s *TicketService) Record(ctx context.Context, record *cache.TicketRecord) {
+	if record.Ticket == "" {
+		return
+	}
+	if _, err := s.store.Set(ctx, record); err != nil {
+		s.log.Warn("failed to record ticket status",
+			zap.String("ticket", record.Ticket),
+			zap.String("status", string(record.Status)),
+			zap.Error(err),
+		)
+	}
+}
+
+// Get 查詢本人的憑證狀態
+func (s *TicketService) Get(ctx context.Context, userID int64, ticket string) (*cache.TicketRecord, error) {
+	record, err := s.store.Get(ctx, ticket)
+	if err != nil {
+		return nil, err
+	}
+	if record == nil || record.UserID != userID {
+		return nil, ErrTicketNotFound
+	}
+	return record, nil
+}
@@ -0,0 +1,138 @@
+// Outbox 投遞工作者
+//
+// 本檔案定義 OutboxRelay：輪詢 Redis Outbox Stream，將秒殺訂單訊息投遞至 Kafka
+// 投遞成功才確認並刪除訊息，失敗則留在 Stream 等待下次重試
+// 多實例部署時透過消費者群組分攤訊息，崩潰遺留的訊息會被其他實例認領
+package worker
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/Mag1cFall/magtrade/internal/cache"
+	"github.com/Mag1cFall/magtrade/internal/mq"
+	"go.uber.org/zap"
+)
+
+const (
+	outboxPollInterval = 200 * time.Millisecond // 輪詢間隔
+	outboxBatchSize    = 100                    // 每個 Stream 每輪最多處理數量
+	outboxClaimIdle    = 30 * time.Second       // 未確認超過此時間的訊息可被認領
+	outboxStreamIdle   = 24 * time.Hour         // Stream 清空後閒置超過此時間才刪除
+)
+
+// OutboxRelay Outbox 訊息投遞者
+type OutboxRelay struct {
+	outbox   *cache.OutboxService
+	producer *mq.Producer
+	consumer string // 本實例在消費者群組中的名稱
+	log      *zap.Logger
+	stopCh   chan struct{}
+}
+
+func NewOutboxRelay(producer *mq.Producer, log *zap.Logger) *OutboxRelay {
+	hostname, _ := os.Hostname()
+
+	return &OutboxRelay{
+		outbox:   cache.NewOutboxService(),
+		producer: producer,
+		consumer: fmt.Sprintf("%s-%d", hostname, os.Getpid()),
+		log:      log,
+		stopCh:   make(chan struct{}),
+	}
+}
+
+// Start 啟動投遞迴圈
+func (r *OutboxRelay) Start(ctx context.Context) {
+	go r.run(ctx)
+}
+
+// Stop 停止投遞
+func (r *OutboxRelay) Stop() {
+	close(r.stopCh)
+}
+
+// run 投遞主迴圈
+func (r *OutboxRelay) run(ctx context.Context) {
+	ticker := time.NewTicker(outboxPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-r.stopCh:
+			return
+		case <-ticker.C:
+			r.relayOnce(ctx)
+		}
+	}
+}
+
+// relayOnce 處理所有已註冊 Stream 的一輪投遞
+func (r *OutboxRelay) relayOnce(ctx context.Context) {
+	streams, err := r.outbox.Streams(ctx)
+	if err != nil {
+		r.log.Error("failed to list outbox streams", zap.Error(err))
+		return
+	}
+
+	for _, stream := range streams {
+		if pruned, err := r.outbox.Prune(ctx, stream, outboxStreamIdle); err != nil {
+			r.log.Error("failed to prune outbox stream", zap.String("stream", stream), zap.Error(err))
+			continue
+		} else if pruned {
+			continue
+		}
+
+		// 先認領其他實例遺留的訊息，再讀取新訊息
+		claimed, err := r.outbox.Claim(ctx, stream, r.consumer, outboxClaimIdle, outboxBatchSize)
+		if err != nil {
+			r.log.Error("failed to claim outbox entries", zap.String("stream", stream), zap.Error(err))
+		}
+
+		fresh, err := r.outbox.Read(ctx, stream, r.consumer, outboxBatchSize)
+		if err != nil {
+			r.log.Error("failed to read outbox entries", zap.String("stream", stream), zap.Error(err))
+		}
+
+		for _, entry := range append(claimed, fresh...) {
+			r.deliver(ctx, entry)
+		}
+	}
+}
+
+// deliver 投遞單筆訊息，成功後確認
+func (r *OutboxRelay) deliver(ctx context.Context, entry cache.OutboxEntry) {
+	msg, err := mq.ParseFlashSaleOrderMessage([]byte(entry.Payload))
+	if err != nil {
+		// 無法解析的訊息重試也不會成功，記錄後直接確認丟棄
+		r.log.Error("dropping malformed outbox entry",
+			zap.String("stream", entry.Stream),
+			zap.String("id", entry.ID),
+			zap.Error(err),
+		)
+		_ = r.outbox.Ack(ctx, entry)
+		return
+	}
+
+	if err := r.producer.SendFlashSaleOrder(ctx, msg); err != nil {
+		r.log.Error("failed to relay outbox entry",
+			zap.String("stream", entry.Stream),
+			zap.String("ticket", msg.Ticket),
+			zap.Error(err),
+		)
+		return // 不確認，等待閒置逾時後重新認領
+	}
+
+	if err := r.outbox.Ack(ctx, entry); err != nil {
+		// Kafka 端以訂單冪等檢查兜底，重複投遞不會建立重複訂單
+		r.log.Error("failed to ack outbox entry",
+			zap.String("stream", entry.Stream),
+			zap.String("id", entry.ID),
+			zap.Error(err),
+		)
+	}
+}
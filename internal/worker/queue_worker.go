@@ -0,0 +1,98 @@
+// 排隊放行工作者
+//
+// 本檔案定義 QueueWorker：輪詢開啟排隊模式的活動，依設定速率出列並扣減庫存
+// 放行結果（成功排入建單、庫存不足、已售罄等）透過 WebSocket 推送給使用者
+// 出列速率由 Redis 腳本全域控制，多實例同時執行也不會超出
+package worker
+
+import (
+	"context"
+	"time"
+
+	"github.com/Mag1cFall/magtrade/internal/config"
+	"github.com/Mag1cFall/magtrade/internal/handler"
+	"github.com/Mag1cFall/magtrade/internal/mq"
+	"github.com/Mag1cFall/magtrade/internal/service"
+	"go.uber.org/zap"
+)
+
+// queuePollInterval 出列輪詢間隔（每秒 10 輪，與 service 的分攤批次對應）
+const queuePollInterval = 100 * time.Millisecond
+
+// QueueWorker 排隊放行工作者
+type QueueWorker struct {
+	flashSaleService *service.FlashSaleService
+	wsHub            *handler.WSHub
+	log              *zap.Logger
+	stopCh           chan struct{}
+}
+
+func NewQueueWorker(deps *service.CacheDeps, producer *mq.Producer, wsHub *handler.WSHub, rushCfg *config.RushConfig, log *zap.Logger) *QueueWorker {
+	flashSaleService := service.NewFlashSaleService(deps, nil, producer, log)
+	flashSaleService.SetLegacyAdmission(rushCfg.LegacyAdmission)
+
+	return &QueueWorker{
+		flashSaleService: flashSaleService,
+		wsHub:            wsHub,
+		log:              log,
+		stopCh:           make(chan struct{}),
+	}
+}
+
+// Start 啟動放行迴圈
+func (w *QueueWorker) Start(ctx context.Context) {
+	go w.run(ctx)
+}
+
+// Stop 停止放行
+func (w *QueueWorker) Stop() {
+	close(w.stopCh)
+}
+
+// run 放行主迴圈
+func (w *QueueWorker) run(ctx context.Context) {
+	ticker := time.NewTicker(queuePollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-w.stopCh:
+			return
+		case <-ticker.C:
+			w.drainOnce(ctx)
+		}
+	}
+}
+
+// drainOnce 處理所有有排隊請求的活動一輪
+func (w *QueueWorker) drainOnce(ctx context.Context) {
+	ids, err := w.flashSaleService.ActiveQueues(ctx)
+	if err != nil {
+		w.log.Error("failed to list active queues", zap.Error(err))
+		return
+	}
+
+	for _, id := range ids {
+		outcomes, err := w.flashSaleService.DrainQueue(ctx, id)
+		if err != nil {
+			w.log.Error("failed to drain queue", zap.Int64("flash_sale_id", id), zap.Error(err))
+		}
+
+		for _, outcome := range outcomes {
+			w.notify(outcome)
+		}
+	}
+}
+
+// notify 推送放行結果
+// 放行成功只代表已扣減庫存，訂單建立結果由 OrderWorker 另行推送
+func (w *QueueWorker) notify(outcome service.QueueOutcome) {
+	w.wsHub.SendToUser(outcome.Entry.UserID, "flash_sale_queue", map[string]interface{}{
+		"flash_sale_id": outcome.Entry.FlashSaleID,
+		"success":       outcome.Response.Success,
+		"message":       outcome.Response.Message,
+		"ticket":        outcome.Entry.Ticket,
+	})
+}
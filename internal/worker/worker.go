@@ -1,14 +1,18 @@
 // 背景工作者
 //
 // 本檔案定義消費 Kafka 訊息和定時任務的 Worker
-// OrderWorker：處理訂單建立訊息，通過 WebSocket 通知使用者
-// SchedulerWorker：定時更新活動狀態、取消過期訂單
+// OrderWorker：處理訂單建立訊息，記錄搶購憑證結果並通過 WebSocket 通知使用者
+// SchedulerWorker：定時預熱庫存、更新活動狀態、取消過期訂單（到期佇列 + DB 兜底）、庫存對帳、抽籤、預約提醒、依範本產生活動
+// 多實例部署時經 Redis 選出領導者，僅領導者執行定時任務
 package worker
 
 import (
 	"context"
+	"errors"
 	"time"
 
+	"github.com/Mag1cFall/magtrade/internal/cache"
+	"github.com/Mag1cFall/magtrade/internal/config"
 	"github.com/Mag1cFall/magtrade/internal/handler"
 	"github.com/Mag1cFall/magtrade/internal/mq"
 	"github.com/Mag1cFall/magtrade/internal/service"
@@ -16,16 +20,18 @@ import (
 )
 
 // OrderWorker 訂單處理工作者
-// 消費 Kafka 訊息，建立訂單並通過 WebSocket 通知使用者結果
+// 消費 Kafka 訊息，建立訂單，記錄憑證結果並通過 WebSocket 通知使用者
 type OrderWorker struct {
 	orderService *service.OrderService
+	tickets      *service.TicketService
 	wsHub        *handler.WSHub
 	log          *zap.Logger
 }
 
-func NewOrderWorker(producer *mq.Producer, wsHub *handler.WSHub, log *zap.Logger) *OrderWorker {
+func NewOrderWorker(deps *service.CacheDeps, producer *mq.Producer, wsHub *handler.WSHub, log *zap.Logger) *OrderWorker {
 	return &OrderWorker{
-		orderService: service.NewOrderService(producer, log),
+		orderService: service.NewOrderService(deps, producer, log),
+		tickets:      service.NewTicketService(log),
 		wsHub:        wsHub,
 		log:          log,
 	}
@@ -40,6 +46,11 @@ func (w *OrderWorker) HandleFlashSaleOrder(ctx context.Context, data []byte) err
 	}
 
 	order, err := w.orderService.CreateFromMessage(ctx, msg)
+	if errors.Is(err, service.ErrFlashSaleCancelled) {
+		// 活動已取消：訂單已取消並歸還庫存，不再重試
+		w.notifyFailure(ctx, msg, "活动已取消")
+		return nil
+	}
 	if err != nil {
 		w.log.Error("failed to create order",
 			zap.Error(err),
@@ -47,18 +58,18 @@ func (w *OrderWorker) HandleFlashSaleOrder(ctx context.Context, data []byte) err
 			zap.Int64("flash_sale_id", msg.FlashSaleID),
 		)
 
-		// 通知使用者失敗
-		w.wsHub.SendToUser(msg.UserID, "flash_sale_result", map[string]interface{}{
-			"flash_sale_id": msg.FlashSaleID,
-			"success":       false,
-			"message":       "订单创建失败，请稍后查看",
-			"ticket":        msg.Ticket,
-		})
-
+		w.notifyFailure(ctx, msg, "订单创建失败，请稍后查看")
 		return err
 	}
 
-	// 通知使用者成功
+	// 記錄憑證結果並通知使用者成功
+	w.tickets.Record(ctx, &cache.TicketRecord{
+		Ticket:      msg.Ticket,
+		UserID:      msg.UserID,
+		FlashSaleID: msg.FlashSaleID,
+		Status:      cache.TicketStatusSuccess,
+		OrderNo:     order.OrderNo,
+	})
 	w.wsHub.SendToUser(msg.UserID, "flash_sale_result", map[string]interface{}{
 		"flash_sale_id": msg.FlashSaleID,
 		"success":       true,
@@ -75,6 +86,23 @@ func (w *OrderWorker) HandleFlashSaleOrder(ctx context.Context, data []byte) err
 	return nil
 }
 
+// notifyFailure 記錄憑證結果並通知使用者失敗
+func (w *OrderWorker) notifyFailure(ctx context.Context, msg *mq.FlashSaleOrderMessage, reason string) {
+	w.tickets.Record(ctx, &cache.TicketRecord{
+		Ticket:      msg.Ticket,
+		UserID:      msg.UserID,
+		FlashSaleID: msg.FlashSaleID,
+		Status:      cache.TicketStatusFailed,
+		Reason:      reason,
+	})
+	w.wsHub.SendToUser(msg.UserID, "flash_sale_result", map[string]interface{}{
+		"flash_sale_id": msg.FlashSaleID,
+		"success":       false,
+		"message":       reason,
+		"ticket":        msg.Ticket,
+	})
+}
+
 // HandleOrderStatusChange 處理訂單狀態變更訊息
 func (w *OrderWorker) HandleOrderStatusChange(ctx context.Context, data []byte) error {
 	msg, err := mq.ParseOrderStatusChangeMessage(data)
@@ -97,23 +125,66 @@ func (w *OrderWorker) HandleOrderStatusChange(ctx context.Context, data []byte)
 type SchedulerWorker struct {
 	flashSaleService *service.FlashSaleService
 	orderService     *service.OrderService
+	reconcileService *service.StockReconcileService
+	raffleService    *service.RaffleService
+	reservation      *service.ReservationService
+	templateService  *service.FlashSaleTemplateService
+	templateHorizon  time.Duration
+	leader           *cache.LeaderElector
+	wsHub            *handler.WSHub
 	log              *zap.Logger
 	stopCh           chan struct{}
 }
 
-func NewSchedulerWorker(producer *mq.Producer, log *zap.Logger) *SchedulerWorker {
+func NewSchedulerWorker(deps *service.CacheDeps, producer *mq.Producer, wsHub *handler.WSHub, emailCfg *config.EmailConfig, schedulerCfg *config.SchedulerConfig, log *zap.Logger) *SchedulerWorker {
+	templateHorizon := schedulerCfg.TemplateHorizon
+	if templateHorizon <= 0 {
+		templateHorizon = defaultTemplateHorizon
+	}
+
 	return &SchedulerWorker{
-		flashSaleService: service.NewFlashSaleService(producer, log),
-		orderService:     service.NewOrderService(producer, log),
+		flashSaleService: service.NewFlashSaleService(deps, nil, producer, log),
+		orderService:     service.NewOrderService(deps, producer, log),
+		reconcileService: service.NewStockReconcileService(log),
+		raffleService:    service.NewRaffleService(deps, producer, log),
+		reservation:      service.NewReservationService(emailCfg, log),
+		templateService:  service.NewFlashSaleTemplateService(deps, producer, log),
+		templateHorizon:  templateHorizon,
+		leader:           cache.NewLeaderElector(schedulerLeaderName, schedulerCfg.LeaderTTL),
+		wsHub:            wsHub,
 		log:              log,
 		stopCh:           make(chan struct{}),
 	}
 }
 
+// warmUpHorizon 提前預熱即將開始活動的時間範圍
+const warmUpHorizon = 10 * time.Minute
+
+// defaultTemplateHorizon 未配置時依範本提前產生活動的時間範圍
+const defaultTemplateHorizon = 24 * time.Hour
+
+// schedulerLeaderName 定時任務領導者選舉名稱，多實例部署時只有領導者執行定時任務
+const schedulerLeaderName = "scheduler"
+
 // Start 啟動定時任務
+// 啟動時先同步預熱一次庫存，避免 Redis 重啟後進行中的活動庫存為 0（各實例皆執行，重複預熱無副作用）
+// 並先參與一次選舉，讓領導者啟動後即可執行定時任務
 func (w *SchedulerWorker) Start(ctx context.Context) {
+	if err := w.flashSaleService.WarmUpFlashSales(ctx, warmUpHorizon); err != nil {
+		w.log.Error("failed to warm up flash sales on startup", zap.Error(err))
+	}
+
+	w.campaign(ctx)
+	go w.runLeaderElection(ctx)
+
+	go w.runStockWarmer(ctx)
 	go w.runFlashSaleStatusUpdater(ctx)
+	go w.runOrderExpiryQueue(ctx)
 	go w.runExpiredOrderCanceller(ctx)
+	go w.runStockReconciler(ctx)
+	go w.runRaffleDrawer(ctx)
+	go w.runReservationReminder(ctx)
+	go w.runTemplateMaterializer(ctx)
 }
 
 // Stop 停止定時任務
@@ -121,6 +192,51 @@ func (w *SchedulerWorker) Stop() {
 	close(w.stopCh)
 }
 
+// runLeaderElection 每隔任期的 1/3 參與選舉或續期，停止時卸任讓其他實例接手
+func (w *SchedulerWorker) runLeaderElection(ctx context.Context) {
+	ticker := time.NewTicker(w.leader.TTL() / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			w.resign(ctx)
+			return
+		case <-w.stopCh:
+			w.resign(ctx)
+			return
+		case <-ticker.C:
+			w.campaign(ctx)
+		}
+	}
+}
+
+// campaign 參與一次選舉，領導者變更時記錄日誌
+func (w *SchedulerWorker) campaign(ctx context.Context) {
+	wasLeader := w.leader.IsLeader()
+	isLeader, err := w.leader.Campaign(ctx)
+	if err != nil {
+		w.log.Warn("scheduler leader election failed", zap.Error(err))
+	}
+
+	if isLeader != wasLeader {
+		w.log.Info("scheduler leadership changed",
+			zap.String("instance", w.leader.ID()),
+			zap.Bool("leader", isLeader),
+		)
+	}
+}
+
+// resign 卸任領導者
+func (w *SchedulerWorker) resign(ctx context.Context) {
+	if !w.leader.IsLeader() {
+		return
+	}
+	if err := w.leader.Resign(ctx); err != nil {
+		w.log.Warn("failed to resign scheduler leadership", zap.Error(err))
+	}
+}
+
 // runFlashSaleStatusUpdater 定時更新秒殺活動狀態
 // 待開始 → 進行中、進行中 → 已結束
 func (w *SchedulerWorker) runFlashSaleStatusUpdater(ctx context.Context) {
@@ -134,6 +250,10 @@ func (w *SchedulerWorker) runFlashSaleStatusUpdater(ctx context.Context) {
 		case <-w.stopCh:
 			return
 		case <-ticker.C:
+			if !w.leader.IsLeader() {
+				continue
+			}
+
 			if err := w.flashSaleService.ActivatePendingFlashSales(ctx); err != nil {
 				w.log.Error("failed to activate pending flash sales", zap.Error(err))
 			}
@@ -145,13 +265,38 @@ func (w *SchedulerWorker) runFlashSaleStatusUpdater(ctx context.Context) {
 	}
 }
 
-// runExpiredOrderCanceller 定時取消過期未付款訂單
-// 15 分鐘未付款的訂單自動取消並恢復庫存
-func (w *SchedulerWorker) runExpiredOrderCanceller(ctx context.Context) {
+// runStockWarmer 定時預熱進行中及即將開始活動的 Redis 庫存
+// 處理 Redis 重啟、清空或 Key 過期後的庫存重建
+func (w *SchedulerWorker) runStockWarmer(ctx context.Context) {
 	ticker := time.NewTicker(30 * time.Second)
 	defer ticker.Stop()
 
-	expireDuration := 15 * time.Minute
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-w.stopCh:
+			return
+		case <-ticker.C:
+			if !w.leader.IsLeader() {
+				continue
+			}
+
+			if err := w.flashSaleService.WarmUpFlashSales(ctx, warmUpHorizon); err != nil {
+				w.log.Error("failed to warm up flash sales", zap.Error(err))
+			}
+		}
+	}
+}
+
+// orderExpiryBatch 到期佇列與 DB 兜底掃描的單批處理量，滿批時繼續處理下一批
+const orderExpiryBatch = 200
+
+// runOrderExpiryQueue 每秒領取到期佇列中已到期的訂單並取消
+// 各訂單依所屬活動的付款時限到期，取消後立即恢復庫存
+func (w *SchedulerWorker) runOrderExpiryQueue(ctx context.Context) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
 
 	for {
 		select {
@@ -160,9 +305,185 @@ func (w *SchedulerWorker) runExpiredOrderCanceller(ctx context.Context) {
 		case <-w.stopCh:
 			return
 		case <-ticker.C:
-			if err := w.orderService.CancelExpiredOrders(ctx, expireDuration); err != nil {
-				w.log.Error("failed to cancel expired orders", zap.Error(err))
+			if !w.leader.IsLeader() {
+				continue
+			}
+
+			for ctx.Err() == nil {
+				n, err := w.orderService.ProcessExpiryQueue(ctx, orderExpiryBatch)
+				if err != nil {
+					w.log.Error("failed to process order expiry queue", zap.Error(err))
+					break
+				}
+				if n < orderExpiryBatch {
+					break
+				}
 			}
 		}
 	}
 }
+
+// runExpiredOrderCanceller 定時以 DB 掃描取消過期未付款訂單，並補做取消後未完成的 Redis 庫存歸還
+// 到期佇列的兜底：處理 Redis 清空或加入佇列失敗而遺漏的訂單
+func (w *SchedulerWorker) runExpiredOrderCanceller(ctx context.Context) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-w.stopCh:
+			return
+		case <-ticker.C:
+			if !w.leader.IsLeader() {
+				continue
+			}
+
+			for ctx.Err() == nil {
+				n, err := w.orderService.CancelExpiredOrders(ctx, orderExpiryBatch)
+				if err != nil {
+					w.log.Error("failed to cancel expired orders", zap.Error(err))
+					break
+				}
+				if n < orderExpiryBatch {
+					break
+				}
+			}
+
+			for ctx.Err() == nil {
+				n, err := w.orderService.RestorePendingStock(ctx, orderExpiryBatch)
+				if err != nil {
+					w.log.Error("failed to restore stock for cancelled orders", zap.Error(err))
+					break
+				}
+				if n < orderExpiryBatch {
+					break
+				}
+			}
+		}
+	}
+}
+
+// runStockReconciler 定時比對 Redis、DB 與訂單推算的庫存
+// 涵蓋待開始、進行中以及 1 小時內結束的活動
+func (w *SchedulerWorker) runStockReconciler(ctx context.Context) {
+	ticker := time.NewTicker(5 * time.Minute)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-w.stopCh:
+			return
+		case <-ticker.C:
+			if !w.leader.IsLeader() {
+				continue
+			}
+
+			if err := w.reconcileService.ReconcileAll(ctx, time.Hour); err != nil {
+				w.log.Error("failed to reconcile stock", zap.Error(err))
+			}
+		}
+	}
+}
+
+// runRaffleDrawer 定時對登記截止的抽籤活動抽籤，並通知中籤與未中籤的使用者
+func (w *SchedulerWorker) runRaffleDrawer(ctx context.Context) {
+	ticker := time.NewTicker(10 * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-w.stopCh:
+			return
+		case <-ticker.C:
+			if !w.leader.IsLeader() {
+				continue
+			}
+
+			outcomes, err := w.raffleService.DrawDue(ctx)
+			if err != nil {
+				w.log.Error("failed to draw raffles", zap.Error(err))
+			}
+
+			for _, outcome := range outcomes {
+				if outcome.Won {
+					w.wsHub.SendToUser(outcome.UserID, "raffle_result", map[string]interface{}{
+						"flash_sale_id": outcome.FlashSaleID,
+						"won":           true,
+						"order_no":      outcome.OrderNo,
+						"message":       "恭喜您中签！请尽快完成付款",
+					})
+					continue
+				}
+
+				w.wsHub.SendToUser(outcome.UserID, "raffle_result", map[string]interface{}{
+					"flash_sale_id": outcome.FlashSaleID,
+					"won":           false,
+					"message":       "很遗憾，您未中签",
+				})
+			}
+		}
+	}
+}
+
+// runReservationReminder 定時提醒已預約使用者活動即將開始（郵件 + WebSocket）
+func (w *SchedulerWorker) runReservationReminder(ctx context.Context) {
+	ticker := time.NewTicker(30 * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-w.stopCh:
+			return
+		case <-ticker.C:
+			if !w.leader.IsLeader() {
+				continue
+			}
+
+			reminders, err := w.reservation.SendDueReminders(ctx)
+			if err != nil {
+				w.log.Error("failed to send reservation reminders", zap.Error(err))
+				continue
+			}
+
+			for _, r := range reminders {
+				w.wsHub.SendToUser(r.UserID, "flash_sale_reminder", map[string]interface{}{
+					"flash_sale_id": r.FlashSaleID,
+					"product_name":  r.ProductName,
+					"start_time":    r.StartTime,
+					"message":       "您预约的秒杀即将开始",
+				})
+			}
+		}
+	}
+}
+
+// runTemplateMaterializer 定時依啟用中的範本產生 horizon 內的活動
+// 啟動時立即執行一次，確保重啟後近期場次已建立
+func (w *SchedulerWorker) runTemplateMaterializer(ctx context.Context) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for {
+		if w.leader.IsLeader() {
+			if _, err := w.templateService.MaterializeDue(ctx, w.templateHorizon); err != nil {
+				w.log.Error("failed to materialize flash sale templates", zap.Error(err))
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-w.stopCh:
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,35 @@
+-- ============================================================
+-- MagTrade 資料庫結構更新 - 多規格秒殺
+-- 版本: 003
+-- 建立日期: 2026-10
+-- 說明: 新增秒殺活動規格表，訂單記錄所購規格
+-- ============================================================
+
+-- ------------------------------------------------------------
+-- 秒殺活動規格表
+-- 同一活動下的多個規格（顏色、尺寸等），各自擁有秒殺價格與庫存
+-- 活動總庫存 = 各規格庫存之和，限購以整個活動計算
+-- ------------------------------------------------------------
+CREATE TABLE IF NOT EXISTS flash_sale_items (
+    id BIGSERIAL PRIMARY KEY,
+    flash_sale_id BIGINT NOT NULL REFERENCES flash_sales(id),    -- 所屬秒殺活動
+    name VARCHAR(100) NOT NULL,                                  -- 規格名稱，如「黑色 / 256GB」
+    sku VARCHAR(64),                                             -- 商家 SKU 編碼
+    flash_price DECIMAL(10, 2) NOT NULL,                         -- 規格秒殺價
+    total_stock INT NOT NULL,                                    -- 規格總庫存
+    available_stock INT NOT NULL,                                -- 規格剩餘庫存（DB）
+    sort INT DEFAULT 0,                                          -- 顯示排序
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    deleted_at TIMESTAMP
+);
+
+CREATE INDEX idx_flash_sale_items_flash_sale_id ON flash_sale_items(flash_sale_id);
+CREATE INDEX idx_flash_sale_items_deleted_at ON flash_sale_items(deleted_at);
+
+-- ------------------------------------------------------------
+-- 訂單新增規格欄位（單規格活動為 NULL）
+-- ------------------------------------------------------------
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS item_id BIGINT REFERENCES flash_sale_items(id);
+
+CREATE INDEX IF NOT EXISTS idx_orders_item_id ON orders(item_id);
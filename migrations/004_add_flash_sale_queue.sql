@@ -0,0 +1,9 @@
+-- ============================================================
+-- MagTrade 資料庫結構更新 - 排隊模式
+-- 版本: 004
+-- 建立日期: 2026-10
+-- 說明: 秒殺活動新增排隊模式開關與放行速率
+-- ============================================================
+
+ALTER TABLE flash_sales ADD COLUMN IF NOT EXISTS queue_enabled BOOLEAN DEFAULT FALSE; -- 是否開啟排隊模式
+ALTER TABLE flash_sales ADD COLUMN IF NOT EXISTS queue_rate INT DEFAULT 0;           -- 每秒放行數，0 使用預設值
@@ -0,0 +1,44 @@
+-- ============================================================
+-- MagTrade 資料庫結構更新 - 抽籤活動
+-- 版本: 005
+-- 建立日期: 2026-10
+-- 說明: 秒殺活動新增類型欄位，新增抽籤登記表與抽籤紀錄表
+-- ============================================================
+
+ALTER TABLE flash_sales ADD COLUMN IF NOT EXISTS sale_type SMALLINT DEFAULT 0; -- 0: 搶購, 1: 抽籤
+
+-- ------------------------------------------------------------
+-- 抽籤登記表
+-- 每位使用者在同一活動只能登記一次，抽籤後記錄結果與訂單號
+-- ------------------------------------------------------------
+CREATE TABLE IF NOT EXISTS raffle_entries (
+    id BIGSERIAL PRIMARY KEY,
+    flash_sale_id BIGINT NOT NULL REFERENCES flash_sales(id),
+    user_id BIGINT NOT NULL REFERENCES users(id),
+    result SMALLINT DEFAULT 0,                                   -- 0: 待抽籤, 1: 中籤, 2: 未中籤
+    order_no VARCHAR(32),                                        -- 中籤後建立的訂單號
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE UNIQUE INDEX idx_raffle_entries_sale_user ON raffle_entries(flash_sale_id, user_id);
+CREATE INDEX idx_raffle_entries_user_id ON raffle_entries(user_id);
+
+-- ------------------------------------------------------------
+-- 抽籤紀錄表
+-- 每個活動僅一筆（唯一索引防止重複抽籤）
+-- 公開種子與名單摘要，任何人可依 SHA-256(seed:user_id) 排序重算中籤名單
+-- ------------------------------------------------------------
+CREATE TABLE IF NOT EXISTS raffle_draws (
+    id BIGSERIAL PRIMARY KEY,
+    flash_sale_id BIGINT NOT NULL REFERENCES flash_sales(id),
+    seed VARCHAR(64) NOT NULL,                                   -- 抽籤種子
+    entries_hash VARCHAR(64) NOT NULL,                           -- 參與者名單摘要
+    entry_count INT NOT NULL,
+    winner_count INT NOT NULL,
+    winners TEXT,                                                -- 中籤使用者 ID（JSON 陣列）
+    fulfilled_at TIMESTAMP,                                      -- 中籤訂單全部建立完成時間
+    drawn_at TIMESTAMP NOT NULL
+);
+
+CREATE UNIQUE INDEX idx_raffle_draws_flash_sale_id ON raffle_draws(flash_sale_id);
@@ -0,0 +1,25 @@
+-- ============================================================
+-- MagTrade 資料庫結構更新 - 活動預約
+-- 版本: 006
+-- 建立日期: 2026-10
+-- 說明: 新增預約表；秒殺活動新增「僅限預約」與提醒時間設定
+-- ============================================================
+
+ALTER TABLE flash_sales ADD COLUMN IF NOT EXISTS reserved_only BOOLEAN DEFAULT FALSE; -- 僅限預約使用者搶購
+ALTER TABLE flash_sales ADD COLUMN IF NOT EXISTS remind_minutes INT DEFAULT 0;       -- 開始前幾分鐘提醒，0 使用預設值
+
+-- ------------------------------------------------------------
+-- 預約表
+-- 每位使用者在同一活動僅能預約一次，提醒發送後記錄時間避免重複推送
+-- ------------------------------------------------------------
+CREATE TABLE IF NOT EXISTS reservations (
+    id BIGSERIAL PRIMARY KEY,
+    flash_sale_id BIGINT NOT NULL REFERENCES flash_sales(id),
+    user_id BIGINT NOT NULL REFERENCES users(id),
+    reminded_at TIMESTAMP,                                       -- 開賣提醒發送時間
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE UNIQUE INDEX idx_reservations_sale_user ON reservations(flash_sale_id, user_id);
+CREATE INDEX idx_reservations_user_id ON reservations(user_id);
+CREATE INDEX idx_reservations_reminded_at ON reservations(reminded_at);
@@ -0,0 +1,36 @@
+-- ============================================================
+-- MagTrade 資料庫結構更新 - 週期性秒殺活動範本
+-- 版本: 007
+-- 建立日期: 2026-10
+-- 說明: 新增活動範本表；秒殺活動記錄來源範本，同一範本同一開始時間僅產生一場
+-- ============================================================
+
+-- ------------------------------------------------------------
+-- 秒殺活動範本表
+-- recurrence 為 5 欄位 cron 表達式（分 時 日 月 週），依 timezone 計算
+-- last_scheduled_at 記錄已產生的最後一場開始時間
+-- ------------------------------------------------------------
+CREATE TABLE IF NOT EXISTS flash_sale_templates (
+    id BIGSERIAL PRIMARY KEY,
+    name VARCHAR(100) NOT NULL,
+    product_id BIGINT NOT NULL REFERENCES products(id),
+    recurrence VARCHAR(100) NOT NULL,
+    timezone VARCHAR(64) NOT NULL DEFAULT 'Asia/Shanghai',
+    duration_minutes INT NOT NULL,                              -- 每場活動持續時間
+    flash_price DECIMAL(10,2) NOT NULL,
+    total_stock INT NOT NULL,
+    per_user_limit INT DEFAULT 1,
+    status SMALLINT DEFAULT 1,                                  -- 0: 已暫停, 1: 啟用中
+    last_scheduled_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    deleted_at TIMESTAMP
+);
+
+CREATE INDEX idx_flash_sale_templates_product_id ON flash_sale_templates(product_id);
+CREATE INDEX idx_flash_sale_templates_status ON flash_sale_templates(status);
+CREATE INDEX idx_flash_sale_templates_deleted_at ON flash_sale_templates(deleted_at);
+
+ALTER TABLE flash_sales ADD COLUMN IF NOT EXISTS template_id BIGINT REFERENCES flash_sale_templates(id);
+
+CREATE UNIQUE INDEX idx_flash_sales_template_start ON flash_sales(template_id, start_time);
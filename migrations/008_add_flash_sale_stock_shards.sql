@@ -0,0 +1,12 @@
+-- ============================================================
+-- MagTrade 資料庫結構更新 - 庫存分片
+-- 版本: 008
+-- 建立日期: 2026-10
+-- 說明: 熱門活動可將 Redis 庫存拆分為多個分片 Key，依使用者 ID 分桶扣減
+-- ============================================================
+
+-- ------------------------------------------------------------
+-- 秒殺活動表新增庫存分片數
+-- 0 或 1 表示不分片；僅單規格搶購活動可分片
+-- ------------------------------------------------------------
+ALTER TABLE flash_sales ADD COLUMN IF NOT EXISTS stock_shards INT NOT NULL DEFAULT 0;
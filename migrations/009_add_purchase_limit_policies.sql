@@ -0,0 +1,45 @@
+-- ============================================================
+-- MagTrade 資料庫結構更新 - 跨活動限購策略
+-- 版本: 009
+-- 建立日期: 2026-10
+-- 說明: 新增限購策略表；秒殺活動新增所屬檔期，供檔期範圍的策略比對
+-- ============================================================
+
+-- ------------------------------------------------------------
+-- 秒殺活動表新增所屬行銷檔期
+-- 空值表示不屬於任何檔期
+-- ------------------------------------------------------------
+ALTER TABLE flash_sales ADD COLUMN IF NOT EXISTS campaign VARCHAR(64);
+
+CREATE INDEX IF NOT EXISTS idx_flash_sales_campaign ON flash_sales(campaign);
+
+-- ------------------------------------------------------------
+-- 限購策略表
+-- scope: product（同一商品，product_id 必填）/ campaign（同一檔期，campaign 必填）
+-- limit_window: day / week（週一起算）/ month / lifetime，依 timezone 劃分
+-- 使用者用量以 Redis 計數器記錄，不落 DB
+-- ------------------------------------------------------------
+CREATE TABLE IF NOT EXISTS purchase_limit_policies (
+    id BIGSERIAL PRIMARY KEY,
+    name VARCHAR(100) NOT NULL,
+    scope VARCHAR(16) NOT NULL,
+    product_id BIGINT REFERENCES products(id),
+    campaign VARCHAR(64),
+    max_quantity INT NOT NULL,
+    limit_window VARCHAR(16) NOT NULL,
+    timezone VARCHAR(64) NOT NULL DEFAULT 'Asia/Shanghai',
+    enabled BOOLEAN DEFAULT TRUE,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    deleted_at TIMESTAMP,
+    CONSTRAINT chk_purchase_limit_scope CHECK (
+        (scope = 'product' AND product_id IS NOT NULL) OR
+        (scope = 'campaign' AND campaign IS NOT NULL AND campaign <> '')
+    ),
+    CONSTRAINT chk_purchase_limit_max CHECK (max_quantity > 0)
+);
+
+CREATE INDEX idx_purchase_limit_policies_product_id ON purchase_limit_policies(product_id);
+CREATE INDEX idx_purchase_limit_policies_campaign ON purchase_limit_policies(campaign);
+CREATE INDEX idx_purchase_limit_policies_enabled ON purchase_limit_policies(enabled);
+CREATE INDEX idx_purchase_limit_policies_deleted_at ON purchase_limit_policies(deleted_at);
@@ -0,0 +1,34 @@
+-- ============================================================
+-- MagTrade 資料庫結構更新 - 支付單
+-- 版本: 010
+-- 建立日期: 2026-10
+-- 說明: 新增支付單表，記錄訂單的每次支付嘗試與供應商支付意圖
+-- ============================================================
+
+-- ------------------------------------------------------------
+-- 支付單表
+-- status: 0=待支付 1=支付成功 2=支付失敗 3=已退款
+-- 訂單只在供應商確認成功（回調驗簽 + 主動查詢）後才標記為已付款
+-- ------------------------------------------------------------
+CREATE TABLE IF NOT EXISTS payments (
+    id BIGSERIAL PRIMARY KEY,
+    payment_no VARCHAR(32) NOT NULL UNIQUE,
+    order_id BIGINT NOT NULL REFERENCES orders(id),
+    order_no VARCHAR(32) NOT NULL,
+    user_id BIGINT NOT NULL REFERENCES users(id),
+    provider VARCHAR(32) NOT NULL,
+    provider_ref VARCHAR(64),
+    pay_url VARCHAR(512),
+    amount DECIMAL(10, 2) NOT NULL,
+    status SMALLINT DEFAULT 0,
+    failure_reason VARCHAR(255),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    paid_at TIMESTAMP
+);
+
+CREATE UNIQUE INDEX idx_payments_provider_ref ON payments(provider, provider_ref);
+CREATE INDEX idx_payments_order_id ON payments(order_id);
+CREATE INDEX idx_payments_order_no ON payments(order_no);
+CREATE INDEX idx_payments_user_id ON payments(user_id);
+CREATE INDEX idx_payments_status ON payments(status);
@@ -0,0 +1,41 @@
+-- ============================================================
+-- MagTrade 資料庫結構更新 - 退款單
+-- 版本: 011
+-- 建立日期: 2026-10
+-- 說明: 新增退款單表；訂單新增狀態 4=退款中
+-- ============================================================
+
+-- ------------------------------------------------------------
+-- 退款單表
+-- status: 0=待審核 1=退款中 2=已退款 3=已駁回 4=退款失敗
+-- 使用者申請後由管理員審核，審核通過才向支付供應商發起退款
+-- restore_stock: 退款完成後將庫存歸還活動（僅活動仍進行中時生效）
+-- ------------------------------------------------------------
+CREATE TABLE IF NOT EXISTS refunds (
+    id BIGSERIAL PRIMARY KEY,
+    refund_no VARCHAR(32) NOT NULL UNIQUE,
+    order_id BIGINT NOT NULL REFERENCES orders(id),
+    order_no VARCHAR(32) NOT NULL,
+    user_id BIGINT NOT NULL REFERENCES users(id),
+    payment_id BIGINT REFERENCES payments(id),
+    provider VARCHAR(32),
+    provider_refund_id VARCHAR(64),
+    amount DECIMAL(10, 2) NOT NULL,
+    reason VARCHAR(255) NOT NULL,
+    status SMALLINT DEFAULT 0,
+    restore_stock BOOLEAN DEFAULT FALSE,
+    reviewer_id BIGINT REFERENCES users(id),
+    review_note VARCHAR(255),
+    failure_reason VARCHAR(255),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    reviewed_at TIMESTAMP,
+    refunded_at TIMESTAMP
+);
+
+CREATE INDEX idx_refunds_order_id ON refunds(order_id);
+CREATE INDEX idx_refunds_order_no ON refunds(order_no);
+CREATE INDEX idx_refunds_user_id ON refunds(user_id);
+CREATE INDEX idx_refunds_payment_id ON refunds(payment_id);
+CREATE INDEX idx_refunds_provider_refund_id ON refunds(provider_refund_id);
+CREATE INDEX idx_refunds_status ON refunds(status);
@@ -0,0 +1,25 @@
+-- ============================================================
+-- MagTrade 資料庫結構更新 - 訂單狀態變更歷史
+-- 版本: 012
+-- 建立日期: 2026-10
+-- 說明: 新增訂單狀態變更歷史表，所有狀態轉換皆記錄來源與原因
+-- ============================================================
+
+-- ------------------------------------------------------------
+-- 訂單狀態變更歷史表
+-- 合法轉換: 0→1 0→2 1→4 1→3 4→3 4→1
+-- actor: user=使用者 admin=管理員 payment=支付供應商 system=系統流程
+-- 狀態更新與歷史寫入在同一交易內完成
+-- ------------------------------------------------------------
+CREATE TABLE IF NOT EXISTS order_status_history (
+    id BIGSERIAL PRIMARY KEY,
+    order_id BIGINT NOT NULL REFERENCES orders(id),
+    from_status SMALLINT NOT NULL,
+    to_status SMALLINT NOT NULL,
+    actor VARCHAR(16) NOT NULL,
+    actor_id BIGINT,
+    reason VARCHAR(255),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_order_status_history_order_id ON order_status_history(order_id);
@@ -0,0 +1,23 @@
+-- ============================================================
+-- MagTrade 資料庫結構更新 - 訂單付款時限
+-- 版本: 013
+-- 建立日期: 2026-10
+-- 說明: 活動新增付款時限；訂單新增付款截止時間
+-- ============================================================
+
+-- ------------------------------------------------------------
+-- 秒殺活動表新增欄位
+-- payment_window_minutes: 下單後付款時限（分鐘），0 使用預設值 15
+-- ------------------------------------------------------------
+ALTER TABLE flash_sales ADD COLUMN IF NOT EXISTS payment_window_minutes INT NOT NULL DEFAULT 0;
+
+-- ------------------------------------------------------------
+-- 訂單表新增欄位
+-- expires_at: 付款截止時間，待付款訂單到期後由 Redis 到期佇列取消，DB 掃描兜底
+-- 既有訂單依原固定時限（建立後 15 分鐘）回填
+-- ------------------------------------------------------------
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS expires_at TIMESTAMP;
+
+UPDATE orders SET expires_at = created_at + INTERVAL '15 minutes' WHERE expires_at IS NULL;
+
+CREATE INDEX IF NOT EXISTS idx_orders_expires_at ON orders(expires_at);
@@ -0,0 +1,14 @@
+-- ============================================================
+-- MagTrade 資料庫結構更新 - 訂單取消庫存歸還
+-- 版本: 014
+-- 建立日期: 2026-10
+-- 說明: 訂單取消時在同一交易內恢復 DB 庫存並標記待歸還 Redis 庫存，崩潰後由定時任務補做
+-- ============================================================
+
+-- ------------------------------------------------------------
+-- 訂單表新增欄位
+-- stock_restore_pending: 已取消但 Redis 庫存與限購計數器尚未歸還
+-- ------------------------------------------------------------
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS stock_restore_pending BOOLEAN NOT NULL DEFAULT FALSE;
+
+CREATE INDEX IF NOT EXISTS idx_orders_stock_restore_pending ON orders(updated_at) WHERE stock_restore_pending;
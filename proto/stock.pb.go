@@ -126,13 +126,16 @@ func (x *GetStockResponse) GetMessage() string {
 }
 
 type DeductStockRequest struct {
-	state         protoimpl.MessageState `protogen:"open.v1"`
-	FlashSaleId   int64                  `protobuf:"varint,1,opt,name=flash_sale_id,json=flashSaleId,proto3" json:"flash_sale_id,omitempty"`
-	UserId        int64                  `protobuf:"varint,2,opt,name=user_id,json=userId,proto3" json:"user_id,omitempty"`
-	Quantity      int32                  `protobuf:"varint,3,opt,name=quantity,proto3" json:"quantity,omitempty"`
-	Limit         int32                  `protobuf:"varint,4,opt,name=limit,proto3" json:"limit,omitempty"`
-	unknownFields protoimpl.UnknownFields
-	sizeCache     protoimpl.SizeCache
+	state            protoimpl.MessageState `protogen:"open.v1"`
+	FlashSaleId      int64                  `protobuf:"varint,1,opt,name=flash_sale_id,json=flashSaleId,proto3" json:"flash_sale_id,omitempty"`
+	UserId           int64                  `protobuf:"varint,2,opt,name=user_id,json=userId,proto3" json:"user_id,omitempty"`
+	Quantity         int32                  `protobuf:"varint,3,opt,name=quantity,proto3" json:"quantity,omitempty"`
+	Limit            int32                  `protobuf:"varint,4,opt,name=limit,proto3" json:"limit,omitempty"`
+	ItemId           int64                  `protobuf:"varint,5,opt,name=item_id,json=itemId,proto3" json:"item_id,omitempty"`
+	Payload          string                 `protobuf:"bytes,6,opt,name=payload,proto3" json:"payload,omitempty"`
+	BoughtTtlSeconds int64                  `protobuf:"varint,7,opt,name=bought_ttl_seconds,json=boughtTtlSeconds,proto3" json:"bought_ttl_seconds,omitempty"`
+	unknownFields    protoimpl.UnknownFields
+	sizeCache        protoimpl.SizeCache
 }
 
 func (x *DeductStockRequest) Reset() {
@@ -193,11 +196,33 @@ func (x *DeductStockRequest) GetLimit() int32 {
 	return 0
 }
 
+func (x *DeductStockRequest) GetItemId() int64 {
+	if x != nil {
+		return x.ItemId
+	}
+	return 0
+}
+
+func (x *DeductStockRequest) GetPayload() string {
+	if x != nil {
+		return x.Payload
+	}
+	return ""
+}
+
+func (x *DeductStockRequest) GetBoughtTtlSeconds() int64 {
+	if x != nil {
+		return x.BoughtTtlSeconds
+	}
+	return 0
+}
+
 type DeductStockResponse struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
 	Success       bool                   `protobuf:"varint,1,opt,name=success,proto3" json:"success,omitempty"`
 	Code          int32                  `protobuf:"varint,2,opt,name=code,proto3" json:"code,omitempty"`
 	Message       string                 `protobuf:"bytes,3,opt,name=message,proto3" json:"message,omitempty"`
+	Remaining     int32                  `protobuf:"varint,4,opt,name=remaining,proto3" json:"remaining,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
@@ -253,11 +278,19 @@ func (x *DeductStockResponse) GetMessage() string {
 	return ""
 }
 
+func (x *DeductStockResponse) GetRemaining() int32 {
+	if x != nil {
+		return x.Remaining
+	}
+	return 0
+}
+
 type RestoreStockRequest struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
 	FlashSaleId   int64                  `protobuf:"varint,1,opt,name=flash_sale_id,json=flashSaleId,proto3" json:"flash_sale_id,omitempty"`
 	UserId        int64                  `protobuf:"varint,2,opt,name=user_id,json=userId,proto3" json:"user_id,omitempty"`
 	Quantity      int32                  `protobuf:"varint,3,opt,name=quantity,proto3" json:"quantity,omitempty"`
+	ItemId        int64                  `protobuf:"varint,4,opt,name=item_id,json=itemId,proto3" json:"item_id,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
@@ -313,6 +346,13 @@ func (x *RestoreStockRequest) GetQuantity() int32 {
 	return 0
 }
 
+func (x *RestoreStockRequest) GetItemId() int64 {
+	if x != nil {
+		return x.ItemId
+	}
+	return 0
+}
+
 type RestoreStockResponse struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
 	Success       bool                   `protobuf:"varint,1,opt,name=success,proto3" json:"success,omitempty"`
@@ -469,6 +509,158 @@ func (x *InitStockResponse) GetMessage() string {
 	return ""
 }
 
+type AdmitStockRequest struct {
+	state            protoimpl.MessageState `protogen:"open.v1"`
+	FlashSaleId      int64                  `protobuf:"varint,1,opt,name=flash_sale_id,json=flashSaleId,proto3" json:"flash_sale_id,omitempty"`
+	UserId           int64                  `protobuf:"varint,2,opt,name=user_id,json=userId,proto3" json:"user_id,omitempty"`
+	ItemId           int64                  `protobuf:"varint,3,opt,name=item_id,json=itemId,proto3" json:"item_id,omitempty"`
+	Quantity         int32                  `protobuf:"varint,4,opt,name=quantity,proto3" json:"quantity,omitempty"`
+	Payload          string                 `protobuf:"bytes,5,opt,name=payload,proto3" json:"payload,omitempty"`
+	RetentionSeconds int64                  `protobuf:"varint,6,opt,name=retention_seconds,json=retentionSeconds,proto3" json:"retention_seconds,omitempty"`
+	StockTaken       bool                   `protobuf:"varint,7,opt,name=stock_taken,json=stockTaken,proto3" json:"stock_taken,omitempty"`
+	unknownFields    protoimpl.UnknownFields
+	sizeCache        protoimpl.SizeCache
+}
+
+func (x *AdmitStockRequest) Reset() {
+	*x = AdmitStockRequest{}
+	mi := &file_proto_stock_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *AdmitStockRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*AdmitStockRequest) ProtoMessage() {}
+
+func (x *AdmitStockRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_stock_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use AdmitStockRequest.ProtoReflect.Descriptor instead.
+func (*AdmitStockRequest) Descriptor() ([]byte, []int) {
+	return file_proto_stock_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *AdmitStockRequest) GetFlashSaleId() int64 {
+	if x != nil {
+		return x.FlashSaleId
+	}
+	return 0
+}
+
+func (x *AdmitStockRequest) GetUserId() int64 {
+	if x != nil {
+		return x.UserId
+	}
+	return 0
+}
+
+func (x *AdmitStockRequest) GetItemId() int64 {
+	if x != nil {
+		return x.ItemId
+	}
+	return 0
+}
+
+func (x *AdmitStockRequest) GetQuantity() int32 {
+	if x != nil {
+		return x.Quantity
+	}
+	return 0
+}
+
+func (x *AdmitStockRequest) GetPayload() string {
+	if x != nil {
+		return x.Payload
+	}
+	return ""
+}
+
+func (x *AdmitStockRequest) GetRetentionSeconds() int64 {
+	if x != nil {
+		return x.RetentionSeconds
+	}
+	return 0
+}
+
+func (x *AdmitStockRequest) GetStockTaken() bool {
+	if x != nil {
+		return x.StockTaken
+	}
+	return false
+}
+
+type AdmitStockResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Code          int32                  `protobuf:"varint,1,opt,name=code,proto3" json:"code,omitempty"`
+	Message       string                 `protobuf:"bytes,2,opt,name=message,proto3" json:"message,omitempty"`
+	Remaining     int32                  `protobuf:"varint,3,opt,name=remaining,proto3" json:"remaining,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *AdmitStockResponse) Reset() {
+	*x = AdmitStockResponse{}
+	mi := &file_proto_stock_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *AdmitStockResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*AdmitStockResponse) ProtoMessage() {}
+
+func (x *AdmitStockResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_stock_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use AdmitStockResponse.ProtoReflect.Descriptor instead.
+func (*AdmitStockResponse) Descriptor() ([]byte, []int) {
+	return file_proto_stock_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *AdmitStockResponse) GetCode() int32 {
+	if x != nil {
+		return x.Code
+	}
+	return 0
+}
+
+func (x *AdmitStockResponse) GetMessage() string {
+	if x != nil {
+		return x.Message
+	}
+	return ""
+}
+
+func (x *AdmitStockResponse) GetRemaining() int32 {
+	if x != nil {
+		return x.Remaining
+	}
+	return 0
+}
+
 var File_proto_stock_proto protoreflect.FileDescriptor
 
 const file_proto_stock_proto_rawDesc = "" +
@@ -479,20 +671,25 @@ const file_proto_stock_proto_rawDesc = "" +
 	"\x10GetStockResponse\x12\x14\n" +
 	"\x05stock\x18\x01 \x01(\x05R\x05stock\x12\x18\n" +
 	"\asuccess\x18\x02 \x01(\bR\asuccess\x12\x18\n" +
-	"\amessage\x18\x03 \x01(\tR\amessage\"\x83\x01\n" +
+	"\amessage\x18\x03 \x01(\tR\amessage\"\xe4\x01\n" +
 	"\x12DeductStockRequest\x12\"\n" +
 	"\rflash_sale_id\x18\x01 \x01(\x03R\vflashSaleId\x12\x17\n" +
 	"\auser_id\x18\x02 \x01(\x03R\x06userId\x12\x1a\n" +
 	"\bquantity\x18\x03 \x01(\x05R\bquantity\x12\x14\n" +
-	"\x05limit\x18\x04 \x01(\x05R\x05limit\"]\n" +
+	"\x05limit\x18\x04 \x01(\x05R\x05limit\x12\x17\n" +
+	"\aitem_id\x18\x05 \x01(\x03R\x06itemId\x12\x18\n" +
+	"\apayload\x18\x06 \x01(\tR\apayload\x12,\n" +
+	"\x12bought_ttl_seconds\x18\a \x01(\x03R\x10boughtTtlSeconds\"{\n" +
 	"\x13DeductStockResponse\x12\x18\n" +
 	"\asuccess\x18\x01 \x01(\bR\asuccess\x12\x12\n" +
 	"\x04code\x18\x02 \x01(\x05R\x04code\x12\x18\n" +
-	"\amessage\x18\x03 \x01(\tR\amessage\"n\n" +
+	"\amessage\x18\x03 \x01(\tR\amessage\x12\x1c\n" +
+	"\tremaining\x18\x04 \x01(\x05R\tremaining\"\x87\x01\n" +
 	"\x13RestoreStockRequest\x12\"\n" +
 	"\rflash_sale_id\x18\x01 \x01(\x03R\vflashSaleId\x12\x17\n" +
 	"\auser_id\x18\x02 \x01(\x03R\x06userId\x12\x1a\n" +
-	"\bquantity\x18\x03 \x01(\x05R\bquantity\"J\n" +
+	"\bquantity\x18\x03 \x01(\x05R\bquantity\x12\x17\n" +
+	"\aitem_id\x18\x04 \x01(\x03R\x06itemId\"J\n" +
 	"\x14RestoreStockResponse\x12\x18\n" +
 	"\asuccess\x18\x01 \x01(\bR\asuccess\x12\x18\n" +
 	"\amessage\x18\x02 \x01(\tR\amessage\"L\n" +
@@ -501,12 +698,27 @@ const file_proto_stock_proto_rawDesc = "" +
 	"\x05stock\x18\x02 \x01(\x05R\x05stock\"G\n" +
 	"\x11InitStockResponse\x12\x18\n" +
 	"\asuccess\x18\x01 \x01(\bR\asuccess\x12\x18\n" +
-	"\amessage\x18\x02 \x01(\tR\amessage2\x9a\x02\n" +
+	"\amessage\x18\x02 \x01(\tR\amessage\"\xed\x01\n" +
+	"\x11AdmitStockRequest\x12\"\n" +
+	"\rflash_sale_id\x18\x01 \x01(\x03R\vflashSaleId\x12\x17\n" +
+	"\auser_id\x18\x02 \x01(\x03R\x06userId\x12\x17\n" +
+	"\aitem_id\x18\x03 \x01(\x03R\x06itemId\x12\x1a\n" +
+	"\bquantity\x18\x04 \x01(\x05R\bquantity\x12\x18\n" +
+	"\apayload\x18\x05 \x01(\tR\apayload\x12+\n" +
+	"\x11retention_seconds\x18\x06 \x01(\x03R\x10retentionSeconds\x12\x1f\n" +
+	"\vstock_taken\x18\a \x01(\bR\n" +
+	"stockTaken\"`\n" +
+	"\x12AdmitStockResponse\x12\x12\n" +
+	"\x04code\x18\x01 \x01(\x05R\x04code\x12\x18\n" +
+	"\amessage\x18\x02 \x01(\tR\amessage\x12\x1c\n" +
+	"\tremaining\x18\x03 \x01(\x05R\tremaining2\xdd\x02\n" +
 	"\fStockService\x12;\n" +
 	"\bGetStock\x12\x16.stock.GetStockRequest\x1a\x17.stock.GetStockResponse\x12D\n" +
 	"\vDeductStock\x12\x19.stock.DeductStockRequest\x1a\x1a.stock.DeductStockResponse\x12G\n" +
 	"\fRestoreStock\x12\x1a.stock.RestoreStockRequest\x1a\x1b.stock.RestoreStockResponse\x12>\n" +
-	"\tInitStock\x12\x17.stock.InitStockRequest\x1a\x18.stock.InitStockResponseB5Z3github.com/Mag1cFall/magtrade/internal/grpc/stockpbb\x06proto3"
+	"\tInitStock\x12\x17.stock.InitStockRequest\x1a\x18.stock.InitStockResponse\x12A\n" +
+	"\n" +
+	"AdmitStock\x12\x18.stock.AdmitStockRequest\x1a\x19.stock.AdmitStockResponseB5Z3github.com/Mag1cFall/magtrade/internal/grpc/stockpbb\x06proto3"
 
 var (
 	file_proto_stock_proto_rawDescOnce sync.Once
@@ -520,7 +732,7 @@ func file_proto_stock_proto_rawDescGZIP() []byte {
 	return file_proto_stock_proto_rawDescData
 }
 
-var file_proto_stock_proto_msgTypes = make([]protoimpl.MessageInfo, 8)
+var file_proto_stock_proto_msgTypes = make([]protoimpl.MessageInfo, 10)
 var file_proto_stock_proto_goTypes = []any{
 	(*GetStockRequest)(nil),      // 0: stock.GetStockRequest
 	(*GetStockResponse)(nil),     // 1: stock.GetStockResponse
@@ -530,18 +742,22 @@ var file_proto_stock_proto_goTypes = []any{
 	(*RestoreStockResponse)(nil), // 5: stock.RestoreStockResponse
 	(*InitStockRequest)(nil),     // 6: stock.InitStockRequest
 	(*InitStockResponse)(nil),    // 7: stock.InitStockResponse
+	(*AdmitStockRequest)(nil),    // 8: stock.AdmitStockRequest
+	(*AdmitStockResponse)(nil),   // 9: stock.AdmitStockResponse
 }
 var file_proto_stock_proto_depIdxs = []int32{
 	0, // 0: stock.StockService.GetStock:input_type -> stock.GetStockRequest
 	2, // 1: stock.StockService.DeductStock:input_type -> stock.DeductStockRequest
 	4, // 2: stock.StockService.RestoreStock:input_type -> stock.RestoreStockRequest
 	6, // 3: stock.StockService.InitStock:input_type -> stock.InitStockRequest
-	1, // 4: stock.StockService.GetStock:output_type -> stock.GetStockResponse
-	3, // 5: stock.StockService.DeductStock:output_type -> stock.DeductStockResponse
-	5, // 6: stock.StockService.RestoreStock:output_type -> stock.RestoreStockResponse
-	7, // 7: stock.StockService.InitStock:output_type -> stock.InitStockResponse
-	4, // [4:8] is the sub-list for method output_type
-	0, // [0:4] is the sub-list for method input_type
+	8, // 4: stock.StockService.AdmitStock:input_type -> stock.AdmitStockRequest
+	1, // 5: stock.StockService.GetStock:output_type -> stock.GetStockResponse
+	3, // 6: stock.StockService.DeductStock:output_type -> stock.DeductStockResponse
+	5, // 7: stock.StockService.RestoreStock:output_type -> stock.RestoreStockResponse
+	7, // 8: stock.StockService.InitStock:output_type -> stock.InitStockResponse
+	9, // 9: stock.StockService.AdmitStock:output_type -> stock.AdmitStockResponse
+	5, // [5:10] is the sub-list for method output_type
+	0, // [0:5] is the sub-list for method input_type
 	0, // [0:0] is the sub-list for extension type_name
 	0, // [0:0] is the sub-list for extension extendee
 	0, // [0:0] is the sub-list for field type_name
@@ -558,7 +774,7 @@ func file_proto_stock_proto_init() {
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: unsafe.Slice(unsafe.StringData(file_proto_stock_proto_rawDesc), len(file_proto_stock_proto_rawDesc)),
 			NumEnums:      0,
-			NumMessages:   8,
+			NumMessages:   10,
 			NumExtensions: 0,
 			NumServices:   1,
 		},
@@ -23,6 +23,7 @@ const (
 	StockService_DeductStock_FullMethodName  = "/stock.StockService/DeductStock"
 	StockService_RestoreStock_FullMethodName = "/stock.StockService/RestoreStock"
 	StockService_InitStock_FullMethodName    = "/stock.StockService/InitStock"
+	StockService_AdmitStock_FullMethodName   = "/stock.StockService/AdmitStock"
 )
 
 // StockServiceClient is the client API for StockService service.
@@ -33,6 +34,7 @@ type StockServiceClient interface {
 	DeductStock(ctx context.Context, in *DeductStockRequest, opts ...grpc.CallOption) (*DeductStockResponse, error)
 	RestoreStock(ctx context.Context, in *RestoreStockRequest, opts ...grpc.CallOption) (*RestoreStockResponse, error)
 	InitStock(ctx context.Context, in *InitStockRequest, opts ...grpc.CallOption) (*InitStockResponse, error)
+	AdmitStock(ctx context.Context, in *AdmitStockRequest, opts ...grpc.CallOption) (*AdmitStockResponse, error)
 }
 
 type stockServiceClient struct {
@@ -83,6 +85,16 @@ func (c *stockServiceClient) InitStock(ctx context.Context, in *InitStockRequest
 	return out, nil
 }
 
+func (c *stockServiceClient) AdmitStock(ctx context.Context, in *AdmitStockRequest, opts ...grpc.CallOption) (*AdmitStockResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(AdmitStockResponse)
+	err := c.cc.Invoke(ctx, StockService_AdmitStock_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // StockServiceServer is the server API for StockService service.
 // All implementations must embed UnimplementedStockServiceServer
 // for forward compatibility.
@@ -91,6 +103,7 @@ type StockServiceServer interface {
 	DeductStock(context.Context, *DeductStockRequest) (*DeductStockResponse, error)
 	RestoreStock(context.Context, *RestoreStockRequest) (*RestoreStockResponse, error)
 	InitStock(context.Context, *InitStockRequest) (*InitStockResponse, error)
+	AdmitStock(context.Context, *AdmitStockRequest) (*AdmitStockResponse, error)
 	mustEmbedUnimplementedStockServiceServer()
 }
 
@@ -113,6 +126,9 @@ func (UnimplementedStockServiceServer) RestoreStock(context.Context, *RestoreSto
 func (UnimplementedStockServiceServer) InitStock(context.Context, *InitStockRequest) (*InitStockResponse, error) {
 	return nil, status.Error(codes.Unimplemented, "method InitStock not implemented")
 }
+func (UnimplementedStockServiceServer) AdmitStock(context.Context, *AdmitStockRequest) (*AdmitStockResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method AdmitStock not implemented")
+}
 func (UnimplementedStockServiceServer) mustEmbedUnimplementedStockServiceServer() {}
 func (UnimplementedStockServiceServer) testEmbeddedByValue()                      {}
 
@@ -206,6 +222,24 @@ func _StockService_InitStock_Handler(srv interface{}, ctx context.Context, dec f
 	return interceptor(ctx, in, info, handler)
 }
 
+func _StockService_AdmitStock_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AdmitStockRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(StockServiceServer).AdmitStock(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: StockService_AdmitStock_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(StockServiceServer).AdmitStock(ctx, req.(*AdmitStockRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 // StockService_ServiceDesc is the grpc.ServiceDesc for StockService service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -229,6 +263,10 @@ var StockService_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "InitStock",
 			Handler:    _StockService_InitStock_Handler,
 		},
+		{
+			MethodName: "AdmitStock",
+			Handler:    _StockService_AdmitStock_Handler,
+		},
 	},
 	Streams:  []grpc.StreamDesc{},
 	Metadata: "proto/stock.proto",